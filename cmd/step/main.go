@@ -23,10 +23,13 @@ import (
 	_ "github.com/smallstep/cli/command/base64"
 	_ "github.com/smallstep/cli/command/ca"
 	_ "github.com/smallstep/cli/command/certificate"
+	_ "github.com/smallstep/cli/command/crl"
 	_ "github.com/smallstep/cli/command/crypto"
 	_ "github.com/smallstep/cli/command/fileserver"
 	_ "github.com/smallstep/cli/command/oauth"
+	_ "github.com/smallstep/cli/command/ocsp"
 	_ "github.com/smallstep/cli/command/path"
+	_ "github.com/smallstep/cli/command/pki"
 	_ "github.com/smallstep/cli/command/ssh"
 
 	// Profiling and debugging
@@ -1,15 +1,18 @@
 package ca
 
 import (
+	"crypto/x509"
 	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/cli/command"
 	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/x509util"
 	"github.com/smallstep/cli/errs"
 	"github.com/smallstep/cli/flags"
 	"github.com/smallstep/cli/token"
 	"github.com/smallstep/cli/ui"
+	"github.com/smallstep/cli/utils"
 	"github.com/smallstep/cli/utils/cautils"
 	"github.com/urfave/cli"
 )
@@ -19,13 +22,14 @@ func certificateCommand() cli.Command {
 		Name:   "certificate",
 		Action: command.ActionFunc(certificateAction),
 		Usage:  "generate a new private key and certificate signed by the root certificate",
-		UsageText: `**step ca certificate** <subject> <crt-file> <key-file>
+		UsageText: `**step ca certificate** <subject> <crt-file> [<key-file>]
 [**--token**=<token>]  [**--issuer**=<name>] [**--ca-url**=<uri>] [**--root**=<file>]
 [**--not-before**=<time|duration>] [**--not-after**=<time|duration>]
 [**--san**=<SAN>] [**--acme**=<path>] [**--standalone**] [**--webroot**=<path>]
 [**--contact**=<email>] [**--http-listen**=<address>] [**--bundle**]
 [**--kty**=<type>] [**--curve**=<curve>] [**--size**=<size>] [**--console**]
-[**--x5c-cert**=<path>] [**--x5c-key**=<path>] [**--k8ssa-token-path**=<file>`,
+[**--x5c-cert**=<path>] [**--x5c-key**=<path>] [**--k8ssa-token-path**=<file>]
+[**--format**=<format>] [**--alias**=<name>] [**--keystore-password-file**=<file>]`,
 		Description: `**step ca certificate** command generates a new certificate pair
 
 ## POSITIONAL ARGUMENTS
@@ -36,10 +40,12 @@ Subject Common Name for the certificate. If no Subject Alternative Names (SANs)
 are configured (via the --san flag) then the <subject> will be set as the only SAN.
 
 <crt-file>
-:  File to write the certificate (PEM format)
+:  File to write the certificate (PEM format). If the '--format' flag is used,
+the certificate will be written in that format.
 
 <key-file>
-:  File to write the private key (PEM format)
+:  File to write the private key (PEM format). It is optional if the format is
+jks, jceks or k8s-secret, as the private key is also written in <crt-file>.
 
 ## EXAMPLES
 
@@ -87,6 +93,19 @@ Request a new certificate with an RSA public key (default is ECDSA256):
 $ step ca certificate foo.internal foo.crt foo.key --kty RSA --size 4096
 '''
 
+Request a new certificate and write it with its chain and private key in a
+Java KeyStore:
+'''
+$ step ca certificate foo.internal foo.jks --format jks --alias foo \
+  --keystore-password-file password.txt
+'''
+
+Request a new certificate and write it as a Kubernetes TLS Secret:
+'''
+$ step ca certificate foo.internal foo-tls.yaml --format k8s-secret --alias foo-tls
+$ kubectl apply -f foo-tls.yaml
+'''
+
 Request a new certificate with an X5C provisioner:
 '''
 $ step ca certificate foo.internal foo.crt foo.key --x5c-cert x5c.cert --x5c-key x5c.key
@@ -146,19 +165,69 @@ $ step ca certificate foo.internal foo.crt foo.key \
 			acmeContactFlag,
 			acmeHTTPListenFlag,
 			flags.K8sSATokenPathFlag,
+			cli.StringFlag{
+				Name:  "format",
+				Value: "pem",
+				Usage: `The <format> used to write <crt-file>.
+
+: <format> is a string and must be one of:
+
+    **pem**
+    :  The certificate and its chain in PEM format.
+
+    **jks**
+    :  Java KeyStore with the certificate, its chain and the private key.
+
+    **jceks**
+    :  Java JCEKS keystore, like **jks** but the private key is protected with 3DES.
+
+    **k8s-secret**
+    :  Kubernetes Secret of type kubernetes.io/tls in YAML format, with the
+    certificate, its chain and the private key.
+
+    **k8s-configmap**
+    :  Kubernetes ConfigMap in YAML format with the certificate and its chain in
+    the ca.crt key. The private key is only written in <key-file>.`,
+			},
+			flags.Alias,
+			flags.KeystorePasswordFile,
 		},
 	}
 }
 
 func certificateAction(ctx *cli.Context) error {
-	if err := errs.NumberOfArguments(ctx, 3); err != nil {
-		return err
+	format := ctx.String("format")
+	switch format {
+	case "jks", "jceks", "k8s-secret":
+		if err := errs.MinMaxNumberOfArguments(ctx, 2, 3); err != nil {
+			return err
+		}
+	case "pem", "k8s-configmap":
+		if err := errs.NumberOfArguments(ctx, 3); err != nil {
+			return err
+		}
+	default:
+		return errs.InvalidFlagValue(ctx, "format", format, "pem, jks, jceks, k8s-secret, k8s-configmap")
 	}
 
 	args := ctx.Args()
 	subject := args.Get(0)
 	crtFile, keyFile := args.Get(1), args.Get(2)
 
+	// Read the keystore password before requesting the certificate.
+	var keystorePassword []byte
+	if format == "jks" || format == "jceks" {
+		var err error
+		if passwordFile := ctx.String("keystore-password-file"); passwordFile != "" {
+			keystorePassword, err = utils.ReadPasswordFromFile(passwordFile)
+		} else {
+			keystorePassword, err = ui.PromptPassword("Please enter a password to protect the keystore")
+		}
+		if err != nil {
+			return err
+		}
+	}
+
 	tok := ctx.String("token")
 	offline := ctx.Bool("offline")
 	sans := ctx.StringSlice("san")
@@ -183,12 +252,18 @@ func certificateAction(ctx *cli.Context) error {
 	if len(tok) == 0 {
 		// Use the ACME protocol with a different certificate authority.
 		if ctx.IsSet("acme") {
+			if format != "pem" {
+				return errs.IncompatibleFlagValue(ctx, "acme", "format", format)
+			}
 			return cautils.ACMECreateCertFlow(ctx, "")
 		}
 		if tok, err = flow.GenerateToken(ctx, subject, sans); err != nil {
 			switch k := err.(type) {
 			// Use the ACME flow with the step certificate authority.
 			case *cautils.ErrACMEToken:
+				if format != "pem" {
+					return errors.Errorf("flag '--format %s' is not supported with ACME provisioners", format)
+				}
 				return cautils.ACMECreateCertFlow(ctx, k.Name)
 			default:
 				return err
@@ -228,16 +303,55 @@ func certificateAction(ctx *cli.Context) error {
 		return errors.New("token is not supported")
 	}
 
-	if err = flow.Sign(ctx, tok, req.CsrPEM, crtFile); err != nil {
-		return err
+	if format == "pem" {
+		if err = flow.Sign(ctx, tok, req.CsrPEM, crtFile); err != nil {
+			return err
+		}
+	} else {
+		certs, err := flow.SignCertificates(ctx, tok, req.CsrPEM)
+		if err != nil {
+			return err
+		}
+		if err := writeCertificateFormat(ctx, format, crtFile, certs, pk, keystorePassword); err != nil {
+			return err
+		}
 	}
 
-	_, err = pemutil.Serialize(pk, pemutil.ToFile(keyFile, 0600))
-	if err != nil {
-		return err
+	if keyFile != "" {
+		_, err = pemutil.Serialize(pk, pemutil.ToFile(keyFile, 0600))
+		if err != nil {
+			return err
+		}
 	}
 
 	ui.PrintSelected("Certificate", crtFile)
-	ui.PrintSelected("Private Key", keyFile)
+	if keyFile != "" {
+		ui.PrintSelected("Private Key", keyFile)
+	}
 	return nil
 }
+
+// writeCertificateFormat writes the certificate and its chain to crtFile using
+// the given format, adding the private key to keystores and secrets.
+func writeCertificateFormat(ctx *cli.Context, format, crtFile string, certs []*x509.Certificate, key interface{}, password []byte) error {
+	var err error
+	var b []byte
+	alias := ctx.String("alias")
+	switch format {
+	case "jks", "jceks":
+		b, err = pemutil.EncodeJKS(key, certs[0], certs[1:], password, &pemutil.JKSOptions{
+			Alias: alias,
+			JCEKS: format == "jceks",
+		})
+	case "k8s-secret":
+		b, err = x509util.EncodeKubernetesSecret(alias, key, certs[0], certs[1:])
+	case "k8s-configmap":
+		b, err = x509util.EncodeKubernetesConfigMap(alias, certs)
+	default:
+		return errs.InvalidFlagValue(ctx, "format", format, "pem, jks, jceks, k8s-secret, k8s-configmap")
+	}
+	if err != nil {
+		return err
+	}
+	return utils.WriteFile(crtFile, b, 0600)
+}
@@ -0,0 +1,102 @@
+package ca
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/x509util"
+	"github.com/smallstep/cli/jose"
+	"github.com/urfave/cli"
+)
+
+// newOfflineCA writes the configuration of an offline CA with a JWK
+// provisioner and returns the path to the configuration, the path to the
+// provisioner password and the root certificate.
+func newOfflineCA(t *testing.T, dir string) (string, string, *x509.Certificate) {
+	root, err := x509util.NewRootProfile("Test Root")
+	assert.FatalError(t, err)
+	b, err := root.CreateCertificate()
+	assert.FatalError(t, err)
+	rootCrt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+	intermediate, err := x509util.NewIntermediateProfile("Test Intermediate", rootCrt, root.SubjectPrivateKey())
+	assert.FatalError(t, err)
+	b, err = intermediate.CreateCertificate()
+	assert.FatalError(t, err)
+	intermediateCrt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+
+	write := func(name string, v interface{}) string {
+		filename := filepath.Join(dir, name)
+		_, err := pemutil.Serialize(v, pemutil.ToFile(filename, 0600))
+		assert.FatalError(t, err)
+		return filename
+	}
+	rootFile := write("root_ca.crt", rootCrt)
+	crtFile := write("intermediate_ca.crt", intermediateCrt)
+	keyFile := write("intermediate_ca.key", intermediate.SubjectPrivateKey())
+
+	password := []byte("password")
+	passwordFile := filepath.Join(dir, "password.txt")
+	assert.FatalError(t, ioutil.WriteFile(passwordFile, password, 0600))
+	jwk, jwe, err := jose.GenerateDefaultKeyPair(password)
+	assert.FatalError(t, err)
+	encryptedKey, err := jwe.CompactSerialize()
+	assert.FatalError(t, err)
+
+	b, err = json.Marshal(map[string]interface{}{
+		"root":     rootFile,
+		"crt":      crtFile,
+		"key":      keyFile,
+		"address":  "127.0.0.1:9000",
+		"dnsNames": []string{"ca.test"},
+		"authority": map[string]interface{}{
+			"provisioners": []interface{}{map[string]interface{}{
+				"type":         "JWK",
+				"name":         "test",
+				"key":          jwk,
+				"encryptedKey": encryptedKey,
+			}},
+		},
+	})
+	assert.FatalError(t, err)
+	configFile := filepath.Join(dir, "ca.json")
+	assert.FatalError(t, ioutil.WriteFile(configFile, b, 0600))
+	return configFile, passwordFile, rootCrt
+}
+
+func TestCertificateAction_jks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "step-ca-certificate")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+	configFile, passwordFile, rootCrt := newOfflineCA(t, dir)
+	keystorePasswordFile := filepath.Join(dir, "keystore.txt")
+	assert.FatalError(t, ioutil.WriteFile(keystorePasswordFile, []byte("changeit"), 0600))
+
+	// The keystore is written once, so it does not require --force.
+	jksFile := filepath.Join(dir, "foo.jks")
+	app := cli.NewApp()
+	app.Commands = []cli.Command{certificateCommand()}
+	assert.FatalError(t, app.Run([]string{"step", "certificate", "--offline",
+		"--ca-config", configFile, "--provisioner-password-file", passwordFile,
+		"--format", "jks", "--alias", "foo", "--keystore-password-file", keystorePasswordFile,
+		"foo.test", jksFile}))
+
+	b, err := ioutil.ReadFile(jksFile)
+	assert.FatalError(t, err)
+	assert.True(t, pemutil.IsJKS(b))
+	key, crt, chain, err := pemutil.DecodeJKS(b, []byte("changeit"))
+	assert.FatalError(t, err)
+	assert.NotNil(t, key)
+	assert.Equals(t, "foo.test", crt.Subject.CommonName)
+	assert.Len(t, 1, chain)
+	assert.Equals(t, "Test Intermediate", chain[0].Subject.CommonName)
+	assert.FatalError(t, crt.CheckSignatureFrom(chain[0]))
+	assert.FatalError(t, chain[0].CheckSignatureFrom(rootCrt))
+}
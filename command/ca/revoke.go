@@ -5,7 +5,6 @@ import (
 	"crypto/x509"
 	"net/http"
 	"os"
-	"strconv"
 	"strings"
 	"time"
 
@@ -23,7 +22,6 @@ import (
 	"github.com/smallstep/cli/ui"
 	"github.com/smallstep/cli/utils/cautils"
 	"github.com/urfave/cli"
-	"golang.org/x/crypto/ocsp"
 )
 
 /*
@@ -200,7 +198,7 @@ func revokeCertificateAction(ctx *cli.Context) error {
 	offline := ctx.Bool("offline")
 
 	// Validate the reasonCode arg early in the flow.
-	if _, err := ReasonCodeToNum(ctx.String("reasonCode")); err != nil {
+	if _, err := x509util.ReasonCodeToNum(ctx.String("reasonCode")); err != nil {
 		return err
 	}
 
@@ -388,7 +386,7 @@ func (f *revokeFlow) Revoke(ctx *cli.Context, serial, token string) error {
 
 	reason := ctx.String("reason")
 	// Convert the reasonCode flag to an OCSP revocation code.
-	reasonCode, err := ReasonCodeToNum(ctx.String("reasonCode"))
+	reasonCode, err := x509util.ReasonCodeToNum(ctx.String("reasonCode"))
 	if err != nil {
 		return err
 	}
@@ -443,42 +441,17 @@ func (f *revokeFlow) Revoke(ctx *cli.Context, serial, token string) error {
 }
 
 // RevocationReasonCodes is a map between string reason codes
-// to integers as defined in RFC 5280
-var RevocationReasonCodes = map[string]int{
-	"unspecified":          ocsp.Unspecified,
-	"keycompromise":        ocsp.KeyCompromise,
-	"cacompromise":         ocsp.CACompromise,
-	"affiliationchanged":   ocsp.AffiliationChanged,
-	"superseded":           ocsp.Superseded,
-	"cessationofoperation": ocsp.CessationOfOperation,
-	"certificatehold":      ocsp.CertificateHold,
-	"removefromcrl":        ocsp.RemoveFromCRL,
-	"privilegewithdrawn":   ocsp.PrivilegeWithdrawn,
-	"aacompromise":         ocsp.AACompromise,
-}
+// to integers as defined in RFC 5280.
+//
+// Deprecated: use x509util.RevocationReasonCodes.
+var RevocationReasonCodes = x509util.RevocationReasonCodes
 
 // ReasonCodeToNum converts a string encoded code to a number.
 // 1) "4" -> 4
 // 2) "key compromise" -> 1
 // 3) "keYComPromIse" -> 1
+//
+// Deprecated: use x509util.ReasonCodeToNum.
 func ReasonCodeToNum(rc string) (int, error) {
-	// default to 0
-	if rc == "" {
-		return 0, nil
-	}
-
-	if code, err := strconv.Atoi(rc); err == nil {
-		if code < ocsp.Unspecified || code > ocsp.AACompromise {
-			return -1, errors.Errorf("reasonCode out of bounds. Got %d, but want value between %d and %d",
-				code, ocsp.Unspecified, ocsp.AACompromise)
-		}
-		return code, nil
-	}
-
-	code, found := RevocationReasonCodes[strings.ToLower(strings.Replace(rc, " ", "", -1))]
-	if !found {
-		return 0, errors.Errorf("unrecognized revocation reason code '%s'", rc)
-	}
-
-	return code, nil
+	return x509util.ReasonCodeToNum(rc)
 }
@@ -7,6 +7,7 @@ import (
 	"github.com/smallstep/certificates/api"
 	"github.com/smallstep/certificates/pki"
 	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/x509util"
 	"github.com/smallstep/cli/errs"
 	"github.com/smallstep/cli/flags"
 	"github.com/smallstep/cli/utils"
@@ -77,6 +78,12 @@ be in the 'sans' claim unless explicitly configured via the '--sans' flag:
 $ step ca token foobar --san 1.1.1.1 --san hello.example.com
 '''
 
+Get a new token for a SPIFFE workload identity. The value of the 'sans' claim
+of the token will be ['spiffe://example.org/ns/default/sa/foo']:
+'''
+$ step ca token foo --san spiffe://example.org/ns/default/sa/foo
+'''
+
 Get a new token that expires in 30 minutes:
 '''
 $ step ca token --not-after 30m internal.example.com
@@ -265,6 +272,14 @@ func tokenAction(ctx *cli.Context) error {
 		return errs.IncompatibleFlagWithFlag(ctx, "san", "revoke")
 	}
 
+	// Validate URI SANs, like SPIFFE IDs.
+	if typ == cautils.SignType {
+		_, _, _, uris := x509util.SplitSANsWithURIs(sans)
+		if err := x509util.ValidateURIs(uris); err != nil {
+			return err
+		}
+	}
+
 	// parse times or durations
 	notBefore, ok := flags.ParseTimeOrDuration(ctx.String("not-before"))
 	if !ok {
@@ -1,11 +1,14 @@
 package certificate
 
 import (
+	"crypto/x509"
 	"encoding/pem"
-	"io/ioutil"
+	"path/filepath"
+	"strings"
 
-	"github.com/pkg/errors"
 	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/x509util"
 	"github.com/smallstep/cli/errs"
 	"github.com/smallstep/cli/flags"
 	"github.com/smallstep/cli/ui"
@@ -15,23 +18,44 @@ import (
 
 func bundleCommand() cli.Command {
 	return cli.Command{
-		Name:      "bundle",
-		Action:    command.ActionFunc(bundleAction),
-		Usage:     `bundle a certificate with intermediate certificate(s) needed for certificate path validation`,
-		UsageText: `**step certificate bundle** <crt_file> <ca> <bundle_file>`,
+		Name:   "bundle",
+		Action: command.ActionFunc(bundleAction),
+		Usage:  `bundle a certificate with intermediate certificate(s) needed for certificate path validation`,
+		UsageText: `**step certificate bundle** <crt_file> <ca> <bundle_file> [**--format**=<format>]
+
+**step certificate bundle** <bundle_file> [<output_file>] [**--fix**] [**--complete**]
+[**--intermediates**=<dir>] [**--remove-root**] [**--format**=<format>]`,
 		Description: `**step certificate bundle** bundles a certificate
 		with any intermediates necessary to validate the certificate.
 
+The certificates can be in PEM, DER or PKCS#7 format. The bundle is written in
+PEM format, or in PKCS#7 format if the <bundle_file> has the .p7b or .p7c
+extension or if the **--format** flag is used.
+
+With **--fix** or **--complete**, the command repairs an existing bundle
+instead. The certificates are sorted from the leaf to the root, and duplicated
+certificates and the ones that are not part of the chain of the leaf are
+removed. With **--complete**, missing intermediates are added from the
+directory in **--intermediates** or downloaded from the caIssuers URLs in the
+authority information access extension of the certificates. The changes made
+are reported, and the repaired bundle is written to <output_file>, or to
+<bundle_file> if not given.
+
 ## POSITIONAL ARGUMENTS
 
 <crt_file>
 : The path to a leaf certificate to bundle with issuing certificate(s).
 
 <ca>
-: The path to the Certificate Authority issusing certificate.
+: The path to the Certificate Authority issusing certificate. If the file
+contains multiple certificates all of them will be added to the bundle.
 
 <bundle_file>
-: The path to write the bundle.
+: The path to write the bundle. With **--fix** or **--complete**, the path to
+the bundle to repair.
+
+<output_file>
+: The path to write the repaired bundle. Defaults to <bundle_file>.
 
 ## EXIT CODES
 
@@ -44,42 +68,205 @@ Bundle a certificate with the intermediate certificate authority (issuer):
 '''
 $ step certificate bundle foo.crt intermediate-ca.crt foo-bundle.crt
 '''
+
+Bundle a certificate with the intermediate certificate authority in a PKCS#7
+file:
+
+'''
+$ step certificate bundle foo.crt intermediate-ca.crt foo-bundle.p7b
+'''
+
+Sort a bundle from the leaf to the root and remove duplicated and unrelated
+certificates:
+
+'''
+$ step certificate bundle --fix foo-bundle.crt
+'''
+
+Repair a bundle writing the result in a new file without the root certificate:
+
+'''
+$ step certificate bundle --fix --remove-root foo-bundle.crt foo-fixed.crt
+'''
+
+Add the missing intermediates to a bundle using the certificates in a local
+directory, or the caIssuers URLs of the certificates:
+
+'''
+$ step certificate bundle --complete --intermediates ./intermediates foo-bundle.crt
+'''
 `,
-		Flags: []cli.Flag{flags.Force},
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name: "format",
+				Usage: `The <format> of the bundle.
+
+: <format> is a string and must be one of:
+
+    **pem**
+    :  PEM format, the default if the <bundle_file> extension is not .p7b or .p7c.
+
+    **p7b**
+    :  PKCS#7 in DER format.
+
+    **p7b-pem**
+    :  PKCS#7 in PEM format.`,
+			},
+			cli.BoolFlag{
+				Name: "fix",
+				Usage: `Repair the bundle sorting the certificates from the leaf to the root and
+removing duplicated and unrelated certificates.`,
+			},
+			cli.BoolFlag{
+				Name: "complete",
+				Usage: `Repair the bundle like **--fix** and add the missing intermediates using the
+certificates in **--intermediates** or the caIssuers URLs in the certificates.`,
+			},
+			cli.StringFlag{
+				Name: "intermediates",
+				Usage: `The <dir> with the intermediate certificates used to complete the bundle. It
+can also be a file or a comma-separated list of files.`,
+			},
+			cli.BoolFlag{
+				Name:  "remove-root",
+				Usage: `Remove the self-signed root certificate from the repaired bundle.`,
+			},
+			flags.Force,
+		},
 	}
 }
 
 func bundleAction(ctx *cli.Context) error {
+	if ctx.Bool("fix") || ctx.Bool("complete") {
+		return fixBundleAction(ctx)
+	}
 	if err := errs.NumberOfArguments(ctx, 3); err != nil {
 		return err
 	}
+	switch {
+	case ctx.String("intermediates") != "":
+		return errs.RequiredWithFlag(ctx, "intermediates", "complete")
+	case ctx.Bool("remove-root"):
+		return errs.RequiredWithOrFlag(ctx, "remove-root", "fix", "complete")
+	}
 
 	crtFile := ctx.Args().Get(0)
-	crtBytes, err := ioutil.ReadFile(crtFile)
+	crt, err := pemutil.ReadCertificate(crtFile, pemutil.WithFirstBlock())
 	if err != nil {
-		return errs.FileError(err, crtFile)
-	}
-	crtBlock, _ := pem.Decode(crtBytes)
-	if crtBlock == nil {
-		return errors.Errorf("could not parse certificate file '%s'", crtFile)
+		return err
 	}
 
 	caFile := ctx.Args().Get(1)
-	caBytes, err := ioutil.ReadFile(caFile)
+	chain, err := pemutil.ReadCertificateBundle(caFile)
 	if err != nil {
-		return errs.FileError(err, caFile)
-	}
-	caBlock, _ := pem.Decode(caBytes)
-	if caBlock == nil {
-		return errors.Errorf("could not parse certificate file '%s'", caFile)
+		return err
 	}
 
+	certs := append([]*x509.Certificate{crt}, chain...)
 	chainFile := ctx.Args().Get(2)
-	if err := utils.WriteFile(chainFile,
-		append(pem.EncodeToMemory(crtBlock), pem.EncodeToMemory(caBlock)...), 0600); err != nil {
+	if err := writeBundle(ctx, chainFile, certs); err != nil {
 		return err
 	}
 
 	ui.Printf("Your certificate has been saved in %s.\n", chainFile)
 	return nil
 }
+
+func fixBundleAction(ctx *cli.Context) error {
+	if err := errs.MinMaxNumberOfArguments(ctx, 1, 2); err != nil {
+		return err
+	}
+
+	bundleFile := ctx.Args().Get(0)
+	outFile := ctx.Args().Get(1)
+	if outFile == "" {
+		outFile = bundleFile
+	}
+
+	opts := x509util.ChainOptions{
+		RemoveRoot: ctx.Bool("remove-root"),
+	}
+	if intermediates := ctx.String("intermediates"); intermediates != "" {
+		if !ctx.Bool("complete") {
+			return errs.RequiredWithFlag(ctx, "intermediates", "complete")
+		}
+		certs, err := x509util.ReadCertificates(intermediates)
+		if err != nil {
+			return err
+		}
+		opts.Intermediates = certs
+	}
+	opts.FetchIssuers = ctx.Bool("complete")
+
+	certs, err := pemutil.ReadCertificateBundle(bundleFile)
+	if err != nil {
+		return err
+	}
+	chain, changes, err := x509util.FixChain(certs, opts)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range changes {
+		ui.Printf("%s\n", c)
+	}
+	if len(changes) == 0 {
+		ui.Printf("The bundle %s is correct, no changes were made.\n", bundleFile)
+	}
+	if opts.FetchIssuers && !opts.RemoveRoot && !x509util.ChainIsComplete(chain) {
+		ui.Printf("warning: the bundle is incomplete, the issuer of %s was not found\n",
+			chain[len(chain)-1].Subject)
+	}
+
+	if len(changes) == 0 && outFile == bundleFile {
+		return nil
+	}
+	if err := writeBundle(ctx, outFile, chain); err != nil {
+		return err
+	}
+
+	ui.Printf("Your certificate bundle has been saved in %s.\n", outFile)
+	return nil
+}
+
+// writeBundle writes the certificates in the format in the --format flag, or
+// in the format of the file extension.
+func writeBundle(ctx *cli.Context, filename string, certs []*x509.Certificate) error {
+	format := ctx.String("format")
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(filename)) {
+		case ".p7b", ".p7c":
+			format = "p7b"
+		default:
+			format = "pem"
+		}
+	}
+
+	var (
+		b   []byte
+		err error
+	)
+	switch format {
+	case "pem":
+		for _, c := range certs {
+			b = append(b, pem.EncodeToMemory(&pem.Block{
+				Type:  "CERTIFICATE",
+				Bytes: c.Raw,
+			})...)
+		}
+	case "p7b", "p7b-pem":
+		if b, err = pemutil.EncodePKCS7(certs); err != nil {
+			return err
+		}
+		if format == "p7b-pem" {
+			b = pem.EncodeToMemory(&pem.Block{
+				Type:  pemutil.PKCS7Type,
+				Bytes: b,
+			})
+		}
+	default:
+		return errs.InvalidFlagValue(ctx, "format", format, "pem, p7b, p7b-pem")
+	}
+
+	return utils.WriteFile(filename, b, 0600)
+}
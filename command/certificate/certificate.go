@@ -83,10 +83,19 @@ $ step certificate uninstall root-ca.crt
 		Subcommands: cli.Commands{
 			bundleCommand(),
 			createCommand(),
+			crossSignCommand(),
+			diffCommand(),
 			formatCommand(),
 			inspectCommand(),
 			fingerprintCommand(),
 			lintCommand(),
+			needsRenewalCommand(),
+			scanCommand(),
+			serveCommand(),
+			tlsaCommand(),
+			ocspCommand(),
+			p12Command(),
+			fromP12Command(),
 			signCommand(),
 			verifyCommand(),
 			keyCommand(),
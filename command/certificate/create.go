@@ -1,10 +1,13 @@
 package certificate
 
 import (
-	"crypto/rand"
+	"crypto"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/cli/command"
@@ -26,7 +29,18 @@ func createCommand() cli.Command {
 		UsageText: `**step certificate create** <subject> <crt_file> <key_file>
 [**ca**=<issuer-cert>] [**ca-key**=<issuer-key>] [**--csr**]
 [**no-password**] [**--profile**=<profile>] [**--san**=<SAN>] [**--bundle**]
-[**--kty**=<type>] [**--curve**=<curve>] [**--size**=<size>]`,
+[**--kty**=<type>] [**--curve**=<curve>] [**--size**=<size>]
+[**--template**=<file>] [**--set**=<key=value>] [**--set-file**=<file>]
+[**--permitted-dns**=<domain>] [**--excluded-dns**=<domain>]
+[**--permitted-ip**=<cidr>] [**--excluded-ip**=<cidr>]
+[**--permitted-email**=<email>] [**--excluded-email**=<email>]
+[**--permitted-uri**=<domain>] [**--excluded-uri**=<domain>]
+[**--max-path-len**=<number>] [**--policy**=<oid>]
+[**--inhibit-any-policy**=<number>] [**--key-usage**=<usage>]
+[**--eku**=<usage>] [**--signature-algorithm**=<algorithm>]
+[**--subject**=<name>] [**--subject-file**=<file>]
+[**--basic-constraints**=<value>] [**--extension**=<oid=value>]
+[**--challenge-password-file**=<file>] [**--unstructured-name**=<name>]`,
 		Description: `**step certificate create** generates a certificate or a
 certificate signing requests (CSR) that can be signed later using 'step
 certificates sign' (or some other tool) to produce a certificate.
@@ -63,6 +77,41 @@ $ step certificate create foo foo.csr foo.key --csr \
   --san inter.smallstep.com --san 1.1.1.1 --san ca.smallstep.com
 '''
 
+Create a CSR and key with a full distinguished name:
+
+'''
+$ step certificate create foo foo.csr foo.key --csr \
+  --subject "CN=foo,O=Smallstep,OU=Engineering,C=US"
+'''
+
+Create a CSR and key with the subject in a JSON file, using the same fields as
+the subject of a certificate template:
+
+'''
+$ cat subject.json
+{"commonName": "foo", "organization": "Smallstep", "country": "US"}
+$ step certificate create foo foo.csr foo.key --csr --subject-file subject.json
+'''
+
+Create a CSR and key requesting a key usage, an extended key usage, basic
+constraints and a custom extension. 'step certificate sign --copy-extensions'
+can copy the extended key usage and the custom extension to the certificate,
+the key usage and basic constraints are always set by the issuer:
+
+'''
+$ step certificate create foo foo.csr foo.key --csr \
+  --key-usage digitalSignature --eku serverAuth --basic-constraints CA:FALSE \
+  --extension 1.3.6.1.4.1.37476.9000.64.2=DAVoZWxsbw==
+'''
+
+Create a CSR and key for a SCEP enrollment with a challenge password and an
+unstructured name:
+
+'''
+$ step certificate create foo foo.csr foo.key --csr \
+  --challenge-password-file challenge.txt --unstructured-name device-01
+'''
+
 Create a CSR and key - do not encrypt the key when writing to disk:
 
 '''
@@ -90,6 +139,24 @@ $ step certificate create intermediate-ca intermediate-ca.crt intermediate-ca.ke
   --san inter.smallstep.com --san 1.1.1.1 --san ca.smallstep.com
 '''
 
+Create an intermediate certificate and key that can only issue certificates
+for subdomains of team.internal and addresses in 10.0.0.0/8, and cannot issue
+other intermediate certificates:
+
+'''
+$ step certificate create "Team Intermediate CA" team-ca.crt team-ca.key \
+  --profile intermediate-ca --ca ./root-ca.crt --ca-key ./root-ca.key \
+  --permitted-dns .team.internal --permitted-ip 10.0.0.0/8 --max-path-len 0
+'''
+
+Create a root certificate and key with a certificate policy and a path length
+of 2:
+
+'''
+$ step certificate create root-ca root-ca.crt root-ca.key --profile root-ca \
+  --policy 1.3.6.1.4.1.37476.9000.64.1 --max-path-len 2
+'''
+
 Create a leaf certificate and key:
 
 '''
@@ -105,6 +172,30 @@ $ step certificate create foo foo.crt foo.key --profile leaf \
   --san inter.smallstep.com --san 1.1.1.1 --san ca.smallstep.com
 '''
 
+Create a leaf certificate and key with a SPIFFE ID:
+
+'''
+$ step certificate create foo foo.crt foo.key --profile leaf \
+  --ca ./intermediate-ca.crt --ca-key ./intermediate-ca.key \
+  --san spiffe://example.org/ns/default/sa/foo
+'''
+
+Create a code signing certificate and key:
+
+'''
+$ step certificate create "Build System" build.crt build.key --profile code-signing \
+  --ca ./intermediate-ca.crt --ca-key ./intermediate-ca.key
+'''
+
+Create a leaf certificate and key with an explicit key usage and extended key
+usages, using a name and an object identifier:
+
+'''
+$ step certificate create foo foo.crt foo.key --profile leaf \
+  --ca ./intermediate-ca.crt --ca-key ./intermediate-ca.key \
+  --key-usage digitalSignature --eku clientAuth --eku 1.3.6.1.5.5.7.3.17
+'''
+
 Create a leaf certificate and key with custom validity:
 
 '''
@@ -140,11 +231,46 @@ $ step certificate create foo foo.crt foo.key --profile leaf \
   --ca ./intermediate-ca.crt --ca-key ./intermediate-ca.key --kty RSA --size 2048
 '''
 
+Create a leaf certificate and key signed by an RSA intermediate using RSA-PSS:
+
+'''
+$ step certificate create foo foo.crt foo.key --profile leaf \
+  --ca ./intermediate-ca.crt --ca-key ./intermediate-ca.key \
+  --signature-algorithm SHA256-RSAPSS
+'''
+
 Create a CSR and key with underlying OKP Ed25519:
 
 '''
 $ step certificate create foo foo.csr foo.key --csr --kty OKP --curve Ed25519
 '''
+
+Create a leaf certificate and key using a certificate template:
+
+'''
+$ cat leaf.tpl
+{
+	"subject": {"commonName": {{ toJson .Subject }}, "organizationalUnit": {{ toJson .team }}},
+	"sans": {{ toJson .SANs }},
+	"keyUsage": ["digitalSignature"],
+	"extKeyUsage": ["serverAuth"]
+}
+$ step certificate create foo.internal foo.crt foo.key --template leaf.tpl \
+  --set team=backend --ca ./intermediate-ca.crt --ca-key ./intermediate-ca.key
+'''
+
+Create a root certificate and key using a certificate template:
+
+'''
+$ cat root.tpl
+{
+	"subject": {"commonName": {{ toJson .Subject }}, "organization": {{ toJson .org }}},
+	"keyUsage": ["certSign", "crlSign"],
+	"basicConstraints": {"isCA": true, "maxPathLen": 1}
+}
+$ step certificate create "Acme Root CA" root-ca.crt root-ca.key \
+  --template root.tpl --set-file vars.json
+'''
 `,
 		Flags: []cli.Flag{
 			cli.StringFlag{
@@ -190,7 +316,92 @@ recommended. Requires **--insecure** flag.`,
     **self-signed**
     :  Generate a new self-signed leaf certificate suitable for use with TLS.
 	This profile requires the **--subtle** flag because the use of self-signed leaf
-	certificates is discouraged unless absolutely necessary.`,
+	certificates is discouraged unless absolutely necessary.
+
+    **server**
+    :  Generate a leaf x.509 certificate for a TLS server, with the serverAuth
+	extended key usage.
+
+    **client**
+    :  Generate a leaf x.509 certificate for a TLS client, with the clientAuth
+	extended key usage.
+
+    **code-signing**
+    :  Generate a leaf x.509 certificate suitable for signing code, with the
+	codeSigning extended key usage.
+
+    **email**
+    :  Generate a leaf x.509 certificate suitable for S/MIME, with the
+	emailProtection extended key usage.
+
+    **ocsp-signing**
+    :  Generate a leaf x.509 certificate for an OCSP responder, with the
+	OCSPSigning extended key usage.
+
+    **timestamping**
+    :  Generate a leaf x.509 certificate for a time-stamping authority, with the
+	timeStamping extended key usage marked as critical.`,
+			},
+			cli.StringSliceFlag{
+				Name: "key-usage",
+				Usage: `Set the key <usage> of the certificate, overriding the default of the
+profile. With the **--csr** flag the key usage is added to the requested
+extensions. Use the '--key-usage' flag multiple times to set multiple usages.
+
+: <usage> is a case-insensitive string and must be one of:
+**digitalSignature**, **contentCommitment**, **keyEncipherment**,
+**dataEncipherment**, **keyAgreement**, **certSign**, **crlSign**,
+**encipherOnly** or **decipherOnly**.`,
+			},
+			cli.StringSliceFlag{
+				Name: "eku",
+				Usage: `Set the extended key <usage> of the certificate, overriding the default of the
+profile. With the **--csr** flag the extended key usage is added to the
+requested extensions. Use the '--eku' flag multiple times to set multiple usages.
+
+: <usage> is a case-insensitive string, like **serverAuth**, **clientAuth**,
+**codeSigning**, **emailProtection**, **timeStamping**, **OCSPSigning** or
+**any**, or an object identifier in the dotted notation, e.g. 1.3.6.1.5.5.7.3.17.`,
+			},
+			cli.StringFlag{
+				Name: "subject",
+				Usage: `The distinguished <name> of the subject, overriding the positional <subject>,
+e.g. "CN=foo,O=Smallstep,C=US" or "/CN=foo/O=Smallstep/C=US". If the common name
+is not present, the positional <subject> is used.
+
+: The attribute types are case-insensitive and can be **CN**, **C**, **O**,
+**OU**, **L**, **ST**, **STREET**, **POSTALCODE**, **SERIALNUMBER**,
+**EMAILADDRESS** (or **E**), or an object identifier in the dotted notation.
+Commas or slashes in a value can be escaped with a backslash.`,
+			},
+			cli.StringFlag{
+				Name: "subject-file",
+				Usage: `The <file> with the subject in JSON format, using the fields of the subject of
+a certificate template: commonName, country, organization, organizationalUnit,
+locality, province and streetAddress.`,
+			},
+			cli.StringFlag{
+				Name: "basic-constraints",
+				Usage: `Add the basic constraints <value> to the requested extensions of a CSR, e.g.
+"CA:FALSE", "CA:TRUE" or "CA:TRUE,pathlen:0". This flag requires the **--csr**
+flag.`,
+			},
+			cli.StringSliceFlag{
+				Name: "extension",
+				Usage: `Add an extension to the requested extensions of a CSR. The value has the format
+<oid>=[critical,]<value>, where <value> is the base64 encoding of the
+DER-encoded extension value. Use the '--extension' flag multiple times to add
+multiple extensions. This flag requires the **--csr** flag.`,
+			},
+			cli.StringFlag{
+				Name: "challenge-password-file",
+				Usage: `The <file> with the challengePassword attribute of a CSR, used in enrollment
+protocols like SCEP. This flag requires the **--csr** flag.`,
+			},
+			cli.StringFlag{
+				Name: "unstructured-name",
+				Usage: `Add the unstructuredName attribute with the given <name> to a CSR. This flag
+requires the **--csr** flag.`,
 			},
 			cli.StringFlag{
 				Name: "not-before",
@@ -210,14 +421,84 @@ unit suffix, such as "300ms", "-1.5h" or "2h45m". Valid time units are "ns",
 			},
 			cli.StringSliceFlag{
 				Name: "san",
-				Usage: `Add DNS or IP Address Subjective Alternative Names (SANs). Use the '--san'
-flag multiple times to configure multiple SANs.`,
+				Usage: `Add DNS, IP Address, Email or URI Subjective Alternative Names (SANs). Use the
+'--san' flag multiple times to configure multiple SANs. URIs, like SPIFFE IDs
+(e.g. spiffe://example.org/workload), are detected by their scheme.`,
 			},
 			cli.BoolFlag{
 				Name: "bundle",
 				Usage: `Bundle the new leaf certificate with the signing certificate. This flag requires
 the **--ca** flag.`,
 			},
+			cli.StringSliceFlag{
+				Name: "permitted-dns",
+				Usage: `Add a permitted DNS <domain> to the name constraints of a certificate
+authority. A domain with a leading period (e.g. .example.com) only matches
+subdomains. Use the '--permitted-dns' flag multiple times to add multiple
+domains.`,
+			},
+			cli.StringSliceFlag{
+				Name: "excluded-dns",
+				Usage: `Add an excluded DNS <domain> to the name constraints of a certificate
+authority. Use the '--excluded-dns' flag multiple times to add multiple domains.`,
+			},
+			cli.StringSliceFlag{
+				Name: "permitted-ip",
+				Usage: `Add a permitted IP range to the name constraints of a certificate authority.
+The <cidr> can be an IP address or a network in CIDR notation (e.g. 10.0.0.0/8).
+Use the '--permitted-ip' flag multiple times to add multiple ranges.`,
+			},
+			cli.StringSliceFlag{
+				Name: "excluded-ip",
+				Usage: `Add an excluded IP range to the name constraints of a certificate authority.
+The <cidr> can be an IP address or a network in CIDR notation. Use the
+'--excluded-ip' flag multiple times to add multiple ranges.`,
+			},
+			cli.StringSliceFlag{
+				Name: "permitted-email",
+				Usage: `Add a permitted <email> address, host or domain to the name constraints of a
+certificate authority (e.g. jane@example.com, example.com or .example.com). Use
+the '--permitted-email' flag multiple times to add multiple values.`,
+			},
+			cli.StringSliceFlag{
+				Name: "excluded-email",
+				Usage: `Add an excluded <email> address, host or domain to the name constraints of a
+certificate authority. Use the '--excluded-email' flag multiple times to add
+multiple values.`,
+			},
+			cli.StringSliceFlag{
+				Name: "permitted-uri",
+				Usage: `Add a permitted URI <domain> to the name constraints of a certificate
+authority. The constraint applies to the host of the URI, for example
+example.org permits spiffe://example.org/foo. Use the '--permitted-uri' flag
+multiple times to add multiple domains.`,
+			},
+			cli.StringSliceFlag{
+				Name: "excluded-uri",
+				Usage: `Add an excluded URI <domain> to the name constraints of a certificate
+authority. Use the '--excluded-uri' flag multiple times to add multiple domains.`,
+			},
+			cli.IntFlag{
+				Name: "max-path-len",
+				Usage: `The maximum <number> of intermediate certificate authorities that may follow
+this certificate in a chain. The default is 1 for a root-ca and 0 for an
+intermediate-ca. Use -1 to remove the path length constraint.`,
+			},
+			cli.StringSliceFlag{
+				Name: "policy",
+				Usage: `Add a certificate policy <oid> (e.g. 2.23.140.1.2.1) to the certificate. Use
+the '--policy' flag multiple times to add multiple policies.`,
+			},
+			cli.IntFlag{
+				Name: "inhibit-any-policy",
+				Usage: `Add the inhibit anyPolicy extension to a certificate authority with the
+<number> of additional certificates that may appear in the path before
+anyPolicy is no longer permitted.`,
+			},
+			signatureAlgorithmFlag,
+			flags.Template,
+			flags.TemplateSet,
+			flags.TemplateSetFile,
 			flags.KTY,
 			flags.Size,
 			flags.Curve,
@@ -273,7 +554,24 @@ func createAction(ctx *cli.Context) error {
 	if len(sans) == 0 {
 		sans = []string{subject}
 	}
-	dnsNames, ips, emails := x509util.SplitSANs(sans)
+	dnsNames, ips, emails, uris := x509util.SplitSANsWithURIs(sans)
+	if err := x509util.ValidateURIs(uris); err != nil {
+		return err
+	}
+
+	caOptions, err := caProfileOptions(ctx)
+	if err != nil {
+		return err
+	}
+	usageOptions := usageProfileOptions(ctx)
+	sigAlg, err := parseSignatureAlgorithm(ctx)
+	if err != nil {
+		return err
+	}
+	name, err := parseSubjectFlags(ctx, subject)
+	if err != nil {
+		return err
+	}
 
 	var (
 		priv       interface{}
@@ -286,23 +584,50 @@ func createAction(ctx *cli.Context) error {
 		if bundle {
 			return errs.IncompatibleFlagWithFlag(ctx, "bundle", "csr")
 		}
+		if len(caOptions) > 0 {
+			return errs.IncompatibleFlagWithFlag(ctx, caConstraintFlag(ctx), "csr")
+		}
 		if ctx.IsSet("profile") {
 			return errs.IncompatibleFlagWithFlag(ctx, "profile", "csr")
 		}
+		if ctx.IsSet("template") {
+			return errs.IncompatibleFlagWithFlag(ctx, "template", "csr")
+		}
+		exts, err := requestedExtensions(ctx)
+		if err != nil {
+			return err
+		}
+		attrs, err := requestAttributes(ctx)
+		if err != nil {
+			return err
+		}
 		priv, err = keys.GenerateKey(kty, crv, size)
 		if err != nil {
 			return errors.WithStack(err)
 		}
+		signer, ok := priv.(crypto.Signer)
+		if !ok {
+			return errors.Errorf("key type %T is not a crypto.Signer", priv)
+		}
 
+		if name == nil {
+			name = &pkix.Name{CommonName: subject}
+		}
 		csr := &x509.CertificateRequest{
-			Subject: pkix.Name{
-				CommonName: subject,
-			},
-			DNSNames:       dnsNames,
-			IPAddresses:    ips,
-			EmailAddresses: emails,
+			Subject:            *name,
+			ExtraExtensions:    exts,
+			DNSNames:           dnsNames,
+			IPAddresses:        ips,
+			EmailAddresses:     emails,
+			URIs:               uris,
+			SignatureAlgorithm: sigAlg,
 		}
-		csrBytes, err := x509.CreateCertificateRequest(rand.Reader, csr, priv)
+		if sigAlg != x509.UnknownSignatureAlgorithm {
+			if err := x509util.CheckSignatureAlgorithm(sigAlg, signer); err != nil {
+				return err
+			}
+		}
+		csrBytes, err := x509util.CreateCertificateRequest(csr, attrs, signer)
 		if err != nil {
 			return errors.WithStack(err)
 		}
@@ -320,34 +645,66 @@ func createAction(ctx *cli.Context) error {
 			caKeyPath = ctx.String("ca-key")
 			profile   x509util.Profile
 		)
-		if bundle && prof != "leaf" {
+		for _, flag := range csrOnlyFlags {
+			if ctx.IsSet(flag) {
+				return errs.RequiredWithFlag(ctx, flag, "csr")
+			}
+		}
+		switch {
+		case ctx.IsSet("template") && ctx.IsSet("profile"):
+			return errs.IncompatibleFlagWithFlag(ctx, "profile", "template")
+		case ctx.IsSet("template") && name != nil:
+			return errs.IncompatibleFlagWithFlag(ctx, subjectFlag(ctx), "template")
+		case ctx.IsSet("template"):
+			prof = "template"
+		case prof == "template":
+			return errs.InvalidFlagValue(ctx, "profile", prof, profileNames)
+		case bundle && !isLeafProfile(prof):
 			return errs.IncompatibleFlagValue(ctx, "bundle", "profile", prof)
+		case len(caOptions) > 0 && (isLeafProfile(prof) || prof == "self-signed"):
+			return errs.IncompatibleFlagValue(ctx, caConstraintFlag(ctx), "profile", prof)
 		}
-		switch prof {
-		case "leaf", "intermediate-ca":
+		switch {
+		case prof == "template":
+			profile, err = createProfileFromTemplate(ctx, subject, sans, caPath, caKeyPath,
+				append(append([]x509util.WithOption{
+					x509util.GenerateKeyPair(kty, crv, size),
+					x509util.WithNotBeforeAfterDuration(notBefore, notAfter, 0),
+				}, caOptions...), usageOptions...)...)
+			if err != nil {
+				return err
+			}
+		case isLeafProfile(prof), prof == "intermediate-ca":
 			if caPath == "" {
 				return errs.RequiredWithFlagValue(ctx, "profile", prof, "ca")
 			}
 			if caKeyPath == "" {
 				return errs.RequiredWithFlagValue(ctx, "profile", prof, "ca-key")
 			}
-			switch prof {
-			case "leaf":
+			switch {
+			case isLeafProfile(prof):
 				var issIdentity *x509util.Identity
 				issIdentity, err = loadIssuerIdentity(ctx, prof, caPath, caKeyPath)
 				if err != nil {
 					return errors.WithStack(err)
 				}
-				profile, err = x509util.NewLeafProfile(subject, issIdentity.Crt,
-					issIdentity.Key, x509util.GenerateKeyPair(kty, crv, size),
+				opts := []x509util.WithOption{
+					x509util.GenerateKeyPair(kty, crv, size),
 					x509util.WithNotBeforeAfterDuration(notBefore, notAfter, 0),
 					x509util.WithDNSNames(dnsNames),
 					x509util.WithIPAddresses(ips),
-					x509util.WithEmailAddresses(emails))
+					x509util.WithEmailAddresses(emails),
+					x509util.WithURIs(uris),
+				}
+				if prof != "leaf" {
+					opts = append(opts, x509util.WithUsage(prof))
+				}
+				profile, err = x509util.NewLeafProfile(subject, issIdentity.Crt,
+					issIdentity.Key, append(opts, usageOptions...)...)
 				if err != nil {
 					return errors.WithStack(err)
 				}
-			case "intermediate-ca":
+			default: // intermediate-ca
 				var issIdentity *x509util.Identity
 				issIdentity, err = loadIssuerIdentity(ctx, prof, caPath, caKeyPath)
 				if err != nil {
@@ -355,40 +712,59 @@ func createAction(ctx *cli.Context) error {
 				}
 				profile, err = x509util.NewIntermediateProfile(subject,
 					issIdentity.Crt, issIdentity.Key,
-					x509util.GenerateKeyPair(kty, crv, size),
-					x509util.WithNotBeforeAfterDuration(notBefore, notAfter, 0),
-					x509util.WithDNSNames(dnsNames),
-					x509util.WithIPAddresses(ips),
-					x509util.WithEmailAddresses(emails))
+					append(append([]x509util.WithOption{
+						x509util.GenerateKeyPair(kty, crv, size),
+						x509util.WithNotBeforeAfterDuration(notBefore, notAfter, 0),
+						x509util.WithDNSNames(dnsNames),
+						x509util.WithIPAddresses(ips),
+						x509util.WithEmailAddresses(emails),
+						x509util.WithURIs(uris),
+					}, caOptions...), usageOptions...)...)
 				if err != nil {
 					return errors.WithStack(err)
 				}
 			}
-		case "root-ca":
+		case prof == "root-ca":
 			profile, err = x509util.NewRootProfile(subject,
-				x509util.GenerateKeyPair(kty, crv, size),
-				x509util.WithNotBeforeAfterDuration(notBefore, notAfter, 0),
-				x509util.WithDNSNames(dnsNames),
-				x509util.WithIPAddresses(ips),
-				x509util.WithEmailAddresses(emails))
+				append(append([]x509util.WithOption{
+					x509util.GenerateKeyPair(kty, crv, size),
+					x509util.WithNotBeforeAfterDuration(notBefore, notAfter, 0),
+					x509util.WithDNSNames(dnsNames),
+					x509util.WithIPAddresses(ips),
+					x509util.WithEmailAddresses(emails),
+					x509util.WithURIs(uris),
+				}, caOptions...), usageOptions...)...)
 			if err != nil {
 				return errors.WithStack(err)
 			}
-		case "self-signed":
+		case prof == "self-signed":
 			if !ctx.Bool("subtle") {
 				return errs.RequiredWithFlagValue(ctx, "profile", "self-signed", "subtle")
 			}
 			profile, err = x509util.NewSelfSignedLeafProfile(subject,
-				x509util.GenerateKeyPair(kty, crv, size),
-				x509util.WithNotBeforeAfterDuration(notBefore, notAfter, 0),
-				x509util.WithDNSNames(dnsNames),
-				x509util.WithIPAddresses(ips),
-				x509util.WithEmailAddresses(emails))
+				append([]x509util.WithOption{
+					x509util.GenerateKeyPair(kty, crv, size),
+					x509util.WithNotBeforeAfterDuration(notBefore, notAfter, 0),
+					x509util.WithDNSNames(dnsNames),
+					x509util.WithIPAddresses(ips),
+					x509util.WithEmailAddresses(emails),
+					x509util.WithURIs(uris),
+				}, usageOptions...)...)
 			if err != nil {
 				return errors.WithStack(err)
 			}
 		default:
-			return errs.InvalidFlagValue(ctx, "profile", prof, "leaf, intermediate-ca, root-ca, self-signed")
+			return errs.InvalidFlagValue(ctx, "profile", prof, profileNames)
+		}
+		if sigAlg != x509.UnknownSignatureAlgorithm {
+			if err = x509util.WithSignatureAlgorithm(sigAlg)(profile); err != nil {
+				return err
+			}
+		}
+		if name != nil {
+			if err = x509util.WithSubject(*name)(profile); err != nil {
+				return err
+			}
 		}
 		var crtBytes []byte
 		crtBytes, err = profile.CreateCertificate()
@@ -443,6 +819,44 @@ func createAction(ctx *cli.Context) error {
 	return nil
 }
 
+// createProfileFromTemplate returns a profile using the certificate template
+// in the --template flag. The certificate will be self-signed if the --ca flag
+// is not used.
+func createProfileFromTemplate(ctx *cli.Context, subject string, sans []string, caPath, caKeyPath string, withOps ...x509util.WithOption) (x509util.Profile, error) {
+	text, data, err := readTemplate(ctx, subject, sans)
+	if err != nil {
+		return nil, err
+	}
+	ct, err := x509util.RenderTemplate(text, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if caPath == "" && caKeyPath == "" {
+		if ctx.Bool("bundle") {
+			return nil, errs.RequiredWithFlag(ctx, "bundle", "ca")
+		}
+		if !ct.IsCA() && !ctx.Bool("subtle") {
+			return nil, errors.New("the certificate template describes a self-signed leaf certificate; use the '--subtle' flag or the '--ca' and '--ca-key' flags")
+		}
+		profile, err := x509util.NewProfileFromCertificateTemplate(ct, nil, nil, withOps...)
+		return profile, errors.WithStack(err)
+	}
+
+	switch {
+	case caPath == "":
+		return nil, errs.RequiredWithFlag(ctx, "ca-key", "ca")
+	case caKeyPath == "":
+		return nil, errs.RequiredWithFlag(ctx, "ca", "ca-key")
+	}
+	issIdentity, err := x509util.LoadIdentityFromDisk(caPath, caKeyPath)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	profile, err := x509util.NewProfileFromCertificateTemplate(ct, issIdentity.Crt, issIdentity.Key, withOps...)
+	return profile, errors.WithStack(err)
+}
+
 func loadIssuerIdentity(ctx *cli.Context, profile, caPath, caKeyPath string) (*x509util.Identity, error) {
 	if caPath == "" {
 		return nil, errs.RequiredWithFlagValue(ctx, "profile", profile, "ca")
@@ -452,3 +866,258 @@ func loadIssuerIdentity(ctx *cli.Context, profile, caPath, caKeyPath string) (*x
 	}
 	return x509util.LoadIdentityFromDisk(caPath, caKeyPath)
 }
+
+// profileNames is the list of supported profiles used in error messages.
+const profileNames = "leaf, intermediate-ca, root-ca, self-signed, server, client, " +
+	"code-signing, email, ocsp-signing, timestamping"
+
+// isLeafProfile returns true if the profile creates a leaf certificate signed
+// by a certificate authority: leaf or one of the usage presets.
+func isLeafProfile(prof string) bool {
+	if prof == "leaf" {
+		return true
+	}
+	_, ok := x509util.GetUsage(prof)
+	return ok
+}
+
+// usageProfileOptions returns the profile modifiers with the key usage and
+// extended key usage defined in the flags.
+func usageProfileOptions(ctx *cli.Context) []x509util.WithOption {
+	var opts []x509util.WithOption
+	if ku := ctx.StringSlice("key-usage"); len(ku) > 0 {
+		opts = append(opts, x509util.WithKeyUsage(ku))
+	}
+	if eku := ctx.StringSlice("eku"); len(eku) > 0 {
+		opts = append(opts, x509util.WithExtKeyUsage(eku))
+	}
+	return opts
+}
+
+// signatureAlgorithmFlag is the flag used to set the algorithm used to sign a
+// certificate or a certificate request.
+var signatureAlgorithmFlag = cli.StringFlag{
+	Name: "signature-algorithm",
+	Usage: `The <algorithm> used to sign the certificate. It must match the type of the
+signing key, by default it is SHA256-RSA for RSA keys, ECDSA-SHA256,
+ECDSA-SHA384 or ECDSA-SHA512 for P-256, P-384 and P-521 keys, and Ed25519
+for Ed25519 keys. RSA-PSS keys can only use the RSA-PSS algorithms, by default
+the one with the hash the key is restricted to, or SHA256-RSAPSS.
+
+: <algorithm> is a case-insensitive string and must be one of:
+
+    **SHA256-RSA**, **SHA384-RSA**, **SHA512-RSA**
+    :  RSA PKCS #1 v1.5 signatures.
+
+    **SHA256-RSAPSS**, **SHA384-RSAPSS**, **SHA512-RSAPSS**
+    :  RSA-PSS signatures.
+
+    **ECDSA-SHA256**, **ECDSA-SHA384**, **ECDSA-SHA512**
+    :  ECDSA signatures.
+
+    **Ed25519**
+    :  Ed25519 signatures.`,
+}
+
+// parseSignatureAlgorithm returns the signature algorithm in the
+// --signature-algorithm flag, x509.UnknownSignatureAlgorithm if it is not
+// set.
+func parseSignatureAlgorithm(ctx *cli.Context) (x509.SignatureAlgorithm, error) {
+	name := ctx.String("signature-algorithm")
+	if name == "" {
+		return x509.UnknownSignatureAlgorithm, nil
+	}
+	alg, err := x509util.ParseSignatureAlgorithm(name)
+	if err != nil {
+		return alg, errs.InvalidFlagValue(ctx, "signature-algorithm", name,
+			strings.Join(x509util.SignatureAlgorithmNames(), ", "))
+	}
+	return alg, nil
+}
+
+// subjectFlag returns the first flag used to set the subject.
+func subjectFlag(ctx *cli.Context) string {
+	if ctx.IsSet("subject") {
+		return "subject"
+	}
+	return "subject-file"
+}
+
+// parseSubjectFlags returns the subject defined in the --subject or
+// --subject-file flags, nil if they are not set. The common name defaults to
+// the given subject.
+func parseSubjectFlags(ctx *cli.Context, subject string) (*pkix.Name, error) {
+	var (
+		name pkix.Name
+		err  error
+	)
+	switch {
+	case ctx.IsSet("subject") && ctx.IsSet("subject-file"):
+		return nil, errs.IncompatibleFlagWithFlag(ctx, "subject", "subject-file")
+	case ctx.IsSet("subject"):
+		if name, err = x509util.ParseDistinguishedName(ctx.String("subject")); err != nil {
+			return nil, errs.InvalidFlagValue(ctx, "subject", ctx.String("subject"), "")
+		}
+	case ctx.IsSet("subject-file"):
+		filename := ctx.String("subject-file")
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, errs.FileError(err, filename)
+		}
+		if name, err = x509util.ParseSubject(b); err != nil {
+			return nil, errors.Wrapf(err, "error reading %s", filename)
+		}
+	default:
+		return nil, nil
+	}
+	if name.CommonName == "" {
+		name.CommonName = subject
+	}
+	return &name, nil
+}
+
+// csrOnlyFlags are the flags that can only be used to create a certificate
+// request.
+var csrOnlyFlags = []string{
+	"basic-constraints", "extension", "challenge-password-file", "unstructured-name",
+}
+
+// requestedExtensions returns the extensions to add to the extensionRequest
+// attribute of a certificate request.
+func requestedExtensions(ctx *cli.Context) ([]pkix.Extension, error) {
+	var exts []pkix.Extension
+	if ku := ctx.StringSlice("key-usage"); len(ku) > 0 {
+		ext, err := x509util.NewKeyUsageExtension(ku)
+		if err != nil {
+			return nil, errs.InvalidFlagValue(ctx, "key-usage", strings.Join(ku, ","), "")
+		}
+		exts = append(exts, ext)
+	}
+	if eku := ctx.StringSlice("eku"); len(eku) > 0 {
+		ext, err := x509util.NewExtKeyUsageExtension(eku)
+		if err != nil {
+			return nil, errs.InvalidFlagValue(ctx, "eku", strings.Join(eku, ","), "")
+		}
+		exts = append(exts, ext)
+	}
+	if bc := ctx.String("basic-constraints"); bc != "" {
+		ext, err := x509util.ParseBasicConstraints(bc)
+		if err != nil {
+			return nil, errs.InvalidFlagValue(ctx, "basic-constraints", bc, "CA:FALSE, CA:TRUE, CA:TRUE,pathlen:<number>")
+		}
+		exts = append(exts, ext)
+	}
+	for _, s := range ctx.StringSlice("extension") {
+		ext, err := x509util.ParseExtension(s)
+		if err != nil {
+			return nil, err
+		}
+		exts = append(exts, ext)
+	}
+	return exts, nil
+}
+
+// requestAttributes returns the challengePassword and unstructuredName
+// attributes of a certificate request.
+func requestAttributes(ctx *cli.Context) (x509util.RequestAttributes, error) {
+	var attrs x509util.RequestAttributes
+	if filename := ctx.String("challenge-password-file"); filename != "" {
+		pass, err := utils.ReadStringPasswordFromFile(filename)
+		if err != nil {
+			return attrs, err
+		}
+		attrs.ChallengePassword = pass
+	}
+	attrs.UnstructuredName = ctx.String("unstructured-name")
+	return attrs, nil
+}
+
+// nameConstraintFlags are the flags used to define the name constraints of a
+// certificate authority.
+var nameConstraintFlags = []string{
+	"permitted-dns", "excluded-dns", "permitted-ip", "excluded-ip",
+	"permitted-email", "excluded-email", "permitted-uri", "excluded-uri",
+}
+
+// caConstraintFlags are all the flags that can only be used to create a
+// certificate authority.
+var caConstraintFlags = append(nameConstraintFlags,
+	"max-path-len", "policy", "inhibit-any-policy")
+
+// caConstraintFlag returns the first certificate authority constraint flag
+// set.
+func caConstraintFlag(ctx *cli.Context) string {
+	for _, name := range caConstraintFlags {
+		if ctx.IsSet(name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// caProfileOptions returns the profile modifiers with the name constraints,
+// path length and policies defined in the flags.
+func caProfileOptions(ctx *cli.Context) ([]x509util.WithOption, error) {
+	var opts []x509util.WithOption
+
+	var nc x509util.NameConstraints
+	nc.PermittedDNSDomains = ctx.StringSlice("permitted-dns")
+	nc.ExcludedDNSDomains = ctx.StringSlice("excluded-dns")
+	nc.PermittedEmailAddresses = ctx.StringSlice("permitted-email")
+	nc.ExcludedEmailAddresses = ctx.StringSlice("excluded-email")
+	nc.PermittedURIDomains = ctx.StringSlice("permitted-uri")
+	nc.ExcludedURIDomains = ctx.StringSlice("excluded-uri")
+	for _, s := range ctx.StringSlice("permitted-ip") {
+		ipNet, err := parseIPRange(s)
+		if err != nil {
+			return nil, errs.InvalidFlagValue(ctx, "permitted-ip", s, "")
+		}
+		nc.PermittedIPRanges = append(nc.PermittedIPRanges, ipNet)
+	}
+	for _, s := range ctx.StringSlice("excluded-ip") {
+		ipNet, err := parseIPRange(s)
+		if err != nil {
+			return nil, errs.InvalidFlagValue(ctx, "excluded-ip", s, "")
+		}
+		nc.ExcludedIPRanges = append(nc.ExcludedIPRanges, ipNet)
+	}
+	for _, name := range nameConstraintFlags {
+		if ctx.IsSet(name) {
+			opts = append(opts, x509util.WithNameConstraints(nc))
+			break
+		}
+	}
+
+	if ctx.IsSet("max-path-len") {
+		opts = append(opts, x509util.WithMaxPathLen(ctx.Int("max-path-len")))
+	}
+	if policies := ctx.StringSlice("policy"); len(policies) > 0 {
+		opts = append(opts, x509util.WithPolicyIdentifiers(policies))
+	}
+	if ctx.IsSet("inhibit-any-policy") {
+		n := ctx.Int("inhibit-any-policy")
+		if n < 0 {
+			return nil, errs.InvalidFlagValue(ctx, "inhibit-any-policy", ctx.String("inhibit-any-policy"), "")
+		}
+		opts = append(opts, x509util.WithInhibitAnyPolicy(n))
+	}
+
+	return opts, nil
+}
+
+// parseIPRange parses an IP address or a network in CIDR notation. IP
+// addresses are converted to a network with a single address.
+func parseIPRange(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, ipNet, err := net.ParseCIDR(s)
+		return ipNet, err
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, errors.Errorf("invalid IP address %s", s)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
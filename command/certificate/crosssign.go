@@ -0,0 +1,225 @@
+package certificate
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/x509util"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/flags"
+	"github.com/smallstep/cli/ui"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+)
+
+func crossSignCommand() cli.Command {
+	return cli.Command{
+		Name:   "cross-sign",
+		Action: command.ActionFunc(crossSignAction),
+		Usage:  "cross-sign a certificate authority with a different issuer",
+		UsageText: `**step certificate cross-sign** <crt_file>
+**--ca**=<issuer-cert> **--ca-key**=<issuer-key> [**--root**=<file>] [**--out**=<file>]
+[**--bundle**] [**--not-before**=<time|duration>] [**--not-after**=<time|duration>]
+[**--password-file**=<file>] [**--force**]`,
+		Description: `**step certificate cross-sign** issues a new certificate for an
+existing certificate authority using a different issuer.
+
+The new certificate reuses the subject, the public key, the subject key
+identifier, the validity and the extensions of the original certificate, so
+certificates issued by the original certificate authority will verify using
+either of them. This is typically used during a root rotation: the new root is
+cross-signed by the old root, and the old root by the new one, so clients with
+either root in their trust store can verify certificates issued under both.
+
+The authority key identifier, CRL distribution points, authority information
+access and certificate transparency extensions of the original certificate are
+bound to the original issuer and are not copied.
+
+The validity of the new certificate is limited to the validity of the issuer.
+
+Before writing the new certificate, this command checks that it verifies using
+the issuer, that it is interchangeable with the original certificate, and that
+the original certificate still verifies using its own root.
+
+## POSITIONAL ARGUMENTS
+
+<crt_file>
+:  The path to the certificate authority to cross-sign.
+
+## EXIT CODES
+
+This command returns 0 on success and \>0 if any error occurs.
+
+## EXAMPLES
+
+Cross-sign a new root with the old root and print the certificate:
+
+'''
+$ step certificate cross-sign new-root.crt --ca old-root.crt --ca-key old-root.key
+'''
+
+Cross-sign the old root with the new root and write the certificate to disk:
+
+'''
+$ step certificate cross-sign old-root.crt --ca new-root.crt --ca-key new-root.key \
+  --out old-root-cross.crt
+'''
+
+Cross-sign an intermediate with a different root, valid for 90 days, and bundle
+the result with the new issuer:
+
+'''
+$ step certificate cross-sign intermediate.crt --ca other-root.crt --ca-key other-root.key \
+  --root root.crt --not-after 2160h --bundle --out intermediate-cross.crt
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "ca",
+				Usage: `The certificate authority used to issue the new certificate (PEM file).`,
+			},
+			cli.StringFlag{
+				Name:  "ca-key",
+				Usage: `The certificate authority private key used to sign the new certificate (PEM file).`,
+			},
+			cli.StringFlag{
+				Name: "root",
+				Usage: `The root certificate of the original certificate authority (PEM file), used
+to verify the original certificate. The file can also include the
+intermediates between the root and the original certificate. Required if
+<crt_file> is not a root certificate.`,
+			},
+			cli.StringFlag{
+				Name:  "out",
+				Usage: `The <file> to write the new certificate to. Defaults to STDOUT.`,
+			},
+			cli.BoolFlag{
+				Name:  "bundle",
+				Usage: `Bundle the new certificate with the signing certificate.`,
+			},
+			cli.StringFlag{
+				Name: "not-before",
+				Usage: `The <time|duration> set in the NotBefore property of the certificate. If a
+<time> is used it is expected to be in RFC 3339 format. If a <duration> is
+used, it is a sequence of decimal numbers, each with optional fraction and a
+unit suffix, such as "300ms", "-1.5h" or "2h45m". Valid time units are "ns",
+"us" (or "µs"), "ms", "s", "m", "h". Defaults to the NotBefore of the original
+certificate.`,
+			},
+			cli.StringFlag{
+				Name: "not-after",
+				Usage: `The <time|duration> set in the NotAfter property of the certificate. If a
+<time> is used it is expected to be in RFC 3339 format. If a <duration> is
+used, it is a sequence of decimal numbers, each with optional fraction and a
+unit suffix, such as "300ms", "-1.5h" or "2h45m". Valid time units are "ns",
+"us" (or "µs"), "ms", "s", "m", "h". Defaults to the NotAfter of the original
+certificate.`,
+			},
+			cli.StringFlag{
+				Name:  "password-file",
+				Usage: `The path to the <file> containing the password to decrypt the issuer private key.`,
+			},
+			flags.Force,
+		},
+	}
+}
+
+func crossSignAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 1); err != nil {
+		return err
+	}
+
+	crtFile := ctx.Args().Get(0)
+	caPath := ctx.String("ca")
+	caKeyPath := ctx.String("ca-key")
+	switch {
+	case caPath == "":
+		return errs.RequiredFlag(ctx, "ca")
+	case caKeyPath == "":
+		return errs.RequiredFlag(ctx, "ca-key")
+	}
+
+	notBefore, ok := flags.ParseTimeOrDuration(ctx.String("not-before"))
+	if !ok {
+		return errs.InvalidFlagValue(ctx, "not-before", ctx.String("not-before"), "")
+	}
+	notAfter, ok := flags.ParseTimeOrDuration(ctx.String("not-after"))
+	if !ok {
+		return errs.InvalidFlagValue(ctx, "not-after", ctx.String("not-after"), "")
+	}
+
+	crt, err := pemutil.ReadCertificate(crtFile, pemutil.WithFirstBlock())
+	if err != nil {
+		return err
+	}
+	var chain []*x509.Certificate
+	if root := ctx.String("root"); root != "" {
+		if chain, err = pemutil.ReadCertificateBundle(root); err != nil {
+			return err
+		}
+	} else if !bytes.Equal(crt.RawSubject, crt.RawIssuer) {
+		return errors.Errorf("%s is not a root certificate, the '--root' flag is required", crtFile)
+	}
+
+	var pemOpts []pemutil.Options
+	if passFile := ctx.String("password-file"); passFile != "" {
+		pemOpts = append(pemOpts, pemutil.WithPasswordFile(passFile))
+	}
+	issuer, err := x509util.LoadIdentityFromDisk(caPath, caKeyPath, pemOpts...)
+	if err != nil {
+		return err
+	}
+
+	// Keep the original validity unless the flags are set.
+	if notBefore.IsZero() {
+		notBefore = crt.NotBefore
+	}
+	if notAfter.IsZero() {
+		notAfter = crt.NotAfter
+	}
+	if notBefore.After(notAfter) {
+		return errs.IncompatibleFlagValues(ctx, "not-before", ctx.String("not-before"), "not-after", ctx.String("not-after"))
+	}
+
+	profile, err := x509util.NewCrossSignedProfile(crt, issuer.Crt, issuer.Key,
+		x509util.WithNotBeforeAfterDuration(notBefore, notAfter, 0))
+	if err != nil {
+		return err
+	}
+	crtBytes, err := profile.CreateCertificate()
+	if err != nil {
+		return errors.Wrap(err, "error creating cross-signed certificate")
+	}
+	crossCrt, err := x509.ParseCertificate(crtBytes)
+	if err != nil {
+		return errors.Wrap(err, "error parsing cross-signed certificate")
+	}
+	if err := x509util.VerifyCrossSigned(crossCrt, crt, issuer.Crt, chain); err != nil {
+		return err
+	}
+
+	pubBytes := pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: crtBytes,
+	})
+	if ctx.Bool("bundle") {
+		pubBytes = append(pubBytes, pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: issuer.Crt.Raw,
+		})...)
+	}
+
+	if out := ctx.String("out"); out != "" {
+		if err := utils.WriteFile(out, pubBytes, 0600); err != nil {
+			return err
+		}
+		ui.Printf("Your certificate has been saved in %s.\n", out)
+		return nil
+	}
+	os.Stdout.Write(pubBytes)
+	return nil
+}
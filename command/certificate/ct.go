@@ -0,0 +1,154 @@
+package certificate
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/x509util"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/ui"
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/ocsp"
+)
+
+// defaultCTMinLogs is the default number of distinct logs that must have
+// issued a valid SCT for a certificate.
+const defaultCTMinLogs = 2
+
+// ctChecker verifies the signed certificate timestamps of a certificate
+// against a list of trusted certificate transparency logs.
+type ctChecker struct {
+	logs    *x509util.CTLogList
+	minLogs int
+	now     time.Time
+}
+
+// sctStatus is the result of the verification of an SCT.
+type sctStatus struct {
+	sct *x509util.SignedCertificateTimestamp
+	log *x509util.CTLog
+	err error
+}
+
+// newCTChecker creates a ctChecker using the --ct-log-list and --ct-min-logs
+// flags. It returns nil if the log list is not set.
+func newCTChecker(ctx *cli.Context) (*ctChecker, error) {
+	logList := ctx.String("ct-log-list")
+	if logList == "" {
+		if ctx.IsSet("ct-min-logs") {
+			return nil, errs.RequiredWithFlag(ctx, "ct-min-logs", "ct-log-list")
+		}
+		return nil, nil
+	}
+	minLogs := ctx.Int("ct-min-logs")
+	if minLogs < 0 {
+		return nil, errs.InvalidFlagValue(ctx, "ct-min-logs", ctx.String("ct-min-logs"), "")
+	}
+	logs, err := x509util.ReadCTLogList(logList)
+	if err != nil {
+		return nil, err
+	}
+	return &ctChecker{
+		logs:    logs,
+		minLogs: minLogs,
+		now:     time.Now(),
+	}, nil
+}
+
+// Check verifies the SCTs of the leaf certificate and fails if the number of
+// distinct logs with a valid SCT is lower than the minimum required. Invalid
+// SCTs or SCTs from unknown logs are reported as warnings.
+func (c *ctChecker) Check(scts []*x509util.SignedCertificateTimestamp, crt, issuer *x509.Certificate) error {
+	logs := make(map[[32]byte]bool)
+	for _, st := range c.verify(scts, crt, issuer) {
+		if st.err != nil {
+			ui.Printf("Warning: SCT from log %s (%s) is not valid: %v\n", st.sct.LogIDString(), st.sct.Source, st.err)
+			continue
+		}
+		logs[st.sct.LogID] = true
+	}
+	if len(logs) < c.minLogs {
+		return errors.Errorf("certificate '%s' has valid SCTs from %d distinct logs, at least %d are required",
+			crt.Subject, len(logs), c.minLogs)
+	}
+	return nil
+}
+
+// verify verifies the signature of all the given SCTs.
+func (c *ctChecker) verify(scts []*x509util.SignedCertificateTimestamp, crt, issuer *x509.Certificate) []sctStatus {
+	var statuses []sctStatus
+	for _, sct := range scts {
+		st := sctStatus{sct: sct}
+		if st.log = c.logs.Find(sct.LogID); st.log == nil {
+			st.err = errors.New("unknown log")
+		} else if sct.Timestamp.After(c.now) {
+			st.err = errors.Errorf("timestamp %s is in the future", sct.Timestamp.Format(time.RFC3339))
+		} else {
+			st.err = x509util.VerifySCT(sct, st.log, crt, issuer)
+		}
+		statuses = append(statuses, st)
+	}
+	return statuses
+}
+
+// certificateSCTs returns the SCTs of a certificate embedded in the
+// certificate and, for remote certificates, the ones in the TLS extension and
+// the stapled OCSP response.
+func certificateSCTs(crt, issuer *x509.Certificate, tlsSCTs [][]byte, stapled []byte) ([]*x509util.SignedCertificateTimestamp, error) {
+	scts, err := x509util.CertificateSCTs(crt)
+	if err != nil {
+		return nil, err
+	}
+	if len(tlsSCTs) > 0 {
+		s, err := x509util.TLSSCTs(tlsSCTs)
+		if err != nil {
+			return nil, err
+		}
+		scts = append(scts, s...)
+	}
+	if len(stapled) > 0 && issuer != nil {
+		var resp *ocsp.Response
+		if resp, err = x509util.ParseOCSPResponse(stapled, crt, issuer); err != nil {
+			return nil, err
+		}
+		s, err := x509util.OCSPResponseSCTs(resp)
+		if err != nil {
+			return nil, err
+		}
+		scts = append(scts, s...)
+	}
+	return scts, nil
+}
+
+// sctText returns the SCTs in a human readable format. If the checker is not
+// nil, the log names and the result of the verification are also included.
+func sctText(scts []*x509util.SignedCertificateTimestamp, c *ctChecker, crt, issuer *x509.Certificate) string {
+	var statuses []sctStatus
+	if c != nil {
+		statuses = c.verify(scts, crt, issuer)
+	}
+
+	var b strings.Builder
+	b.WriteString("Signed Certificate Timestamps:\n")
+	for i, sct := range scts {
+		fmt.Fprintf(&b, "    SCT (%s):\n", sct.Source)
+		fmt.Fprintf(&b, "        Log ID: %s\n", sct.LogIDString())
+		if statuses != nil {
+			st := statuses[i]
+			switch {
+			case st.log == nil:
+				b.WriteString("        Log: unknown\n")
+			case st.err != nil:
+				fmt.Fprintf(&b, "        Log: %s (invalid: %v)\n", st.log.Description, st.err)
+			default:
+				fmt.Fprintf(&b, "        Log: %s (verified)\n", st.log.Description)
+			}
+		}
+		fmt.Fprintf(&b, "        Timestamp: %s\n", sct.Timestamp.Format(time.RFC3339))
+		fmt.Fprintf(&b, "        Signature Algorithm: %s\n", sct.SignatureAlgorithmString())
+	}
+	return b.String()
+}
@@ -0,0 +1,515 @@
+package certificate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/x509util"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+)
+
+// diffErrorCode is the exit code used by diff if an error occurs, 0 and 1
+// are used to indicate if the certificates are equal or not.
+const diffErrorCode = 2
+
+func diffCommand() cli.Command {
+	return cli.Command{
+		Name:   "diff",
+		Action: cli.ActionFunc(diffAction),
+		Usage:  "compare two certificates or CSRs",
+		UsageText: `**step certificate diff** <crt_file_a> <crt_file_b>
+[**--format**=<format>] [**--roots**=<root-bundle>]
+[**--roots-password-file**=<file>] [**--insecure**] [**--servername**=<name>]`,
+		Description: `**step certificate diff** compares two certificates or certificate
+signing requests (CSRs) field by field and prints the differences. The fields
+compared include the subject, issuer, subject alternative names, validity, key
+algorithm, size and fingerprint, key usages, extended key usages, certificate
+policies, name constraints and the extensions by object identifier.
+
+Certificates in PEM and DER format, and certificate bundles in PKCS#7 format
+are supported; for files with multiple certificates only the first one is
+compared. The certificate of a remote server can be compared using an URL like
+https://smallstep.com.
+
+## POSITIONAL ARGUMENTS
+
+<crt_file_a>, <crt_file_b>
+:  The paths or URLs of the certificates or CSRs to compare.
+
+## EXIT CODES
+
+This command returns 0 if the certificates are equal, 1 if they are
+different, and 2 if any error occurs.
+
+## EXAMPLES
+
+Compare a certificate with its renewed version:
+
+'''
+$ step certificate diff old.crt new.crt
+'''
+
+Compare a local certificate with the one served by a remote server:
+
+'''
+$ step certificate diff ./certificate.crt https://smallstep.com
+'''
+
+Compare a certificate with the CSR used to request it:
+
+'''
+$ step certificate diff ./certificate.crt ./certificate.csr
+'''
+
+Print the differences in JSON:
+
+'''
+$ step certificate diff old.crt new.crt --format json
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "format",
+				Value: "text",
+				Usage: `The <format> used to print the differences.
+
+: <format> is a string and must be one of:
+
+    **text**
+    :  Print the differences in a unified diff like format.
+
+    **json**
+    :  Print the differences in JSON format.`,
+			},
+			cli.StringFlag{
+				Name: "roots",
+				Usage: `Root certificate(s) that will be used to verify the
+authenticity of the remote servers.
+
+: <roots> is a case-sensitive string and may be one of:
+
+    **file**
+	:  Relative or full path to a file. All certificates in the file will be used for path validation.
+
+    **list of files**
+	:  Comma-separated list of relative or full file paths. Every PEM encoded certificate from each file will be used for path validation.
+
+    **directory**
+	:  Relative or full path to a directory. Every PEM encoded certificate from each file in the directory will be used for path validation.`,
+			},
+			rootsPasswordFileFlag,
+			cli.BoolFlag{
+				Name: "insecure",
+				Usage: `Use an insecure client to retrieve the remote peer certificates. Useful to
+compare expired or invalid certificates remotely.`,
+			},
+			serverNameFlag,
+		},
+	}
+}
+
+func diffAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 2); err != nil {
+		return errs.NewExitError(err, diffErrorCode)
+	}
+	diffs, err := diffCertificates(ctx, os.Stdout)
+	if err != nil {
+		return errs.NewExitError(err, diffErrorCode)
+	}
+	if len(diffs) > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// diffCertificates compares the certificates in the arguments and prints the
+// differences in the format requested.
+func diffCertificates(ctx *cli.Context, w io.Writer) ([]fieldDiff, error) {
+	var (
+		nameA  = ctx.Args().Get(0)
+		nameB  = ctx.Args().Get(1)
+		format = ctx.String("format")
+	)
+	if format != "text" && format != "json" {
+		return nil, errs.InvalidFlagValue(ctx, "format", format, "text, json")
+	}
+
+	fieldsA, err := readDiffFields(ctx, nameA)
+	if err != nil {
+		return nil, err
+	}
+	fieldsB, err := readDiffFields(ctx, nameB)
+	if err != nil {
+		return nil, err
+	}
+	diffs := diffFields(fieldsA, fieldsB)
+
+	switch format {
+	case "json":
+		if diffs == nil {
+			diffs = []fieldDiff{}
+		}
+		b, err := json.MarshalIndent(struct {
+			A           string      `json:"a"`
+			B           string      `json:"b"`
+			Equal       bool        `json:"equal"`
+			Differences []fieldDiff `json:"differences"`
+		}{nameA, nameB, len(diffs) == 0, diffs}, "", "  ")
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		fmt.Fprintln(w, string(b))
+	default:
+		if len(diffs) > 0 {
+			fmt.Fprintf(w, "--- %s\n+++ %s\n", nameA, nameB)
+			for _, d := range diffs {
+				io.WriteString(w, d.text())
+			}
+		}
+	}
+	return diffs, nil
+}
+
+// readDiffFields reads the certificate or CSR in the given file or URL and
+// returns its fields.
+func readDiffFields(ctx *cli.Context, name string) ([]certField, error) {
+	if _, addr, isURL := trimURLPrefix(name); isURL {
+		opts, err := newRemoteOptions(ctx)
+		if err != nil {
+			return nil, err
+		}
+		peerCertificates, err := getPeerCertificates(addr, opts)
+		if err != nil {
+			return nil, err
+		}
+		return certificateFields(peerCertificates[0]), nil
+	}
+
+	b, err := utils.ReadFile(name)
+	if err != nil {
+		return nil, errs.FileError(err, name)
+	}
+	switch {
+	case pemutil.IsPKCS7(b):
+		certs, err := pemutil.ParsePKCS7(b)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing %s", name)
+		}
+		return certificateFields(certs[0]), nil
+	case bytes.HasPrefix(b, []byte("-----BEGIN ")):
+		for len(b) > 0 {
+			var block *pem.Block
+			if block, b = pem.Decode(b); block == nil {
+				break
+			}
+			switch block.Type {
+			case "CERTIFICATE":
+				crt, err := x509.ParseCertificate(block.Bytes)
+				if err != nil {
+					return nil, errors.Wrapf(err, "error parsing %s", name)
+				}
+				return certificateFields(crt), nil
+			case "CERTIFICATE REQUEST", "NEW CERTIFICATE REQUEST":
+				csr, err := x509.ParseCertificateRequest(block.Bytes)
+				if err != nil {
+					return nil, errors.Wrapf(err, "error parsing %s", name)
+				}
+				return csrFields(csr), nil
+			}
+		}
+		return nil, errors.Errorf("%s does not contain a certificate or CSR", name)
+	default:
+		if crt, err := x509.ParseCertificate(b); err == nil {
+			return certificateFields(crt), nil
+		}
+		if csr, err := x509.ParseCertificateRequest(b); err == nil {
+			return csrFields(csr), nil
+		}
+		return nil, errors.Errorf("%s does not contain a certificate or CSR", name)
+	}
+}
+
+// certField is a field of a certificate or CSR. Fields with multiple values
+// are sorted if the order is not relevant.
+type certField struct {
+	Name   string
+	Values []string
+}
+
+// fieldDiff is a field with different values in the certificates compared.
+type fieldDiff struct {
+	Field string   `json:"field"`
+	A     []string `json:"a"`
+	B     []string `json:"b"`
+}
+
+// diffFields returns the fields with different values, in the order of the
+// first list followed by the fields only in the second one.
+func diffFields(a, b []certField) []fieldDiff {
+	index := func(fields []certField) map[string][]string {
+		m := make(map[string][]string, len(fields))
+		for _, f := range fields {
+			m[f.Name] = f.Values
+		}
+		return m
+	}
+	ma, mb := index(a), index(b)
+
+	var diffs []fieldDiff
+	for _, f := range a {
+		if vb := mb[f.Name]; !equalStrings(f.Values, vb) {
+			diffs = append(diffs, fieldDiff{Field: f.Name, A: f.Values, B: vb})
+		}
+	}
+	for _, f := range b {
+		if _, ok := ma[f.Name]; !ok && len(f.Values) > 0 {
+			diffs = append(diffs, fieldDiff{Field: f.Name, B: f.Values})
+		}
+	}
+	return diffs
+}
+
+// text returns the difference in a unified diff like format. For fields with
+// multiple values, the common values are printed as context.
+func (d fieldDiff) text() string {
+	var b strings.Builder
+	if len(d.A) <= 1 && len(d.B) <= 1 {
+		for _, v := range d.A {
+			fmt.Fprintf(&b, "- %s: %s\n", d.Field, v)
+		}
+		for _, v := range d.B {
+			fmt.Fprintf(&b, "+ %s: %s\n", d.Field, v)
+		}
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "  %s:\n", d.Field)
+	inA, inB := stringSet(d.A), stringSet(d.B)
+	for _, v := range d.A {
+		if inB[v] {
+			fmt.Fprintf(&b, "      %s\n", v)
+		} else {
+			fmt.Fprintf(&b, "-     %s\n", v)
+		}
+	}
+	for _, v := range d.B {
+		if !inA[v] {
+			fmt.Fprintf(&b, "+     %s\n", v)
+		}
+	}
+	return b.String()
+}
+
+func stringSet(values []string) map[string]bool {
+	m := make(map[string]bool, len(values))
+	for _, v := range values {
+		m[v] = true
+	}
+	return m
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// certificateFields returns the fields of a certificate.
+func certificateFields(crt *x509.Certificate) []certField {
+	fields := []certField{
+		{"Version", []string{strconv.Itoa(crt.Version)}},
+		{"Serial Number", []string{crt.SerialNumber.String()}},
+		{"Subject", []string{crt.Subject.String()}},
+		{"Issuer", []string{crt.Issuer.String()}},
+		{"Not Before", []string{crt.NotBefore.UTC().Format(time.RFC3339)}},
+		{"Not After", []string{crt.NotAfter.UTC().Format(time.RFC3339)}},
+		{"Validity Period", []string{crt.NotAfter.Sub(crt.NotBefore).String()}},
+		{"Signature Algorithm", []string{crt.SignatureAlgorithm.String()}},
+		{"Public Key", []string{x509util.PublicKeyString(crt.PublicKey)}},
+		{"Public Key Fingerprint", spkiFingerprintStrings(crt.RawSubjectPublicKeyInfo)},
+	}
+	fields = append(fields, sanFields(crt.DNSNames, crt.IPAddresses, crt.EmailAddresses, crt.URIs)...)
+	fields = append(fields,
+		certField{"Key Usage", x509util.KeyUsageStrings(crt.KeyUsage)},
+		certField{"Extended Key Usage", extKeyUsageStrings(crt)},
+	)
+	fields = append(fields,
+		certField{"Basic Constraints", basicConstraintsStrings(crt)},
+		certField{"Subject Key Identifier", hexStrings(crt.SubjectKeyId)},
+		certField{"Authority Key Identifier", hexStrings(crt.AuthorityKeyId)},
+		certField{"Certificate Policies", sortedStrings(oidStrings(crt.PolicyIdentifiers))},
+		certField{"CRL Distribution Points", sortedStrings(crt.CRLDistributionPoints)},
+		certField{"OCSP Servers", sortedStrings(crt.OCSPServer)},
+		certField{"Issuing Certificate URLs", sortedStrings(crt.IssuingCertificateURL)},
+		certField{"Name Constraints Critical", nameConstraintsCriticalStrings(crt)},
+		certField{"Permitted DNS Domains", sortedStrings(crt.PermittedDNSDomains)},
+		certField{"Excluded DNS Domains", sortedStrings(crt.ExcludedDNSDomains)},
+		certField{"Permitted IP Ranges", sortedStrings(ipNetStrings(crt.PermittedIPRanges))},
+		certField{"Excluded IP Ranges", sortedStrings(ipNetStrings(crt.ExcludedIPRanges))},
+		certField{"Permitted Email Addresses", sortedStrings(crt.PermittedEmailAddresses)},
+		certField{"Excluded Email Addresses", sortedStrings(crt.ExcludedEmailAddresses)},
+		certField{"Permitted URI Domains", sortedStrings(crt.PermittedURIDomains)},
+		certField{"Excluded URI Domains", sortedStrings(crt.ExcludedURIDomains)},
+	)
+	return append(fields, extensionFields(crt.Extensions)...)
+}
+
+// csrFields returns the fields of a certificate signing request.
+func csrFields(csr *x509.CertificateRequest) []certField {
+	fields := []certField{
+		{"Subject", []string{csr.Subject.String()}},
+		{"Signature Algorithm", []string{csr.SignatureAlgorithm.String()}},
+		{"Public Key", []string{x509util.PublicKeyString(csr.PublicKey)}},
+		{"Public Key Fingerprint", spkiFingerprintStrings(csr.RawSubjectPublicKeyInfo)},
+	}
+	fields = append(fields, sanFields(csr.DNSNames, csr.IPAddresses, csr.EmailAddresses, csr.URIs)...)
+	return append(fields, extensionFields(csr.Extensions)...)
+}
+
+func sanFields(dnsNames []string, ips []net.IP, emails []string, uris []*url.URL) []certField {
+	ipStrings := make([]string, len(ips))
+	for i, ip := range ips {
+		ipStrings[i] = ip.String()
+	}
+	uriStrings := make([]string, len(uris))
+	for i, u := range uris {
+		uriStrings[i] = u.String()
+	}
+	return []certField{
+		{"DNS Names", sortedStrings(dnsNames)},
+		{"IP Addresses", sortedStrings(ipStrings)},
+		{"Email Addresses", sortedStrings(emails)},
+		{"URIs", sortedStrings(uriStrings)},
+	}
+}
+
+func extKeyUsageStrings(crt *x509.Certificate) []string {
+	var usages []string
+	for _, eku := range crt.ExtKeyUsage {
+		usages = append(usages, x509util.ExtKeyUsageString(eku))
+	}
+	usages = append(usages, oidStrings(crt.UnknownExtKeyUsage)...)
+	return sortedStrings(usages)
+}
+
+func basicConstraintsStrings(crt *x509.Certificate) []string {
+	switch {
+	case !crt.BasicConstraintsValid:
+		return nil
+	case !crt.IsCA:
+		return []string{"CA:false"}
+	case crt.MaxPathLen > 0 || crt.MaxPathLenZero:
+		return []string{fmt.Sprintf("CA:true, pathlen:%d", crt.MaxPathLen)}
+	default:
+		return []string{"CA:true"}
+	}
+}
+
+// extensionNames are the names of common extensions.
+var extensionNames = map[string]string{
+	"2.5.29.14":               "Subject Key Identifier",
+	"2.5.29.15":               "Key Usage",
+	"2.5.29.17":               "Subject Alternative Name",
+	"2.5.29.19":               "Basic Constraints",
+	"2.5.29.30":               "Name Constraints",
+	"2.5.29.31":               "CRL Distribution Points",
+	"2.5.29.32":               "Certificate Policies",
+	"2.5.29.35":               "Authority Key Identifier",
+	"2.5.29.37":               "Extended Key Usage",
+	"1.3.6.1.5.5.7.1.1":       "Authority Information Access",
+	"1.3.6.1.5.5.7.1.24":      "TLS Feature",
+	"1.3.6.1.4.1.11129.2.4.2": "Signed Certificate Timestamps",
+	"1.3.6.1.4.1.11129.2.4.3": "Precertificate Poison",
+}
+
+// extensionFields returns a field with the list of extensions and a field
+// with the value of each extension not covered by the other fields.
+func extensionFields(exts []pkix.Extension) []certField {
+	var list []string
+	var fields []certField
+	for _, ext := range exts {
+		oid := ext.Id.String()
+		name := oid
+		if n, ok := extensionNames[oid]; ok {
+			name = fmt.Sprintf("%s (%s)", n, oid)
+		}
+		if ext.Critical {
+			name += " critical"
+		}
+		list = append(list, name)
+		if _, ok := extensionNames[oid]; !ok {
+			fields = append(fields, certField{"Extension " + oid, []string{hex.EncodeToString(ext.Value)}})
+		}
+	}
+	return append([]certField{{"Extensions", sortedStrings(list)}}, fields...)
+}
+
+func oidStrings(oids []asn1.ObjectIdentifier) []string {
+	s := make([]string, len(oids))
+	for i, oid := range oids {
+		s[i] = oid.String()
+	}
+	return s
+}
+
+func nameConstraintsCriticalStrings(crt *x509.Certificate) []string {
+	if crt.PermittedDNSDomainsCritical {
+		return []string{"true"}
+	}
+	return nil
+}
+
+func ipNetStrings(nets []*net.IPNet) []string {
+	s := make([]string, len(nets))
+	for i, n := range nets {
+		s[i] = n.String()
+	}
+	return s
+}
+
+// spkiFingerprintStrings returns the SHA-256 fingerprint of the subject public
+// key info, two keys of the same type and size are only different by it.
+func spkiFingerprintStrings(spki []byte) []string {
+	sum := sha256.Sum256(spki)
+	return []string{hex.EncodeToString(sum[:])}
+}
+
+func hexStrings(b []byte) []string {
+	if len(b) == 0 {
+		return nil
+	}
+	return []string{hex.EncodeToString(b)}
+}
+
+func sortedStrings(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	s := append([]string(nil), values...)
+	sort.Strings(s)
+	return s
+}
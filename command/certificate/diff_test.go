@@ -0,0 +1,122 @@
+package certificate
+
+import (
+	"crypto/x509"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/cli/crypto/x509util"
+)
+
+func TestDiffFields(t *testing.T) {
+	root, err := x509util.NewRootProfile("root")
+	assert.FatalError(t, err)
+	b, err := root.CreateCertificate()
+	assert.FatalError(t, err)
+	rootCrt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+
+	createLeaf := func(opts ...x509util.WithOption) *x509.Certificate {
+		p, err := x509util.NewLeafProfile("leaf", rootCrt, root.SubjectPrivateKey(), opts...)
+		assert.FatalError(t, err)
+		b, err := p.CreateCertificate()
+		assert.FatalError(t, err)
+		crt, err := x509.ParseCertificate(b)
+		assert.FatalError(t, err)
+		return crt
+	}
+
+	now := time.Now().Truncate(time.Second)
+	a := createLeaf(x509util.WithDNSNames([]string{"a.example.com", "b.example.com"}),
+		x509util.WithNotBeforeAfterDuration(now, now.Add(24*time.Hour), 0))
+	b2 := createLeaf(x509util.WithDNSNames([]string{"b.example.com", "c.example.com"}),
+		x509util.WithNotBeforeAfterDuration(now, now.Add(48*time.Hour), 0),
+		x509util.WithExtKeyUsage([]string{"clientAuth"}))
+
+	// Equal certificates
+	assert.Len(t, 0, diffFields(certificateFields(a), certificateFields(a)))
+
+	diffs := diffFields(certificateFields(a), certificateFields(b2))
+	fields := map[string]fieldDiff{}
+	for _, d := range diffs {
+		fields[d.Field] = d
+	}
+	for _, name := range []string{"Serial Number", "Not After", "Validity Period", "Public Key Fingerprint",
+		"DNS Names", "Extended Key Usage", "Subject Key Identifier"} {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("field %s not found in differences", name)
+		}
+	}
+	for _, name := range []string{"Subject", "Issuer", "Not Before", "Public Key", "Authority Key Identifier"} {
+		if _, ok := fields[name]; ok {
+			t.Errorf("unexpected difference in field %s", name)
+		}
+	}
+	assert.Equals(t, fieldDiff{
+		Field: "DNS Names",
+		A:     []string{"a.example.com", "b.example.com"},
+		B:     []string{"b.example.com", "c.example.com"},
+	}, fields["DNS Names"])
+	assert.Equals(t, []string{"clientAuth"}, fields["Extended Key Usage"].B)
+
+	text := fields["DNS Names"].text()
+	assert.Equals(t, "  DNS Names:\n-     a.example.com\n      b.example.com\n+     c.example.com\n", text)
+	text = fields["Not After"].text()
+	assert.True(t, strings.HasPrefix(text, "- Not After: "))
+	assert.True(t, strings.Contains(text, "\n+ Not After: "))
+
+	// Name constraints
+	createCA := func(opts ...x509util.WithOption) *x509.Certificate {
+		p, err := x509util.NewIntermediateProfile("intermediate", rootCrt, root.SubjectPrivateKey(), opts...)
+		assert.FatalError(t, err)
+		b, err := p.CreateCertificate()
+		assert.FatalError(t, err)
+		crt, err := x509.ParseCertificate(b)
+		assert.FatalError(t, err)
+		return crt
+	}
+	withNameConstraints := func(critical bool, ips []string, emails []string, uris []string) x509util.WithOption {
+		return func(p x509util.Profile) error {
+			crt := p.Subject()
+			crt.PermittedDNSDomainsCritical = critical
+			crt.PermittedEmailAddresses = emails
+			crt.ExcludedURIDomains = uris
+			for _, s := range ips {
+				_, ipNet, err := net.ParseCIDR(s)
+				assert.FatalError(t, err)
+				crt.PermittedIPRanges = append(crt.PermittedIPRanges, ipNet)
+			}
+			return nil
+		}
+	}
+	ca := createCA(withNameConstraints(false, []string{"10.0.0.0/8"}, []string{"example.com"}, []string{".example.com"}))
+	tests := []struct {
+		name  string
+		crt   *x509.Certificate
+		field string
+	}{
+		{"ip", createCA(withNameConstraints(false, []string{"192.168.0.0/16"}, []string{"example.com"}, []string{".example.com"})), "Permitted IP Ranges"},
+		{"email", createCA(withNameConstraints(false, []string{"10.0.0.0/8"}, []string{"example.org"}, []string{".example.com"})), "Permitted Email Addresses"},
+		{"uri", createCA(withNameConstraints(false, []string{"10.0.0.0/8"}, []string{"example.com"}, []string{".example.org"})), "Excluded URI Domains"},
+		{"critical", createCA(withNameConstraints(true, []string{"10.0.0.0/8"}, []string{"example.com"}, []string{".example.com"})), "Name Constraints Critical"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var found bool
+			for _, d := range diffFields(certificateFields(ca), certificateFields(tt.crt)) {
+				found = found || d.Field == tt.field
+			}
+			assert.True(t, found, "field %s not found in differences", tt.field)
+		})
+	}
+
+	// Fields only in one of the lists
+	diffs = diffFields([]certField{{"A", []string{"1"}}}, []certField{{"B", []string{"2"}}, {"C", nil}})
+	assert.Equals(t, []fieldDiff{
+		{Field: "A", A: []string{"1"}},
+		{Field: "B", B: []string{"2"}},
+	}, diffs)
+}
@@ -1,8 +1,10 @@
 package certificate
 
 import (
+	"crypto/sha256"
 	"crypto/x509"
 	"fmt"
+	"strings"
 
 	"github.com/smallstep/cli/crypto/pemutil"
 	"github.com/smallstep/cli/crypto/x509util"
@@ -12,10 +14,13 @@ import (
 
 func fingerprintCommand() cli.Command {
 	return cli.Command{
-		Name:      "fingerprint",
-		Action:    cli.ActionFunc(fingerprintAction),
-		Usage:     "print the fingerprint of a certificate",
-		UsageText: `**step certificate fingerprint** <crt-file>`,
+		Name:   "fingerprint",
+		Action: cli.ActionFunc(fingerprintAction),
+		Usage:  "print the fingerprint of a certificate",
+		UsageText: `**step certificate fingerprint** <crt-file> [**--bundle**]
+[**--spki**] [**--format**=<format>] [**--roots**=<root-bundle>]
+[**--roots-password-file**=<file>] [**--insecure**] [**--servername**=<name>]
+[**--starttls**=<protocol>] [**--client-cert**=<file>] [**--client-key**=<file>]`,
 		Description: `**step certificate fingerprint** reads a certificate and prints to STDOUT the
 certificate SHA256 of the raw certificate.
 
@@ -24,6 +29,10 @@ If <crt-file> contains multiple certificates (i.e., it is a certificate
 printed. Pass the --bundle option to print all fingerprints in the order in
 which they appear in the bundle.
 
+Pass the --spki option to print the SHA256 of the subject public key info
+instead, the value used in HPKP-style pins. Pins do not change if the
+certificate is renewed with the same key.
+
 ## POSITIONAL ARGUMENTS
 
 <crt-file>
@@ -48,6 +57,21 @@ Get the fingerprints for a remote certificate with its intemediate:
 $ step certificate fingerprint --bundle https://smallstep.com
 e2c4f12edfc1816cc610755d32e6f45d5678ba21ecda1693bb5b246e3c48c03d
 25847d668eb4f04fdd40b12b6b0740c567da7d024308eb6c2c96fe41d9de218d
+'''
+
+Get the SPKI pin of a remote certificate in base64 format:
+'''
+$ step certificate fingerprint https://smallstep.com --spki --format base64
+'''
+
+Get the fingerprint of a root certificate as emojis to compare it visually:
+'''
+$ step certificate fingerprint /path/to/root_ca.crt --format emoji
+'''
+
+Get the fingerprint for the certificate of a mail server using STARTTLS:
+'''
+$ step certificate fingerprint smtp.example.com:587 --starttls smtp
 '''`,
 		Flags: []cli.Flag{
 			cli.StringFlag{
@@ -66,15 +90,43 @@ authenticity of the remote server.
     **directory**
 	:  Relative or full path to a directory. Every PEM encoded certificate from each file in the directory will be used for path validation.`,
 			},
+			rootsPasswordFileFlag,
 			cli.BoolFlag{
 				Name:  `bundle`,
 				Usage: `Print all fingerprints in the order in which they appear in the bundle.`,
 			},
+			cli.BoolFlag{
+				Name:  "spki",
+				Usage: `Print the SHA256 of the subject public key info instead of the certificate.`,
+			},
+			cli.StringFlag{
+				Name:  "format",
+				Value: "hex",
+				Usage: `The <format> of the fingerprint.
+
+: <format> is a string and must be one of:
+
+    **hex**
+    :  Print the fingerprint in lowercase hexadecimal.
+
+    **base64**
+    :  Print the fingerprint in standard base64 with padding.
+
+    **base64url**
+    :  Print the fingerprint in URL safe base64 without padding.
+
+    **emoji**
+    :  Print the fingerprint as a list of emojis, one for each byte.`,
+			},
 			cli.BoolFlag{
 				Name: "insecure",
 				Usage: `Use an insecure client to retrieve a remote peer certificate. Useful for
 debugging invalid certificates remotely.`,
 			},
+			serverNameFlag,
+			startTLSFlag,
+			clientCertFlag,
+			clientKeyFlag,
 		},
 	}
 }
@@ -85,16 +137,26 @@ func fingerprintAction(ctx *cli.Context) error {
 	}
 
 	var (
-		certs    []*x509.Certificate
-		err      error
-		roots    = ctx.String("roots")
-		bundle   = ctx.Bool("bundle")
-		insecure = ctx.Bool("insecure")
-		crtFile  = ctx.Args().First()
+		certs   []*x509.Certificate
+		err     error
+		bundle  = ctx.Bool("bundle")
+		spki    = ctx.Bool("spki")
+		format  = ctx.String("format")
+		crtFile = ctx.Args().First()
 	)
 
-	if _, addr, isURL := trimURLPrefix(crtFile); isURL {
-		certs, err = getPeerCertificates(addr, roots, insecure)
+	switch format {
+	case "hex", "base64", "base64url", "emoji":
+	default:
+		return errs.InvalidFlagValue(ctx, "format", format, strings.Join(x509util.FingerprintEncodings, ", "))
+	}
+
+	if _, addr, isURL := trimRemotePrefix(ctx, crtFile); isURL {
+		opts, err := newRemoteOptions(ctx)
+		if err != nil {
+			return err
+		}
+		certs, err = getPeerCertificates(addr, opts)
 		if err != nil {
 			return err
 		}
@@ -110,10 +172,21 @@ func fingerprintAction(ctx *cli.Context) error {
 	}
 
 	for i, crt := range certs {
+		var sum []byte
+		if spki {
+			sum = x509util.SPKIFingerprint(crt)
+		} else {
+			b := sha256.Sum256(crt.Raw)
+			sum = b[:]
+		}
+		fp, err := x509util.EncodeFingerprint(sum, format)
+		if err != nil {
+			return err
+		}
 		if bundle {
-			fmt.Printf("%d: %s\n", i, x509util.Fingerprint(crt))
+			fmt.Printf("%d: %s\n", i, fp)
 		} else {
-			fmt.Println(x509util.Fingerprint(crt))
+			fmt.Println(fp)
 		}
 	}
 	return nil
@@ -2,12 +2,16 @@ package certificate
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/x509"
 	"encoding/pem"
 	"os"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/keys"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/x509util"
 	"github.com/smallstep/cli/errs"
 	"github.com/smallstep/cli/flags"
 	"github.com/smallstep/cli/ui"
@@ -17,15 +21,26 @@ import (
 
 func formatCommand() cli.Command {
 	return cli.Command{
-		Name:      "format",
-		Action:    command.ActionFunc(formatAction),
-		Usage:     `reformat certificate`,
-		UsageText: `**step certificate format** <crt_file> [**--out**=<path>]`,
+		Name:   "format",
+		Action: command.ActionFunc(formatAction),
+		Usage:  `reformat certificate`,
+		UsageText: `**step certificate format** <crt_file> [**--out**=<path>]
+[**--format**=<format>] [**--key**=<file>] [**--alias**=<name>]
+[**--keystore-password-file**=<file>]`,
 		Description: `**step certificate format** prints the certificate in
 a different format.
 
-Only 2 formats are currently supported; PEM and ASN.1 DER. This tool will convert
-a certificate in one format to the other.
+The supported formats are PEM, ASN.1 DER and PKCS#7 (also known as .p7b or
+.p7c) in PEM or DER encoding. By default, this tool will convert a PEM
+certificate to DER, a DER certificate to PEM, and a PKCS#7 file or a Java
+KeyStore to a PEM bundle. Use the **--format** flag to select a different
+output format. The integrity of a Java KeyStore is verified using the password
+in **--keystore-password-file**, or the user is prompted for it.
+
+Java KeyStores (JKS or JCEKS) and Kubernetes manifests can also be created.
+If a private key is given using the **--key** flag, the keystore will contain
+the key with the certificate and its chain, otherwise all the certificates are
+added as trusted certificates, creating a truststore.
 
 ## POSITIONAL ARGUMENTS
 
@@ -52,12 +67,84 @@ Convert PEM format to DER and write to disk.
 '''
 $ step certificate format foo.pem --out foo.der
 '''
+
+Convert a PEM bundle to PKCS#7.
+'''
+$ step certificate format foo-bundle.crt --format p7b --out foo.p7b
+'''
+
+Convert PKCS#7 to a PEM bundle.
+'''
+$ step certificate format foo.p7b --out foo-bundle.crt
+'''
+
+Create a Java truststore with a root certificate.
+'''
+$ step certificate format root_ca.crt --format jks --alias root-ca \
+  --keystore-password-file password.txt --out truststore.jks
+'''
+
+Create a Java keystore with a certificate, its chain and its private key.
+'''
+$ step certificate format foo-bundle.crt --key foo.key --format jks \
+  --keystore-password-file password.txt --out foo.jks
+'''
+
+Create a Kubernetes TLS Secret and apply it.
+'''
+$ step certificate format foo-bundle.crt --key foo.key --format k8s-secret --alias foo-tls \
+  | kubectl apply -f -
+'''
+
+Create a Kubernetes ConfigMap with a trust bundle.
+'''
+$ step certificate format roots.crt --format k8s-configmap --alias trust-bundle --out trust-bundle.yaml
+'''
 `,
 		Flags: []cli.Flag{
 			cli.StringFlag{
 				Name:  "out",
 				Usage: `Path to write the reformatted result.`,
 			},
+			cli.StringFlag{
+				Name: "format",
+				Usage: `The <format> of the output.
+
+: <format> is a string and must be one of:
+
+    **pem**
+    :  PEM format, all the certificates are written.
+
+    **der**
+    :  ASN.1 DER format, only the first certificate is written.
+
+    **p7b**
+    :  PKCS#7 in DER format, all the certificates are written.
+
+    **p7b-pem**
+    :  PKCS#7 in PEM format, all the certificates are written.
+
+    **jks**
+    :  Java KeyStore, with the private key if **--key** is used, or a truststore
+    with all the certificates.
+
+    **jceks**
+    :  Java JCEKS keystore, like **jks** but the private key is protected with 3DES.
+
+    **k8s-secret**
+    :  Kubernetes Secret of type kubernetes.io/tls in YAML format, requires **--key**.
+
+    **k8s-configmap**
+    :  Kubernetes ConfigMap in YAML format with all the certificates in the ca.crt
+    key.`,
+			},
+			cli.StringFlag{
+				Name: "key",
+				Usage: `The path to the private key <file> of the certificate, used with the formats
+jks, jceks and k8s-secret.`,
+			},
+			flags.Alias,
+			flags.KeystorePasswordFile,
 			flags.Force,
 		},
 	}
@@ -71,6 +158,8 @@ func formatAction(ctx *cli.Context) error {
 	var (
 		crtFile = ctx.Args().Get(0)
 		out     = ctx.String("out")
+		format  = ctx.String("format")
+		certs   []*x509.Certificate
 		ob      []byte
 	)
 
@@ -80,11 +169,29 @@ func formatAction(ctx *cli.Context) error {
 	}
 
 	switch {
+	case pemutil.IsJKS(crtBytes): // Java KeyStore format
+		opts := []pemutil.Options{pemutil.WithFilename(crtFile)}
+		if passwordFile := ctx.String("keystore-password-file"); passwordFile != "" {
+			opts = append(opts, pemutil.WithPasswordFile(passwordFile))
+		}
+		if certs, err = pemutil.DecodeJKSCertificates(crtBytes, opts...); err != nil {
+			return errors.Wrapf(err, "error parsing %s", crtFile)
+		}
+		if len(certs) == 0 {
+			return errors.Errorf("%s does not contain trusted certificates", crtFile)
+		}
+		if format == "" {
+			format = "pem"
+		}
+	case pemutil.IsPKCS7(crtBytes): // PKCS#7 format
+		if certs, err = pemutil.ParsePKCS7(crtBytes); err != nil {
+			return errors.Wrapf(err, "error parsing %s", crtFile)
+		}
+		if format == "" {
+			format = "pem"
+		}
 	case bytes.HasPrefix(crtBytes, []byte("-----BEGIN ")): // PEM format
-		var (
-			blocks []*pem.Block
-			block  *pem.Block
-		)
+		var block *pem.Block
 		for len(crtBytes) > 0 {
 			block, crtBytes = pem.Decode(crtBytes)
 			if block == nil {
@@ -95,20 +202,88 @@ func formatAction(ctx *cli.Context) error {
 					"unexpected PEM block of type %s\n\n  expected type: "+
 					"CERTIFICATE", crtFile, block.Type)
 			}
-			blocks = append(blocks, block)
+			crt, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return err
+			}
+			certs = append(certs, crt)
+		}
+		if format == "" {
+			format = "der"
 		}
+	default: // assuming DER format
+		crt, err := x509.ParseCertificate(crtBytes)
+		if err != nil {
+			return errors.Wrapf(err, "error parsing %s", crtFile)
+		}
+		certs = append(certs, crt)
+		if format == "" {
+			format = "pem"
+		}
+	}
+
+	// Only keystores and secrets can contain private keys.
+	switch format {
+	case "jks", "jceks", "k8s-secret":
+	default:
+		if ctx.String("key") != "" {
+			return errs.IncompatibleFlagValue(ctx, "key", "format", format)
+		}
+	}
+
+	switch format {
+	case "pem":
+		for _, crt := range certs {
+			ob = append(ob, pem.EncodeToMemory(&pem.Block{
+				Type:  "CERTIFICATE",
+				Bytes: crt.Raw,
+			})...)
+		}
+	case "der":
 		// Only format the first certificate in the chain.
-		crt, err := x509.ParseCertificate(blocks[0].Bytes)
+		ob = certs[0].Raw
+	case "p7b", "p7b-pem":
+		if ob, err = pemutil.EncodePKCS7(certs); err != nil {
+			return err
+		}
+		if format == "p7b-pem" {
+			ob = pem.EncodeToMemory(&pem.Block{
+				Type:  pemutil.PKCS7Type,
+				Bytes: ob,
+			})
+		}
+	case "jks", "jceks":
+		key, err := readFormatKey(ctx, certs[0])
 		if err != nil {
 			return err
 		}
-		ob = crt.Raw
-	default: // assuming DER format
-		p := &pem.Block{
-			Type:  "CERTIFICATE",
-			Bytes: crtBytes,
+		password, err := readKeystorePassword(ctx)
+		if err != nil {
+			return err
+		}
+		if ob, err = pemutil.EncodeJKS(key, certs[0], certs[1:], password, &pemutil.JKSOptions{
+			Alias: ctx.String("alias"),
+			JCEKS: format == "jceks",
+		}); err != nil {
+			return err
 		}
-		ob = pem.EncodeToMemory(p)
+	case "k8s-secret":
+		if ctx.String("key") == "" {
+			return errs.RequiredWithFlagValue(ctx, "format", format, "key")
+		}
+		key, err := readFormatKey(ctx, certs[0])
+		if err != nil {
+			return err
+		}
+		if ob, err = x509util.EncodeKubernetesSecret(ctx.String("alias"), key, certs[0], certs[1:]); err != nil {
+			return err
+		}
+	case "k8s-configmap":
+		if ob, err = x509util.EncodeKubernetesConfigMap(ctx.String("alias"), certs); err != nil {
+			return err
+		}
+	default:
+		return errs.InvalidFlagValue(ctx, "format", format, "pem, der, p7b, p7b-pem, jks, jceks, k8s-secret, k8s-configmap")
 	}
 
 	if out == "" {
@@ -118,7 +293,12 @@ func formatAction(ctx *cli.Context) error {
 		if err != nil {
 			return err
 		}
-		if err := utils.WriteFile(out, ob, info.Mode()); err != nil {
+		// Private keys are not written with the permissions of the certificate.
+		mode := info.Mode()
+		if ctx.String("key") != "" {
+			mode = 0600
+		}
+		if err := utils.WriteFile(out, ob, mode); err != nil {
 			return err
 		}
 		ui.Printf("Your certificate has been saved in %s.\n", out)
@@ -126,3 +306,36 @@ func formatAction(ctx *cli.Context) error {
 
 	return nil
 }
+
+// readFormatKey reads the private key in the --key flag and verifies that it
+// matches the certificate. It returns nil if the flag is not set.
+func readFormatKey(ctx *cli.Context, crt *x509.Certificate) (interface{}, error) {
+	keyFile := ctx.String("key")
+	if keyFile == "" {
+		return nil, nil
+	}
+	key, err := pemutil.Read(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := key.(crypto.Signer); !ok {
+		return nil, errors.Errorf("file %s does not contain a private key", keyFile)
+	}
+	if err := keys.VerifyPair(crt.PublicKey, key); err != nil {
+		return nil, errors.Wrapf(err, "error verifying %s", keyFile)
+	}
+	return key, nil
+}
+
+// readKeystorePassword returns the password in the --keystore-password-file
+// flag or prompts the user for one.
+func readKeystorePassword(ctx *cli.Context) ([]byte, error) {
+	if passwordFile := ctx.String("keystore-password-file"); passwordFile != "" {
+		return utils.ReadPasswordFromFile(passwordFile)
+	}
+	password, err := ui.PromptPassword("Please enter a password to protect the keystore")
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading password")
+	}
+	return password, nil
+}
@@ -7,9 +7,11 @@ import (
 	"encoding/pem"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/certinfo"
+	"github.com/smallstep/cli/crypto/pemutil"
 	"github.com/smallstep/cli/errs"
 	"github.com/smallstep/cli/utils"
 	zx509 "github.com/smallstep/zcrypto/x509"
@@ -22,7 +24,10 @@ func inspectCommand() cli.Command {
 		Action: cli.ActionFunc(inspectAction),
 		Usage:  `print certificate or CSR details in human readable format`,
 		UsageText: `**step certificate inspect** <crt_file>
-[**--bundle**] [**--short**] [**--format**=<format>] [**--roots**=<root-bundle>]`,
+[**--bundle**] [**--short**] [**--format**=<format>] [**--roots**=<root-bundle>]
+[**--roots-password-file**=<file>] [**--ct-log-list**=<file>] [**--insecure**]
+[**--servername**=<name>]
+[**--starttls**=<protocol>] [**--client-cert**=<file>] [**--client-key**=<file>]`,
 		Description: `**step certificate inspect** prints the details of a certificate
 or CSR in a human readable format. Output from the inspect command is printed to
 STDERR instead of STDOUT unless. This is an intentional barrier to accidental
@@ -33,6 +38,18 @@ If crt_file contains multiple certificates (i.e., it is a certificate "bundle")
 the first certificate in the bundle will be output. Pass the --bundle option to
 print all certificates in the order in which they appear in the bundle.
 
+Certificates in PEM and DER format, and certificate bundles in PKCS#7 format
+(also known as .p7b or .p7c files) are automatically detected.
+
+In text format, the signed certificate timestamps (SCTs) of the first
+certificate are also printed. For remote certificates, these include the SCTs
+sent by the server in the TLS extension and in the stapled OCSP response, in
+addition to the ones embedded in the certificate. The negotiated protocol
+version, cipher suite and ALPN protocol of the connection are printed too.
+
+Remote servers that use STARTTLS, like mail or database servers, are supported
+using the '--starttls' flag. In this case the URL prefix can be omitted.
+
 ## POSITIONAL ARGUMENTS
 
 <crt_file>
@@ -56,6 +73,12 @@ Inspect a local certificate bundle (default to text format):
 $ step certificate inspect ./certificate-bundle.crt --bundle
 '''
 
+Inspect all the certificates in a PKCS#7 file:
+
+'''
+$ step certificate inspect ./certificate.p7b --bundle
+'''
+
 Inspect a local certificate in json format:
 
 '''
@@ -114,6 +137,38 @@ $ step certificate inspect https://google.com --format json \
 --roots "./path/to/root/certificates/" --bundle
 '''
 
+Inspect a remote certificate and verify its SCTs using a local copy of a
+certificate transparency log list:
+
+'''
+$ step certificate inspect https://smallstep.com --ct-log-list ./log_list.json
+'''
+
+Inspect the certificate of a server behind a load balancer that routes by SNI:
+
+'''
+$ step certificate inspect https://10.0.0.10 --servername api.example.com
+'''
+
+Inspect the certificate of a mail server using STARTTLS:
+
+'''
+$ step certificate inspect smtp.example.com --starttls smtp
+'''
+
+Inspect the certificate of a PostgreSQL server listening in a custom port:
+
+'''
+$ step certificate inspect db.example.com:5433 --starttls postgres
+'''
+
+Inspect the certificate of a server that requires a client certificate:
+
+'''
+$ step certificate inspect https://mtls.example.com \
+--client-cert client.crt --client-key client.key
+'''
+
 Inspect a local CSR in text format (default):
 
 '''
@@ -156,12 +211,19 @@ authenticity of the remote server.
     **directory**
 	:  Relative or full path to a directory. Every PEM encoded certificate from each file in the directory will be used for path validation.`,
 			},
+			rootsPasswordFileFlag,
 			cli.BoolFlag{
 				Name: `bundle`,
 				Usage: `Print all certificates in the order in which they appear in the bundle.
 If the output format is 'json' then output a list of certificates, even if
 the bundle only contains one certificate. This flag will result in an error
 if the input bundle includes any PEM that does not have type CERTIFICATE.`,
+			},
+			cli.StringFlag{
+				Name: "ct-log-list",
+				Usage: `The <file> with the list of trusted certificate transparency logs, in the
+JSON format of the Chrome log lists, used to print the name of the logs and to
+verify the signed certificate timestamps of the certificate.`,
 			},
 			cli.BoolFlag{
 				Name:  "short",
@@ -172,6 +234,10 @@ if the input bundle includes any PEM that does not have type CERTIFICATE.`,
 				Usage: `Use an insecure client to retrieve a remote peer certificate. Useful for
 debugging invalid certificates remotely.`,
 			},
+			serverNameFlag,
+			startTLSFlag,
+			clientCertFlag,
+			clientKeyFlag,
 		},
 	}
 }
@@ -182,12 +248,10 @@ func inspectAction(ctx *cli.Context) error {
 	}
 
 	var (
-		crtFile  = ctx.Args().Get(0)
-		bundle   = ctx.Bool("bundle")
-		format   = ctx.String("format")
-		roots    = ctx.String("roots")
-		short    = ctx.Bool("short")
-		insecure = ctx.Bool("insecure")
+		crtFile = ctx.Args().Get(0)
+		bundle  = ctx.Bool("bundle")
+		format  = ctx.String("format")
+		short   = ctx.Bool("short")
 	)
 
 	if format != "text" && format != "json" {
@@ -197,14 +261,34 @@ func inspectAction(ctx *cli.Context) error {
 		return errs.IncompatibleFlagWithFlag(ctx, "short", "format json")
 	}
 
-	var block *pem.Block
-	var blocks []*pem.Block
-	if _, addr, isURL := trimURLPrefix(crtFile); isURL {
-		peerCertificates, err := getPeerCertificates(addr, roots, insecure)
+	checker, err := newCTChecker(ctx)
+	if err != nil {
+		return err
+	}
+
+	opts, err := newRemoteOptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	var (
+		block    *pem.Block
+		blocks   []*pem.Block
+		tlsSCTs  [][]byte
+		stapled  []byte
+		connInfo string
+	)
+	if prefix, addr, isURL := trimRemotePrefix(ctx, crtFile); isURL {
+		if strings.EqualFold(prefix, "https://") && opts.startTLS == "" {
+			opts.nextProtos = []string{"h2", "http/1.1"}
+		}
+		cs, err := getConnectionState(addr, opts)
 		if err != nil {
 			return err
 		}
-		for _, crt := range peerCertificates {
+		tlsSCTs, stapled = cs.SignedCertificateTimestamps, cs.OCSPResponse
+		connInfo = connectionStateText(cs)
+		for _, crt := range cs.PeerCertificates {
 			blocks = append(blocks, &pem.Block{
 				Type:  "CERTIFICATE",
 				Bytes: crt.Raw,
@@ -215,7 +299,18 @@ func inspectAction(ctx *cli.Context) error {
 		if err != nil {
 			return errs.FileError(err, crtFile)
 		}
-		if bytes.HasPrefix(crtBytes, []byte("-----BEGIN ")) {
+		if pemutil.IsPKCS7(crtBytes) {
+			certs, err := pemutil.ParsePKCS7(crtBytes)
+			if err != nil {
+				return errors.Wrapf(err, "error parsing %s", crtFile)
+			}
+			for _, crt := range certs {
+				blocks = append(blocks, &pem.Block{
+					Type:  "CERTIFICATE",
+					Bytes: crt.Raw,
+				})
+			}
+		} else if bytes.HasPrefix(crtBytes, []byte("-----BEGIN ")) {
 			for len(crtBytes) > 0 {
 				block, crtBytes = pem.Decode(crtBytes)
 				if block == nil {
@@ -235,6 +330,14 @@ func inspectAction(ctx *cli.Context) error {
 		}
 	}
 
+	// Signed certificate timestamps of the first certificate
+	var sctInfo string
+	if blocks[0].Type == "CERTIFICATE" && format == "text" && !short {
+		if sctInfo, err = inspectSCTs(blocks, checker, tlsSCTs, stapled); err != nil {
+			return err
+		}
+	}
+
 	// Keep the first one if !bundle
 	if !bundle {
 		blocks = []*pem.Block{blocks[0]}
@@ -242,7 +345,10 @@ func inspectAction(ctx *cli.Context) error {
 
 	switch blocks[0].Type {
 	case "CERTIFICATE":
-		return inspectCertificates(ctx, blocks)
+		if format == "text" && !short && connInfo != "" {
+			fmt.Print(connInfo)
+		}
+		return inspectCertificates(ctx, blocks, sctInfo)
 	case "CERTIFICATE REQUEST", "NEW CERTIFICATE REQUEST": // only one is supported
 		return inspectCertificateRequest(ctx, blocks[0])
 	default:
@@ -250,12 +356,12 @@ func inspectAction(ctx *cli.Context) error {
 	}
 }
 
-func inspectCertificates(ctx *cli.Context, blocks []*pem.Block) error {
+func inspectCertificates(ctx *cli.Context, blocks []*pem.Block, sctInfo string) error {
 	format, short := ctx.String("format"), ctx.Bool("short")
 	switch format {
 	case "text":
 		var text string
-		for _, block := range blocks {
+		for i, block := range blocks {
 			crt, err := x509.ParseCertificate(block.Bytes)
 			if err != nil {
 				return errors.WithStack(err)
@@ -270,6 +376,9 @@ func inspectCertificates(ctx *cli.Context, blocks []*pem.Block) error {
 				}
 			}
 			fmt.Print(text)
+			if i == 0 && sctInfo != "" {
+				fmt.Print(sctInfo)
+			}
 		}
 		return nil
 	case "json":
@@ -343,6 +452,35 @@ func inspectCertificateRequest(ctx *cli.Context, block *pem.Block) error {
 	}
 }
 
+// inspectSCTs returns the text with the signed certificate timestamps of the
+// first certificate in the blocks. The second certificate, if present, is
+// used as the issuer. It returns an empty string if there are no SCTs. If the
+// SCTs cannot be read, the text reports them as invalid so the certificate is
+// still printed.
+func inspectSCTs(blocks []*pem.Block, checker *ctChecker, tlsSCTs [][]byte, stapled []byte) (string, error) {
+	crt, err := x509.ParseCertificate(blocks[0].Bytes)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	var issuer *x509.Certificate
+	if len(blocks) > 1 && blocks[1].Type == "CERTIFICATE" {
+		if issuer, err = x509.ParseCertificate(blocks[1].Bytes); err != nil {
+			return "", errors.WithStack(err)
+		}
+		if crt.CheckSignatureFrom(issuer) != nil {
+			issuer = nil
+		}
+	}
+	scts, err := certificateSCTs(crt, issuer, tlsSCTs, stapled)
+	if err != nil {
+		return fmt.Sprintf("Signed Certificate Timestamps:\n    invalid: %v\n", err), nil
+	}
+	if len(scts) == 0 {
+		return "", nil
+	}
+	return sctText(scts, checker, crt, issuer), nil
+}
+
 // derToPemBlock attempts to parse the ASN.1 data as a certificate or a
 // certificate request, returning a pem.Block of the one that succeeds. Returns
 // nil if it cannot parse the data.
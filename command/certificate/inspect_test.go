@@ -0,0 +1,52 @@
+package certificate
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+func TestInspectSCTs_invalid(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{{
+			Id:    asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2},
+			Value: []byte("not an SCT list"),
+		}},
+	}
+	b, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	assert.FatalError(t, err)
+
+	// A malformed SCT list is reported but does not fail the inspection.
+	text, err := inspectSCTs([]*pem.Block{{Type: "CERTIFICATE", Bytes: b}}, nil, nil, nil)
+	assert.FatalError(t, err)
+	assert.True(t, strings.HasPrefix(text, "Signed Certificate Timestamps:\n    invalid: "))
+
+	// A malformed TLS SCT is also reported.
+	template.ExtraExtensions = nil
+	b, err = x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	assert.FatalError(t, err)
+	text, err = inspectSCTs([]*pem.Block{{Type: "CERTIFICATE", Bytes: b}}, nil, [][]byte{{0x01}}, nil)
+	assert.FatalError(t, err)
+	assert.True(t, strings.HasPrefix(text, "Signed Certificate Timestamps:\n    invalid: "))
+
+	// No SCTs
+	text, err = inspectSCTs([]*pem.Block{{Type: "CERTIFICATE", Bytes: b}}, nil, nil, nil)
+	assert.FatalError(t, err)
+	assert.Equals(t, "", text)
+}
@@ -1,26 +1,46 @@
 package certificate
 
 import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
+	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/cli/errs"
 	zx509 "github.com/smallstep/zcrypto/x509"
 	"github.com/smallstep/zlint"
+	"github.com/smallstep/zlint/lints"
 	"github.com/urfave/cli"
 )
 
 func lintCommand() cli.Command {
 	return cli.Command{
-		Name:      "lint",
-		Action:    cli.ActionFunc(lintAction),
-		Usage:     `lint certificate details`,
-		UsageText: `**step certificate lint** <crt_file> [**--roots**=<root-bundle>]`,
-		Description: `**step certificate lint** checks a certificate for common
-errors and outputs the result in JSON format.
+		Name:   "lint",
+		Action: cli.ActionFunc(lintAction),
+		Usage:  `lint certificate details`,
+		UsageText: `**step certificate lint** <crt_file> [**--roots**=<root-bundle>]
+[**--roots-password-file**=<file>] [**--format**=<format>] [**--min-severity**=<severity>] [**--bundle**]
+[**--include**=<lint>] [**--exclude**=<lint>] [**--insecure**]
+[**--servername**=<name>] [**--starttls**=<protocol>] [**--client-cert**=<file>]
+[**--client-key**=<file>]`,
+		Description: `**step certificate lint** checks a certificate or a certificate
+signing request (CSR) for common errors and outputs the result in JSON format.
+
+Certificates are checked using the zlint linters, including the ones specific
+to certificate authorities for intermediate and root certificates. CSRs are
+checked for invalid signatures, weak keys and algorithms, and missing subject
+alternative names.
 
 ## POSITIONAL ARGUMENTS
 
@@ -29,7 +49,9 @@ errors and outputs the result in JSON format.
 
 ## EXIT CODES
 
-This command returns 0 on success and \>0 if any error occurs.
+This command returns 0 on success and \>0 if any error occurs. If
+'--min-severity' is given, it also returns \>0 if any lint has a result with
+that severity or higher.
 
 ## EXAMPLES
 
@@ -61,6 +83,36 @@ Lint a remote certificate using a custom directory of root certificates to verif
 '''
 $ step certificate lint https://smallstep.com --roots "./path/to/certificates/"
 '''
+
+Lint all the certificates in a bundle and report only errors:
+
+'''
+$ step certificate lint ./certificate-bundle.crt --bundle --min-severity error
+'''
+
+Lint a certificate skipping the lints with names starting with 'w_ext_':
+
+'''
+$ step certificate lint ./certificate.crt --exclude 'w_ext_*'
+'''
+
+Lint the certificate of an LDAP server using STARTTLS:
+
+'''
+$ step certificate lint ldap.example.com --starttls ldap
+'''
+
+Lint a certificate signing request:
+
+'''
+$ step certificate lint ./certificate.csr
+'''
+
+Lint a certificate and print a table with the warnings and errors:
+
+'''
+$ step certificate lint ./certificate.crt --format text
+'''
 `,
 		Flags: []cli.Flag{
 			cli.StringFlag{
@@ -79,15 +131,107 @@ authenticity of the remote server.
     **directory**
 	:  Relative or full path to a directory. Every PEM encoded certificate from each file in the directory will be used for path validation.`,
 			},
+			rootsPasswordFileFlag,
 			cli.BoolFlag{
 				Name: "insecure",
 				Usage: `Use an insecure client to retrieve a remote peer certificate. Useful for
 debugging invalid certificates remotely.`,
 			},
+			serverNameFlag,
+			startTLSFlag,
+			clientCertFlag,
+			clientKeyFlag,
+			cli.StringFlag{
+				Name:  "format",
+				Value: "json",
+				Usage: `The output format for printing the lint results.
+
+: <format> is a string and must be one of:
+
+    **json**
+    :  Print the result of all the lints in JSON format. With '--bundle' an array
+    with the results of each certificate is printed. This is the default.
+
+    **text**
+    :  Print a table with the findings, suitable for a human to read.`,
+			},
+			cli.StringFlag{
+				Name:  "min-severity",
+				Value: "warn",
+				Usage: `The minimum <severity> of the findings to report in the text output.
+If this flag is given, the command fails if any lint has a result with this
+severity or higher. Defaults to 'warn'.
+
+: <severity> is a string and must be one of:
+
+    **notice**
+    :  Report notices, warnings, errors and fatal errors.
+
+    **warn**
+    :  Report warnings, errors and fatal errors.
+
+    **error**
+    :  Report errors and fatal errors.
+
+    **fatal**
+    :  Report fatal errors only.`,
+			},
+			cli.BoolFlag{
+				Name: "bundle",
+				Usage: `Lint all the certificates in the file, or all the certificates sent by the
+remote server, not only the first one.`,
+			},
+			cli.StringSliceFlag{
+				Name: "include",
+				Usage: `The name of the <lint> to run, shell patterns like 'e_ext_*' are supported.
+Use the '--include' flag multiple times to run multiple lints. Defaults to all
+the lints.`,
+			},
+			cli.StringSliceFlag{
+				Name: "exclude",
+				Usage: `The name of the <lint> to skip, shell patterns like 'n_*' are supported. Use
+the '--exclude' flag multiple times to skip multiple lints.`,
+			},
 		},
 	}
 }
 
+// lintSeverities maps the values of the --min-severity flag to a lint status.
+var lintSeverities = map[string]lints.LintStatus{
+	"notice": lints.Notice,
+	"warn":   lints.Warn,
+	"error":  lints.Error,
+	"fatal":  lints.Fatal,
+}
+
+// lintResultSet is the result of linting a certificate or a CSR.
+// The subject and type are only used in the text output, the JSON output is
+// the zlint result set.
+type lintResultSet struct {
+	Subject string `json:"-"`
+	Type    string `json:"-"`
+	*zlint.ResultSet
+}
+
+// findings returns the names of the lints with a result equal or higher than
+// the given severity, sorted by severity and name.
+func (r *lintResultSet) findings(min lints.LintStatus) []string {
+	var names []string
+	for name, res := range r.Results {
+		if res.Status >= min {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		si, sj := r.Results[names[i]].Status, r.Results[names[j]].Status
+		if si != sj {
+			return si > sj
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
 func lintAction(ctx *cli.Context) error {
 	if err := errs.NumberOfArguments(ctx, 1); err != nil {
 		return err
@@ -95,43 +239,290 @@ func lintAction(ctx *cli.Context) error {
 
 	var (
 		crtFile  = ctx.Args().Get(0)
-		roots    = ctx.String("roots")
-		insecure = ctx.Bool("insecure")
-		block    *pem.Block
+		format   = ctx.String("format")
+		severity = ctx.String("min-severity")
+		bundle   = ctx.Bool("bundle")
+		blocks   []*pem.Block
 	)
-	if _, addr, isURL := trimURLPrefix(crtFile); isURL {
-		peerCertificates, err := getPeerCertificates(addr, roots, insecure)
+
+	if format != "text" && format != "json" {
+		return errs.InvalidFlagValue(ctx, "format", format, "text, json")
+	}
+	minSeverity, ok := lintSeverities[severity]
+	if !ok {
+		return errs.InvalidFlagValue(ctx, "min-severity", severity, "notice, warn, error, fatal")
+	}
+	filter, err := newLintFilter(ctx.StringSlice("include"), ctx.StringSlice("exclude"))
+	if err != nil {
+		return err
+	}
+
+	if _, addr, isURL := trimRemotePrefix(ctx, crtFile); isURL {
+		opts, err := newRemoteOptions(ctx)
+		if err != nil {
+			return err
+		}
+		peerCertificates, err := getPeerCertificates(addr, opts)
 		if err != nil {
 			return err
 		}
-		crt := peerCertificates[0]
-		block = &pem.Block{
-			Type:  "CERTIFICATE",
-			Bytes: crt.Raw,
+		for _, crt := range peerCertificates {
+			blocks = append(blocks, &pem.Block{
+				Type:  "CERTIFICATE",
+				Bytes: crt.Raw,
+			})
 		}
 	} else {
 		crtBytes, err := ioutil.ReadFile(crtFile)
 		if err != nil {
 			return errs.FileError(err, crtFile)
 		}
-		block, _ = pem.Decode(crtBytes)
-		if block == nil {
+		var block *pem.Block
+		for len(crtBytes) > 0 {
+			block, crtBytes = pem.Decode(crtBytes)
+			if block == nil {
+				break
+			}
+			switch block.Type {
+			case "CERTIFICATE", "CERTIFICATE REQUEST", "NEW CERTIFICATE REQUEST":
+				blocks = append(blocks, block)
+			}
+		}
+		if len(blocks) == 0 {
 			return errors.Errorf("could not parse certificate file '%s'", crtFile)
 		}
 	}
+	if !bundle {
+		blocks = blocks[:1]
+	}
 
-	zcrt, err := zx509.ParseCertificate(block.Bytes)
-	if err != nil {
-		return errors.WithStack(err)
+	var results []*lintResultSet
+	for _, block := range blocks {
+		if block.Type == "CERTIFICATE" {
+			crt, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			zcrt, err := zx509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			results = append(results, lintCertificate(crt, zcrt, filter))
+		} else {
+			csr, err := x509.ParseCertificateRequest(block.Bytes)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			results = append(results, lintCSR(csr, filter))
+		}
 	}
-	zlintResult := zlint.LintCertificate(zcrt)
-	b, err := json.MarshalIndent(struct {
-		*zlint.ResultSet
-	}{zlintResult}, "", " ")
-	if err != nil {
-		return errors.WithStack(err)
+
+	switch format {
+	case "json":
+		var v interface{} = results[0]
+		if bundle {
+			v = results
+		}
+		b, err := json.MarshalIndent(v, "", " ")
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		os.Stdout.Write(b)
+	default:
+		printLintResults(results, minSeverity)
 	}
-	os.Stdout.Write(b)
 
+	if !ctx.IsSet("min-severity") {
+		return nil
+	}
+	var count int
+	for _, rs := range results {
+		count += len(rs.findings(minSeverity))
+	}
+	if count > 0 {
+		return errors.Errorf("found %d lint results with severity %s or higher", count, severity)
+	}
 	return nil
 }
+
+// lintFilter returns true if the lint with the given name must be run.
+type lintFilter func(name string) bool
+
+// newLintFilter returns a lintFilter using the given include and exclude
+// patterns.
+func newLintFilter(include, exclude []string) (lintFilter, error) {
+	for _, pattern := range append(include, exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.Errorf("invalid lint pattern '%s'", pattern)
+		}
+	}
+	match := func(name string, patterns []string) bool {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+		return false
+	}
+	return func(name string) bool {
+		if len(include) > 0 && !match(name, include) {
+			return false
+		}
+		return !match(name, exclude)
+	}, nil
+}
+
+// newLintResultSet creates a lintResultSet with the given results.
+func newLintResultSet(subject, typ string, results map[string]*lints.LintResult) *lintResultSet {
+	rs := &zlint.ResultSet{
+		Timestamp: time.Now().Unix(),
+		Results:   results,
+	}
+	for _, res := range results {
+		switch res.Status {
+		case lints.Notice:
+			rs.NoticesPresent = true
+		case lints.Warn:
+			rs.WarningsPresent = true
+		case lints.Error:
+			rs.ErrorsPresent = true
+		case lints.Fatal:
+			rs.FatalsPresent = true
+		}
+	}
+	return &lintResultSet{
+		Subject:   subject,
+		Type:      typ,
+		ResultSet: rs,
+	}
+}
+
+// lintCertificate runs the zlint lints that match the filter. Lints specific
+// to subscriber or CA certificates only apply to certificates of that type.
+func lintCertificate(crt *x509.Certificate, zcrt *zx509.Certificate, filter lintFilter) *lintResultSet {
+	results := make(map[string]*lints.LintResult)
+	for name, l := range lints.Lints {
+		if filter(name) {
+			results[name] = l.Execute(zcrt)
+		}
+	}
+
+	typ := "leaf"
+	if crt.IsCA {
+		if bytes.Equal(crt.RawSubject, crt.RawIssuer) {
+			typ = "root"
+		} else {
+			typ = "intermediate"
+		}
+	}
+	return newLintResultSet(crt.Subject.String(), typ, results)
+}
+
+// csrLints are the lints run on certificate signing requests.
+var csrLints = map[string]func(csr *x509.CertificateRequest) *lints.LintResult{
+	"e_csr_signature_invalid": func(csr *x509.CertificateRequest) *lints.LintResult {
+		if err := csr.CheckSignature(); err != nil {
+			return &lints.LintResult{Status: lints.Error, Details: err.Error()}
+		}
+		return &lints.LintResult{Status: lints.Pass}
+	},
+	"e_csr_signature_algorithm_weak": func(csr *x509.CertificateRequest) *lints.LintResult {
+		switch csr.SignatureAlgorithm {
+		case x509.MD2WithRSA, x509.MD5WithRSA, x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+			return &lints.LintResult{Status: lints.Error, Details: csr.SignatureAlgorithm.String()}
+		}
+		return &lints.LintResult{Status: lints.Pass}
+	},
+	"e_csr_rsa_key_too_small": func(csr *x509.CertificateRequest) *lints.LintResult {
+		key, ok := csr.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return &lints.LintResult{Status: lints.NA}
+		}
+		if bits := key.N.BitLen(); bits < 2048 {
+			return &lints.LintResult{Status: lints.Error, Details: fmt.Sprintf("RSA key has %d bits", bits)}
+		}
+		return &lints.LintResult{Status: lints.Pass}
+	},
+	"e_csr_empty_subject_and_sans": func(csr *x509.CertificateRequest) *lints.LintResult {
+		if len(csr.Subject.Names) == 0 && !csrHasSANs(csr) {
+			return &lints.LintResult{Status: lints.Error}
+		}
+		return &lints.LintResult{Status: lints.Pass}
+	},
+	"w_csr_missing_sans": func(csr *x509.CertificateRequest) *lints.LintResult {
+		if !csrHasSANs(csr) {
+			return &lints.LintResult{Status: lints.Warn}
+		}
+		return &lints.LintResult{Status: lints.Pass}
+	},
+	"w_csr_common_name_not_in_sans": func(csr *x509.CertificateRequest) *lints.LintResult {
+		cn := csr.Subject.CommonName
+		if cn == "" || !csrHasSANs(csr) {
+			return &lints.LintResult{Status: lints.NA}
+		}
+		for _, name := range append(csr.DNSNames, csr.EmailAddresses...) {
+			if strings.EqualFold(name, cn) {
+				return &lints.LintResult{Status: lints.Pass}
+			}
+		}
+		if ip := net.ParseIP(cn); ip != nil {
+			for _, v := range csr.IPAddresses {
+				if v.Equal(ip) {
+					return &lints.LintResult{Status: lints.Pass}
+				}
+			}
+		}
+		return &lints.LintResult{
+			Status:  lints.Warn,
+			Details: fmt.Sprintf("common name '%s' is not a subject alternative name", cn),
+		}
+	},
+}
+
+func csrHasSANs(csr *x509.CertificateRequest) bool {
+	return len(csr.DNSNames) > 0 || len(csr.IPAddresses) > 0 ||
+		len(csr.EmailAddresses) > 0 || len(csr.URIs) > 0
+}
+
+// lintCSR runs the CSR lints that match the filter.
+func lintCSR(csr *x509.CertificateRequest, filter lintFilter) *lintResultSet {
+	results := make(map[string]*lints.LintResult)
+	for name, fn := range csrLints {
+		if filter(name) {
+			results[name] = fn(csr)
+		}
+	}
+	return newLintResultSet(csr.Subject.String(), "csr", results)
+}
+
+// lintStatusString returns the name of a lint status used in the text output.
+func lintStatusString(s lints.LintStatus) string {
+	for name, status := range lintSeverities {
+		if s == status {
+			return name
+		}
+	}
+	return s.String()
+}
+
+// printLintResults prints a table with the findings of each certificate.
+func printLintResults(results []*lintResultSet, min lints.LintStatus) {
+	for i, rs := range results {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s (%s):\n", rs.Subject, rs.Type)
+		names := rs.findings(min)
+		if len(names) == 0 {
+			fmt.Println("    No findings.")
+			continue
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "    SEVERITY\tLINT\tDETAILS")
+		for _, name := range names {
+			res := rs.Results[name]
+			fmt.Fprintf(w, "    %s\t%s\t%s\n", lintStatusString(res.Status), name, res.Details)
+		}
+		w.Flush()
+	}
+}
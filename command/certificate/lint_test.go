@@ -0,0 +1,125 @@
+package certificate
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/zlint/lints"
+)
+
+func TestNewLintFilter(t *testing.T) {
+	tests := []struct {
+		name             string
+		include, exclude []string
+		lint             string
+		want             bool
+	}{
+		{"all", nil, nil, "e_csr_signature_invalid", true},
+		{"include", []string{"e_csr_signature_invalid"}, nil, "e_csr_signature_invalid", true},
+		{"include pattern", []string{"e_*"}, nil, "e_csr_signature_invalid", true},
+		{"not included", []string{"w_*"}, nil, "e_csr_signature_invalid", false},
+		{"exclude", nil, []string{"e_csr_*"}, "e_csr_signature_invalid", false},
+		{"include and exclude", []string{"e_*"}, []string{"e_csr_signature_invalid"}, "e_csr_signature_invalid", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := newLintFilter(tt.include, tt.exclude)
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.want, filter(tt.lint))
+		})
+	}
+
+	_, err := newLintFilter([]string{"[a-"}, nil)
+	assert.Error(t, err)
+}
+
+func TestLintCSR(t *testing.T) {
+	mustCSR := func(tmpl *x509.CertificateRequest, key interface{}) *x509.CertificateRequest {
+		b, err := x509.CreateCertificateRequest(rand.Reader, tmpl, key)
+		assert.FatalError(t, err)
+		csr, err := x509.ParseCertificateRequest(b)
+		assert.FatalError(t, err)
+		return csr
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.FatalError(t, err)
+
+	all := func(string) bool { return true }
+	tests := []struct {
+		name string
+		csr  *x509.CertificateRequest
+		want map[string]lints.LintStatus
+	}{
+		{"ok", mustCSR(&x509.CertificateRequest{
+			Subject:  pkix.Name{CommonName: "foo.example.com"},
+			DNSNames: []string{"foo.example.com"},
+		}, ecKey), map[string]lints.LintStatus{
+			"e_csr_signature_invalid":        lints.Pass,
+			"e_csr_signature_algorithm_weak": lints.Pass,
+			"e_csr_rsa_key_too_small":        lints.NA,
+			"e_csr_empty_subject_and_sans":   lints.Pass,
+			"w_csr_missing_sans":             lints.Pass,
+			"w_csr_common_name_not_in_sans":  lints.Pass,
+		}},
+		{"weak", mustCSR(&x509.CertificateRequest{
+			Subject:            pkix.Name{CommonName: "foo.example.com"},
+			SignatureAlgorithm: x509.SHA1WithRSA,
+		}, rsaKey), map[string]lints.LintStatus{
+			"e_csr_signature_invalid":        lints.Pass,
+			"e_csr_signature_algorithm_weak": lints.Error,
+			"e_csr_rsa_key_too_small":        lints.Error,
+			"e_csr_empty_subject_and_sans":   lints.Pass,
+			"w_csr_missing_sans":             lints.Warn,
+			"w_csr_common_name_not_in_sans":  lints.NA,
+		}},
+		{"names", mustCSR(&x509.CertificateRequest{
+			Subject:  pkix.Name{CommonName: "foo.example.com"},
+			DNSNames: []string{"bar.example.com"},
+		}, ecKey), map[string]lints.LintStatus{
+			"w_csr_common_name_not_in_sans": lints.Warn,
+		}},
+		{"empty", mustCSR(&x509.CertificateRequest{}, ecKey), map[string]lints.LintStatus{
+			"e_csr_empty_subject_and_sans": lints.Error,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := lintCSR(tt.csr, all)
+			assert.Equals(t, "csr", rs.Type)
+			for name, status := range tt.want {
+				res, ok := rs.Results[name]
+				assert.True(t, ok)
+				assert.Equals(t, status, res.Status, name)
+			}
+		})
+	}
+
+	rs := lintCSR(mustCSR(&x509.CertificateRequest{}, ecKey), func(name string) bool {
+		return name == "w_csr_missing_sans"
+	})
+	assert.Len(t, 1, rs.Results)
+	assert.True(t, rs.WarningsPresent)
+	assert.False(t, rs.ErrorsPresent)
+	assert.Equals(t, []string{"w_csr_missing_sans"}, rs.findings(lints.Warn))
+	assert.Len(t, 0, rs.findings(lints.Error))
+}
+
+func TestLintResultSet_JSON(t *testing.T) {
+	rs := newLintResultSet("CN=foo", "leaf", map[string]*lints.LintResult{
+		"w_csr_missing_sans": {Status: lints.Warn},
+	})
+	b, err := json.Marshal(rs)
+	assert.FatalError(t, err)
+	want, err := json.Marshal(rs.ResultSet)
+	assert.FatalError(t, err)
+	assert.Equals(t, string(want), string(b))
+}
@@ -0,0 +1,410 @@
+package certificate
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/errs"
+	"github.com/urfave/cli"
+)
+
+// needsRenewalErrorCode is the exit code used by needs-renewal if an error
+// occurs, 0 and 1 are used to indicate if the renewal is needed.
+const needsRenewalErrorCode = 255
+
+func needsRenewalCommand() cli.Command {
+	return cli.Command{
+		Name:   "needs-renewal",
+		Action: cli.ActionFunc(needsRenewalAction),
+		// Usage errors must not use the exit code 1, renewal not needed.
+		OnUsageError: func(ctx *cli.Context, err error, isSubcommand bool) error {
+			return errs.NewExitError(err, needsRenewalErrorCode)
+		},
+		Usage: "check if a certificate needs to be renewed",
+		UsageText: `**step certificate needs-renewal** <crt_file|dir|glob|url>
+[**--expires-in**=<duration|percent>] [**--format**=<format>] [**--verbose**]
+[**--roots**=<root-bundle>] [**--roots-password-file**=<file>] [**--insecure**]
+[**--servername**=<name>] [**--starttls**=<protocol>]`,
+		Description: `**step certificate needs-renewal** checks if a certificate needs to
+be renewed. It's meant to be used in scripts, the result is indicated using the
+exit code.
+
+A certificate needs to be renewed if the time remaining before its expiration
+is lower than the value of '--expires-in'. By default, as in **step ca renew**,
+a certificate needs to be renewed after 2/3 of its validity period have
+elapsed. Expired certificates always need to be renewed.
+
+## POSITIONAL ARGUMENTS
+
+<crt_file|dir|glob|url>
+:  The path to a certificate, a directory with certificates, a shell pattern
+like '/etc/certs/*.crt', or the address of a remote server. Certificates in
+PEM, DER and PKCS#7 format are supported. For files with multiple certificates
+only the first one is checked. In directories, the files without certificates
+are ignored.
+
+## EXIT CODES
+
+This command returns 0 if the certificate, or any of the certificates, needs
+to be renewed, 1 if the renewal is not needed, and 255 if any error occurs.
+
+## EXAMPLES
+
+Check if a certificate needs to be renewed:
+
+'''
+$ step certificate needs-renewal ./certificate.crt
+'''
+
+Renew a certificate if it expires in less than 8 hours:
+
+'''
+$ step certificate needs-renewal ./certificate.crt --expires-in 8h && \
+  step ca renew --force ./certificate.crt ./certificate.key
+'''
+
+Check if a certificate has less than 10% of its lifetime remaining and print the
+time remaining:
+
+'''
+$ step certificate needs-renewal ./certificate.crt --expires-in 10% --verbose
+'''
+
+Check the certificates in a directory and print the results in JSON:
+
+'''
+$ step certificate needs-renewal /etc/ssl/mycerts --format json
+'''
+
+Check the certificates matching a pattern:
+
+'''
+$ step certificate needs-renewal '/etc/ssl/mycerts/*.crt' --expires-in 720h
+'''
+
+Check the certificate of a remote server:
+
+'''
+$ step certificate needs-renewal https://smallstep.com --expires-in 720h
+'''
+
+Check the certificate of a mail server using STARTTLS:
+
+'''
+$ step certificate needs-renewal smtp.example.com:587 --starttls smtp
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name: "expires-in",
+				Usage: `The amount of time remaining before the certificate expiration at which point
+a renewal is needed. The value can be a <duration> or a <percent> of the
+validity period of the certificate. The <duration> is a sequence of decimal
+numbers, each with optional fraction and a unit suffix, such as "300ms", "-1.5h"
+or "2h45m". Valid time units are "ns", "us" (or "µs"), "ms", "s", "m", "h". The
+<percent> is a number followed by '%', e.g. "25%". Defaults to 1/3 of the
+validity period.`,
+			},
+			cli.StringFlag{
+				Name: "format",
+				Usage: `The <format> used to print the result of each certificate.
+
+: <format> is a string and must be one of:
+
+    **text**
+    :  Print the time remaining of each certificate, like '--verbose'.
+
+    **json**
+    :  Print an array with the result of each certificate in JSON format.`,
+			},
+			cli.BoolFlag{
+				Name:  "verbose",
+				Usage: `Print the time remaining before the expiration of each certificate.`,
+			},
+			cli.StringFlag{
+				Name: "roots",
+				Usage: `Root certificate(s) that will be used to verify the
+authenticity of the remote server.
+
+: <roots> is a case-sensitive string and may be one of:
+
+    **file**
+	:  Relative or full path to a file. All certificates in the file will be used for path validation.
+
+    **list of files**
+	:  Comma-separated list of relative or full file paths. Every PEM encoded certificate from each file will be used for path validation.
+
+    **directory**
+	:  Relative or full path to a directory. Every PEM encoded certificate from each file in the directory will be used for path validation.`,
+			},
+			rootsPasswordFileFlag,
+			cli.BoolFlag{
+				Name: "insecure",
+				Usage: `Use an insecure client to retrieve a remote peer certificate. Useful to check
+expired or invalid certificates remotely.`,
+			},
+			serverNameFlag,
+			startTLSFlag,
+		},
+	}
+}
+
+// renewalThreshold is the parsed value of the --expires-in flag. Only one of
+// the properties is set, if none is set the default of 1/3 of the validity
+// period is used.
+type renewalThreshold struct {
+	duration time.Duration
+	percent  float64
+}
+
+// parseRenewalThreshold parses a duration or a percent like "25%".
+func parseRenewalThreshold(s string) (renewalThreshold, error) {
+	if s == "" {
+		return renewalThreshold{}, nil
+	}
+	if strings.HasSuffix(s, "%") {
+		p, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		if err != nil || p <= 0 || p > 100 {
+			return renewalThreshold{}, errors.Errorf("invalid percent '%s'", s)
+		}
+		return renewalThreshold{percent: p}, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return renewalThreshold{}, errors.Errorf("invalid duration '%s'", s)
+	}
+	return renewalThreshold{duration: d}, nil
+}
+
+// expiresIn returns the time before the expiration of the given certificate
+// at which the renewal is needed.
+func (t renewalThreshold) expiresIn(crt *x509.Certificate) time.Duration {
+	period := crt.NotAfter.Sub(crt.NotBefore)
+	switch {
+	case t.duration > 0:
+		return t.duration
+	case t.percent > 0:
+		return time.Duration(float64(period) * t.percent / 100)
+	default:
+		return period / 3
+	}
+}
+
+// renewalStatus is the result of checking a certificate.
+type renewalStatus struct {
+	Name             string    `json:"name"`
+	Subject          string    `json:"subject"`
+	NotBefore        time.Time `json:"not_before"`
+	NotAfter         time.Time `json:"not_after"`
+	Remaining        string    `json:"remaining"`
+	RemainingPercent float64   `json:"remaining_percent"`
+	NeedsRenewal     bool      `json:"needs_renewal"`
+}
+
+// newRenewalStatus checks if the certificate needs to be renewed at the given
+// time.
+func newRenewalStatus(name string, crt *x509.Certificate, t renewalThreshold, now time.Time) renewalStatus {
+	remaining := crt.NotAfter.Sub(now)
+	if remaining < 0 {
+		remaining = 0
+	}
+	var percent float64
+	if period := crt.NotAfter.Sub(crt.NotBefore); period > 0 {
+		percent = float64(remaining) * 100 / float64(period)
+		if percent > 100 {
+			percent = 100
+		}
+	}
+	return renewalStatus{
+		Name:             name,
+		Subject:          crt.Subject.String(),
+		NotBefore:        crt.NotBefore,
+		NotAfter:         crt.NotAfter,
+		Remaining:        remaining.Round(time.Second).String(),
+		RemainingPercent: float64(int(percent*100)) / 100,
+		NeedsRenewal:     remaining <= t.expiresIn(crt),
+	}
+}
+
+func needsRenewalAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 1); err != nil {
+		return errs.NewExitError(err, needsRenewalErrorCode)
+	}
+	statuses, err := needsRenewal(ctx)
+	if err != nil {
+		return errs.NewExitError(err, needsRenewalErrorCode)
+	}
+
+	var needed bool
+	for _, st := range statuses {
+		needed = needed || st.NeedsRenewal
+	}
+	if !needed {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// needsRenewal checks the certificates and prints the results in the format
+// requested.
+func needsRenewal(ctx *cli.Context) ([]renewalStatus, error) {
+	var (
+		arg     = ctx.Args().Get(0)
+		format  = ctx.String("format")
+		verbose = ctx.Bool("verbose")
+		now     = time.Now()
+	)
+
+	switch format {
+	case "", "text", "json":
+	default:
+		return nil, errs.InvalidFlagValue(ctx, "format", format, "text, json")
+	}
+	threshold, err := parseRenewalThreshold(ctx.String("expires-in"))
+	if err != nil {
+		return nil, errs.InvalidFlagValue(ctx, "expires-in", ctx.String("expires-in"), "")
+	}
+
+	var statuses []renewalStatus
+	if _, addr, isURL := trimRemotePrefix(ctx, arg); isURL {
+		opts, err := newRemoteOptions(ctx)
+		if err != nil {
+			return nil, err
+		}
+		peerCertificates, err := getPeerCertificates(addr, opts)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, newRenewalStatus(arg, peerCertificates[0], threshold, now))
+	} else {
+		files, err := renewalFiles(arg)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			crt, err := readFirstCertificate(f.name)
+			switch {
+			case err != nil && f.optional:
+				continue
+			case err != nil:
+				return nil, err
+			}
+			statuses = append(statuses, newRenewalStatus(f.name, crt, threshold, now))
+		}
+		if len(statuses) == 0 {
+			return nil, errors.Errorf("no certificates found in %s", arg)
+		}
+	}
+
+	switch {
+	case format == "json":
+		b, err := json.MarshalIndent(statuses, "", "  ")
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		fmt.Println(string(b))
+	case format == "text" || verbose:
+		for _, st := range statuses {
+			if st.NeedsRenewal {
+				fmt.Printf("%s: certificate expires in %s (%.2f%% of its lifetime), renewal is needed\n",
+					st.Name, st.Remaining, st.RemainingPercent)
+			} else {
+				fmt.Printf("%s: certificate expires in %s (%.2f%% of its lifetime), renewal is not needed\n",
+					st.Name, st.Remaining, st.RemainingPercent)
+			}
+		}
+	}
+	return statuses, nil
+}
+
+// renewalFile is a file to check. Optional files are the ones found in a
+// directory or using a pattern, and they are skipped if they don't contain a
+// certificate.
+type renewalFile struct {
+	name     string
+	optional bool
+}
+
+// renewalFiles returns the files in the given path, that can be a file, a
+// directory, or a shell pattern.
+func renewalFiles(path string) ([]renewalFile, error) {
+	info, err := os.Stat(path)
+	switch {
+	case err == nil && info.IsDir():
+		finfos, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, errs.FileError(err, path)
+		}
+		var files []renewalFile
+		for _, fi := range finfos {
+			if !fi.IsDir() {
+				files = append(files, renewalFile{name: filepath.Join(path, fi.Name()), optional: true})
+			}
+		}
+		return files, nil
+	case err == nil:
+		return []renewalFile{{name: path}}, nil
+	case os.IsNotExist(err) && strings.ContainsAny(path, "*?["):
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid pattern '%s'", path)
+		}
+		var files []renewalFile
+		for _, m := range matches {
+			if fi, err := os.Stat(m); err == nil && !fi.IsDir() {
+				files = append(files, renewalFile{name: m, optional: true})
+			}
+		}
+		return files, nil
+	default:
+		return nil, errs.FileError(err, path)
+	}
+}
+
+// readFirstCertificate returns the first certificate in a PEM, DER or PKCS#7
+// file.
+func readFirstCertificate(filename string) (*x509.Certificate, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errs.FileError(err, filename)
+	}
+	if pemutil.IsPKCS7(b) {
+		certs, err := pemutil.ParsePKCS7(b)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing %s", filename)
+		}
+		return certs[0], nil
+	}
+	if block, _ := pem.Decode(b); block == nil {
+		crt, err := x509.ParseCertificate(b)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing %s", filename)
+		}
+		return crt, nil
+	}
+	var block *pem.Block
+	for len(b) > 0 {
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		crt, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing certificate in %s", filename)
+		}
+		return crt, nil
+	}
+	return nil, errors.Errorf("%s contains no PEM certificate blocks", filename)
+}
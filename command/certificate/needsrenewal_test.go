@@ -0,0 +1,151 @@
+package certificate
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/x509util"
+	"github.com/urfave/cli"
+)
+
+func TestParseRenewalThreshold(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    renewalThreshold
+		wantErr bool
+	}{
+		{"", renewalThreshold{}, false},
+		{"8h", renewalThreshold{duration: 8 * time.Hour}, false},
+		{"25%", renewalThreshold{percent: 25}, false},
+		{"12.5%", renewalThreshold{percent: 12.5}, false},
+		{"0%", renewalThreshold{}, true},
+		{"101%", renewalThreshold{}, true},
+		{"-1h", renewalThreshold{}, true},
+		{"foo", renewalThreshold{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseRenewalThreshold(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewRenewalStatus(t *testing.T) {
+	now := time.Now()
+	crt := &x509.Certificate{
+		Subject:   pkix.Name{CommonName: "test"},
+		NotBefore: now.Add(-60 * time.Hour),
+		NotAfter:  now.Add(40 * time.Hour),
+	}
+	expired := &x509.Certificate{
+		Subject:   pkix.Name{CommonName: "expired"},
+		NotBefore: now.Add(-2 * time.Hour),
+		NotAfter:  now.Add(-time.Hour),
+	}
+
+	tests := []struct {
+		name      string
+		crt       *x509.Certificate
+		threshold renewalThreshold
+		want      bool
+	}{
+		{"default", crt, renewalThreshold{}, false},
+		{"duration needed", crt, renewalThreshold{duration: 41 * time.Hour}, true},
+		{"duration not needed", crt, renewalThreshold{duration: 39 * time.Hour}, false},
+		{"percent needed", crt, renewalThreshold{percent: 41}, true},
+		{"percent not needed", crt, renewalThreshold{percent: 39}, false},
+		{"expired", expired, renewalThreshold{duration: time.Minute}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := newRenewalStatus("test.crt", tt.crt, tt.threshold, now)
+			assert.Equals(t, tt.want, st.NeedsRenewal)
+			assert.Equals(t, "test.crt", st.Name)
+		})
+	}
+
+	st := newRenewalStatus("test.crt", crt, renewalThreshold{}, now)
+	assert.Equals(t, "40h0m0s", st.Remaining)
+	assert.Equals(t, float64(40), st.RemainingPercent)
+	st = newRenewalStatus("expired.crt", expired, renewalThreshold{}, now)
+	assert.Equals(t, "0s", st.Remaining)
+	assert.Equals(t, float64(0), st.RemainingPercent)
+}
+
+func TestNeedsRenewalUsageError(t *testing.T) {
+	err := needsRenewalCommand().OnUsageError(nil, errors.New("flag provided but not defined: -foo"), false)
+	ec, ok := err.(cli.ExitCoder)
+	if !ok {
+		t.Fatalf("error %T is not a cli.ExitCoder", err)
+	}
+	assert.Equals(t, needsRenewalErrorCode, ec.ExitCode())
+}
+
+func TestReadFirstCertificate(t *testing.T) {
+	p, err := x509util.NewRootProfile("root")
+	assert.FatalError(t, err)
+	der, err := p.CreateCertificate()
+	assert.FatalError(t, err)
+	crt, err := x509.ParseCertificate(der)
+	assert.FatalError(t, err)
+	p7, err := pemutil.EncodePKCS7([]*x509.Certificate{crt})
+	assert.FatalError(t, err)
+	key, err := pemutil.Serialize(p.SubjectPrivateKey())
+	assert.FatalError(t, err)
+
+	dir, err := ioutil.TempDir("", "needs-renewal")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+	files := map[string][]byte{
+		"crt.pem":   pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		"chain.pem": append(pem.EncodeToMemory(key), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...),
+		"crt.der":   der,
+		"crt.p7b":   p7,
+		"crt.p7":    pem.EncodeToMemory(&pem.Block{Type: pemutil.PKCS7Type, Bytes: p7}),
+		"key.pem":   pem.EncodeToMemory(key),
+		"foo.txt":   []byte("foo"),
+	}
+	for name, b := range files {
+		assert.FatalError(t, ioutil.WriteFile(filepath.Join(dir, name), b, 0600))
+	}
+
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{"crt.pem", false},
+		{"chain.pem", false},
+		{"crt.der", false},
+		{"crt.p7b", false},
+		{"crt.p7", false},
+		{"key.pem", true},
+		{"foo.txt", true},
+		{"missing.pem", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readFirstCertificate(filepath.Join(dir, tt.name))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, crt.Raw, got.Raw)
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package certificate
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/x509util"
+	"github.com/smallstep/cli/errs"
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/ocsp"
+)
+
+func ocspCommand() cli.Command {
+	return cli.Command{
+		Name:   "ocsp",
+		Action: command.ActionFunc(ocspAction),
+		Usage:  "check the revocation status of a certificate using OCSP",
+		UsageText: `**step certificate ocsp** <crt_file|url> [**--issuer**=<file>] [**--url**=<url>]
+[**--format**=<format>] [**--roots**=<root-bundle>]
+[**--roots-password-file**=<file>] [**--insecure**]`,
+		Description: `**step certificate ocsp** builds an Online Certificate Status Protocol (OCSP)
+request for a certificate, sends it to an OCSP responder, verifies the signed
+response and prints the revocation status of the certificate.
+
+By default the request is sent to the first OCSP responder in the authority
+information access extension of the certificate. The issuer certificate is used
+to build the request and to verify the response. If the <crt_file> is a bundle
+or a remote URL, the second certificate in the chain is used as the issuer if
+the '--issuer' flag is not present.
+
+## POSITIONAL ARGUMENTS
+
+<crt_file|url>
+:  The path to a certificate or the URL of a remote server to check.
+
+## EXIT CODES
+
+This command returns 0 if the status of the certificate is good, and \>0 if the
+certificate is revoked, its status is unknown, or any error occurs.
+
+## EXAMPLES
+
+Check the status of a certificate using the OCSP responder in the certificate:
+'''
+$ step certificate ocsp foo.crt --issuer intermediate_ca.crt
+'''
+
+Check the status of a certificate bundle using a local OCSP responder:
+'''
+$ step certificate ocsp bundle.crt --url http://localhost:8080
+'''
+
+Check the status of the certificate of a remote server in json format:
+'''
+$ step certificate ocsp https://smallstep.com --format json
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "issuer",
+				Usage: `The issuer certificate <file> used to build the request and to verify the response.`,
+			},
+			cli.StringFlag{
+				Name: "url",
+				Usage: `The <url> of the OCSP responder. Defaults to the first OCSP responder in the
+certificate.`,
+			},
+			cli.StringFlag{
+				Name:  "format",
+				Value: "text",
+				Usage: `The output format for printing the OCSP response.
+
+: <format> is a string and must be one of:
+
+    **text**
+    :  Print output in unstructured text suitable for a human to read.
+
+    **json**
+    :  Print output in JSON format.`,
+			},
+			cli.StringFlag{
+				Name: "roots",
+				Usage: `Root certificate(s) that will be used to verify the
+authenticity of the remote server.
+
+: <roots> is a case-sensitive string and may be one of:
+
+    **file**
+	:  Relative or full path to a file. All certificates in the file will be used for path validation.
+
+    **list of files**
+	:  Comma-separated list of relative or full file paths. Every PEM encoded certificate from each file will be used for path validation.
+
+    **directory**
+	:  Relative or full path to a directory. Every PEM encoded certificate from each file in the directory will be used for path validation.`,
+			},
+			rootsPasswordFileFlag,
+			cli.BoolFlag{
+				Name: "insecure",
+				Usage: `Use an insecure client to retrieve a remote peer certificate. Useful for
+debugging invalid certificates remotely.`,
+			},
+		},
+	}
+}
+
+// ocspInfo is the JSON representation of an OCSP response.
+type ocspInfo struct {
+	SerialNumber     *big.Int   `json:"serial_number"`
+	Status           string     `json:"status"`
+	ProducedAt       time.Time  `json:"produced_at"`
+	ThisUpdate       time.Time  `json:"this_update"`
+	NextUpdate       *time.Time `json:"next_update,omitempty"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	RevocationReason string     `json:"revocation_reason,omitempty"`
+	Responder        string     `json:"responder"`
+}
+
+func ocspAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 1); err != nil {
+		return err
+	}
+
+	var (
+		crtFile    = ctx.Args().Get(0)
+		issuerFile = ctx.String("issuer")
+		server     = ctx.String("url")
+		format     = ctx.String("format")
+		chain      []*x509.Certificate
+		err        error
+	)
+	if format != "text" && format != "json" {
+		return errs.InvalidFlagValue(ctx, "format", format, "text, json")
+	}
+
+	if _, addr, isURL := trimURLPrefix(crtFile); isURL {
+		opts, err := newRemoteOptions(ctx)
+		if err != nil {
+			return err
+		}
+		if chain, err = getPeerCertificates(addr, opts); err != nil {
+			return err
+		}
+	} else if chain, err = pemutil.ReadCertificateBundle(crtFile); err != nil {
+		return err
+	}
+
+	crt := chain[0]
+	var issuer *x509.Certificate
+	switch {
+	case issuerFile != "":
+		if issuer, err = pemutil.ReadCertificate(issuerFile); err != nil {
+			return err
+		}
+	case len(chain) > 1:
+		issuer = chain[1]
+	default:
+		return errs.RequiredFlag(ctx, "issuer")
+	}
+
+	if server == "" {
+		if len(crt.OCSPServer) == 0 {
+			return errors.Errorf("certificate '%s' does not have an OCSP responder, use the '--url' flag", crt.Subject)
+		}
+		server = crt.OCSPServer[0]
+	}
+
+	resp, err := x509util.QueryOCSP(server, crt, issuer)
+	if err != nil {
+		return err
+	}
+
+	info := ocspInfo{
+		SerialNumber: resp.SerialNumber,
+		Status:       x509util.OCSPStatusString(resp.Status),
+		ProducedAt:   resp.ProducedAt.UTC(),
+		ThisUpdate:   resp.ThisUpdate.UTC(),
+		Responder:    server,
+	}
+	if !resp.NextUpdate.IsZero() {
+		t := resp.NextUpdate.UTC()
+		info.NextUpdate = &t
+	}
+	if resp.Status == ocsp.Revoked {
+		t := resp.RevokedAt.UTC()
+		info.RevokedAt = &t
+		info.RevocationReason = x509util.ReasonCodeString(resp.RevocationReason)
+	}
+
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(info, "", "  ")
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		os.Stdout.Write(b)
+		fmt.Println()
+	default:
+		fmt.Printf("Serial Number: %s\n", info.SerialNumber)
+		fmt.Printf("Status: %s\n", info.Status)
+		if info.RevokedAt != nil {
+			fmt.Printf("Revoked At: %s\n", info.RevokedAt.Format(time.RFC3339))
+			fmt.Printf("Revocation Reason: %s\n", info.RevocationReason)
+		}
+		fmt.Printf("Produced At: %s\n", info.ProducedAt.Format(time.RFC3339))
+		fmt.Printf("This Update: %s\n", info.ThisUpdate.Format(time.RFC3339))
+		if info.NextUpdate != nil {
+			fmt.Printf("Next Update: %s\n", info.NextUpdate.Format(time.RFC3339))
+		}
+		fmt.Printf("Responder: %s\n", info.Responder)
+	}
+
+	if resp.Status != ocsp.Good {
+		os.Exit(1)
+	}
+	return nil
+}
@@ -0,0 +1,407 @@
+package certificate
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/keys"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/flags"
+	"github.com/smallstep/cli/ui"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+)
+
+func p12Command() cli.Command {
+	return cli.Command{
+		Name:   "p12",
+		Action: command.ActionFunc(p12Action),
+		Usage:  `package a certificate and keys into a .p12 file`,
+		UsageText: `**step certificate p12** <p12_file> <crt_file> [<key_file>]
+[**--ca**=<file>] [**--password-file**=<file>] [**--no-password** **--insecure**]
+[**--cipher**=<name>] [**--mac**=<name>] [**--legacy**] [**--name**=<name>]
+[**--force**]`,
+		Description: `**step certificate p12** creates a PKCS#12 file (also known as .p12 or
+.pfx) with a certificate, its intermediate certificates and its private key.
+PKCS#12 files are used by Java applications, Windows, browsers and mobile
+devices to import certificates and keys.
+
+By default, the certificates and the key are encrypted with AES-256-CBC using
+PBKDF2 with HMAC-SHA256, and the integrity of the file is protected with an
+HMAC-SHA256. Some old software cannot read these files, in this case the
+'--legacy' flag can be used to encrypt with 3DES and protect with an HMAC-SHA1.
+
+## POSITIONAL ARGUMENTS
+
+<p12_file>
+:  The path to write the PKCS#12 file.
+
+<crt_file>
+:  The path to a certificate to add to the PKCS#12 file. If the file is a
+bundle, the rest of the certificates will be added as intermediates.
+
+<key_file>
+:  The path to the private key of the certificate.
+
+## EXIT CODES
+
+This command returns 0 on success and \>0 if any error occurs.
+
+## EXAMPLES
+
+Package a certificate and its private key into a .p12 file:
+'''
+$ step certificate p12 foo.p12 foo.crt foo.key
+'''
+
+Package a certificate, its private key and the intermediate certificate:
+'''
+$ step certificate p12 foo.p12 foo.crt foo.key --ca intermediate_ca.crt
+'''
+
+Package a certificate without a private key, for example to be imported as a
+trusted certificate:
+'''
+$ step certificate p12 root_ca.p12 root_ca.crt
+'''
+
+Package a certificate and its private key for legacy software:
+'''
+$ step certificate p12 foo.p12 foo.crt foo.key --legacy
+'''
+
+Package a certificate and its private key without a password, the PKCS#12
+file will use an empty password:
+'''
+$ step certificate p12 foo.p12 foo.crt foo.key --no-password --insecure
+'''`,
+		Flags: []cli.Flag{
+			cli.StringSliceFlag{
+				Name: "ca",
+				Usage: `The path to an intermediate certificate <file> to add to the PKCS#12 file.
+Use the '--ca' flag multiple times to add multiple certificates.`,
+			},
+			cli.StringFlag{
+				Name:  "password-file",
+				Usage: `The path to the <file> containing the password to encrypt the PKCS#12 file.`,
+			},
+			flags.NoPassword,
+			cli.StringFlag{
+				Name: "cipher",
+				Usage: `The <name> of the cipher used to encrypt the certificates and the key.
+
+: <name> is a case-insensitive string and must be one of:
+
+    **aes128**
+    :  AES-128-CBC with PBKDF2.
+
+    **aes192**
+    :  AES-192-CBC with PBKDF2.
+
+    **aes256** (default)
+    :  AES-256-CBC with PBKDF2.
+
+    **3des**
+    :  3DES with the legacy PKCS#12 key derivation function.`,
+			},
+			cli.StringFlag{
+				Name: "mac",
+				Usage: `The <name> of the hash function used to protect the integrity of the file.
+
+: <name> is a case-insensitive string and must be one of:
+
+    **sha1**
+    :  HMAC-SHA1.
+
+    **sha256** (default)
+    :  HMAC-SHA256.
+
+    **sha384**
+    :  HMAC-SHA384.
+
+    **sha512**
+    :  HMAC-SHA512.`,
+			},
+			cli.BoolFlag{
+				Name: "legacy",
+				Usage: `Use 3DES and HMAC-SHA1, supported by old software. It is equivalent to
+'--cipher 3des --mac sha1'.`,
+			},
+			cli.StringFlag{
+				Name:  "name",
+				Usage: `The friendly <name> of the certificate and key.`,
+			},
+			flags.Insecure,
+			flags.Force,
+		},
+	}
+}
+
+func fromP12Command() cli.Command {
+	return cli.Command{
+		Name:   "from-p12",
+		Action: command.ActionFunc(fromP12Action),
+		Usage:  `extract the certificates and keys in a .p12 file`,
+		UsageText: `**step certificate from-p12** <p12_file> [<crt_file>] [<key_file>]
+[**--ca**=<file>] [**--password-file**=<file>] [**--no-password** **--insecure**]
+[**--force**]`,
+		Description: `**step certificate from-p12** extracts the certificate, the intermediate
+certificates and the private key in a PKCS#12 file (also known as .p12 or
+.pfx) and writes them in PEM format.
+
+If no <crt_file> is given, the certificate and the intermediate certificates
+will be printed to STDOUT.
+
+PKCS#12 files encrypted with AES or 3DES, using PBKDF2 or the legacy PKCS#12
+key derivation function, and files encrypted with RC2 are supported.
+
+## POSITIONAL ARGUMENTS
+
+<p12_file>
+:  The path to the PKCS#12 file.
+
+<crt_file>
+:  The path to write the certificate.
+
+<key_file>
+:  The path to write the private key.
+
+## EXIT CODES
+
+This command returns 0 on success and \>0 if any error occurs.
+
+## EXAMPLES
+
+Print the certificates in a .p12 file:
+'''
+$ step certificate from-p12 foo.p12
+'''
+
+Extract the certificate, the private key and the intermediate certificates:
+'''
+$ step certificate from-p12 foo.p12 foo.crt foo.key --ca intermediate_ca.crt
+'''
+
+Extract the certificate and the private key, writing the key unencrypted:
+'''
+$ step certificate from-p12 foo.p12 foo.crt foo.key --no-password --insecure
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "ca",
+				Usage: `The path to the <file> to write the intermediate certificates.`,
+			},
+			cli.StringFlag{
+				Name:  "password-file",
+				Usage: `The path to the <file> containing the password to decrypt the PKCS#12 file.`,
+			},
+			flags.NoPassword,
+			flags.Insecure,
+			flags.Force,
+		},
+	}
+}
+
+func p12Action(ctx *cli.Context) error {
+	if err := errs.MinMaxNumberOfArguments(ctx, 2, 3); err != nil {
+		return err
+	}
+
+	args := ctx.Args()
+	p12File, crtFile, keyFile := args.Get(0), args.Get(1), args.Get(2)
+	passwordFile := ctx.String("password-file")
+	noPass := ctx.Bool("no-password")
+	if noPass && passwordFile != "" {
+		return errs.IncompatibleFlagWithFlag(ctx, "no-password", "password-file")
+	}
+	if noPass && !ctx.Bool("insecure") {
+		return errs.RequiredWithFlag(ctx, "insecure", "no-password")
+	}
+
+	opts, err := p12Options(ctx)
+	if err != nil {
+		return err
+	}
+
+	bundle, err := pemutil.ReadCertificateBundle(crtFile)
+	if err != nil {
+		return err
+	}
+	crt, chain := bundle[0], bundle[1:]
+	for _, caFile := range ctx.StringSlice("ca") {
+		certs, err := pemutil.ReadCertificateBundle(caFile)
+		if err != nil {
+			return err
+		}
+		chain = append(chain, certs...)
+	}
+
+	var key interface{}
+	if keyFile != "" {
+		if key, err = pemutil.Read(keyFile); err != nil {
+			return err
+		}
+		if _, ok := key.(crypto.Signer); !ok {
+			return errors.Errorf("file %s does not contain a private key", keyFile)
+		}
+		if err := keys.VerifyPair(crt.PublicKey, key); err != nil {
+			return errors.Wrapf(err, "error verifying %s", keyFile)
+		}
+	}
+
+	var password []byte
+	switch {
+	case noPass:
+	case passwordFile != "":
+		if password, err = utils.ReadPasswordFromFile(passwordFile); err != nil {
+			return err
+		}
+	default:
+		if password, err = ui.PromptPassword("Please enter a password to encrypt the PKCS#12 file"); err != nil {
+			return errors.Wrap(err, "error reading password")
+		}
+	}
+
+	b, err := pemutil.EncodePKCS12(key, crt, chain, password, opts)
+	if err != nil {
+		return err
+	}
+	if err := utils.WriteFile(p12File, b, 0600); err != nil {
+		return err
+	}
+
+	ui.Printf("Your .p12 bundle has been saved as %s.\n", p12File)
+	return nil
+}
+
+// p12Options returns the PKCS#12 options from the cipher, mac and legacy
+// flags.
+func p12Options(ctx *cli.Context) (*pemutil.PKCS12Options, error) {
+	opts := pemutil.DefaultPKCS12Options()
+	if ctx.Bool("legacy") {
+		opts = pemutil.LegacyPKCS12Options()
+	}
+	opts.FriendlyName = ctx.String("name")
+
+	if s := ctx.String("cipher"); s != "" {
+		switch strings.ToLower(s) {
+		case "aes128":
+			opts.Cipher = x509.PEMCipherAES128
+		case "aes192":
+			opts.Cipher = x509.PEMCipherAES192
+		case "aes256":
+			opts.Cipher = x509.PEMCipherAES256
+		case "3des":
+			opts.Cipher = x509.PEMCipher3DES
+		default:
+			return nil, errs.InvalidFlagValue(ctx, "cipher", s, "aes128, aes192, aes256, 3des")
+		}
+	}
+
+	if s := ctx.String("mac"); s != "" {
+		switch strings.ToLower(s) {
+		case "sha1":
+			opts.MAC = crypto.SHA1
+		case "sha256":
+			opts.MAC = crypto.SHA256
+		case "sha384":
+			opts.MAC = crypto.SHA384
+		case "sha512":
+			opts.MAC = crypto.SHA512
+		default:
+			return nil, errs.InvalidFlagValue(ctx, "mac", s, "sha1, sha256, sha384, sha512")
+		}
+	}
+
+	return opts, nil
+}
+
+func fromP12Action(ctx *cli.Context) error {
+	if err := errs.MinMaxNumberOfArguments(ctx, 1, 3); err != nil {
+		return err
+	}
+
+	args := ctx.Args()
+	p12File, crtFile, keyFile := args.Get(0), args.Get(1), args.Get(2)
+	caFile := ctx.String("ca")
+	noPass := ctx.Bool("no-password")
+	if noPass && !ctx.Bool("insecure") {
+		return errs.RequiredWithFlag(ctx, "insecure", "no-password")
+	}
+	if crtFile == "" && caFile != "" {
+		return errs.MissingArguments(ctx, "crt_file")
+	}
+
+	b, err := utils.ReadFile(p12File)
+	if err != nil {
+		return errs.FileError(err, p12File)
+	}
+	opts := []pemutil.Options{pemutil.WithFilename(p12File)}
+	if passwordFile := ctx.String("password-file"); passwordFile != "" {
+		opts = append(opts, pemutil.WithPasswordFile(passwordFile))
+	}
+	key, crt, chain, err := pemutil.ParsePKCS12(b, opts...)
+	if err != nil {
+		return err
+	}
+	if crt == nil {
+		return errors.Errorf("file %s does not contain a certificate", p12File)
+	}
+
+	// Print the certificates if no files are given.
+	if crtFile == "" {
+		os.Stdout.Write(encodeCertificates(append([]*x509.Certificate{crt}, chain...)...))
+		return nil
+	}
+
+	if err := utils.WriteFile(crtFile, encodeCertificates(crt), 0600); err != nil {
+		return err
+	}
+	ui.Printf("Your certificate has been saved in %s.\n", crtFile)
+
+	if caFile != "" {
+		if len(chain) == 0 {
+			return errors.Errorf("file %s does not contain intermediate certificates", p12File)
+		}
+		if err := utils.WriteFile(caFile, encodeCertificates(chain...), 0600); err != nil {
+			return err
+		}
+		ui.Printf("Your intermediate certificates have been saved in %s.\n", caFile)
+	}
+
+	if keyFile != "" {
+		if key == nil {
+			return errors.Errorf("file %s does not contain a private key", p12File)
+		}
+		if noPass {
+			_, err = pemutil.Serialize(key, pemutil.ToFile(keyFile, 0600))
+		} else {
+			var pass []byte
+			if pass, err = ui.PromptPassword("Please enter the password to encrypt the private key"); err != nil {
+				return errors.Wrap(err, "error reading password")
+			}
+			_, err = pemutil.Serialize(key, pemutil.WithPassword(pass), pemutil.ToFile(keyFile, 0600))
+		}
+		if err != nil {
+			return err
+		}
+		ui.Printf("Your private key has been saved in %s.\n", keyFile)
+	}
+
+	return nil
+}
+
+// encodeCertificates returns the PEM encoding of the given certificates.
+func encodeCertificates(certs ...*x509.Certificate) []byte {
+	var b []byte
+	for _, crt := range certs {
+		b = append(b, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw})...)
+	}
+	return b
+}
@@ -3,48 +3,278 @@ package certificate
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"fmt"
+	"net"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/pemutil"
 	"github.com/smallstep/cli/crypto/x509util"
+	"github.com/smallstep/cli/errs"
+	"github.com/urfave/cli"
 )
 
 var urlPrefixes = []string{"https://", "tcp://", "tls://"}
 
+// remoteOptions are the options used to connect to a remote server.
+type remoteOptions struct {
+	// roots is a file, a directory, or a comma-separated list of files with
+	// the root certificates used to verify the server.
+	roots string
+	// rootsPasswordFile is the file with the password of the truststores in
+	// roots.
+	rootsPasswordFile string
+	// insecure disables the verification of the server certificate.
+	insecure bool
+	// serverName is the name sent in the SNI extension and used to verify
+	// the server certificate, it defaults to the host in the address.
+	serverName string
+	// startTLS is the protocol used to negotiate TLS on a plain connection.
+	startTLS string
+	// clientCert and clientKey are the certificate and key used to
+	// authenticate with the server.
+	clientCert string
+	clientKey  string
+	// nextProtos are the protocols offered using ALPN.
+	nextProtos []string
+}
+
+// Flags shared by the commands that connect to remote servers.
+var (
+	rootsPasswordFileFlag = cli.StringFlag{
+		Name: "roots-password-file",
+		Usage: `The path to the <file> containing the password of the JKS or JCEKS
+truststores in '--roots'. The password is used to verify the integrity of the
+truststores, if it is not set the user is prompted for it.`,
+	}
+	serverNameFlag = cli.StringFlag{
+		Name: "servername",
+		Usage: `The server <name> sent in the TLS server name indication (SNI) extension and
+used to verify the certificate of a remote server. Defaults to the host in the
+address.`,
+	}
+	startTLSFlag = cli.StringFlag{
+		Name: "starttls",
+		Usage: `The <protocol> used to negotiate TLS with a remote server before the TLS
+handshake. If the address does not contain a port, the default port of the
+protocol is used.
+
+: <protocol> is a string and must be one of:
+
+    **smtp**, **imap**, **pop3**, **ftp**, **ldap**, **postgres**, **mysql**, **xmpp**`,
+	}
+	clientCertFlag = cli.StringFlag{
+		Name: "client-cert",
+		Usage: `The certificate <file> used to authenticate with a remote server that requires
+client certificates. Requires '--client-key'.`,
+	}
+	clientKeyFlag = cli.StringFlag{
+		Name:  "client-key",
+		Usage: `The private key <file> of the certificate in '--client-cert'.`,
+	}
+)
+
+// newRemoteOptions returns the remoteOptions using the flags in the context:
+// roots, roots-password-file, insecure, servername, starttls, client-cert and
+// client-key.
+func newRemoteOptions(ctx *cli.Context) (*remoteOptions, error) {
+	opts := &remoteOptions{
+		roots:             ctx.String("roots"),
+		rootsPasswordFile: ctx.String("roots-password-file"),
+		insecure:          ctx.Bool("insecure"),
+		serverName:        ctx.String("servername"),
+		startTLS:          strings.ToLower(ctx.String("starttls")),
+		clientCert:        ctx.String("client-cert"),
+		clientKey:         ctx.String("client-key"),
+	}
+	if _, ok := startTLSPorts[opts.startTLS]; opts.startTLS != "" && !ok {
+		return nil, errs.InvalidFlagValue(ctx, "starttls", ctx.String("starttls"),
+			"smtp, imap, pop3, ftp, ldap, postgres, mysql, xmpp")
+	}
+	switch {
+	case opts.clientCert != "" && opts.clientKey == "":
+		return nil, errs.RequiredWithFlag(ctx, "client-cert", "client-key")
+	case opts.clientKey != "" && opts.clientCert == "":
+		return nil, errs.RequiredWithFlag(ctx, "client-key", "client-cert")
+	}
+	return opts, nil
+}
+
 // getPeerCertificates creates a connection to a remote server and returns the
 // list of server certificates.
 //
-// If the address does not contain a port then default to port 443.
+// If the address does not contain a port then default to port 443, or to the
+// default port of the STARTTLS protocol.
 //
 // Params
 //   *addr*:     e.g. smallstep.com
-//   *roots*:    a file, a directory, or a comma-separated list of files.
-//   *insecure*: do not verify that the server's certificate has been signed by
-//               a trusted root
-func getPeerCertificates(addr, roots string, insecure bool) ([]*x509.Certificate, error) {
-	var (
-		err     error
-		rootCAs *x509.CertPool
-	)
-	if roots != "" {
-		rootCAs, err = x509util.ReadCertPool(roots)
+//   *opts*:     the options used to connect to the server
+func getPeerCertificates(addr string, opts *remoteOptions) ([]*x509.Certificate, error) {
+	cs, err := getConnectionState(addr, opts)
+	if err != nil {
+		return nil, err
+	}
+	return cs.PeerCertificates, nil
+}
+
+// getConnectionState creates a connection to a remote server and returns the
+// state of the TLS connection, including the server certificates and the
+// stapled OCSP response, if any. The parameters are the same as in
+// getPeerCertificates.
+func getConnectionState(addr string, opts *remoteOptions) (tls.ConnectionState, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: opts.insecure,
+		ServerName:         opts.serverName,
+		NextProtos:         opts.nextProtos,
+	}
+	if opts.roots != "" {
+		rootCAs, err := x509util.ReadCertPool(opts.roots, rootsOptions(opts.rootsPasswordFile)...)
 		if err != nil {
-			return nil, errors.Wrapf(err, "failure to load root certificate pool from input path '%s'", roots)
+			return tls.ConnectionState{}, errors.Wrapf(err, "failure to load root certificate pool from input path '%s'", opts.roots)
 		}
+		tlsConfig.RootCAs = rootCAs
 	}
-	if !strings.Contains(addr, ":") {
-		addr += ":443"
+	if opts.clientCert != "" {
+		chain, err := pemutil.ReadCertificateBundle(opts.clientCert)
+		if err != nil {
+			return tls.ConnectionState{}, err
+		}
+		key, err := pemutil.Read(opts.clientKey)
+		if err != nil {
+			return tls.ConnectionState{}, err
+		}
+		crt := tls.Certificate{PrivateKey: key, Leaf: chain[0]}
+		for _, c := range chain {
+			crt.Certificate = append(crt.Certificate, c.Raw)
+		}
+		tlsConfig.Certificates = []tls.Certificate{crt}
 	}
-	tlsConfig := &tls.Config{RootCAs: rootCAs}
-	if insecure {
-		tlsConfig.InsecureSkipVerify = true
+	return dialTLS(addr, tlsConfig, opts.startTLS, 0)
+}
+
+// dialTLS creates a TLS connection to the given address and returns the state
+// of the connection. If startTLS is set, the protocol is used to negotiate TLS
+// before the handshake. If the address does not contain a port then default to
+// port 443, or the default port of the STARTTLS protocol. A timeout of 0 means
+// no timeout.
+func dialTLS(addr string, tlsConfig *tls.Config, startTLS string, timeout time.Duration) (tls.ConnectionState, error) {
+	if !strings.Contains(addr, ":") {
+		if port, ok := startTLSPorts[startTLS]; ok {
+			addr += ":" + port
+		} else {
+			addr += ":443"
+		}
 	}
-	conn, err := tls.Dial("tcp", addr, tlsConfig)
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := dialer.Dial("tcp", addr)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to connect")
+		return tls.ConnectionState{}, errors.Wrapf(err, "failed to connect")
 	}
-	conn.Close()
-	return conn.ConnectionState().PeerCertificates, nil
+	defer conn.Close()
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
+
+	config := tlsConfig.Clone()
+	if config.ServerName == "" {
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			config.ServerName = host
+		}
+	}
+	if startTLS != "" {
+		if err := negotiateStartTLS(conn, startTLS, config.ServerName); err != nil {
+			return tls.ConnectionState{}, errors.Wrapf(err, "failed to negotiate %s STARTTLS", startTLS)
+		}
+	}
+
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		return tls.ConnectionState{}, errors.Wrapf(err, "failed to connect")
+	}
+	return tlsConn.ConnectionState(), nil
+}
+
+// tlsVersionNames are the names of the TLS versions.
+var tlsVersionNames = map[uint16]string{
+	tls.VersionSSL30: "SSL 3.0",
+	tls.VersionTLS10: "TLS 1.0",
+	tls.VersionTLS11: "TLS 1.1",
+	tls.VersionTLS12: "TLS 1.2",
+	tls.VersionTLS13: "TLS 1.3",
+}
+
+// cipherSuiteNames are the names of the cipher suites supported by the tls
+// package.
+var cipherSuiteNames = map[uint16]string{
+	tls.TLS_RSA_WITH_RC4_128_SHA:                "TLS_RSA_WITH_RC4_128_SHA",
+	tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA:           "TLS_RSA_WITH_3DES_EDE_CBC_SHA",
+	tls.TLS_RSA_WITH_AES_128_CBC_SHA:            "TLS_RSA_WITH_AES_128_CBC_SHA",
+	tls.TLS_RSA_WITH_AES_256_CBC_SHA:            "TLS_RSA_WITH_AES_256_CBC_SHA",
+	tls.TLS_RSA_WITH_AES_128_CBC_SHA256:         "TLS_RSA_WITH_AES_128_CBC_SHA256",
+	tls.TLS_RSA_WITH_AES_128_GCM_SHA256:         "TLS_RSA_WITH_AES_128_GCM_SHA256",
+	tls.TLS_RSA_WITH_AES_256_GCM_SHA384:         "TLS_RSA_WITH_AES_256_GCM_SHA384",
+	tls.TLS_ECDHE_ECDSA_WITH_RC4_128_SHA:        "TLS_ECDHE_ECDSA_WITH_RC4_128_SHA",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA:    "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA:    "TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA",
+	tls.TLS_ECDHE_RSA_WITH_RC4_128_SHA:          "TLS_ECDHE_RSA_WITH_RC4_128_SHA",
+	tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA:     "TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA",
+	tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA:      "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA",
+	tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA:      "TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256: "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256",
+	tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256:   "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256",
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256:   "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256: "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384:   "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384: "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305:    "TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305",
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305:  "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305",
+	tls.TLS_AES_128_GCM_SHA256:                  "TLS_AES_128_GCM_SHA256",
+	tls.TLS_AES_256_GCM_SHA384:                  "TLS_AES_256_GCM_SHA384",
+	tls.TLS_CHACHA20_POLY1305_SHA256:            "TLS_CHACHA20_POLY1305_SHA256",
+}
+
+func tlsVersionName(v uint16) string {
+	if name, ok := tlsVersionNames[v]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown (0x%04x)", v)
+}
+
+func cipherSuiteName(c uint16) string {
+	if name, ok := cipherSuiteNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown (0x%04x)", c)
+}
+
+// connectionStateText returns the negotiated protocol version, cipher suite
+// and ALPN protocol of a TLS connection in a human readable format.
+func connectionStateText(cs tls.ConnectionState) string {
+	alpn := cs.NegotiatedProtocol
+	if alpn == "" {
+		alpn = "none"
+	}
+
+	var b strings.Builder
+	b.WriteString("TLS Connection:\n")
+	fmt.Fprintf(&b, "    Protocol: %s\n", tlsVersionName(cs.Version))
+	fmt.Fprintf(&b, "    Cipher Suite: %s\n", cipherSuiteName(cs.CipherSuite))
+	fmt.Fprintf(&b, "    ALPN: %s\n", alpn)
+	return b.String()
+}
+
+// trimRemotePrefix is like trimURLPrefix, but it also considers the input a
+// remote address if the --starttls flag is set, as addresses of STARTTLS
+// servers are usually given without a prefix.
+func trimRemotePrefix(ctx *cli.Context, url string) (string, string, bool) {
+	if prefix, addr, isURL := trimURLPrefix(url); isURL {
+		return prefix, addr, true
+	}
+	if ctx.String("starttls") != "" {
+		return "", url, true
+	}
+	return "", "", false
 }
 
 // trimURLPrefix returns the url split into prefix and suffix and a bool which
@@ -63,3 +293,12 @@ func trimURLPrefix(url string) (string, string, bool) {
 	}
 	return "", "", false
 }
+
+// rootsOptions returns the options used to read the truststores in the
+// --roots flag.
+func rootsOptions(passwordFile string) []pemutil.Options {
+	if passwordFile == "" {
+		return nil
+	}
+	return []pemutil.Options{pemutil.WithPasswordFile(passwordFile)}
+}
@@ -0,0 +1,214 @@
+package certificate
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/x509util"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/ui"
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/ocsp"
+)
+
+// Revocation policies used in the --revocation flag.
+const (
+	revocationHard = "hard"
+	revocationSoft = "soft"
+	revocationOff  = "off"
+)
+
+// revocationChecker checks the revocation status of a certificate chain
+// using OCSP and CRLs.
+type revocationChecker struct {
+	policy  string
+	crls    []string
+	useOCSP bool
+	useCDP  bool
+	stapled []byte
+	now     time.Time
+	cache   map[string]*pkix.CertificateList
+}
+
+// revocationStatus is the status of a certificate reported by an OCSP
+// responder or a CRL.
+type revocationStatus struct {
+	revoked   bool
+	reason    int
+	revokedAt time.Time
+	source    string
+}
+
+// newRevocationChecker creates a revocationChecker using the --crl, --ocsp
+// and --revocation flags. It returns nil if revocation checking is disabled.
+func newRevocationChecker(ctx *cli.Context) (*revocationChecker, error) {
+	var (
+		policy  = ctx.String("revocation")
+		crls    = ctx.StringSlice("crl")
+		useOCSP = ctx.Bool("ocsp")
+	)
+	switch policy {
+	case "":
+		if len(crls) == 0 && !useOCSP {
+			return nil, nil
+		}
+		policy = revocationSoft
+	case revocationOff:
+		if len(crls) > 0 {
+			return nil, errs.IncompatibleFlagWithFlag(ctx, "crl", "revocation off")
+		}
+		if useOCSP {
+			return nil, errs.IncompatibleFlagWithFlag(ctx, "ocsp", "revocation off")
+		}
+		return nil, nil
+	case revocationHard, revocationSoft:
+	default:
+		return nil, errs.InvalidFlagValue(ctx, "revocation", policy, "hard, soft, off")
+	}
+
+	rc := &revocationChecker{
+		policy:  policy,
+		crls:    crls,
+		useOCSP: useOCSP,
+		now:     time.Now(),
+		cache:   make(map[string]*pkix.CertificateList),
+	}
+	// Without explicit sources use all the ones in the certificates.
+	if len(crls) == 0 && !useOCSP {
+		rc.useOCSP = true
+		rc.useCDP = true
+	}
+	return rc, nil
+}
+
+// Check verifies the revocation status of all the certificates in the chain
+// but the last one, that must be the root certificate. A revoked certificate
+// always results in an error, if the status of a certificate cannot be
+// determined the result depends on the revocation policy.
+func (rc *revocationChecker) Check(chain []*x509.Certificate) error {
+	for i := 0; i < len(chain)-1; i++ {
+		crt, issuer := chain[i], chain[i+1]
+		status, err := rc.status(crt, issuer, i == 0)
+		if err != nil {
+			if rc.policy == revocationHard {
+				return errors.Wrapf(err, "failed to check the revocation status of '%s'", crt.Subject)
+			}
+			ui.Printf("Warning: failed to check the revocation status of '%s': %v\n", crt.Subject, err)
+			continue
+		}
+		if status.revoked {
+			return errors.Errorf("certificate '%s' with serial number %s was revoked on %s with reason '%s', according to %s",
+				crt.Subject, crt.SerialNumber, status.revokedAt.Format(time.RFC3339),
+				x509util.ReasonCodeString(status.reason), status.source)
+		}
+	}
+	return nil
+}
+
+// status returns the revocation status of a certificate. OCSP is tried first
+// and then the CRLs. An error is returned if none of the sources can provide
+// the status of the certificate.
+func (rc *revocationChecker) status(crt, issuer *x509.Certificate, isLeaf bool) (*revocationStatus, error) {
+	var failures []string
+	if rc.useOCSP {
+		if isLeaf && len(rc.stapled) > 0 {
+			resp, err := x509util.ParseOCSPResponse(rc.stapled, crt, issuer)
+			if err == nil {
+				err = rc.checkOCSPResponse(resp)
+			}
+			if err == nil {
+				return ocspStatus(resp, "stapled OCSP response"), nil
+			}
+			failures = append(failures, "stapled OCSP response: "+err.Error())
+		}
+		for _, server := range crt.OCSPServer {
+			resp, err := x509util.QueryOCSP(server, crt, issuer)
+			if err == nil {
+				err = rc.checkOCSPResponse(resp)
+			}
+			if err == nil {
+				return ocspStatus(resp, "OCSP responder "+server), nil
+			}
+			failures = append(failures, err.Error())
+		}
+	}
+
+	var sources []string
+	for _, name := range rc.crls {
+		crl, err := rc.readCRL(name)
+		if err != nil {
+			failures = append(failures, err.Error())
+			continue
+		}
+		// Skip CRLs of other issuers
+		if x509util.CRLIssuer(crl).String() == crt.Issuer.String() {
+			sources = append(sources, name)
+		}
+	}
+	if rc.useCDP {
+		sources = append(sources, crt.CRLDistributionPoints...)
+	}
+	for _, name := range sources {
+		crl, err := rc.readCRL(name)
+		if err == nil {
+			err = x509util.VerifyCRL(crl, issuer, rc.now)
+		}
+		if err != nil {
+			failures = append(failures, errors.Wrapf(err, "CRL %s", name).Error())
+			continue
+		}
+		status := &revocationStatus{source: "CRL " + name}
+		if entry, ok := x509util.FindRevokedCertificate(crl, crt.SerialNumber); ok {
+			status.revoked = true
+			status.reason = x509util.RevocationReason(entry)
+			status.revokedAt = entry.RevocationTime
+		}
+		return status, nil
+	}
+
+	if len(failures) == 0 {
+		return nil, errors.New("no revocation information available")
+	}
+	return nil, errors.New(strings.Join(failures, "; "))
+}
+
+// checkOCSPResponse validates that the OCSP response is current and that the
+// certificate status is known.
+func (rc *revocationChecker) checkOCSPResponse(resp *ocsp.Response) error {
+	if resp.Status == ocsp.Unknown {
+		return errors.New("OCSP responder does not know the certificate")
+	}
+	if rc.now.Before(resp.ThisUpdate.Add(-5 * time.Minute)) {
+		return errors.Errorf("OCSP response is not valid yet, thisUpdate is %s", resp.ThisUpdate.Format(time.RFC3339))
+	}
+	if !resp.NextUpdate.IsZero() && rc.now.After(resp.NextUpdate) {
+		return errors.Errorf("OCSP response has expired, nextUpdate was %s", resp.NextUpdate.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// readCRL reads a CRL from a file or a URL, every CRL is only read once.
+func (rc *revocationChecker) readCRL(name string) (*pkix.CertificateList, error) {
+	if crl, ok := rc.cache[name]; ok {
+		return crl, nil
+	}
+	crl, err := x509util.ReadCRL(name)
+	if err != nil {
+		return nil, err
+	}
+	rc.cache[name] = crl
+	return crl, nil
+}
+
+func ocspStatus(resp *ocsp.Response, source string) *revocationStatus {
+	status := &revocationStatus{source: source}
+	if resp.Status == ocsp.Revoked {
+		status.revoked = true
+		status.reason = resp.RevocationReason
+		status.revokedAt = resp.RevokedAt
+	}
+	return status
+}
@@ -0,0 +1,85 @@
+package certificate
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/cli/crypto/x509util"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestRevocationChecker_Check(t *testing.T) {
+	mustCertificate := func(p x509util.Profile, err error) (*x509.Certificate, x509util.Profile) {
+		assert.FatalError(t, err)
+		b, err := p.CreateCertificate()
+		assert.FatalError(t, err)
+		crt, err := x509.ParseCertificate(b)
+		assert.FatalError(t, err)
+		return crt, p
+	}
+
+	caTemplate := `{"subject": {"commonName": {{ toJson .Subject }}}, "keyUsage": ["certSign", "crlSign"], "basicConstraints": {"isCA": true}}`
+	leafTemplate := `{"subject": {"commonName": {{ toJson .Subject }}}, "sans": {{ toJson .SANs }}}`
+	root, rootProfile := mustCertificate(x509util.NewProfileFromTemplate(caTemplate, x509util.TemplateData{"Subject": "root"}, nil, nil))
+	leaf, _ := mustCertificate(x509util.NewProfileFromTemplate(leafTemplate, x509util.TemplateData{"Subject": "leaf", "SANs": []string{"leaf"}}, root, rootProfile.SubjectPrivateKey()))
+
+	dir, err := ioutil.TempDir("", "revocation")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+
+	writeCRL := func(name string, revoked ...*big.Int) string {
+		var entries []pkix.RevokedCertificate
+		for _, sn := range revoked {
+			rc, err := x509util.NewRevokedCertificate(sn, time.Now(), ocsp.KeyCompromise)
+			assert.FatalError(t, err)
+			entries = append(entries, rc)
+		}
+		b, err := x509util.CreateCRL(&x509util.CRL{Number: big.NewInt(1), RevokedCertificates: entries}, root, rootProfile.SubjectPrivateKey())
+		assert.FatalError(t, err)
+		fn := filepath.Join(dir, name)
+		assert.FatalError(t, ioutil.WriteFile(fn, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: b}), 0600))
+		return fn
+	}
+	goodCRL := writeCRL("good.crl", big.NewInt(1))
+	revokedCRL := writeCRL("revoked.crl", leaf.SerialNumber)
+
+	newChecker := func(policy string, crls ...string) *revocationChecker {
+		return &revocationChecker{
+			policy: policy,
+			crls:   crls,
+			now:    time.Now(),
+			cache:  make(map[string]*pkix.CertificateList),
+		}
+	}
+
+	tests := map[string]struct {
+		checker *revocationChecker
+		wantErr bool
+	}{
+		"ok":                   {newChecker(revocationHard, goodCRL), false},
+		"ok/soft":              {newChecker(revocationSoft), false},
+		"ok/soft missing file": {newChecker(revocationSoft, filepath.Join(dir, "missing.crl")), false},
+		"fail/revoked":         {newChecker(revocationSoft, revokedCRL), true},
+		"fail/revoked hard":    {newChecker(revocationHard, revokedCRL, goodCRL), true},
+		"fail/hard":            {newChecker(revocationHard), true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tc.checker.Check([]*x509.Certificate{leaf, root})
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,514 @@
+package certificate
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/x509util"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+)
+
+// maxScanFileSize is the maximum size of the files read while walking a
+// directory, bigger files are ignored.
+const maxScanFileSize = 1 << 20
+
+func scanCommand() cli.Command {
+	return cli.Command{
+		Name:   "scan",
+		Action: cli.ActionFunc(scanAction),
+		Usage:  "collect an inventory of the certificates in files and TLS endpoints",
+		UsageText: `**step certificate scan** [<path|host:port>...] [**--targets**=<file>]
+[**--format**=<format>] [**--roots**=<root-bundle>]
+[**--roots-password-file**=<file>] [**--concurrency**=<number>]
+[**--timeout**=<duration>] [**--password-file**=<file>]`,
+		Description: `**step certificate scan** collects all the certificates in the given
+files, directories and TLS endpoints, and prints for each certificate where it
+was found, its subject, subject alternative names, issuer, serial number, key
+type and size, validity period, fingerprint, and if it chains to a trusted root.
+
+Directories are walked recursively and certificates in PEM, DER, PKCS#7 and
+PKCS#12 formats are recognized, files without certificates are ignored. For TLS
+endpoints, the certificates sent by the server are collected, even if they are
+not valid, and the leaf certificate is also verified against the host name.
+
+The chain of each certificate is built using the other certificates in the same
+file or sent by the same server. Files and endpoints are scanned concurrently.
+
+## POSITIONAL ARGUMENTS
+
+<path|host:port>
+:  A certificate file, a directory, or the address of a TLS server like
+'smallstep.com:443' or 'https://smallstep.com'. Multiple values can be given.
+
+## EXIT CODES
+
+This command returns 0 on success and \>0 if any error occurs. Errors reading
+a file or connecting to a server are included in the results and do not change
+the exit code.
+
+## EXAMPLES
+
+Scan the certificates in a directory:
+
+'''
+$ step certificate scan /etc/ssl
+'''
+
+Scan a list of servers, one host:port per line, using 20 concurrent
+connections and a timeout of 5 seconds:
+
+'''
+$ step certificate scan --targets servers.txt --concurrency 20 --timeout 5s
+'''
+
+Scan a directory and a server using a custom root certificate, and print the
+results in CSV:
+
+'''
+$ step certificate scan /etc/nginx/certs internal.example.com:8443 \
+  --roots ./root-ca.crt --format csv
+'''
+
+Scan the PKCS#12 files in a directory and print the results in JSON:
+
+'''
+$ step certificate scan ./keystores --password-file ./password.txt --format json
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name: "targets",
+				Usage: `The <file> with a list of paths or TLS servers to scan, one per line. Empty
+lines and lines starting with '#' are ignored.`,
+			},
+			cli.StringFlag{
+				Name:  "format",
+				Value: "table",
+				Usage: `The <format> of the results.
+
+: <format> is a string and must be one of:
+
+    **table**
+    :  Print a table suitable for a human to read.
+
+    **json**
+    :  Print an array with the details of each certificate in JSON format.
+
+    **csv**
+    :  Print the details of each certificate in comma-separated values.`,
+			},
+			cli.StringFlag{
+				Name: "roots",
+				Usage: `Root certificate(s) used to verify the chain of the certificates. Defaults to
+the system's default root certificate bundle.
+
+: <roots> is a case-sensitive string and may be one of:
+
+    **file**
+	:  Relative or full path to a file. All certificates in the file will be used for path validation.
+
+    **list of files**
+	:  Comma-separated list of relative or full file paths. Every PEM encoded certificate from each file will be used for path validation.
+
+    **directory**
+	:  Relative or full path to a directory. Every PEM encoded certificate from each file in the directory will be used for path validation.`,
+			},
+			rootsPasswordFileFlag,
+			cli.IntFlag{
+				Name:  "concurrency",
+				Value: 10,
+				Usage: `The maximum <number> of files or servers scanned at the same time.`,
+			},
+			cli.StringFlag{
+				Name:  "timeout",
+				Value: "10s",
+				Usage: `The <duration> after which a connection to a server is aborted.`,
+			},
+			cli.StringFlag{
+				Name: "password-file",
+				Usage: `The path to the <file> containing the password to decrypt PKCS#12 files. If
+not set, an empty password is used.`,
+			},
+		},
+	}
+}
+
+// scanCertificate are the details collected of a certificate.
+type scanCertificate struct {
+	Subject      string    `json:"subject"`
+	SANs         []string  `json:"sans,omitempty"`
+	Issuer       string    `json:"issuer"`
+	SerialNumber string    `json:"serial_number"`
+	Key          string    `json:"key"`
+	NotBefore    time.Time `json:"not_before"`
+	NotAfter     time.Time `json:"not_after"`
+	Fingerprint  string    `json:"fingerprint"`
+	Valid        bool      `json:"valid"`
+	VerifyError  string    `json:"verify_error,omitempty"`
+}
+
+// scanResult is a certificate found in a file or TLS server. If the file or
+// server cannot be scanned, only the error is set.
+type scanResult struct {
+	Source string `json:"source"`
+	*scanCertificate
+	Error string `json:"error,omitempty"`
+}
+
+// scanTarget is a file or a TLS server to scan. Files found walking a
+// directory are optional, and are ignored if they don't contain certificates.
+type scanTarget struct {
+	source   string
+	endpoint bool
+	optional bool
+}
+
+// scanner collects the certificates in the targets.
+type scanner struct {
+	roots    *x509.CertPool
+	password []byte
+	timeout  time.Duration
+}
+
+func scanAction(ctx *cli.Context) error {
+	var (
+		format      = ctx.String("format")
+		concurrency = ctx.Int("concurrency")
+	)
+
+	switch format {
+	case "table", "json", "csv":
+	default:
+		return errs.InvalidFlagValue(ctx, "format", format, "table, json, csv")
+	}
+	if concurrency <= 0 {
+		return errs.InvalidFlagValue(ctx, "concurrency", ctx.String("concurrency"), "")
+	}
+	timeout, err := time.ParseDuration(ctx.String("timeout"))
+	if err != nil || timeout <= 0 {
+		return errs.InvalidFlagValue(ctx, "timeout", ctx.String("timeout"), "")
+	}
+
+	args := ctx.Args()
+	if targetsFile := ctx.String("targets"); targetsFile != "" {
+		lines, err := readScanTargets(targetsFile)
+		if err != nil {
+			return err
+		}
+		args = append(args, lines...)
+	}
+	if len(args) == 0 {
+		return errs.MissingArguments(ctx, "path|host:port")
+	}
+
+	s := &scanner{timeout: timeout}
+	if roots := ctx.String("roots"); roots != "" {
+		if s.roots, err = x509util.ReadCertPool(roots, rootsOptions(ctx.String("roots-password-file"))...); err != nil {
+			return errors.Wrapf(err, "failure to load root certificate pool from input path '%s'", roots)
+		}
+	}
+	if passFile := ctx.String("password-file"); passFile != "" {
+		if s.password, err = utils.ReadPasswordFromFile(passFile); err != nil {
+			return err
+		}
+	}
+
+	targets, err := collectScanTargets(args)
+	if err != nil {
+		return err
+	}
+
+	// Scan the targets using a pool of workers, the results are kept in the
+	// same order as the targets.
+	results := make([][]scanResult, len(targets))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				results[j] = s.scan(targets[j])
+			}
+		}()
+	}
+	for i := range targets {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var all []scanResult
+	for _, r := range results {
+		all = append(all, r...)
+	}
+
+	switch format {
+	case "json":
+		if all == nil {
+			all = []scanResult{}
+		}
+		b, err := json.MarshalIndent(all, "", "  ")
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		fmt.Println(string(b))
+		return nil
+	case "csv":
+		return printScanCSV(all)
+	default:
+		printScanTable(all)
+		return nil
+	}
+}
+
+// readScanTargets reads the list of targets in a file.
+func readScanTargets(filename string) ([]string, error) {
+	b, err := utils.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var targets []string
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		targets = append(targets, line)
+	}
+	return targets, errors.Wrapf(sc.Err(), "error reading %s", filename)
+}
+
+// collectScanTargets returns the targets for the given arguments, walking
+// the directories recursively. Arguments that are not files or directories
+// are considered TLS servers.
+func collectScanTargets(args []string) ([]scanTarget, error) {
+	var targets []scanTarget
+	for _, arg := range args {
+		if _, addr, isURL := trimURLPrefix(arg); isURL {
+			targets = append(targets, scanTarget{source: addr, endpoint: true})
+			continue
+		}
+		info, err := os.Stat(arg)
+		switch {
+		case err == nil && info.IsDir():
+			err := filepath.Walk(arg, func(path string, fi os.FileInfo, err error) error {
+				if err != nil {
+					return nil
+				}
+				if fi.Mode().IsRegular() && fi.Size() <= maxScanFileSize {
+					targets = append(targets, scanTarget{source: path, optional: true})
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, errors.Wrapf(err, "error walking %s", arg)
+			}
+		case err == nil:
+			targets = append(targets, scanTarget{source: arg})
+		case os.IsNotExist(err) && strings.Contains(arg, ":"):
+			targets = append(targets, scanTarget{source: arg, endpoint: true})
+		default:
+			return nil, errs.FileError(err, arg)
+		}
+	}
+	return targets, nil
+}
+
+// scan returns the results of scanning the given target.
+func (s *scanner) scan(t scanTarget) []scanResult {
+	var (
+		certs []*x509.Certificate
+		host  string
+		err   error
+	)
+	if t.endpoint {
+		certs, host, err = s.scanEndpoint(t.source)
+	} else {
+		certs, err = s.scanFile(t.source)
+		if err == nil && len(certs) == 0 {
+			if t.optional {
+				return nil
+			}
+			err = errors.Errorf("%s does not contain certificates", t.source)
+		}
+	}
+	if err != nil {
+		return []scanResult{{Source: t.source, Error: err.Error()}}
+	}
+
+	results := make([]scanResult, len(certs))
+	for i, crt := range certs {
+		intermediates := x509.NewCertPool()
+		for j, c := range certs {
+			if i != j {
+				intermediates.AddCert(c)
+			}
+		}
+		opts := x509.VerifyOptions{
+			Roots:         s.roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		}
+		if i == 0 {
+			opts.DNSName = host
+		}
+		sc := &scanCertificate{
+			Subject:      crt.Subject.String(),
+			SANs:         x509util.SANs(crt),
+			Issuer:       crt.Issuer.String(),
+			SerialNumber: crt.SerialNumber.String(),
+			Key:          x509util.PublicKeyString(crt.PublicKey),
+			NotBefore:    crt.NotBefore,
+			NotAfter:     crt.NotAfter,
+			Fingerprint:  x509util.Fingerprint(crt),
+			Valid:        true,
+		}
+		if _, err := crt.Verify(opts); err != nil {
+			sc.Valid = false
+			sc.VerifyError = err.Error()
+		}
+		results[i] = scanResult{Source: t.source, scanCertificate: sc}
+	}
+	return results
+}
+
+// scanEndpoint returns the certificates sent by a TLS server and the host
+// name used to verify the leaf certificate. The certificates are not
+// verified in the handshake.
+func (s *scanner) scanEndpoint(addr string) ([]*x509.Certificate, string, error) {
+	host := addr
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		host = h
+	}
+	cs, err := dialTLS(addr, &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: true,
+	}, "", s.timeout)
+	if err != nil {
+		return nil, "", err
+	}
+	return cs.PeerCertificates, host, nil
+}
+
+// scanFile returns the certificates in a PEM, DER, PKCS#7 or PKCS#12 file. It
+// returns an empty list if the file format is not recognized.
+func (s *scanner) scanFile(filename string) ([]*x509.Certificate, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errs.FileError(err, filename)
+	}
+
+	// PEM format, including PKCS#7 blocks
+	if bytes.Contains(b, []byte("-----BEGIN ")) {
+		var (
+			block *pem.Block
+			certs []*x509.Certificate
+		)
+		for len(b) > 0 {
+			block, b = pem.Decode(b)
+			if block == nil {
+				break
+			}
+			switch block.Type {
+			case "CERTIFICATE":
+				crt, err := x509.ParseCertificate(block.Bytes)
+				if err != nil {
+					return nil, errors.Wrapf(err, "error parsing %s", filename)
+				}
+				certs = append(certs, crt)
+			case pemutil.PKCS7Type:
+				bundle, err := pemutil.ParsePKCS7(block.Bytes)
+				if err != nil {
+					return nil, errors.Wrapf(err, "error parsing %s", filename)
+				}
+				certs = append(certs, bundle...)
+			}
+		}
+		return certs, nil
+	}
+
+	// PKCS#7 format
+	if pemutil.IsPKCS7(b) {
+		certs, err := pemutil.ParsePKCS7(b)
+		return certs, errors.Wrapf(err, "error parsing %s", filename)
+	}
+
+	// PKCS#12 format
+	if pemutil.IsPKCS12(b) {
+		_, crt, chain, err := pemutil.DecodePKCS12(b, s.password)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing %s", filename)
+		}
+		if crt == nil {
+			return chain, nil
+		}
+		return append([]*x509.Certificate{crt}, chain...), nil
+	}
+
+	// DER format
+	if crt, err := x509.ParseCertificate(b); err == nil {
+		return []*x509.Certificate{crt}, nil
+	}
+	return nil, nil
+}
+
+// printScanTable prints the results in a table.
+func printScanTable(results []scanResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "SOURCE\tSUBJECT\tISSUER\tKEY\tNOT AFTER\tVALID")
+	for _, r := range results {
+		if r.scanCertificate == nil {
+			fmt.Fprintf(w, "%s\t-\t-\t-\t-\terror: %s\n", r.Source, r.Error)
+			continue
+		}
+		valid := "yes"
+		if !r.Valid {
+			valid = "no: " + r.VerifyError
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Source, r.Subject, r.Issuer, r.Key,
+			r.NotAfter.UTC().Format(time.RFC3339), valid)
+	}
+	w.Flush()
+}
+
+// printScanCSV prints the results in comma-separated values.
+func printScanCSV(results []scanResult) error {
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{
+		"source", "subject", "sans", "issuer", "serial_number", "key", "not_before",
+		"not_after", "fingerprint", "valid", "verify_error", "error",
+	})
+	for _, r := range results {
+		if r.scanCertificate == nil {
+			w.Write([]string{r.Source, "", "", "", "", "", "", "", "", "", "", r.Error})
+			continue
+		}
+		w.Write([]string{
+			r.Source, r.Subject, strings.Join(r.SANs, " "), r.Issuer, r.SerialNumber, r.Key,
+			r.NotBefore.UTC().Format(time.RFC3339), r.NotAfter.UTC().Format(time.RFC3339),
+			r.Fingerprint, strconv.FormatBool(r.Valid), r.VerifyError, "",
+		})
+	}
+	w.Flush()
+	return errors.WithStack(w.Error())
+}
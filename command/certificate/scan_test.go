@@ -0,0 +1,105 @@
+package certificate
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/x509util"
+)
+
+func TestScanner_scan(t *testing.T) {
+	mustCertificate := func(p x509util.Profile, err error) (*x509.Certificate, x509util.Profile) {
+		assert.FatalError(t, err)
+		b, err := p.CreateCertificate()
+		assert.FatalError(t, err)
+		crt, err := x509.ParseCertificate(b)
+		assert.FatalError(t, err)
+		return crt, p
+	}
+	root, rootProfile := mustCertificate(x509util.NewRootProfile("root"))
+	leaf, leafProfile := mustCertificate(x509util.NewLeafProfile("leaf", root, rootProfile.SubjectPrivateKey()))
+
+	dir, err := ioutil.TempDir("", "scan")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+
+	write := func(name string, b []byte) string {
+		fn := filepath.Join(dir, name)
+		assert.FatalError(t, ioutil.WriteFile(fn, b, 0600))
+		return fn
+	}
+	p7b, err := pemutil.EncodePKCS7([]*x509.Certificate{leaf, root})
+	assert.FatalError(t, err)
+	p12, err := pemutil.EncodePKCS12(leafProfile.SubjectPrivateKey(), leaf, []*x509.Certificate{root}, []byte("pass"), pemutil.DefaultPKCS12Options())
+	assert.FatalError(t, err)
+
+	pemFile := write("bundle.crt", append(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw})...))
+	derFile := write("root.der", root.Raw)
+	p7bFile := write("bundle.p7b", p7b)
+	p12File := write("leaf.p12", p12)
+	otherFile := write("other.txt", []byte("foo"))
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	s := &scanner{roots: roots, password: []byte("pass")}
+
+	tests := []struct {
+		name   string
+		target scanTarget
+		want   []string
+		err    bool
+	}{
+		{"pem", scanTarget{source: pemFile}, []string{"CN=leaf", "CN=root"}, false},
+		{"der", scanTarget{source: derFile}, []string{"CN=root"}, false},
+		{"p7b", scanTarget{source: p7bFile}, []string{"CN=leaf", "CN=root"}, false},
+		{"p12", scanTarget{source: p12File}, []string{"CN=leaf", "CN=root"}, false},
+		{"other optional", scanTarget{source: otherFile, optional: true}, nil, false},
+		{"other", scanTarget{source: otherFile}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := s.scan(tt.target)
+			if tt.err {
+				assert.Len(t, 1, results)
+				assert.Nil(t, results[0].scanCertificate)
+				assert.NotEquals(t, "", results[0].Error)
+				return
+			}
+			assert.Len(t, len(tt.want), results)
+			for i, r := range results {
+				assert.Equals(t, tt.target.source, r.Source)
+				assert.Equals(t, tt.want[i], r.Subject)
+				assert.True(t, r.Valid)
+				assert.Equals(t, "", r.Error)
+			}
+		})
+	}
+
+	// Wrong PKCS#12 password.
+	s.password = []byte("foo")
+	results := s.scan(scanTarget{source: p12File})
+	assert.Len(t, 1, results)
+	assert.NotEquals(t, "", results[0].Error)
+
+	// Collect the files in a directory.
+	targets, err := collectScanTargets([]string{dir, "smallstep.com:443", "https://smallstep.com"})
+	assert.FatalError(t, err)
+	assert.Len(t, 7, targets)
+	for _, tt := range targets[:5] {
+		assert.True(t, tt.optional)
+		assert.False(t, tt.endpoint)
+	}
+	assert.Equals(t, scanTarget{source: "smallstep.com:443", endpoint: true}, targets[5])
+	assert.Equals(t, scanTarget{source: "smallstep.com", endpoint: true}, targets[6])
+
+	_, err = collectScanTargets([]string{filepath.Join(dir, "missing.crt")})
+	assert.Error(t, err)
+}
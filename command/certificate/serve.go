@@ -0,0 +1,479 @@
+package certificate
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/tlsutil"
+	"github.com/smallstep/cli/crypto/x509util"
+	"github.com/smallstep/cli/errs"
+	"github.com/urfave/cli"
+)
+
+func serveCommand() cli.Command {
+	return cli.Command{
+		Name:   "serve",
+		Action: cli.ActionFunc(serveAction),
+		Usage:  "serve a certificate over TLS and log the handshakes",
+		UsageText: `**step certificate serve** <crt_file> <key_file>
+[**--address**=<address>] [**--password-file**=<file>] [**--roots**=<file>]
+[**--roots-password-file**=<file>]
+[**--client-auth**=<type>] [**--min-version**=<version>] [**--max-version**=<version>]
+[**--cipher-suite**=<name>] [**--alpn**=<protocol>] [**--timeout**=<duration>]`,
+		Description: `**step certificate serve** starts a TLS server using the given
+certificate and key, and logs the details of every TLS handshake. It's meant
+to debug TLS clients that cannot connect to a server.
+
+For every connection, the server prints the ClientHello sent by the client,
+including the server name indication (SNI), the offered TLS versions, cipher
+suites, ALPN protocols, signature schemes and curves, and then the negotiated
+protocol version, cipher suite and ALPN protocol, or the error if the handshake
+fails. If the client sends an HTTP/1.1 request after the handshake, the server
+responds with the same information.
+
+The supported TLS versions and cipher suites can be constrained to reproduce
+the configuration of other servers. Client certificates can be requested and
+verified using the root certificates in '--roots'.
+
+This command is only intended for test purposes. The server runs until it's
+interrupted.
+
+## POSITIONAL ARGUMENTS
+
+<crt_file>
+:  The path to the certificate to serve. If the file contains a bundle, the
+rest of the certificates are sent as the chain.
+
+<key_file>
+:  The path to the private key of the certificate.
+
+## EXAMPLES
+
+Serve a certificate and its chain on port 8443:
+
+'''
+$ step certificate serve ./bundle.crt ./leaf.key --address :8443
+'''
+
+Serve a certificate using only TLS 1.2 and a given cipher suite:
+
+'''
+$ step certificate serve ./leaf.crt ./leaf.key \
+--min-version 1.2 --max-version 1.2 \
+--cipher-suite TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256
+'''
+
+Serve a certificate offering HTTP/2 and HTTP/1.1 using ALPN:
+
+'''
+$ step certificate serve ./leaf.crt ./leaf.key --alpn h2 --alpn http/1.1
+'''
+
+Serve a certificate requiring client certificates signed by a root:
+
+'''
+$ step certificate serve ./leaf.crt ./leaf.key --roots ./root_ca.crt
+'''
+
+Serve a certificate requesting, but not requiring, client certificates:
+
+'''
+$ step certificate serve ./leaf.crt ./leaf.key --roots ./root_ca.crt \
+--client-auth verify-if-given
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "address",
+				Usage: "The TCP <address> to listen on (e.g. \":8443\").",
+				Value: "127.0.0.1:8443",
+			},
+			cli.StringFlag{
+				Name:  "password-file",
+				Usage: `The path to the <file> containing the password to decrypt the private key.`,
+			},
+			cli.StringFlag{
+				Name: "roots",
+				Usage: `Root certificate(s) used to verify the client certificates. Setting it
+requires and verifies the client certificates unless '--client-auth' is set.
+
+: <roots> is a case-sensitive string and may be one of:
+
+    **file**
+	:  Relative or full path to a file. All certificates in the file will be used for path validation.
+
+    **list of files**
+	:  Comma-separated list of relative or full file paths. Every PEM encoded certificate from each file will be used for path validation.
+
+    **directory**
+	:  Relative or full path to a directory. Every PEM encoded certificate from each file in the directory will be used for path validation.`,
+			},
+			rootsPasswordFileFlag,
+			cli.StringFlag{
+				Name: "client-auth",
+				Usage: `The <type> of client authentication. Defaults to **none**, or to
+**require-and-verify** if '--roots' is set.
+
+: <type> is a string and must be one of:
+
+    **none**
+    :  Do not request client certificates.
+
+    **request**
+    :  Request client certificates, but do not require or verify them.
+
+    **require**
+    :  Require client certificates, but do not verify them.
+
+    **verify-if-given**
+    :  Request client certificates and verify them if they are sent.
+
+    **require-and-verify**
+    :  Require client certificates and verify them.`,
+			},
+			cli.StringFlag{
+				Name:  "min-version",
+				Usage: `The minimum TLS <version> supported: 1.0, 1.1, 1.2 or 1.3.`,
+				Value: "1.2",
+			},
+			cli.StringFlag{
+				Name:  "max-version",
+				Usage: `The maximum TLS <version> supported: 1.0, 1.1, 1.2 or 1.3.`,
+				Value: "1.3",
+			},
+			cli.StringSliceFlag{
+				Name: "cipher-suite",
+				Usage: `The <name> of a cipher suite supported in TLS 1.2 and earlier, e.g.
+TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256. Use the '--cipher-suite' flag multiple
+times to support multiple cipher suites. Defaults to the cipher suites of the
+Go TLS library.`,
+			},
+			cli.StringSliceFlag{
+				Name: "alpn",
+				Usage: `The ALPN <protocol> supported, e.g. h2 or http/1.1. Use the '--alpn' flag
+multiple times to support multiple protocols.`,
+			},
+			cli.DurationFlag{
+				Name:  "timeout",
+				Usage: `The <duration> after which a connection is closed.`,
+				Value: 30 * time.Second,
+			},
+		},
+	}
+}
+
+// clientAuthTypes are the values supported by the --client-auth flag.
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"none":               tls.NoClientCert,
+	"request":            tls.RequestClientCert,
+	"require":            tls.RequireAnyClientCert,
+	"verify-if-given":    tls.VerifyClientCertIfGiven,
+	"require-and-verify": tls.RequireAndVerifyClientCert,
+}
+
+func serveAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 2); err != nil {
+		return err
+	}
+
+	var (
+		crtFile    = ctx.Args().Get(0)
+		keyFile    = ctx.Args().Get(1)
+		address    = ctx.String("address")
+		roots      = ctx.String("roots")
+		clientAuth = ctx.String("client-auth")
+	)
+
+	if address == "" {
+		return errs.RequiredFlag(ctx, "address")
+	}
+	tlsOpts := &tlsutil.TLSOptions{
+		CipherSuites: x509util.CipherSuites(ctx.StringSlice("cipher-suite")),
+	}
+	for _, name := range []string{"min-version", "max-version"} {
+		f, err := strconv.ParseFloat(ctx.String(name), 64)
+		if err != nil || x509util.TLSVersion(f).Validate() != nil {
+			return errs.InvalidFlagValue(ctx, name, ctx.String(name), "1.0, 1.1, 1.2, 1.3")
+		}
+		if name == "min-version" {
+			tlsOpts.MinVersion = x509util.TLSVersion(f)
+		} else {
+			tlsOpts.MaxVersion = x509util.TLSVersion(f)
+		}
+	}
+	if tlsOpts.MinVersion > tlsOpts.MaxVersion {
+		return errs.IncompatibleFlagValues(ctx, "min-version", ctx.String("min-version"), "max-version", ctx.String("max-version"))
+	}
+	for _, name := range tlsOpts.CipherSuites {
+		if err := x509util.CipherSuites([]string{name}).Validate(); err != nil {
+			return errs.InvalidFlagValue(ctx, "cipher-suite", name, "")
+		}
+	}
+
+	config := tlsOpts.TLSConfig()
+	config.NextProtos = ctx.StringSlice("alpn")
+	if len(tlsOpts.CipherSuites) == 0 {
+		// Use the default cipher suites
+		config.CipherSuites = nil
+	}
+
+	// Client authentication
+	if clientAuth == "" {
+		if roots != "" {
+			clientAuth = "require-and-verify"
+		} else {
+			clientAuth = "none"
+		}
+	}
+	authType, ok := clientAuthTypes[clientAuth]
+	if !ok {
+		return errs.InvalidFlagValue(ctx, "client-auth", clientAuth, "none, request, require, verify-if-given, require-and-verify")
+	}
+	config.ClientAuth = authType
+	if roots != "" {
+		pool, err := x509util.ReadCertPool(roots, rootsOptions(ctx.String("roots-password-file"))...)
+		if err != nil {
+			return errors.Wrapf(err, "failure to load root certificate pool from input path '%s'", roots)
+		}
+		config.ClientCAs = pool
+	} else if authType == tls.VerifyClientCertIfGiven || authType == tls.RequireAndVerifyClientCert {
+		return errs.RequiredWithFlagValue(ctx, "client-auth", clientAuth, "roots")
+	}
+
+	// Server certificate
+	chain, err := pemutil.ReadCertificateBundle(crtFile)
+	if err != nil {
+		return err
+	}
+	var pemOpts []pemutil.Options
+	if passFile := ctx.String("password-file"); passFile != "" {
+		pemOpts = append(pemOpts, pemutil.WithPasswordFile(passFile))
+	}
+	key, err := pemutil.Read(keyFile, pemOpts...)
+	if err != nil {
+		return err
+	}
+	crt := tls.Certificate{PrivateKey: key, Leaf: chain[0]}
+	for _, c := range chain {
+		crt.Certificate = append(crt.Certificate, c.Raw)
+	}
+	config.Certificates = []tls.Certificate{crt}
+
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return errors.Wrapf(err, "failed to listen on at %s", address)
+	}
+	defer l.Close()
+
+	fmt.Printf("Serving TLS at %s ...\n", l.Addr().String())
+	srv := &tlsServer{
+		config:  config,
+		timeout: ctx.Duration("timeout"),
+		out:     os.Stdout,
+	}
+	return srv.Serve(l)
+}
+
+// tlsServer is a TLS server that logs the details of the handshakes.
+type tlsServer struct {
+	config  *tls.Config
+	timeout time.Duration
+	out     io.Writer
+	mu      sync.Mutex
+	count   int
+}
+
+// Serve accepts connections on the listener and handles them in a new
+// goroutine.
+func (s *tlsServer) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return errors.Wrap(err, "error accepting connection")
+		}
+		s.mu.Lock()
+		s.count++
+		id := s.count
+		s.mu.Unlock()
+		go s.handle(conn, id)
+	}
+}
+
+// handle runs the TLS handshake in the connection and prints the result. If
+// the handshake succeeds and the client sends an HTTP request, the result is
+// also written in the response.
+func (s *tlsServer) handle(conn net.Conn, id int) {
+	defer conn.Close()
+	if s.timeout > 0 {
+		conn.SetDeadline(time.Now().Add(s.timeout))
+	}
+
+	var hello string
+	config := s.config.Clone()
+	config.GetConfigForClient = func(info *tls.ClientHelloInfo) (*tls.Config, error) {
+		hello = clientHelloText(info)
+		return nil, nil
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Connection #%d from %s:\n", id, conn.RemoteAddr())
+	tlsConn := tls.Server(conn, config)
+	err := tlsConn.Handshake()
+	b.WriteString(hello)
+	if err != nil {
+		fmt.Fprintf(&b, "Handshake failed: %v\n", err)
+	} else {
+		b.WriteString(serverConnectionStateText(tlsConn.ConnectionState()))
+	}
+
+	s.mu.Lock()
+	s.out.Write(b.Bytes())
+	fmt.Fprintln(s.out)
+	s.mu.Unlock()
+
+	if err != nil {
+		return
+	}
+	switch tlsConn.ConnectionState().NegotiatedProtocol {
+	case "", "http/1.1":
+		req, err := http.ReadRequest(bufio.NewReader(tlsConn))
+		if err != nil {
+			return
+		}
+		req.Body.Close()
+		resp := &http.Response{
+			StatusCode:    http.StatusOK,
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": []string{"text/plain; charset=utf-8"}},
+			Body:          ioutil.NopCloser(&b),
+			ContentLength: int64(b.Len()),
+			Close:         true,
+		}
+		resp.Write(tlsConn)
+	}
+}
+
+// clientHelloText returns the details of a ClientHello message in a human
+// readable format.
+func clientHelloText(info *tls.ClientHelloInfo) string {
+	var versions, suites, schemes, curves []string
+	for _, v := range info.SupportedVersions {
+		versions = append(versions, tlsVersionName(v))
+	}
+	for _, c := range info.CipherSuites {
+		suites = append(suites, cipherSuiteName(c))
+	}
+	for _, s := range info.SignatureSchemes {
+		schemes = append(schemes, signatureSchemeName(s))
+	}
+	for _, c := range info.SupportedCurves {
+		curves = append(curves, curveName(c))
+	}
+	serverName := info.ServerName
+	if serverName == "" {
+		serverName = "none"
+	}
+
+	var b strings.Builder
+	b.WriteString("ClientHello:\n")
+	fmt.Fprintf(&b, "    Server Name: %s\n", serverName)
+	fmt.Fprintf(&b, "    Versions: %s\n", listText(versions))
+	b.WriteString("    Cipher Suites:\n")
+	for _, s := range suites {
+		fmt.Fprintf(&b, "        %s\n", s)
+	}
+	fmt.Fprintf(&b, "    ALPN: %s\n", listText(info.SupportedProtos))
+	fmt.Fprintf(&b, "    Signature Schemes: %s\n", listText(schemes))
+	fmt.Fprintf(&b, "    Curves: %s\n", listText(curves))
+	return b.String()
+}
+
+// serverConnectionStateText returns the negotiated parameters of a TLS
+// connection and the client certificate, if any.
+func serverConnectionStateText(cs tls.ConnectionState) string {
+	var b strings.Builder
+	b.WriteString(connectionStateText(cs))
+	if len(cs.PeerCertificates) == 0 {
+		b.WriteString("    Client Certificate: none\n")
+		return b.String()
+	}
+	crt := cs.PeerCertificates[0]
+	fmt.Fprintf(&b, "    Client Certificate: %s\n", crt.Subject)
+	fmt.Fprintf(&b, "        Issuer: %s\n", crt.Issuer)
+	if len(cs.VerifiedChains) > 0 {
+		b.WriteString("        Verified: true\n")
+	} else {
+		b.WriteString("        Verified: false\n")
+	}
+	return b.String()
+}
+
+func listText(items []string) string {
+	if len(items) == 0 {
+		return "none"
+	}
+	return strings.Join(items, ", ")
+}
+
+// signatureSchemeNames are the names of the signature schemes supported by
+// the tls package and other common ones.
+var signatureSchemeNames = map[tls.SignatureScheme]string{
+	tls.PKCS1WithSHA1:          "PKCS1WithSHA1",
+	tls.PKCS1WithSHA256:        "PKCS1WithSHA256",
+	tls.PKCS1WithSHA384:        "PKCS1WithSHA384",
+	tls.PKCS1WithSHA512:        "PKCS1WithSHA512",
+	tls.PSSWithSHA256:          "PSSWithSHA256",
+	tls.PSSWithSHA384:          "PSSWithSHA384",
+	tls.PSSWithSHA512:          "PSSWithSHA512",
+	tls.ECDSAWithP256AndSHA256: "ECDSAWithP256AndSHA256",
+	tls.ECDSAWithP384AndSHA384: "ECDSAWithP384AndSHA384",
+	tls.ECDSAWithP521AndSHA512: "ECDSAWithP521AndSHA512",
+	tls.ECDSAWithSHA1:          "ECDSAWithSHA1",
+	tls.Ed25519:                "Ed25519",
+	0x0808:                     "Ed448",
+	0x0809:                     "PSSPSSWithSHA256",
+	0x080a:                     "PSSPSSWithSHA384",
+	0x080b:                     "PSSPSSWithSHA512",
+}
+
+func signatureSchemeName(s tls.SignatureScheme) string {
+	if name, ok := signatureSchemeNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown (0x%04x)", uint16(s))
+}
+
+// curveNames are the names of the elliptic curves supported by the tls
+// package and other common key exchange groups.
+var curveNames = map[tls.CurveID]string{
+	tls.CurveP256: "P-256",
+	tls.CurveP384: "P-384",
+	tls.CurveP521: "P-521",
+	tls.X25519:    "X25519",
+	0x001e:        "X448",
+	0x0100:        "ffdhe2048",
+	0x0101:        "ffdhe3072",
+	0x0102:        "ffdhe4096",
+	0x0103:        "ffdhe6144",
+	0x0104:        "ffdhe8192",
+}
+
+func curveName(c tls.CurveID) string {
+	if name, ok := curveNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown (0x%04x)", uint16(c))
+}
@@ -0,0 +1,108 @@
+package certificate
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/cli/crypto/x509util"
+)
+
+func TestTLSServer_handle(t *testing.T) {
+	mustProfile := func(p x509util.Profile, err error) (*x509.Certificate, x509util.Profile) {
+		assert.FatalError(t, err)
+		b, err := p.CreateCertificate()
+		assert.FatalError(t, err)
+		crt, err := x509.ParseCertificate(b)
+		assert.FatalError(t, err)
+		return crt, p
+	}
+	root, rootProfile := mustProfile(x509util.NewRootProfile("root"))
+	leaf, leafProfile := mustProfile(x509util.NewLeafProfile("localhost", root, rootProfile.SubjectPrivateKey(),
+		x509util.WithHosts("localhost")))
+	client, clientProfile := mustProfile(x509util.NewLeafProfile("client", root, rootProfile.SubjectPrivateKey()))
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+
+	serverCert := tls.Certificate{Certificate: [][]byte{leaf.Raw}, PrivateKey: leafProfile.SubjectPrivateKey()}
+	clientCert := tls.Certificate{Certificate: [][]byte{client.Raw}, PrivateKey: clientProfile.SubjectPrivateKey()}
+
+	tests := []struct {
+		name         string
+		serverConfig *tls.Config
+		clientConfig *tls.Config
+		contains     []string
+	}{
+		{"ok", &tls.Config{
+			Certificates: []tls.Certificate{serverCert},
+			NextProtos:   []string{"http/1.1"},
+		}, &tls.Config{
+			ServerName: "localhost",
+			RootCAs:    roots,
+			NextProtos: []string{"h2", "http/1.1"},
+		}, []string{"Connection #1 from", "Server Name: localhost", "Versions: TLS 1.3", "ALPN: h2, http/1.1",
+			"Protocol: TLS 1.3", "ALPN: http/1.1", "Client Certificate: none"}},
+		{"tls 1.2", &tls.Config{
+			Certificates: []tls.Certificate{serverCert},
+			MaxVersion:   tls.VersionTLS12,
+			CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+		}, &tls.Config{
+			ServerName: "localhost",
+			RootCAs:    roots,
+		}, []string{"Protocol: TLS 1.2", "Cipher Suite: TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", "ALPN: none"}},
+		{"client certificate", &tls.Config{
+			Certificates: []tls.Certificate{serverCert},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    roots,
+		}, &tls.Config{
+			ServerName:   "localhost",
+			RootCAs:      roots,
+			Certificates: []tls.Certificate{clientCert},
+		}, []string{"Client Certificate: CN=client", "Issuer: CN=root", "Verified: true"}},
+		{"handshake failure", &tls.Config{
+			Certificates: []tls.Certificate{serverCert},
+			MinVersion:   tls.VersionTLS13,
+		}, &tls.Config{
+			ServerName: "localhost",
+			RootCAs:    roots,
+			MaxVersion: tls.VersionTLS12,
+		}, []string{"ClientHello:", "Versions: TLS 1.2", "Handshake failed:"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			srv := &tlsServer{config: tt.serverConfig, timeout: 5 * time.Second, out: &out}
+			c, s := net.Pipe()
+			done := make(chan struct{})
+			go func() {
+				srv.handle(s, 1)
+				close(done)
+			}()
+
+			conn := tls.Client(c, tt.clientConfig)
+			if err := conn.Handshake(); err == nil {
+				req, err := http.NewRequest("GET", "https://localhost/", nil)
+				assert.FatalError(t, err)
+				assert.FatalError(t, req.Write(conn))
+				b, err := ioutil.ReadAll(conn)
+				assert.FatalError(t, err)
+				assert.True(t, strings.HasPrefix(string(b), "HTTP/1.1 200 OK"))
+				assert.True(t, strings.Contains(string(b), "Client Certificate:"))
+			}
+			conn.Close()
+			<-done
+
+			for _, s := range tt.contains {
+				assert.True(t, strings.Contains(out.String(), s), "output does not contain "+s)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package certificate
 
 import (
+	"crypto/x509"
 	"encoding/pem"
 	"fmt"
 	"io/ioutil"
@@ -8,6 +9,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/smallstep/cli/crypto/x509util"
 	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/flags"
 	"github.com/urfave/cli"
 )
 
@@ -17,7 +19,9 @@ func signCommand() cli.Command {
 		Action: cli.ActionFunc(signAction),
 		Usage:  "sign a certificate signing request (CSR)",
 		UsageText: `**step certificate sign** <csr_file> <crt_file> <key_file>
-[**--bundle**]`,
+[**--bundle**] [**--template**=<file>] [**--set**=<key=value>] [**--set-file**=<file>]
+[**--signature-algorithm**=<algorithm>] [**--copy-extensions**=<mode>]
+[**--policy**=<file>]`,
 		Description: `**step certificate sign** generates a signed
 certificate from a certificate signing request (CSR).
 
@@ -32,6 +36,45 @@ certificate from a certificate signing request (CSR).
 <key_file>
 : The path to a private key for signing the CSR.
 
+## POLICY
+
+The **--policy** flag restricts what can be signed. The <file> is a JSON
+document with the following optional fields:
+
+**dns**
+: The allowed DNS names. A pattern like "*.example.com" matches one label, a
+pattern with a leading period like ".example.com" matches any subdomain, and
+other patterns must match exactly.
+
+**ips**
+: The allowed IP addresses or networks in CIDR notation.
+
+**emails**
+: The allowed email addresses, or domains using the same patterns as DNS names.
+
+**uris**
+: The allowed URI prefixes, e.g. "spiffe://example.org/".
+
+**allowWildcardNames**
+: Allow wildcard DNS names like "*.example.com", they must still match one of
+the DNS patterns. By default wildcard names are rejected.
+
+**maxValidity**
+: The maximum validity of the certificate, e.g. "2160h" or "90d".
+
+**keys**
+: The allowed key types, e.g. {"kty": "EC", "crv": "P-256"} or
+{"kty": "RSA", "minSize": 3072}. Any key is allowed if it is not set.
+
+**forbiddenExtensions**
+: The extensions that the certificate cannot contain, using object identifiers
+or names like basicConstraints or nameConstraints.
+
+Names of a type without patterns are not allowed. The common name is also
+checked if it is not one of the SANs and it looks like a DNS name, an IP
+address, an email address or a URI. All the violations are reported and the
+certificate is not signed.
+
 ## EXIT CODES
 
 This command returns 0 on success and \>0 if any error occurs.
@@ -48,12 +91,79 @@ Sign a certificate signing request and bundle the new certificate with the issue
 '''
 $ step certificate sign ./certificate-signing-request.csr \
 ./issuer-certificate.crt ./issuer-private-key.priv --bundle
+'''
+
+Sign a certificate signing request using RSA-PSS with SHA-384, the issuer key
+must be an RSA key:
+'''
+$ step certificate sign --signature-algorithm SHA384-RSAPSS \
+./certificate-signing-request.csr ./issuer-certificate.crt ./issuer-private-key.priv
+'''
+
+Sign a certificate signing request copying the requested extensions not already
+defined by the profile, like custom extensions:
+'''
+$ step certificate sign --copy-extensions copy \
+./certificate-signing-request.csr ./issuer-certificate.crt ./issuer-private-key.priv
+'''
+
+Sign a certificate signing request only if it complies with a policy:
+'''
+$ cat policy.json
+{
+  "dns": ["*.example.com"],
+  "ips": ["10.0.0.0/8"],
+  "maxValidity": "90d",
+  "keys": [{"kty": "EC", "crv": "P-256"}, {"kty": "RSA", "minSize": 3072}],
+  "forbiddenExtensions": ["basicConstraints", "nameConstraints"]
+}
+$ step certificate sign --policy policy.json \
+./certificate-signing-request.csr ./issuer-certificate.crt ./issuer-private-key.priv
+'''
+
+Sign a certificate signing request using a certificate template, the variables
+.Subject and .SANs will contain the common name and the SANs in the CSR:
+'''
+$ step certificate sign --template leaf.tpl --set team=backend \
+./certificate-signing-request.csr ./issuer-certificate.crt ./issuer-private-key.priv
 '''`,
 		Flags: []cli.Flag{
 			cli.BoolFlag{
 				Name:  "bundle",
 				Usage: `Bundle the new leaf certificate with the signing certificate.`,
 			},
+			signatureAlgorithmFlag,
+			cli.StringFlag{
+				Name:  "copy-extensions",
+				Value: x509util.CopyExtensionsNone,
+				Usage: `The <mode> used to copy the extensions requested in the CSR to the
+certificate. The subject alternative names are always copied, and the subject
+and authority key identifiers are always set by the issuer. The basic
+constraints, name constraints and key usage are never copied, so a CSR cannot
+request a certificate authority. Neither are the CRL distribution points and the
+authority information access, they are defined by the issuer.
+
+: <mode> must be one of:
+
+    **none**
+    :  Ignore the requested extensions.
+
+    **copy**
+    :  Copy the requested extensions not already defined by the profile or the
+	template, like custom extensions.
+
+    **copyall**
+    :  Copy all the requested extensions, replacing the ones defined by the
+	profile or the template, like the extended key usage.`,
+			},
+			cli.StringFlag{
+				Name: "policy",
+				Usage: `The <file> with the issuance policy, the certificate will only be signed
+if it complies with it. See the POLICY section for the format.`,
+			},
+			flags.Template,
+			flags.TemplateSet,
+			flags.TemplateSetFile,
 		},
 	}
 }
@@ -67,6 +177,17 @@ func signAction(ctx *cli.Context) error {
 	crtFile := ctx.Args().Get(1)
 	keyFile := ctx.Args().Get(2)
 
+	sigAlg, err := parseSignatureAlgorithm(ctx)
+	if err != nil {
+		return err
+	}
+	copyMode := ctx.String("copy-extensions")
+	switch copyMode {
+	case x509util.CopyExtensionsNone, x509util.CopyExtensions, x509util.CopyAllExtensions:
+	default:
+		return errs.InvalidFlagValue(ctx, "copy-extensions", copyMode, "none, copy, copyall")
+	}
+
 	csrBytes, err := ioutil.ReadFile(csrFile)
 	if err != nil {
 		return errors.WithStack(err)
@@ -84,14 +205,47 @@ func signAction(ctx *cli.Context) error {
 		return errors.WithStack(err)
 	}
 
-	leafProfile, err := x509util.NewLeafProfileWithCSR(csr, issuerIdentity.Crt,
-		issuerIdentity.Key)
-	if err != nil {
-		return errors.WithStack(err)
+	var opts []x509util.WithOption
+	if sigAlg != x509.UnknownSignatureAlgorithm {
+		opts = append(opts, x509util.WithSignatureAlgorithm(sigAlg))
+	}
+	opts = append(opts, x509util.WithRequestedExtensions(csr, copyMode))
+	if filename := ctx.String("policy"); filename != "" {
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return errs.FileError(err, filename)
+		}
+		policy, err := x509util.ParsePolicy(b)
+		if err != nil {
+			return errors.Wrapf(err, "error reading %s", filename)
+		}
+		opts = append(opts, x509util.WithPolicy(policy))
+	}
+
+	var leafProfile x509util.Profile
+	if ctx.IsSet("template") {
+		text, data, err := readTemplate(ctx, csr.Subject.CommonName, x509util.CSRSANs(csr))
+		if err != nil {
+			return err
+		}
+		leafProfile, err = x509util.NewProfileFromTemplate(text, data, issuerIdentity.Crt,
+			issuerIdentity.Key, append(opts, x509util.WithPublicKey(csr.PublicKey))...)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	} else {
+		leafProfile, err = x509util.NewLeafProfileWithCSR(csr, issuerIdentity.Crt,
+			issuerIdentity.Key, opts...)
+		if err != nil {
+			return errors.WithStack(err)
+		}
 	}
 
 	crtBytes, err := leafProfile.CreateCertificate()
 	if err != nil {
+		if _, ok := err.(*x509util.PolicyError); ok {
+			return err
+		}
 		return errors.Wrapf(err, "failure creating new leaf certificate from input csr")
 	}
 	pubPEMs := []*pem.Block{{
@@ -112,3 +266,4 @@ func signAction(ctx *cli.Context) error {
 
 	return nil
 }
+
@@ -0,0 +1,327 @@
+package certificate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// startTLSPorts are the protocols supported by --starttls and their default
+// ports.
+var startTLSPorts = map[string]string{
+	"smtp":     "25",
+	"imap":     "143",
+	"pop3":     "110",
+	"ftp":      "21",
+	"ldap":     "389",
+	"postgres": "5432",
+	"mysql":    "3306",
+	"xmpp":     "5222",
+}
+
+// negotiateStartTLS runs the STARTTLS negotiation of the given protocol in
+// the connection. After it, the connection is ready for the TLS handshake.
+func negotiateStartTLS(conn net.Conn, protocol, serverName string) error {
+	switch protocol {
+	case "smtp":
+		return startTLSSMTP(conn)
+	case "imap":
+		return startTLSIMAP(conn)
+	case "pop3":
+		return startTLSPOP3(conn)
+	case "ftp":
+		return startTLSFTP(conn)
+	case "ldap":
+		return startTLSLDAP(conn)
+	case "postgres":
+		return startTLSPostgres(conn)
+	case "mysql":
+		return startTLSMySQL(conn)
+	case "xmpp":
+		return startTLSXMPP(conn, serverName)
+	default:
+		return errors.Errorf("unsupported STARTTLS protocol '%s'", protocol)
+	}
+}
+
+// readLine reads a line and removes the line terminator.
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", errors.Wrap(err, "error reading response")
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readCodeResponse reads a, possibly multi-line, response with a three digit
+// code as used in SMTP and FTP, and fails if the code is not the expected one.
+func readCodeResponse(r *bufio.Reader, code string) error {
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return err
+		}
+		if len(line) < 3 || line[:3] != code {
+			return errors.Errorf("unexpected response '%s'", line)
+		}
+		if len(line) == 3 || line[3] == ' ' {
+			return nil
+		}
+	}
+}
+
+func startTLSSMTP(conn net.Conn) error {
+	r := bufio.NewReader(conn)
+	if err := readCodeResponse(r, "220"); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(conn, "EHLO step\r\n"); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := readCodeResponse(r, "250"); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(conn, "STARTTLS\r\n"); err != nil {
+		return errors.WithStack(err)
+	}
+	return readCodeResponse(r, "220")
+}
+
+func startTLSFTP(conn net.Conn) error {
+	r := bufio.NewReader(conn)
+	if err := readCodeResponse(r, "220"); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(conn, "AUTH TLS\r\n"); err != nil {
+		return errors.WithStack(err)
+	}
+	return readCodeResponse(r, "234")
+}
+
+func startTLSIMAP(conn net.Conn) error {
+	r := bufio.NewReader(conn)
+	line, err := readLine(r)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "* OK") {
+		return errors.Errorf("unexpected response '%s'", line)
+	}
+	if _, err := io.WriteString(conn, "a1 STARTTLS\r\n"); err != nil {
+		return errors.WithStack(err)
+	}
+	// Skip untagged responses.
+	for {
+		if line, err = readLine(r); err != nil {
+			return err
+		}
+		if strings.HasPrefix(line, "a1 ") {
+			break
+		}
+	}
+	if !strings.HasPrefix(line, "a1 OK") {
+		return errors.Errorf("unexpected response '%s'", line)
+	}
+	return nil
+}
+
+func startTLSPOP3(conn net.Conn) error {
+	r := bufio.NewReader(conn)
+	for i, cmd := range []string{"", "STLS\r\n"} {
+		if i > 0 {
+			if _, err := io.WriteString(conn, cmd); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		line, err := readLine(r)
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(line, "+OK") {
+			return errors.Errorf("unexpected response '%s'", line)
+		}
+	}
+	return nil
+}
+
+// ldapStartTLSRequest is an LDAP extended request with the StartTLS object
+// identifier, 1.3.6.1.4.1.1466.20037, and message id 1.
+var ldapStartTLSRequest = append([]byte{
+	0x30, 0x1d, // LDAPMessage
+	0x02, 0x01, 0x01, // messageID
+	0x77, 0x18, // [APPLICATION 23] ExtendedRequest
+	0x80, 0x16, // [0] requestName
+}, "1.3.6.1.4.1.1466.20037"...)
+
+func startTLSLDAP(conn net.Conn) error {
+	if _, err := conn.Write(ldapStartTLSRequest); err != nil {
+		return errors.WithStack(err)
+	}
+
+	// Read the header and the length of the LDAPMessage.
+	r := bufio.NewReader(conn)
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return errors.Wrap(err, "error reading response")
+	}
+	length := int(header[1])
+	if header[1]&0x80 != 0 {
+		n := int(header[1] & 0x7f)
+		if n == 0 || n > 3 {
+			return errors.New("error reading response: invalid length")
+		}
+		lb := make([]byte, n)
+		if _, err := io.ReadFull(r, lb); err != nil {
+			return errors.Wrap(err, "error reading response")
+		}
+		header = append(header, lb...)
+		length = 0
+		for _, b := range lb {
+			length = length<<8 | int(b)
+		}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return errors.Wrap(err, "error reading response")
+	}
+
+	var msg struct {
+		ID       int
+		Response asn1.RawValue
+	}
+	if _, err := asn1.Unmarshal(append(header, body...), &msg); err != nil {
+		return errors.Wrap(err, "error parsing response")
+	}
+	// [APPLICATION 24] ExtendedResponse
+	if msg.Response.Class != asn1.ClassApplication || msg.Response.Tag != 24 {
+		return errors.Errorf("unexpected response with tag %d", msg.Response.Tag)
+	}
+	var resultCode asn1.Enumerated
+	if _, err := asn1.Unmarshal(msg.Response.Bytes, &resultCode); err != nil {
+		return errors.Wrap(err, "error parsing response")
+	}
+	if resultCode != 0 {
+		return errors.Errorf("server returned result code %d", resultCode)
+	}
+	return nil
+}
+
+// postgresSSLRequest is the SSLRequest message of the PostgreSQL protocol.
+var postgresSSLRequest = []byte{0x00, 0x00, 0x00, 0x08, 0x04, 0xd2, 0x16, 0x2f}
+
+func startTLSPostgres(conn net.Conn) error {
+	if _, err := conn.Write(postgresSSLRequest); err != nil {
+		return errors.WithStack(err)
+	}
+	resp := make([]byte, 1)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return errors.Wrap(err, "error reading response")
+	}
+	if resp[0] != 'S' {
+		return errors.New("server does not support TLS")
+	}
+	return nil
+}
+
+// MySQL capability flags used in the SSL request.
+const (
+	mysqlClientSSL               = 0x00000800
+	mysqlClientProtocol41        = 0x00000200
+	mysqlClientSecureConnection  = 0x00008000
+	mysqlDefaultMaxPacketSize    = 1 << 24
+	mysqlDefaultCharacterSetUTF8 = 33
+)
+
+func startTLSMySQL(conn net.Conn) error {
+	// Read the initial handshake packet.
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return errors.Wrap(err, "error reading handshake")
+	}
+	length := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		return errors.Wrap(err, "error reading handshake")
+	}
+	if len(payload) == 0 || payload[0] != 10 {
+		return errors.New("unsupported handshake protocol")
+	}
+	// Skip the server version, connection id, auth plugin data and filler.
+	i := bytes.IndexByte(payload[1:], 0)
+	if i < 0 || len(payload) < i+2+4+8+1+2 {
+		return errors.New("error parsing handshake")
+	}
+	capabilities := binary.LittleEndian.Uint16(payload[i+2+4+8+1:])
+	if capabilities&mysqlClientSSL == 0 {
+		return errors.New("server does not support TLS")
+	}
+
+	// Send the SSL request packet with sequence id 1.
+	req := make([]byte, 4+32)
+	req[0], req[3] = 32, 1
+	binary.LittleEndian.PutUint32(req[4:], mysqlClientSSL|mysqlClientProtocol41|mysqlClientSecureConnection)
+	binary.LittleEndian.PutUint32(req[8:], mysqlDefaultMaxPacketSize)
+	req[12] = mysqlDefaultCharacterSetUTF8
+	_, err := conn.Write(req)
+	return errors.WithStack(err)
+}
+
+// maxXMPPResponseSize is the maximum size of the XMPP responses read.
+const maxXMPPResponseSize = 64 * 1024
+
+// readXMPPUntil reads from the connection until one of the given strings is
+// found, and returns the data read.
+func readXMPPUntil(r io.Reader, s ...string) (string, error) {
+	var buf bytes.Buffer
+	b := make([]byte, 4096)
+	for buf.Len() < maxXMPPResponseSize {
+		n, err := r.Read(b)
+		buf.Write(b[:n])
+		for _, v := range s {
+			if strings.Contains(buf.String(), v) {
+				return buf.String(), nil
+			}
+		}
+		if err != nil {
+			return "", errors.Wrap(err, "error reading response")
+		}
+	}
+	return "", errors.New("error reading response: response too large")
+}
+
+func startTLSXMPP(conn net.Conn, serverName string) error {
+	var to bytes.Buffer
+	if err := xml.EscapeText(&to, []byte(serverName)); err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err := fmt.Fprintf(conn, "<?xml version='1.0'?><stream:stream to='%s' xmlns='jabber:client' "+
+		"xmlns:stream='http://etherx.jabber.org/streams' version='1.0'>", to.String()); err != nil {
+		return errors.WithStack(err)
+	}
+	features, err := readXMPPUntil(conn, "</stream:features>")
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(features, "<starttls") {
+		return errors.New("server does not support TLS")
+	}
+	if _, err := io.WriteString(conn, "<starttls xmlns='urn:ietf:params:xml:ns:xmpp-tls'/>"); err != nil {
+		return errors.WithStack(err)
+	}
+	resp, err := readXMPPUntil(conn, "<proceed", "<failure")
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(resp, "<proceed") {
+		return errors.New("server rejected STARTTLS")
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package certificate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+// lineServer returns a fake server that writes the greeting and then, for
+// each expected command, reads a line and writes the response.
+func lineServer(greeting string, exchanges ...string) func(net.Conn) {
+	return func(conn net.Conn) {
+		r := bufio.NewReader(conn)
+		io.WriteString(conn, greeting)
+		for i := 0; i < len(exchanges); i += 2 {
+			line, err := r.ReadString('\n')
+			if err != nil || strings.TrimRight(line, "\r\n") != exchanges[i] {
+				io.WriteString(conn, "500 unexpected command\r\n")
+				return
+			}
+			io.WriteString(conn, exchanges[i+1])
+		}
+	}
+}
+
+func TestNegotiateStartTLS(t *testing.T) {
+	mysqlHandshake := func(capabilities uint16) func(net.Conn) {
+		return func(conn net.Conn) {
+			payload := []byte{10}
+			payload = append(payload, "8.0.0\x00"...)
+			payload = append(payload, make([]byte, 4+8+1)...)
+			payload = append(payload, byte(capabilities), byte(capabilities>>8))
+			header := []byte{byte(len(payload)), 0, 0, 0}
+			conn.Write(append(header, payload...))
+			req := make([]byte, 36)
+			io.ReadFull(conn, req)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		protocol string
+		server   func(net.Conn)
+		wantErr  bool
+	}{
+		{"smtp", "smtp", lineServer("220-mail.example.com ESMTP\r\n220 ready\r\n",
+			"EHLO step", "250-mail.example.com\r\n250 STARTTLS\r\n",
+			"STARTTLS", "220 go ahead\r\n"), false},
+		{"smtp fail", "smtp", lineServer("220 ready\r\n",
+			"EHLO step", "250 mail.example.com\r\n",
+			"STARTTLS", "454 TLS not available\r\n"), true},
+		{"ftp", "ftp", lineServer("220 ready\r\n", "AUTH TLS", "234 AUTH TLS successful\r\n"), false},
+		{"ftp fail", "ftp", lineServer("220 ready\r\n", "AUTH TLS", "502 not implemented\r\n"), true},
+		{"imap", "imap", lineServer("* OK IMAP4rev1 ready\r\n", "a1 STARTTLS", "* CAPABILITY IMAP4rev1\r\na1 OK begin TLS\r\n"), false},
+		{"imap fail", "imap", lineServer("* OK IMAP4rev1 ready\r\n", "a1 STARTTLS", "a1 BAD unknown command\r\n"), true},
+		{"pop3", "pop3", lineServer("+OK POP3 ready\r\n", "STLS", "+OK begin TLS\r\n"), false},
+		{"pop3 fail", "pop3", lineServer("+OK POP3 ready\r\n", "STLS", "-ERR unknown command\r\n"), true},
+		{"ldap", "ldap", func(conn net.Conn) {
+			req := make([]byte, len(ldapStartTLSRequest))
+			io.ReadFull(conn, req)
+			// ExtendedResponse with resultCode success, matchedDN and
+			// diagnosticMessage.
+			conn.Write([]byte{0x30, 0x0c, 0x02, 0x01, 0x01, 0x78, 0x07, 0x0a, 0x01, 0x00, 0x04, 0x00, 0x04, 0x00})
+		}, false},
+		{"ldap fail", "ldap", func(conn net.Conn) {
+			req := make([]byte, len(ldapStartTLSRequest))
+			io.ReadFull(conn, req)
+			conn.Write([]byte{0x30, 0x0c, 0x02, 0x01, 0x01, 0x78, 0x07, 0x0a, 0x01, 0x02, 0x04, 0x00, 0x04, 0x00})
+		}, true},
+		{"postgres", "postgres", func(conn net.Conn) {
+			req := make([]byte, 8)
+			io.ReadFull(conn, req)
+			if bytes.Equal(req, postgresSSLRequest) {
+				conn.Write([]byte("S"))
+			}
+		}, false},
+		{"postgres fail", "postgres", func(conn net.Conn) {
+			req := make([]byte, 8)
+			io.ReadFull(conn, req)
+			conn.Write([]byte("N"))
+		}, true},
+		{"mysql", "mysql", mysqlHandshake(0xffff), false},
+		{"mysql fail", "mysql", mysqlHandshake(0xffff &^ mysqlClientSSL), true},
+		{"xmpp", "xmpp", func(conn net.Conn) {
+			if _, err := readXMPPUntil(conn, "version='1.0'>"); err != nil {
+				return
+			}
+			io.WriteString(conn, "<stream:stream><stream:features><starttls xmlns='urn:ietf:params:xml:ns:xmpp-tls'/></stream:features>")
+			if _, err := readXMPPUntil(conn, "<starttls"); err != nil {
+				return
+			}
+			io.WriteString(conn, "<proceed xmlns='urn:ietf:params:xml:ns:xmpp-tls'/>")
+		}, false},
+		{"xmpp fail", "xmpp", func(conn net.Conn) {
+			if _, err := readXMPPUntil(conn, "version='1.0'>"); err != nil {
+				return
+			}
+			io.WriteString(conn, "<stream:stream><stream:features></stream:features>")
+		}, true},
+		{"unknown", "foo", func(conn net.Conn) {}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			go func() {
+				defer server.Close()
+				tt.server(server)
+			}()
+			err := negotiateStartTLS(client, tt.protocol, "example.com")
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestStartTLSMySQLRequest(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	req := make([]byte, 36)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer server.Close()
+		payload := append([]byte{10}, "8.0.0\x00"...)
+		payload = append(payload, make([]byte, 4+8+1)...)
+		payload = append(payload, 0xff, 0xff)
+		server.Write(append([]byte{byte(len(payload)), 0, 0, 0}, payload...))
+		io.ReadFull(server, req)
+	}()
+	assert.NoError(t, startTLSMySQL(client))
+	<-done
+
+	assert.Equals(t, []byte{32, 0, 0, 1}, req[:4])
+	assert.Equals(t, uint32(mysqlClientSSL|mysqlClientProtocol41|mysqlClientSecureConnection), binary.LittleEndian.Uint32(req[4:]))
+	assert.Equals(t, uint32(mysqlDefaultMaxPacketSize), binary.LittleEndian.Uint32(req[8:]))
+	assert.Equals(t, byte(mysqlDefaultCharacterSetUTF8), req[12])
+}
+
+func TestStartTLSXMPPServerName(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	var header string
+	go func() {
+		defer server.Close()
+		header, _ = readXMPPUntil(server, "version='1.0'>")
+	}()
+	// The server closes the connection after reading the stream header.
+	assert.Error(t, startTLSXMPP(client, "example.com' foo='<bar>"))
+	assert.True(t, strings.Contains(header, "to='example.com&#39; foo=&#39;&lt;bar&gt;' "))
+}
@@ -0,0 +1,51 @@
+package certificate
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/x509util"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+)
+
+// readTemplate returns the contents of the file in the --template flag and the
+// data used to render it. The data contains the given subject and SANs, and
+// the variables defined using the --set-file and --set flags.
+func readTemplate(ctx *cli.Context, subject string, sans []string) (string, x509util.TemplateData, error) {
+	templateFile := ctx.String("template")
+	b, err := utils.ReadFile(templateFile)
+	if err != nil {
+		return "", nil, errs.FileError(err, templateFile)
+	}
+
+	data := x509util.TemplateData{}
+	data.SetSubject(subject)
+	data.SetSANs(sans)
+
+	if setFile := ctx.String("set-file"); setFile != "" {
+		vb, err := utils.ReadFile(setFile)
+		if err != nil {
+			return "", nil, errs.FileError(err, setFile)
+		}
+		var vars map[string]interface{}
+		if err := json.Unmarshal(vb, &vars); err != nil {
+			return "", nil, errors.Wrapf(err, "error unmarshaling %s", setFile)
+		}
+		for k, v := range vars {
+			data.Set(k, v)
+		}
+	}
+
+	for _, s := range ctx.StringSlice("set") {
+		i := strings.Index(s, "=")
+		if i <= 0 {
+			return "", nil, errs.InvalidFlagValue(ctx, "set", s, "")
+		}
+		data.Set(s[:i], s[i+1:])
+	}
+
+	return string(b), data, nil
+}
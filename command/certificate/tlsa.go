@@ -0,0 +1,236 @@
+package certificate
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/errs"
+	"github.com/urfave/cli"
+)
+
+func tlsaCommand() cli.Command {
+	return cli.Command{
+		Name:   "tlsa",
+		Action: cli.ActionFunc(tlsaAction),
+		Usage:  "print the DANE TLSA record of a certificate",
+		UsageText: `**step certificate tlsa** <crt-file> [**--usage**=<usage>]
+[**--selector**=<selector>] [**--matching**=<matching>] [**--name**=<name>]
+[**--roots**=<root-bundle>] [**--roots-password-file**=<file>] [**--insecure**]
+[**--servername**=<name>] [**--starttls**=<protocol>] [**--client-cert**=<file>]
+[**--client-key**=<file>]`,
+		Description: `**step certificate tlsa** reads a certificate and prints to STDOUT the
+data of a DNS TLSA resource record as defined in RFC 6698, used to
+authenticate TLS servers with DANE.
+
+The certificate used depends on the certificate usage. For end entity usages
+(1 and 3) the first certificate in <crt-file> is used. For trust anchor usages
+(0 and 2) the last certificate in <crt-file>, usually the root or the top most
+intermediate of the chain, is used.
+
+## POSITIONAL ARGUMENTS
+
+<crt-file>
+:  A certificate PEM file or bundle, or the URL of a remote server.
+
+## EXAMPLES
+
+Print the TLSA record data for the certificate of a server using the public
+key and SHA-256 (DANE-EE SPKI SHA2-256):
+'''
+$ step certificate tlsa server.crt
+3 1 1 ef0fb6ceff01045db8983cfc9dac8efd74a43488084469684cb8a682b00864db
+'''
+
+Print the TLSA record for the issuer of a remote server, with the SHA-512 of
+the full certificate (DANE-TA Cert SHA2-512):
+'''
+$ step certificate tlsa https://smallstep.com --usage 2 --selector 0 --matching 2 \
+  --name _443._tcp.smallstep.com.
+_443._tcp.smallstep.com. IN TLSA 2 0 2 1f7a3d...
+'''
+
+Print the TLSA record for a mail server using STARTTLS:
+'''
+$ step certificate tlsa smtp.example.com:25 --starttls smtp --name _25._tcp.smtp.example.com.
+'''`,
+		Flags: []cli.Flag{
+			cli.IntFlag{
+				Name:  "usage",
+				Value: 3,
+				Usage: `The certificate <usage> field of the record.
+
+: <usage> is a number and must be one of:
+
+    **0**
+    :  PKIX-TA, CA constraint. The certificate is a trust anchor that must be part
+    of a chain validated using PKIX.
+
+    **1**
+    :  PKIX-EE, service certificate constraint. The certificate is the end entity
+    and must be validated using PKIX.
+
+    **2**
+    :  DANE-TA, trust anchor assertion. The certificate is a trust anchor that
+    must be part of the chain, PKIX validation is not required.
+
+    **3**
+    :  DANE-EE, domain-issued certificate. The certificate is the end entity,
+    PKIX validation is not required.`,
+			},
+			cli.IntFlag{
+				Name:  "selector",
+				Value: 1,
+				Usage: `The <selector> field of the record, the part of the certificate to match.
+
+: <selector> is a number and must be one of:
+
+    **0**
+    :  Cert, match the full certificate.
+
+    **1**
+    :  SPKI, match the subject public key info.`,
+			},
+			cli.IntFlag{
+				Name:  "matching",
+				Value: 1,
+				Usage: `The <matching> type field of the record, how the data is presented.
+
+: <matching> is a number and must be one of:
+
+    **0**
+    :  Full, the selected content is not hashed.
+
+    **1**
+    :  SHA2-256, the SHA-256 hash of the selected content.
+
+    **2**
+    :  SHA2-512, the SHA-512 hash of the selected content.`,
+			},
+			cli.StringFlag{
+				Name: "name",
+				Usage: `The owner <name> of the record, e.g. _443._tcp.example.com. If set, the record
+is printed in zone file format.`,
+			},
+			cli.StringFlag{
+				Name: "roots",
+				Usage: `Root certificate(s) that will be used to verify the
+authenticity of the remote server.
+
+: <roots> is a case-sensitive string and may be one of:
+
+    **file**
+	:  Relative or full path to a file. All certificates in the file will be used for path validation.
+
+    **list of files**
+	:  Comma-separated list of relative or full file paths. Every PEM encoded certificate from each file will be used for path validation.
+
+    **directory**
+	:  Relative or full path to a directory. Every PEM encoded certificate from each file in the directory will be used for path validation.`,
+			},
+			rootsPasswordFileFlag,
+			cli.BoolFlag{
+				Name: "insecure",
+				Usage: `Use an insecure client to retrieve a remote peer certificate. Useful for
+debugging invalid certificates remotely.`,
+			},
+			serverNameFlag,
+			startTLSFlag,
+			clientCertFlag,
+			clientKeyFlag,
+		},
+	}
+}
+
+func tlsaAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 1); err != nil {
+		return err
+	}
+
+	var (
+		certs    []*x509.Certificate
+		err      error
+		crtFile  = ctx.Args().First()
+		usage    = ctx.Int("usage")
+		selector = ctx.Int("selector")
+		matching = ctx.Int("matching")
+		name     = ctx.String("name")
+	)
+
+	if usage < 0 || usage > 3 {
+		return errs.InvalidFlagValue(ctx, "usage", strconv.Itoa(usage), "0, 1, 2, 3")
+	}
+	if selector < 0 || selector > 1 {
+		return errs.InvalidFlagValue(ctx, "selector", strconv.Itoa(selector), "0, 1")
+	}
+	if matching < 0 || matching > 2 {
+		return errs.InvalidFlagValue(ctx, "matching", strconv.Itoa(matching), "0, 1, 2")
+	}
+
+	if _, addr, isURL := trimRemotePrefix(ctx, crtFile); isURL {
+		opts, err := newRemoteOptions(ctx)
+		if err != nil {
+			return err
+		}
+		certs, err = getPeerCertificates(addr, opts)
+		if err != nil {
+			return err
+		}
+	} else {
+		certs, err = pemutil.ReadCertificateBundle(crtFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Trust anchor usages use the last certificate in the chain.
+	crt := certs[0]
+	if usage == 0 || usage == 2 {
+		crt = certs[len(certs)-1]
+	}
+
+	data, err := tlsaRecord(crt, usage, selector, matching)
+	if err != nil {
+		return err
+	}
+	if name != "" {
+		fmt.Printf("%s IN TLSA %s\n", name, data)
+	} else {
+		fmt.Println(data)
+	}
+	return nil
+}
+
+// tlsaRecord returns the data of a TLSA record for the given certificate,
+// with the usage, selector and matching type fields followed by the
+// certificate association data in hexadecimal.
+func tlsaRecord(crt *x509.Certificate, usage, selector, matching int) (string, error) {
+	var content []byte
+	switch selector {
+	case 0:
+		content = crt.Raw
+	case 1:
+		content = crt.RawSubjectPublicKeyInfo
+	default:
+		return "", errors.Errorf("unsupported TLSA selector %d", selector)
+	}
+
+	switch matching {
+	case 0:
+	case 1:
+		sum := sha256.Sum256(content)
+		content = sum[:]
+	case 2:
+		sum := sha512.Sum512(content)
+		content = sum[:]
+	default:
+		return "", errors.Errorf("unsupported TLSA matching type %d", matching)
+	}
+
+	return fmt.Sprintf("%d %d %d %s", usage, selector, matching, hex.EncodeToString(content)), nil
+}
@@ -0,0 +1,51 @@
+package certificate
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/hex"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/cli/crypto/x509util"
+)
+
+func TestTLSARecord(t *testing.T) {
+	root, err := x509util.NewRootProfile("root")
+	assert.FatalError(t, err)
+	b, err := root.CreateCertificate()
+	assert.FatalError(t, err)
+	crt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+
+	certSHA256 := sha256.Sum256(crt.Raw)
+	certSHA512 := sha512.Sum512(crt.Raw)
+	spkiSHA256 := sha256.Sum256(crt.RawSubjectPublicKeyInfo)
+	spkiSHA512 := sha512.Sum512(crt.RawSubjectPublicKeyInfo)
+
+	tests := []struct {
+		name                      string
+		usage, selector, matching int
+		want                      string
+		wantErr                   bool
+	}{
+		{"3 1 1", 3, 1, 1, "3 1 1 " + hex.EncodeToString(spkiSHA256[:]), false},
+		{"3 1 2", 3, 1, 2, "3 1 2 " + hex.EncodeToString(spkiSHA512[:]), false},
+		{"3 1 0", 3, 1, 0, "3 1 0 " + hex.EncodeToString(crt.RawSubjectPublicKeyInfo), false},
+		{"2 0 1", 2, 0, 1, "2 0 1 " + hex.EncodeToString(certSHA256[:]), false},
+		{"0 0 2", 0, 0, 2, "0 0 2 " + hex.EncodeToString(certSHA512[:]), false},
+		{"1 0 0", 1, 0, 0, "1 0 0 " + hex.EncodeToString(crt.Raw), false},
+		{"fail selector", 3, 2, 1, "", true},
+		{"fail matching", 3, 1, 3, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tlsaRecord(crt, tt.usage, tt.selector, tt.matching)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("tlsaRecord() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
@@ -2,12 +2,19 @@ package certificate
 
 import (
 	"crypto/x509"
+	"encoding/json"
 	"encoding/pem"
+	"fmt"
 	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/cli/crypto/x509util"
 	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/flags"
 	"github.com/urfave/cli"
 )
 
@@ -17,12 +24,36 @@ func verifyCommand() cli.Command {
 		Action: cli.ActionFunc(verifyAction),
 		Usage:  `verify a certificate`,
 		UsageText: `**step certificate verify** <crt_file> [**--host**=<host>]
-[**--roots**=<root-bundle>]`,
+[**--roots**=<root-bundle>] [**--roots-password-file**=<file>]
+[**--crl**=<file|url>] [**--ocsp**]
+[**--revocation**=<policy>] [**--ct-log-list**=<file>] [**--ct-min-logs**=<number>]
+[**--ip**=<address>] [**--email**=<email>] [**--eku**=<usage>] [**--time**=<time|duration>]
+[**--format**=<format>] [**--verbose**] [**--servername**=<name>]
+[**--starttls**=<protocol>] [**--client-cert**=<file>] [**--client-key**=<file>]`,
 		Description: `**step certificate verify** executes the certificate path
 validation algorithm for x.509 certificates defined in RFC 5280. If the
 certificate is valid this command will return '0'. If validation fails, or if
 an error occurs, this command will produce a non-zero return value.
 
+Optionally, the revocation status of the certificate and its intermediates can
+be checked using certificate revocation lists (CRLs) and the Online Certificate
+Status Protocol (OCSP). For remote certificates, the OCSP response stapled by
+the server in the TLS handshake will be used if available.
+
+Optionally, the signed certificate timestamps (SCTs) of the certificate can be
+verified against a list of certificate transparency logs. The SCTs embedded in
+the certificate and, for remote certificates, the SCTs sent in the TLS
+extension and in the stapled OCSP response are used. The validation fails if
+the certificate does not have valid SCTs from a minimum number of distinct
+logs.
+
+When the validation fails, '--format' and '--verbose' print a report with all
+the candidate paths from the certificate to a trusted root and the result of
+each check in them: the validity period, the signatures, the basic and name
+constraints, the path length, the extended key usages and the trust anchor, as
+well as the host, IP address and email checks. Without '--verbose' only the
+failed checks are printed.
+
 ## POSITIONAL ARGUMENTS
 
 <crt_file>
@@ -64,6 +95,76 @@ Verify a certificate using a custom directory of root certificates for path vali
 '''
 $ step certificate verify ./certificate.crt --roots "./path/to/root-certificates/"
 '''
+
+Verify a certificate and check its revocation status using a local CRL:
+
+'''
+$ step certificate verify ./certificate.crt --roots ./root-certificate.crt \
+--crl ./intermediate.crl
+'''
+
+Verify a remote certificate and check its revocation status using the stapled
+OCSP response or the OCSP responders in the certificate:
+
+'''
+$ step certificate verify https://smallstep.com --ocsp
+'''
+
+Verify a certificate failing if the revocation status of any certificate in
+the chain cannot be determined using the OCSP responders or the CRL distribution
+points in the certificates:
+
+'''
+$ step certificate verify ./certificate.crt --revocation hard
+'''
+
+Verify a remote certificate requiring valid SCTs from at least two distinct logs
+in a local copy of a certificate transparency log list:
+
+'''
+$ step certificate verify https://smallstep.com --ct-log-list ./log_list.json
+'''
+
+Verify a certificate bundle requiring valid SCTs from at least three distinct
+logs:
+
+'''
+$ step certificate verify ./certificate-bundle.crt --ct-log-list ./log_list.json \
+--ct-min-logs 3
+'''
+
+Verify a client certificate for an email address at a given time:
+
+'''
+$ step certificate verify ./client.crt --roots ./root-certificate.crt \
+--eku clientAuth --email jane@example.com --time 2021-01-01T00:00:00Z
+'''
+
+Verify a certificate and print the failed checks if the validation fails:
+
+'''
+$ step certificate verify ./certificate.crt --roots ./root-certificate.crt \
+--host foo.example.com --format text
+'''
+
+Verify the certificate of a mail server using STARTTLS:
+
+'''
+$ step certificate verify smtp.example.com --starttls smtp
+'''
+
+Verify the certificate of a server behind a load balancer that routes by SNI:
+
+'''
+$ step certificate verify https://10.0.0.10 --servername api.example.com
+'''
+
+Verify a certificate and print the full report in JSON:
+
+'''
+$ step certificate verify ./certificate.crt --roots ./root-certificate.crt \
+--format json --verbose
+'''
 `,
 		Flags: []cli.Flag{
 			cli.StringFlag{
@@ -86,6 +187,94 @@ authenticity of the remote server.
     **directory**
 	:  Relative or full path to a directory. Every PEM encoded certificate from each file in the directory will be used for path validation.`,
 			},
+			rootsPasswordFileFlag,
+			cli.StringSliceFlag{
+				Name: "crl",
+				Usage: `The <file|url> of a certificate revocation list used to check the revocation
+status of the certificates in the chain. CRLs are only used for the
+certificates issued by the CRL issuer. Use the '--crl' flag multiple times to
+use multiple CRLs.`,
+			},
+			cli.BoolFlag{
+				Name: "ocsp",
+				Usage: `Check the revocation status of the certificates in the chain using the OCSP
+responders in the authority information access extension of the certificates.
+For remote certificates the stapled OCSP response will be used if available.`,
+			},
+			cli.StringFlag{
+				Name: "revocation",
+				Usage: `The <policy> used to check the revocation status of the certificates in the
+chain. A revoked certificate always results in a validation failure. If this
+flag is not set, a soft policy is used when the '--crl' or '--ocsp' flags are
+present. If this flag is set but neither '--crl' nor '--ocsp' are present, the
+OCSP responders and the CRL distribution points in the certificates are used.
+
+: <policy> is a string and must be one of:
+
+    **hard**
+    :  Fail if the revocation status of any certificate cannot be determined.
+
+    **soft**
+    :  Print a warning if the revocation status of a certificate cannot be determined.
+
+    **off**
+    :  Do not check the revocation status of the certificates.`,
+			},
+			cli.StringFlag{
+				Name: "ct-log-list",
+				Usage: `The <file> with the list of trusted certificate transparency logs, in the
+JSON format of the Chrome log lists. If set, the signed certificate timestamps
+of the certificate are verified using the logs in the list.`,
+			},
+			cli.IntFlag{
+				Name: "ct-min-logs",
+				Usage: `The minimum <number> of distinct logs in the '--ct-log-list' that must have
+issued a valid signed certificate timestamp for the certificate.`,
+				Value: defaultCTMinLogs,
+			},
+			cli.StringFlag{
+				Name:  "ip",
+				Usage: `Check whether the certificate is for the specified IP <address>.`,
+			},
+			cli.StringFlag{
+				Name:  "email",
+				Usage: `Check whether the certificate is for the specified <email>.`,
+			},
+			cli.StringSliceFlag{
+				Name: "eku",
+				Usage: `The extended key <usage> the certificate path must be valid for, e.g.
+serverAuth, clientAuth, codeSigning or emailProtection. Use the '--eku' flag
+multiple times to accept any of multiple usages. Defaults to serverAuth.`,
+			},
+			cli.StringFlag{
+				Name: "time",
+				Usage: `The <time|duration> used to check the validity of the certificates. If a
+<time> is used it is expected to be in RFC 3339 format. If a <duration> is
+used, it is a sequence of decimal numbers, each with optional fraction and a
+unit suffix, such as "300ms", "-1.5h" or "2h45m", relative to the current time.
+Defaults to the current time.`,
+			},
+			cli.StringFlag{
+				Name: "format",
+				Usage: `The <format> of the report printed if the validation fails.
+
+: <format> is a string and must be one of:
+
+    **text**
+    :  Print the report in unstructured text suitable for a human to read.
+
+    **json**
+    :  Print the report in JSON format.`,
+			},
+			cli.BoolFlag{
+				Name: "verbose",
+				Usage: `Print the result of all the checks, even if the validation succeeds. Defaults
+to a text report if '--format' is not set.`,
+			},
+			serverNameFlag,
+			startTLSFlag,
+			clientCertFlag,
+			clientKeyFlag,
 		},
 	}
 }
@@ -96,33 +285,78 @@ func verifyAction(ctx *cli.Context) error {
 	}
 
 	var (
-		crtFile          = ctx.Args().Get(0)
-		host             = ctx.String("host")
-		roots            = ctx.String("roots")
-		intermediatePool = x509.NewCertPool()
-		rootPool         *x509.CertPool
-		cert             *x509.Certificate
+		crtFile       = ctx.Args().Get(0)
+		host          = ctx.String("host")
+		roots         = ctx.String("roots")
+		format        = ctx.String("format")
+		verbose       = ctx.Bool("verbose")
+		intermediates []*x509.Certificate
+		rootCerts     []*x509.Certificate
+		cert          *x509.Certificate
+		stapled       []byte
+		tlsSCTs       [][]byte
 	)
 
-	if _, addr, isURL := trimURLPrefix(crtFile); isURL {
-		peerCertificates, err := getPeerCertificates(addr, roots, false)
+	switch format {
+	case "", "text", "json":
+	default:
+		return errs.InvalidFlagValue(ctx, "format", format, "text, json")
+	}
+
+	opts := x509util.DiagnoseOptions{
+		DNSName: host,
+		Email:   ctx.String("email"),
+	}
+	if s := ctx.String("ip"); s != "" {
+		if opts.IPAddress = net.ParseIP(s); opts.IPAddress == nil {
+			return errs.InvalidFlagValue(ctx, "ip", s, "")
+		}
+	}
+	for _, name := range ctx.StringSlice("eku") {
+		eku, err := x509util.ParseExtKeyUsage(name)
+		if err != nil {
+			return errs.InvalidFlagValue(ctx, "eku", name, "")
+		}
+		opts.KeyUsages = append(opts.KeyUsages, eku)
+	}
+	now, ok := flags.ParseTimeOrDuration(ctx.String("time"))
+	if !ok {
+		return errs.InvalidFlagValue(ctx, "time", ctx.String("time"), "")
+	}
+	if now.IsZero() {
+		now = time.Now()
+	}
+	opts.CurrentTime = now
+
+	checker, err := newRevocationChecker(ctx)
+	if err != nil {
+		return err
+	}
+	ctChecker, err := newCTChecker(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, addr, isURL := trimRemotePrefix(ctx, crtFile); isURL {
+		opts, err := newRemoteOptions(ctx)
 		if err != nil {
 			return err
 		}
-		cert = peerCertificates[0]
-		for _, pc := range peerCertificates {
-			intermediatePool.AddCert(pc)
+		cs, err := getConnectionState(addr, opts)
+		if err != nil {
+			return err
 		}
+		cert = cs.PeerCertificates[0]
+		intermediates = cs.PeerCertificates[1:]
+		stapled = cs.OCSPResponse
+		tlsSCTs = cs.SignedCertificateTimestamps
 	} else {
 		crtBytes, err := ioutil.ReadFile(crtFile)
 		if err != nil {
 			return errs.FileError(err, crtFile)
 		}
 
-		var (
-			ipems []byte
-			block *pem.Block
-		)
+		var block *pem.Block
 		// The first certificate PEM in the file is our leaf Certificate.
 		// Any certificate after the first is added to the list of Intermediate
 		// certificates used for path validation.
@@ -134,40 +368,142 @@ func verifyAction(ctx *cli.Context) error {
 			if block.Type != "CERTIFICATE" {
 				continue
 			}
+			crt, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return errors.WithStack(err)
+			}
 			if cert == nil {
-				cert, err = x509.ParseCertificate(block.Bytes)
-				if err != nil {
-					return errors.WithStack(err)
-				}
+				cert = crt
 			} else {
-				ipems = append(ipems, pem.EncodeToMemory(block)...)
+				intermediates = append(intermediates, crt)
 			}
 		}
 		if cert == nil {
 			return errors.Errorf("%s contains no PEM certificate blocks", crtFile)
 		}
-		if len(ipems) > 0 && !intermediatePool.AppendCertsFromPEM(ipems) {
-			return errors.Errorf("failure creating intermediate list from certificate '%s'", crtFile)
-		}
 	}
 
 	if roots != "" {
 		var err error
-		rootPool, err = x509util.ReadCertPool(roots)
+		rootCerts, err = x509util.ReadCertificates(roots, rootsOptions(ctx.String("roots-password-file"))...)
 		if err != nil {
-			errors.Wrapf(err, "failure to load root certificate pool from input path '%s'", roots)
+			return errors.Wrapf(err, "failure to load root certificate pool from input path '%s'", roots)
 		}
 	}
 
-	opts := x509.VerifyOptions{
-		DNSName:       host,
-		Roots:         rootPool,
-		Intermediates: intermediatePool,
+	opts.Roots = rootCerts
+	opts.Intermediates = intermediates
+	report := x509util.DiagnoseVerify(cert, opts)
+	printReport := format != "" || verbose
+	if printReport {
+		if err := printVerifyReport(report, format, verbose); err != nil {
+			return err
+		}
+	}
+	if !report.Valid {
+		// The reason is already in the printed report.
+		if printReport {
+			return errors.New("failed to verify certificate")
+		}
+		return errors.Wrapf(report.Err, "failed to verify certificate")
 	}
+	chains := report.Chains
 
-	if _, err := cert.Verify(opts); err != nil {
-		return errors.Wrapf(err, "failed to verify certificate")
+	if checker != nil {
+		checker.now = now
+		checker.stapled = stapled
+		if err := checker.Check(chains[0]); err != nil {
+			return errors.Wrapf(err, "failed to verify certificate")
+		}
 	}
 
+	if ctChecker != nil {
+		var issuer *x509.Certificate
+		if len(chains[0]) > 1 {
+			issuer = chains[0][1]
+		}
+		ctChecker.now = now
+		scts, err := certificateSCTs(cert, issuer, tlsSCTs, stapled)
+		if err != nil {
+			return errors.Wrapf(err, "failed to verify certificate")
+		}
+		if err := ctChecker.Check(scts, cert, issuer); err != nil {
+			return errors.Wrapf(err, "failed to verify certificate")
+		}
+	}
+
+	return nil
+}
+
+// printVerifyReport prints the verification report in the given format. In
+// the text format, if verbose is false, only the failed checks are printed.
+func printVerifyReport(report *x509util.VerifyReport, format string, verbose bool) error {
+	if format == "json" {
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		os.Stdout.Write(append(b, '\n'))
+		return nil
+	}
+	fmt.Print(verifyReportText(report, verbose))
 	return nil
 }
+
+// verifyReportText returns the verification report in a human readable
+// format.
+func verifyReportText(report *x509util.VerifyReport, verbose bool) string {
+	var b strings.Builder
+	if report.Valid {
+		b.WriteString("Verification: OK\n")
+	} else {
+		fmt.Fprintf(&b, "Verification: FAILED (%s)\n", report.Error)
+	}
+	fmt.Fprintf(&b, "Time: %s\n", report.Time.UTC().Format(time.RFC3339))
+
+	writeChecks := func(checks []x509util.VerifyCheck) {
+		for _, c := range checks {
+			if c.Passed && !verbose {
+				continue
+			}
+			status := "FAIL"
+			if c.Passed {
+				status = "OK"
+			}
+			if c.Subject != "" {
+				fmt.Fprintf(&b, "    [%s] %s (%s): %s\n", status, c.Name, c.Subject, c.Message)
+			} else {
+				fmt.Fprintf(&b, "    [%s] %s: %s\n", status, c.Name, c.Message)
+			}
+		}
+	}
+
+	if hasFailedChecks(report.Checks) || (verbose && len(report.Checks) > 0) {
+		b.WriteString("Identity:\n")
+		writeChecks(report.Checks)
+	}
+	for i, p := range report.Paths {
+		if p.Valid && !verbose {
+			continue
+		}
+		status := "invalid"
+		if p.Valid {
+			status = "valid"
+		}
+		fmt.Fprintf(&b, "Path %d (%s):\n", i+1, status)
+		for j, c := range p.Certificates {
+			fmt.Fprintf(&b, "    %d: %s\n", j, c.Subject)
+		}
+		writeChecks(p.Checks)
+	}
+	return b.String()
+}
+
+func hasFailedChecks(checks []x509util.VerifyCheck) bool {
+	for _, c := range checks {
+		if !c.Passed {
+			return true
+		}
+	}
+	return false
+}
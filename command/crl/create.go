@@ -0,0 +1,272 @@
+package crl
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/x509util"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/flags"
+	"github.com/smallstep/cli/ui"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+)
+
+func createCommand() cli.Command {
+	return cli.Command{
+		Name:   "create",
+		Action: command.ActionFunc(createAction),
+		Usage:  "create a certificate revocation list",
+		UsageText: `**step crl create** <crl_file> **--ca**=<issuer-cert> **--ca-key**=<issuer-key>
+[**--revoked**=<serial[,reason[,time]]>] [**--revoked-file**=<file>]
+[**--number**=<number>] [**--delta-base**=<number>] [**--next-update**=<time|duration>]
+[**--format**=<format>] [**--password-file**=<file>]`,
+		Description: `**step crl create** creates a certificate revocation list (CRL) signed by the
+given certificate authority.
+
+Revoked certificates are defined using their serial number, and optionally a
+reason code and the revocation time, separated by commas. The serial number can
+be a decimal number, a hexadecimal number prefixed with '0x', or a hexadecimal
+number with colon separated bytes. The reason code can be a number or the name
+of the reason as described in **step ca revoke**. The revocation time must be
+in RFC 3339 format and it defaults to the current time.
+
+## POSITIONAL ARGUMENTS
+
+<crl_file>
+:  The path to write the CRL to.
+
+## EXIT CODES
+
+This command returns 0 on success and \>0 if any error occurs.
+
+## EXAMPLES
+
+Create an empty CRL:
+'''
+$ step crl create ca.crl --ca intermediate_ca.crt --ca-key intermediate_ca_key
+'''
+
+Create a CRL revoking a certificate because its key was compromised:
+'''
+$ step crl create ca.crl --ca intermediate_ca.crt --ca-key intermediate_ca_key \
+  --revoked 308893286343609293989051180431574390766,keyCompromise
+'''
+
+Create a CRL with the revoked certificates in a file, using the given CRL
+number, valid for 24 hours:
+'''
+$ cat revoked.txt
+308893286343609293989051180431574390766,keyCompromise,2020-03-30T15:04:05Z
+0x1c3b2a,superseded
+$ step crl create ca.crl --ca intermediate_ca.crt --ca-key intermediate_ca_key \
+  --revoked-file revoked.txt --number 42 --next-update 24h
+'''
+
+Create a DER encoded delta CRL of the CRL number 42:
+'''
+$ step crl create delta.crl --ca intermediate_ca.crt --ca-key intermediate_ca_key \
+  --revoked 0x1c3b2b --number 43 --delta-base 42 --format der
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "ca",
+				Usage: `The certificate authority <file> used to issue the CRL (PEM file).`,
+			},
+			cli.StringFlag{
+				Name:  "ca-key",
+				Usage: `The certificate authority private key <file> used to sign the CRL (PEM file).`,
+			},
+			cli.StringSliceFlag{
+				Name: "revoked",
+				Usage: `The <serial[,reason[,time]]> of a revoked certificate. Use the '--revoked'
+flag multiple times to revoke multiple certificates.`,
+			},
+			cli.StringFlag{
+				Name: "revoked-file",
+				Usage: `The <file> with the list of revoked certificates, one <serial[,reason[,time]]>
+per line. Empty lines and lines starting with '#' are ignored.`,
+			},
+			cli.StringFlag{
+				Name: "number",
+				Usage: `The CRL <number>. CRL numbers must be monotonically increasing, if not set the
+current Unix time will be used.`,
+			},
+			cli.StringFlag{
+				Name: "delta-base",
+				Usage: `The <number> of the complete CRL this delta CRL is based on. If set, the
+delta CRL indicator extension will be added to the CRL.`,
+			},
+			cli.StringFlag{
+				Name: "next-update",
+				Usage: `The <time|duration> set in the nextUpdate field of the CRL. If a <time> is
+used it is expected to be in RFC 3339 format. If a <duration> is used, it is a
+sequence of decimal numbers, each with optional fraction and a unit suffix, such
+as "300ms", "-1.5h" or "2h45m". Valid time units are "ns", "us" (or "µs"), "ms",
+"s", "m", "h". Defaults to 7 days.`,
+			},
+			cli.StringFlag{
+				Name:  "format",
+				Value: "pem",
+				Usage: `The <format> of the CRL.
+
+: <format> is a string and must be one of:
+
+    **pem**
+    :  PEM encoded CRL.
+
+    **der**
+    :  DER encoded CRL.`,
+			},
+			flags.PasswordFile,
+			flags.Force,
+		},
+	}
+}
+
+func createAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 1); err != nil {
+		return err
+	}
+
+	var (
+		crlFile   = ctx.Args().Get(0)
+		caPath    = ctx.String("ca")
+		caKeyPath = ctx.String("ca-key")
+		format    = ctx.String("format")
+	)
+	switch {
+	case caPath == "":
+		return errs.RequiredFlag(ctx, "ca")
+	case caKeyPath == "":
+		return errs.RequiredFlag(ctx, "ca-key")
+	case format != "pem" && format != "der":
+		return errs.InvalidFlagValue(ctx, "format", format, "pem, der")
+	}
+
+	now := time.Now()
+	template := &x509util.CRL{
+		ThisUpdate: now,
+	}
+
+	nextUpdate, ok := flags.ParseTimeOrDuration(ctx.String("next-update"))
+	if !ok {
+		return errs.InvalidFlagValue(ctx, "next-update", ctx.String("next-update"), "")
+	}
+	if !nextUpdate.IsZero() && !nextUpdate.After(now) {
+		return errors.New("flag '--next-update' must be in the future")
+	}
+	template.NextUpdate = nextUpdate
+
+	if s := ctx.String("number"); s != "" {
+		n, ok := new(big.Int).SetString(s, 10)
+		if !ok || n.Sign() < 0 {
+			return errs.InvalidFlagValue(ctx, "number", s, "")
+		}
+		template.Number = n
+	} else {
+		template.Number = big.NewInt(now.Unix())
+	}
+	if s := ctx.String("delta-base"); s != "" {
+		n, ok := new(big.Int).SetString(s, 10)
+		if !ok || n.Sign() < 0 {
+			return errs.InvalidFlagValue(ctx, "delta-base", s, "")
+		}
+		if n.Cmp(template.Number) >= 0 {
+			return errors.New("flag '--delta-base' must be lower than the CRL number")
+		}
+		template.BaseNumber = n
+	}
+
+	entries := ctx.StringSlice("revoked")
+	if revokedFile := ctx.String("revoked-file"); revokedFile != "" {
+		b, err := utils.ReadFile(revokedFile)
+		if err != nil {
+			return errs.FileError(err, revokedFile)
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(b))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			entries = append(entries, line)
+		}
+		if err := scanner.Err(); err != nil {
+			return errs.FileError(err, revokedFile)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		rc, err := parseRevokedEntry(entry, now)
+		if err != nil {
+			return err
+		}
+		if seen[rc.SerialNumber.String()] {
+			return errors.Errorf("serial number '%s' is revoked more than once", rc.SerialNumber)
+		}
+		seen[rc.SerialNumber.String()] = true
+		template.RevokedCertificates = append(template.RevokedCertificates, rc)
+	}
+
+	var opts []pemutil.Options
+	if passFile := ctx.String("password-file"); passFile != "" {
+		opts = append(opts, pemutil.WithPasswordFile(passFile))
+	}
+	issuer, err := x509util.LoadIdentityFromDisk(caPath, caKeyPath, opts...)
+	if err != nil {
+		return err
+	}
+
+	crlBytes, err := x509util.CreateCRL(template, issuer.Crt, issuer.Key)
+	if err != nil {
+		return err
+	}
+	if format == "pem" {
+		crlBytes = pem.EncodeToMemory(&pem.Block{
+			Type:  "X509 CRL",
+			Bytes: crlBytes,
+		})
+	}
+	if err := utils.WriteFile(crlFile, crlBytes, 0644); err != nil {
+		return errs.FileError(err, crlFile)
+	}
+
+	ui.Printf("Your CRL has been saved in %s.\n", crlFile)
+	return nil
+}
+
+// parseRevokedEntry parses a string with the format serial[,reason[,time]]
+// and returns the CRL entry.
+func parseRevokedEntry(s string, now time.Time) (pkix.RevokedCertificate, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) > 3 {
+		return pkix.RevokedCertificate{}, errors.Errorf("invalid revoked certificate '%s': expected serial[,reason[,time]]", s)
+	}
+	serial, err := x509util.ParseSerialNumber(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return pkix.RevokedCertificate{}, err
+	}
+	var reasonCode int
+	if len(parts) > 1 {
+		if reasonCode, err = x509util.ReasonCodeToNum(strings.TrimSpace(parts[1])); err != nil {
+			return pkix.RevokedCertificate{}, err
+		}
+	}
+	revokedAt := now
+	if len(parts) > 2 {
+		if revokedAt, err = time.Parse(time.RFC3339, strings.TrimSpace(parts[2])); err != nil {
+			return pkix.RevokedCertificate{}, errors.Errorf("invalid revocation time '%s': expected RFC 3339 format", parts[2])
+		}
+	}
+	return x509util.NewRevokedCertificate(serial, revokedAt, reasonCode)
+}
@@ -0,0 +1,43 @@
+package crl
+
+import (
+	"github.com/smallstep/cli/command"
+	"github.com/urfave/cli"
+)
+
+// init creates and registers the crl command
+func init() {
+	cmd := cli.Command{
+		Name:      "crl",
+		Usage:     "create, inspect, and verify certificate revocation lists",
+		UsageText: "step crl SUBCOMMAND [ARGUMENTS] [GLOBAL_FLAGS] [SUBCOMMAND_FLAGS]",
+		Description: `**step crl** command group provides facilities to create, inspect, and verify
+certificate revocation lists (CRLs) as defined in RFC 5280.
+
+## EXAMPLES
+
+Create a CRL revoking two certificates:
+'''
+$ step crl create ca.crl --ca intermediate_ca.crt --ca-key intermediate_ca_key \
+  --revoked 308893286343609293989051180431574390766,keyCompromise \
+  --revoked 0x1c3b2a
+'''
+
+Inspect the contents of a CRL:
+'''
+$ step crl inspect ca.crl
+'''
+
+Verify a CRL using its issuer:
+'''
+$ step crl verify ca.crl --issuer intermediate_ca.crt
+'''`,
+		Subcommands: cli.Commands{
+			createCommand(),
+			inspectCommand(),
+			verifyCommand(),
+		},
+	}
+
+	command.Register(cmd)
+}
@@ -0,0 +1,230 @@
+package crl
+
+import (
+	"bytes"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/x509util"
+	"github.com/smallstep/cli/errs"
+	"github.com/urfave/cli"
+)
+
+func inspectCommand() cli.Command {
+	return cli.Command{
+		Name:      "inspect",
+		Action:    command.ActionFunc(inspectAction),
+		Usage:     "print certificate revocation list details in human readable format",
+		UsageText: `**step crl inspect** <crl_file|url> [**--format**=<format>]`,
+		Description: `**step crl inspect** prints the details of a certificate revocation list (CRL)
+in a human readable format. The CRL can be PEM or DER encoded, and it can be
+read from a file or downloaded from an http or https URL.
+
+## POSITIONAL ARGUMENTS
+
+<crl_file|url>
+:  The path or the URL of the CRL to inspect.
+
+## EXIT CODES
+
+This command returns 0 on success and \>0 if any error occurs.
+
+## EXAMPLES
+
+Inspect a local CRL:
+'''
+$ step crl inspect ca.crl
+'''
+
+Inspect a CRL from its distribution point in json format:
+'''
+$ step crl inspect http://crl.example.com/ca.crl --format json
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "format",
+				Value: "text",
+				Usage: `The output format for printing the introspection details.
+
+: <format> is a string and must be one of:
+
+    **text**
+    :  Print output in unstructured text suitable for a human to read.
+
+    **json**
+    :  Print output in JSON format.`,
+			},
+		},
+	}
+}
+
+// crlInfo is the JSON representation of a CRL.
+type crlInfo struct {
+	Version                int           `json:"version"`
+	SignatureAlgorithm     string        `json:"signature_algorithm"`
+	SignatureAlgorithmOID  string        `json:"signature_algorithm_oid"`
+	Issuer                 string        `json:"issuer"`
+	ThisUpdate             time.Time     `json:"this_update"`
+	NextUpdate             *time.Time    `json:"next_update,omitempty"`
+	Number                 *big.Int      `json:"crl_number,omitempty"`
+	BaseNumber             *big.Int      `json:"delta_crl_indicator,omitempty"`
+	AuthorityKeyID         string        `json:"authority_key_id,omitempty"`
+	RevokedCertificates    []revokedInfo `json:"revoked_certificates"`
+	UnhandledExtensionOIDs []string      `json:"unhandled_extensions,omitempty"`
+}
+
+// revokedInfo is the JSON representation of a CRL entry.
+type revokedInfo struct {
+	SerialNumber   *big.Int  `json:"serial_number"`
+	RevocationTime time.Time `json:"revocation_time"`
+	Reason         string    `json:"reason"`
+	ReasonCode     int       `json:"reason_code"`
+}
+
+var signatureAlgorithmNames = []struct {
+	oid  asn1.ObjectIdentifier
+	name string
+}{
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}, "SHA1-RSA"},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}, "SHA256-RSA"},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}, "SHA384-RSA"},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}, "SHA512-RSA"},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}, "RSA-PSS"},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1}, "ECDSA-SHA1"},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}, "ECDSA-SHA256"},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}, "ECDSA-SHA384"},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}, "ECDSA-SHA512"},
+	{asn1.ObjectIdentifier{1, 3, 101, 112}, "Ed25519"},
+}
+
+func signatureAlgorithmName(oid asn1.ObjectIdentifier) string {
+	for _, sa := range signatureAlgorithmNames {
+		if sa.oid.Equal(oid) {
+			return sa.name
+		}
+	}
+	return oid.String()
+}
+
+func newCRLInfo(crl *pkix.CertificateList) crlInfo {
+	tbs := crl.TBSCertList
+	var issuer pkix.Name
+	issuer.FillFromRDNSequence(&tbs.Issuer)
+
+	info := crlInfo{
+		Version:               tbs.Version + 1,
+		SignatureAlgorithm:    signatureAlgorithmName(crl.SignatureAlgorithm.Algorithm),
+		SignatureAlgorithmOID: crl.SignatureAlgorithm.Algorithm.String(),
+		Issuer:                issuer.String(),
+		ThisUpdate:            tbs.ThisUpdate.UTC(),
+		Number:                x509util.CRLNumber(crl),
+		BaseNumber:            x509util.CRLBaseNumber(crl),
+		RevokedCertificates:   []revokedInfo{},
+	}
+	if !tbs.NextUpdate.IsZero() {
+		t := tbs.NextUpdate.UTC()
+		info.NextUpdate = &t
+	}
+	if aki := x509util.CRLAuthorityKeyID(crl); aki != nil {
+		info.AuthorityKeyID = formatBytes(aki)
+	}
+	for _, ext := range tbs.Extensions {
+		switch ext.Id.String() {
+		case "2.5.29.20", "2.5.29.27", "2.5.29.35":
+		default:
+			info.UnhandledExtensionOIDs = append(info.UnhandledExtensionOIDs, ext.Id.String())
+		}
+	}
+	for _, rc := range tbs.RevokedCertificates {
+		code := x509util.RevocationReason(rc)
+		info.RevokedCertificates = append(info.RevokedCertificates, revokedInfo{
+			SerialNumber:   rc.SerialNumber,
+			RevocationTime: rc.RevocationTime.UTC(),
+			Reason:         x509util.ReasonCodeString(code),
+			ReasonCode:     code,
+		})
+	}
+	return info
+}
+
+func inspectAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 1); err != nil {
+		return err
+	}
+
+	crlFile, format := ctx.Args().Get(0), ctx.String("format")
+	if format != "text" && format != "json" {
+		return errs.InvalidFlagValue(ctx, "format", format, "text, json")
+	}
+
+	crl, err := x509util.ReadCRL(crlFile)
+	if err != nil {
+		return err
+	}
+	info := newCRLInfo(crl)
+
+	if format == "json" {
+		b, err := json.MarshalIndent(info, "", "  ")
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		os.Stdout.Write(b)
+		return nil
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Certificate Revocation List (CRL):\n")
+	fmt.Fprintf(&buf, "    Data:\n")
+	fmt.Fprintf(&buf, "        Version: %d (0x%x)\n", info.Version, info.Version-1)
+	fmt.Fprintf(&buf, "        Signature Algorithm: %s\n", info.SignatureAlgorithm)
+	fmt.Fprintf(&buf, "        Issuer: %s\n", info.Issuer)
+	fmt.Fprintf(&buf, "        Last Update: %s\n", info.ThisUpdate.Format(time.RFC3339))
+	if info.NextUpdate != nil {
+		fmt.Fprintf(&buf, "        Next Update: %s\n", info.NextUpdate.Format(time.RFC3339))
+	} else {
+		fmt.Fprintf(&buf, "        Next Update: NONE\n")
+	}
+	if info.Number != nil || info.BaseNumber != nil || info.AuthorityKeyID != "" {
+		fmt.Fprintf(&buf, "        CRL Extensions:\n")
+		if info.Number != nil {
+			fmt.Fprintf(&buf, "            X509v3 CRL Number:\n")
+			fmt.Fprintf(&buf, "                %s\n", info.Number)
+		}
+		if info.BaseNumber != nil {
+			fmt.Fprintf(&buf, "            X509v3 Delta CRL Indicator: critical\n")
+			fmt.Fprintf(&buf, "                %s\n", info.BaseNumber)
+		}
+		if info.AuthorityKeyID != "" {
+			fmt.Fprintf(&buf, "            X509v3 Authority Key Identifier:\n")
+			fmt.Fprintf(&buf, "                keyid:%s\n", info.AuthorityKeyID)
+		}
+	}
+	if len(info.RevokedCertificates) == 0 {
+		fmt.Fprintf(&buf, "    No Revoked Certificates.\n")
+	} else {
+		fmt.Fprintf(&buf, "    Revoked Certificates:\n")
+		for _, rc := range info.RevokedCertificates {
+			fmt.Fprintf(&buf, "        Serial Number: %s (0x%X)\n", rc.SerialNumber, rc.SerialNumber)
+			fmt.Fprintf(&buf, "            Revocation Date: %s\n", rc.RevocationTime.Format(time.RFC3339))
+			fmt.Fprintf(&buf, "            Reason: %s\n", rc.Reason)
+		}
+	}
+	os.Stdout.Write(buf.Bytes())
+	return nil
+}
+
+func formatBytes(b []byte) string {
+	s := make([]string, len(b))
+	for i := range b {
+		s[i] = fmt.Sprintf("%02X", b[i])
+	}
+	return strings.Join(s, ":")
+}
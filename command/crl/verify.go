@@ -0,0 +1,80 @@
+package crl
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/x509util"
+	"github.com/smallstep/cli/errs"
+	"github.com/urfave/cli"
+)
+
+func verifyCommand() cli.Command {
+	return cli.Command{
+		Name:      "verify",
+		Action:    command.ActionFunc(verifyAction),
+		Usage:     "verify a certificate revocation list",
+		UsageText: `**step crl verify** <crl_file|url> **--issuer**=<file>`,
+		Description: `**step crl verify** verifies that a certificate revocation list (CRL) has
+been signed by the given issuer and that it is currently valid.
+
+The verification checks that the CRL issuer matches the subject of the issuer
+certificate, that the authority key identifier matches the subject key
+identifier of the issuer, that the signature is valid, and that the current
+time is between the thisUpdate and nextUpdate fields of the CRL.
+
+## POSITIONAL ARGUMENTS
+
+<crl_file|url>
+:  The path or the URL of the CRL to verify.
+
+## EXIT CODES
+
+This command returns 0 on success and \>0 if any error occurs.
+
+## EXAMPLES
+
+Verify a local CRL:
+'''
+$ step crl verify ca.crl --issuer intermediate_ca.crt
+'''
+
+Verify a CRL from its distribution point:
+'''
+$ step crl verify http://crl.example.com/ca.crl --issuer intermediate_ca.crt
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "issuer",
+				Usage: `The certificate <file> of the CRL issuer.`,
+			},
+		},
+	}
+}
+
+func verifyAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 1); err != nil {
+		return err
+	}
+
+	crlFile, issuerFile := ctx.Args().Get(0), ctx.String("issuer")
+	if issuerFile == "" {
+		return errs.RequiredFlag(ctx, "issuer")
+	}
+
+	crl, err := x509util.ReadCRL(crlFile)
+	if err != nil {
+		return err
+	}
+	issuer, err := pemutil.ReadCertificate(issuerFile)
+	if err != nil {
+		return err
+	}
+
+	if err := x509util.VerifyCRL(crl, issuer, time.Now()); err != nil {
+		return errors.Wrapf(err, "failed to verify %s", crlFile)
+	}
+	return nil
+}
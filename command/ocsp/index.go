@@ -0,0 +1,114 @@
+package ocsp
+
+import (
+	"bufio"
+	"bytes"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/x509util"
+	"golang.org/x/crypto/ocsp"
+)
+
+// indexEntry is an entry of a certificate database in the OpenSSL index.txt
+// format.
+type indexEntry struct {
+	status    int
+	expiresAt time.Time
+	revokedAt time.Time
+	reason    int
+	serial    *big.Int
+	subject   string
+}
+
+// parseIndex parses a certificate database in the OpenSSL index.txt format
+// and returns the entries indexed by serial number. Each line contains the
+// following tab separated fields:
+//
+//   - The status of the certificate: V (valid), R (revoked) or E (expired).
+//   - The expiration time of the certificate.
+//   - The revocation time and an optional reason, separated by a comma.
+//   - The serial number in hexadecimal.
+//   - The certificate file name, usually "unknown".
+//   - The certificate subject.
+//
+// Times are in the ASN.1 UTCTime (YYMMDDHHMMSSZ) or GeneralizedTime
+// (YYYYMMDDHHMMSSZ) formats.
+func parseIndex(b []byte) (map[string]*indexEntry, error) {
+	entries := make(map[string]*indexEntry)
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entry, err := parseIndexLine(line)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing line %d", n)
+		}
+		entries[entry.serial.String()] = entry
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "error reading index")
+	}
+	return entries, nil
+}
+
+func parseIndexLine(line string) (*indexEntry, error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) < 4 {
+		return nil, errors.Errorf("invalid number of fields: found %d, expected at least 4", len(fields))
+	}
+
+	var (
+		err   error
+		entry = new(indexEntry)
+	)
+	if entry.expiresAt, err = parseIndexTime(fields[1]); err != nil {
+		return nil, err
+	}
+	if entry.serial, err = x509util.ParseSerialNumber("0x" + fields[3]); err != nil {
+		return nil, err
+	}
+	if len(fields) > 5 {
+		entry.subject = fields[5]
+	}
+
+	switch fields[0] {
+	case "V", "E":
+		entry.status = ocsp.Good
+	case "R":
+		entry.status = ocsp.Revoked
+		parts := strings.SplitN(fields[2], ",", 2)
+		if entry.revokedAt, err = parseIndexTime(parts[0]); err != nil {
+			return nil, err
+		}
+		if len(parts) == 2 {
+			if entry.reason, err = x509util.ReasonCodeToNum(parts[1]); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, errors.Errorf("invalid status '%s'", fields[0])
+	}
+	return entry, nil
+}
+
+func parseIndexTime(s string) (time.Time, error) {
+	var layout string
+	switch len(s) {
+	case 13:
+		layout = "060102150405Z"
+	case 15:
+		layout = "20060102150405Z"
+	default:
+		return time.Time{}, errors.Errorf("invalid time '%s'", s)
+	}
+	t, err := time.Parse(layout, s)
+	if err != nil {
+		return time.Time{}, errors.Errorf("invalid time '%s'", s)
+	}
+	return t, nil
+}
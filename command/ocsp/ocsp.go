@@ -0,0 +1,31 @@
+package ocsp
+
+import (
+	"github.com/smallstep/cli/command"
+	"github.com/urfave/cli"
+)
+
+// init creates and registers the ocsp command
+func init() {
+	cmd := cli.Command{
+		Name:      "ocsp",
+		Usage:     "run an Online Certificate Status Protocol (OCSP) responder",
+		UsageText: "step ocsp SUBCOMMAND [ARGUMENTS] [GLOBAL_FLAGS] [SUBCOMMAND_FLAGS]",
+		Description: `**step ocsp** command group provides facilities to answer Online Certificate
+Status Protocol (OCSP) requests as defined in RFC 6960.
+
+To check the status of a certificate using OCSP see **step certificate ocsp**.
+
+## EXAMPLES
+
+Run an OCSP responder for an offline certificate authority:
+'''
+$ step ocsp serve --ca intermediate_ca.crt --key intermediate_ca_key --db index.txt
+'''`,
+		Subcommands: cli.Commands{
+			serveCommand(),
+		},
+	}
+
+	command.Register(cmd)
+}
@@ -0,0 +1,357 @@
+package ocsp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/x509util"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/flags"
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/ocsp"
+)
+
+// maxRequestSize is the maximum size of an OCSP request.
+const maxRequestSize = 10000
+
+func serveCommand() cli.Command {
+	return cli.Command{
+		Name:   "serve",
+		Action: command.ActionFunc(serveAction),
+		Usage:  "start an OCSP responder for a certificate authority",
+		UsageText: `**step ocsp serve** **--ca**=<file> **--key**=<file> **--db**=<file>
+[**--cert**=<file>] [**--address**=<address>] [**--validity**=<duration>]
+[**--password-file**=<file>]`,
+		Description: `**step ocsp serve** starts an HTTP server answering Online Certificate Status
+Protocol (OCSP) requests for the certificates issued by a certificate authority.
+
+The status of the certificates is read from a certificate database in the
+OpenSSL index.txt format. The database is reloaded every time it changes, so
+certificates can be revoked without restarting the responder. Each line of the
+database has the following tab separated fields: the status of the certificate
+(V for valid, R for revoked, E for expired), the expiration time, the
+revocation time and an optional reason separated by a comma, the serial number
+in hexadecimal, the file name of the certificate (usually "unknown"), and the
+subject of the certificate. Times use the YYMMDDHHMMSSZ format. Certificates
+that are not in the database will have the unknown status.
+
+Responses are signed by the certificate authority, or by a delegated OCSP
+responder if the '--cert' flag is used. The delegated responder certificate
+must be issued by the certificate authority and it must have the OCSP signing
+extended key usage.
+
+Both GET and POST requests, as defined in RFC 6960, are supported.
+
+## EXIT CODES
+
+This command returns 0 on success and \>0 if any error occurs.
+
+## EXAMPLES
+
+Start an OCSP responder in port 8080 signing responses with the CA key:
+'''
+$ cat index.txt
+V	300101000000Z		4F3A	unknown	/CN=foo.example.com
+R	300101000000Z	200330150405Z,keyCompromise	4F3B	unknown	/CN=bar.example.com
+$ step ocsp serve --ca intermediate_ca.crt --key intermediate_ca_key --db index.txt
+'''
+
+Start an OCSP responder using a delegated OCSP signing certificate:
+'''
+$ step ocsp serve --ca intermediate_ca.crt --cert ocsp.crt --key ocsp.key \
+  --db index.txt --address 127.0.0.1:8888
+'''
+
+Check the status of a certificate using the local responder:
+'''
+$ step certificate ocsp foo.crt --issuer intermediate_ca.crt --url http://localhost:8080
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "ca",
+				Usage: `The certificate authority <file> that issued the certificates (PEM file).`,
+			},
+			cli.StringFlag{
+				Name: "key",
+				Usage: `The private key <file> used to sign the responses. It must be the key of the
+certificate authority or, if the '--cert' flag is used, the key of the
+delegated OCSP responder.`,
+			},
+			cli.StringFlag{
+				Name:  "cert",
+				Usage: `The delegated OCSP responder certificate <file> (PEM file).`,
+			},
+			cli.StringFlag{
+				Name:  "db",
+				Usage: `The certificate database <file> in the OpenSSL index.txt format.`,
+			},
+			cli.StringFlag{
+				Name:  "address",
+				Usage: "The TCP <address> to listen on (e.g. \":8080\").",
+				Value: ":8080",
+			},
+			cli.StringFlag{
+				Name: "validity",
+				Usage: `The <duration> between the thisUpdate and nextUpdate fields of the responses.
+It is a sequence of decimal numbers, each with optional fraction and a unit
+suffix, such as "300ms", "1.5h" or "2h45m". Valid time units are "ns", "us" (or
+"µs"), "ms", "s", "m", "h".`,
+				Value: "24h",
+			},
+			flags.PasswordFile,
+		},
+	}
+}
+
+func serveAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 0); err != nil {
+		return err
+	}
+
+	var (
+		caFile   = ctx.String("ca")
+		keyFile  = ctx.String("key")
+		certFile = ctx.String("cert")
+		dbFile   = ctx.String("db")
+		address  = ctx.String("address")
+	)
+	switch {
+	case caFile == "":
+		return errs.RequiredFlag(ctx, "ca")
+	case keyFile == "":
+		return errs.RequiredFlag(ctx, "key")
+	case dbFile == "":
+		return errs.RequiredFlag(ctx, "db")
+	case address == "":
+		return errs.RequiredFlag(ctx, "address")
+	}
+
+	validity, err := time.ParseDuration(ctx.String("validity"))
+	if err != nil || validity <= 0 {
+		return errs.InvalidFlagValue(ctx, "validity", ctx.String("validity"), "")
+	}
+
+	var opts []pemutil.Options
+	if passFile := ctx.String("password-file"); passFile != "" {
+		opts = append(opts, pemutil.WithPasswordFile(passFile))
+	}
+
+	var issuer *x509.Certificate
+	var signer *x509util.Identity
+	if certFile == "" {
+		if signer, err = x509util.LoadIdentityFromDisk(caFile, keyFile, opts...); err != nil {
+			return err
+		}
+		issuer = signer.Crt
+	} else {
+		if issuer, err = pemutil.ReadCertificate(caFile); err != nil {
+			return err
+		}
+		if signer, err = x509util.LoadIdentityFromDisk(certFile, keyFile, opts...); err != nil {
+			return err
+		}
+	}
+
+	r, err := newResponder(issuer, signer.Crt, signer.Key, dbFile, validity)
+	if err != nil {
+		return err
+	}
+	if _, err := r.loadIndex(); err != nil {
+		return err
+	}
+
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return errors.Wrapf(err, "failed to listen on at %s", address)
+	}
+
+	fmt.Printf("Serving OCSP at %s ...\n", l.Addr().String())
+	if err := http.Serve(l, r); err != nil && err != http.ErrServerClosed {
+		return errors.Wrap(err, "OCSP responder failed")
+	}
+	return nil
+}
+
+// responder is an http.Handler that answers OCSP requests using the status in
+// a certificate database.
+type responder struct {
+	issuer        *x509.Certificate
+	cert          *x509.Certificate
+	signer        crypto.Signer
+	dbFile        string
+	validity      time.Duration
+	issuerKeyBits []byte
+	mu            sync.Mutex
+	modTime       time.Time
+	entries       map[string]*indexEntry
+}
+
+func newResponder(issuer, cert *x509.Certificate, key interface{}, dbFile string, validity time.Duration) (*responder, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.Errorf("key of type %T is not a crypto.Signer", key)
+	}
+	if cert != issuer {
+		if err := cert.CheckSignatureFrom(issuer); err != nil {
+			return nil, errors.Wrap(err, "OCSP responder certificate is not signed by the certificate authority")
+		}
+		var found bool
+		for _, eku := range cert.ExtKeyUsage {
+			if eku == x509.ExtKeyUsageOCSPSigning {
+				found = true
+			}
+		}
+		if !found {
+			return nil, errors.New("OCSP responder certificate does not have the OCSP signing extended key usage")
+		}
+	}
+
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return nil, errors.Wrap(err, "error parsing certificate authority public key")
+	}
+
+	return &responder{
+		issuer:        issuer,
+		cert:          cert,
+		signer:        signer,
+		dbFile:        dbFile,
+		validity:      validity,
+		issuerKeyBits: spki.PublicKey.RightAlign(),
+	}, nil
+}
+
+// loadIndex returns the entries in the certificate database, the database is
+// read again if it has been modified.
+func (r *responder) loadIndex() (map[string]*indexEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fi, err := os.Stat(r.dbFile)
+	if err != nil {
+		return nil, errs.FileError(err, r.dbFile)
+	}
+	if r.entries != nil && fi.ModTime().Equal(r.modTime) {
+		return r.entries, nil
+	}
+
+	b, err := ioutil.ReadFile(r.dbFile)
+	if err != nil {
+		return nil, errs.FileError(err, r.dbFile)
+	}
+	entries, err := parseIndex(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s", r.dbFile)
+	}
+	r.entries, r.modTime = entries, fi.ModTime()
+	return r.entries, nil
+}
+
+// isIssuer returns true if the request is for a certificate issued by the
+// certificate authority of the responder.
+func (r *responder) isIssuer(req *ocsp.Request) bool {
+	if !req.HashAlgorithm.Available() {
+		return false
+	}
+	h := req.HashAlgorithm.New()
+	h.Write(r.issuer.RawSubject)
+	if !bytes.Equal(h.Sum(nil), req.IssuerNameHash) {
+		return false
+	}
+	h.Reset()
+	h.Write(r.issuerKeyBits)
+	return bytes.Equal(h.Sum(nil), req.IssuerKeyHash)
+}
+
+// ServeHTTP implements http.Handler.
+func (r *responder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var (
+		b   []byte
+		err error
+	)
+	switch req.Method {
+	case http.MethodGet:
+		s := strings.TrimPrefix(req.URL.Path, "/")
+		if b, err = base64.StdEncoding.DecodeString(s); err != nil {
+			writeResponse(w, ocsp.MalformedRequestErrorResponse)
+			return
+		}
+	case http.MethodPost:
+		if b, err = ioutil.ReadAll(io.LimitReader(req.Body, maxRequestSize)); err != nil {
+			writeResponse(w, ocsp.MalformedRequestErrorResponse)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	ocspReq, err := ocsp.ParseRequest(b)
+	if err != nil {
+		writeResponse(w, ocsp.MalformedRequestErrorResponse)
+		return
+	}
+	if !r.isIssuer(ocspReq) {
+		writeResponse(w, ocsp.UnauthorizedErrorResponse)
+		return
+	}
+
+	entries, err := r.loadIndex()
+	if err != nil {
+		log.Printf("error loading certificate database: %v", err)
+		writeResponse(w, ocsp.InternalErrorErrorResponse)
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Minute)
+	template := ocsp.Response{
+		Status:       ocsp.Unknown,
+		SerialNumber: ocspReq.SerialNumber,
+		ThisUpdate:   now,
+		NextUpdate:   now.Add(r.validity),
+	}
+	if r.cert != r.issuer {
+		template.Certificate = r.cert
+	}
+	if entry, ok := entries[ocspReq.SerialNumber.String()]; ok {
+		template.Status = entry.status
+		if entry.status == ocsp.Revoked {
+			template.RevokedAt = entry.revokedAt
+			template.RevocationReason = entry.reason
+		}
+	}
+
+	resp, err := x509util.CreateOCSPResponse(r.issuer, r.cert, template, r.signer)
+	if err != nil {
+		log.Printf("error creating OCSP response: %v", err)
+		writeResponse(w, ocsp.InternalErrorErrorResponse)
+		return
+	}
+	writeResponse(w, resp)
+}
+
+func writeResponse(w http.ResponseWriter, b []byte) {
+	w.Header().Set("Content-Type", "application/ocsp-response")
+	w.Write(b)
+}
@@ -0,0 +1,147 @@
+package ocsp
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/x509util"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestParseIndex(t *testing.T) {
+	index := "V\t300101000000Z\t\t4F3A\tunknown\t/CN=foo\n" +
+		"R\t20300101000000Z\t200330150405Z,keyCompromise\t4F3B\tunknown\t/CN=bar\n" +
+		"\n# comment\n" +
+		"E\t200101000000Z\t\t4F3C\tunknown\t/CN=zap\n"
+	entries, err := parseIndex([]byte(index))
+	assert.FatalError(t, err)
+	assert.Len(t, 3, entries)
+
+	foo := entries[fmt.Sprint(0x4F3A)]
+	assert.Equals(t, ocsp.Good, foo.status)
+	assert.Equals(t, "/CN=foo", foo.subject)
+	assert.Equals(t, time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), foo.expiresAt)
+
+	bar := entries[fmt.Sprint(0x4F3B)]
+	assert.Equals(t, ocsp.Revoked, bar.status)
+	assert.Equals(t, ocsp.KeyCompromise, bar.reason)
+	assert.Equals(t, time.Date(2020, 3, 30, 15, 4, 5, 0, time.UTC), bar.revokedAt)
+
+	for _, s := range []string{
+		"V\t300101000000Z\t4F3A",
+		"X\t300101000000Z\t\t4F3A\tunknown\t/CN=foo",
+		"V\t3001010000Z\t\t4F3A\tunknown\t/CN=foo",
+		"V\t300101000000Z\t\tXYZ\tunknown\t/CN=foo",
+		"R\t300101000000Z\t\t4F3A\tunknown\t/CN=foo",
+		"R\t300101000000Z\t200330150405Z,foo\t4F3A\tunknown\t/CN=foo",
+	} {
+		_, err := parseIndex([]byte(s))
+		assert.Error(t, err)
+	}
+}
+
+func TestResponder(t *testing.T) {
+	newCertificate := func(text string, data x509util.TemplateData, iss *x509.Certificate, issPriv interface{}) (*x509.Certificate, x509util.Profile) {
+		p, err := x509util.NewProfileFromTemplate(text, data, iss, issPriv)
+		assert.FatalError(t, err)
+		b, err := p.CreateCertificate()
+		assert.FatalError(t, err)
+		crt, err := x509.ParseCertificate(b)
+		assert.FatalError(t, err)
+		return crt, p
+	}
+
+	caTemplate := `{"subject": {"commonName": {{ toJson .Subject }}}, "keyUsage": ["certSign", "crlSign"], "basicConstraints": {"isCA": true}}`
+	leafTemplate := `{"subject": {"commonName": {{ toJson .Subject }}}, "extKeyUsage": {{ toJson .eku }}}`
+	ca, caProfile := newCertificate(caTemplate, x509util.TemplateData{"Subject": "ca"}, nil, nil)
+	other, _ := newCertificate(caTemplate, x509util.TemplateData{"Subject": "other"}, nil, nil)
+	good, _ := newCertificate(leafTemplate, x509util.TemplateData{"Subject": "good", "eku": []string{"serverAuth"}}, ca, caProfile.SubjectPrivateKey())
+	revoked, _ := newCertificate(leafTemplate, x509util.TemplateData{"Subject": "revoked", "eku": []string{"serverAuth"}}, ca, caProfile.SubjectPrivateKey())
+	unknown, _ := newCertificate(leafTemplate, x509util.TemplateData{"Subject": "unknown", "eku": []string{"serverAuth"}}, ca, caProfile.SubjectPrivateKey())
+	delegated, delegatedProfile := newCertificate(leafTemplate, x509util.TemplateData{"Subject": "ocsp", "eku": []string{"ocspSigning"}}, ca, caProfile.SubjectPrivateKey())
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	pssKey := &pemutil.RSAPSSPrivateKey{PrivateKey: rsaKey}
+	pssProfile, err := x509util.NewLeafProfile("ocsp-pss", ca, caProfile.SubjectPrivateKey(), func(p x509util.Profile) error {
+		p.SetSubjectPublicKey(pssKey.Public())
+		p.SetSubjectPrivateKey(pssKey)
+		p.Subject().ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning}
+		return nil
+	})
+	assert.FatalError(t, err)
+	b, err := pssProfile.CreateCertificate()
+	assert.FatalError(t, err)
+	delegatedPSS, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+
+	dir, err := ioutil.TempDir("", "ocsp")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+	dbFile := filepath.Join(dir, "index.txt")
+	index := fmt.Sprintf("V\t300101000000Z\t\t%X\tunknown\t/CN=good\n", good.SerialNumber) +
+		fmt.Sprintf("R\t300101000000Z\t200330150405Z,superseded\t%X\tunknown\t/CN=revoked\n", revoked.SerialNumber)
+	assert.FatalError(t, ioutil.WriteFile(dbFile, []byte(index), 0600))
+
+	_, err = newResponder(ca, good, caProfile.SubjectPrivateKey(), dbFile, time.Hour)
+	assert.Error(t, err)
+
+	for name, r := range map[string]struct {
+		cert *x509.Certificate
+		key  interface{}
+	}{
+		"ca":        {ca, caProfile.SubjectPrivateKey()},
+		"delegated": {delegated, delegatedProfile.SubjectPrivateKey()},
+		"rsa-pss":   {delegatedPSS, pssKey},
+	} {
+		t.Run(name, func(t *testing.T) {
+			r, err := newResponder(ca, r.cert, r.key, dbFile, time.Hour)
+			assert.FatalError(t, err)
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+
+			resp, err := x509util.QueryOCSP(srv.URL, good, ca)
+			assert.FatalError(t, err)
+			assert.Equals(t, ocsp.Good, resp.Status)
+			assert.Equals(t, time.Hour, resp.NextUpdate.Sub(resp.ThisUpdate))
+			assert.Equals(t, x509util.DefaultSignatureAlgorithm(r.signer), resp.SignatureAlgorithm)
+
+			resp, err = x509util.QueryOCSP(srv.URL, revoked, ca)
+			assert.FatalError(t, err)
+			assert.Equals(t, ocsp.Revoked, resp.Status)
+			assert.Equals(t, ocsp.Superseded, resp.RevocationReason)
+
+			resp, err = x509util.QueryOCSP(srv.URL, unknown, ca)
+			assert.FatalError(t, err)
+			assert.Equals(t, ocsp.Unknown, resp.Status)
+
+			// GET request
+			req, err := ocsp.CreateRequest(revoked, ca, nil)
+			assert.FatalError(t, err)
+			httpResp, err := http.Get(srv.URL + "/" + base64.StdEncoding.EncodeToString(req))
+			assert.FatalError(t, err)
+			b, err := ioutil.ReadAll(httpResp.Body)
+			httpResp.Body.Close()
+			assert.FatalError(t, err)
+			resp, err = x509util.ParseOCSPResponse(b, revoked, ca)
+			assert.FatalError(t, err)
+			assert.Equals(t, ocsp.Revoked, resp.Status)
+
+			// Other issuer
+			_, err = x509util.QueryOCSP(srv.URL, good, other)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,407 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/command"
+	"github.com/smallstep/cli/crypto/keys"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/x509util"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/flags"
+	"github.com/smallstep/cli/ui"
+	"github.com/smallstep/cli/utils"
+	"github.com/urfave/cli"
+)
+
+func applyCommand() cli.Command {
+	return cli.Command{
+		Name:      "apply",
+		Action:    command.ActionFunc(applyAction),
+		Usage:     "create or re-issue the certificates described in a specification",
+		UsageText: `**step pki apply** <spec-file> [**--plan**] [**--insecure**] [**--force**]`,
+		Description: `**step pki apply** reads a specification describing a hierarchy of root,
+intermediate and leaf certificates, compares it with the certificates on disk,
+and creates or re-issues the certificates that are missing, expiring, or that
+do not match the specification.
+
+The command is idempotent, running it twice in a row does not change anything
+the second time. Existing keys are reused unless the key type has changed or
+the key is missing, if only the certificate is missing it is created with the
+existing key. A certificate is re-issued if its subject, subject alternative
+names, basic constraints or name constraints have changed, if it has not been
+signed by its issuer, if its issuer will have a new key, or if it expires
+before the renewal window. The renewal window defaults to a third of the
+validity of the certificate.
+
+The specification can be written in YAML or in JSON, files with the .json
+extension are parsed as JSON. Relative paths are relative to the directory of
+the specification. The specification has the following format:
+
+'''
+# Optional time before the expiration when certificates are re-issued.
+renewBefore: 720h
+certificates:
+    # The name used to reference the certificate, required.
+  - name: root
+    # The type of certificate: root, intermediate or leaf, required.
+    type: root
+    # The common name of the certificate, defaults to the name.
+    subject: Smallstep Root CA
+    # The key type (EC, RSA or OKP) and curve or size, defaults to EC P-256.
+    kty: EC
+    crv: P-256
+    # The validity, defaults to 10 years for CAs and 24 hours for leaves.
+    validity: 3650d
+    # The path length constraint, defaults to 1 for roots and 0 for
+    # intermediates, -1 means unconstrained.
+    maxPathLen: 1
+    # The name constraints, only for roots and intermediates. The permitted
+    # and excluded names can have dns, ips, emails and uris.
+    nameConstraints:
+      permitted:
+        dns: [.example.com, example.com]
+        ips: [10.0.0.0/8]
+      excluded:
+        dns: [.internal.example.com]
+    # The certificate and key files, default to <name>.crt and <name>.key.
+    crt: root_ca.crt
+    key: root_ca.key
+    # The file with the password used to encrypt the key, if not set the
+    # password will be prompted.
+    passwordFile: secrets/root.pass
+  - name: intermediate
+    type: intermediate
+    # The name of the issuer, required for intermediates and leaves.
+    issuer: root
+  - name: web
+    type: leaf
+    issuer: intermediate
+    subject: www.example.com
+    # The subject alternative names, defaults to the subject for leaves.
+    sans: [www.example.com, example.com, 10.0.0.1]
+    kty: RSA
+    size: 3072
+    validity: 2160h
+    # Stores the key without encryption, requires --insecure.
+    noPassword: true
+    # Appends the intermediates to the certificate file.
+    bundle: true
+'''
+
+## POSITIONAL ARGUMENTS
+
+<spec-file>
+:  The YAML or JSON file with the specification of the PKI.
+
+## EXIT CODES
+
+This command returns 0 on success and \>0 if any error occurs.
+
+## EXAMPLES
+
+Show what would change without modifying any file:
+'''
+$ step pki apply pki.yaml --plan
+NAME          TYPE          ACTION   REASON
+root          root          keep
+intermediate  intermediate  reissue  certificate expires in 312h0m0s
+web           leaf          create   certificate not found
+'''
+
+Create or re-issue the certificates without asking for confirmation:
+'''
+$ step pki apply pki.yaml --force
+'''
+
+Create the PKI from a specification with unencrypted keys:
+'''
+$ step pki apply pki.yaml --insecure
+'''`,
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name: "plan",
+				Usage: `Show the changes required to build the PKI described in the specification
+without modifying any file.`,
+			},
+			cli.BoolFlag{
+				Name: "insecure",
+				Usage: `Allow the creation of private keys without encryption, required if the
+specification uses noPassword.`,
+			},
+			flags.Force,
+		},
+	}
+}
+
+func applyAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 1); err != nil {
+		return err
+	}
+
+	spec, err := readSpec(ctx.Args().First())
+	if err != nil {
+		return err
+	}
+	if !ctx.Bool("insecure") {
+		for _, c := range spec.Certificates {
+			if c.NoPassword {
+				return errors.Errorf("certificate %s: noPassword requires the '--insecure' flag", c.Name)
+			}
+		}
+	}
+
+	actions, err := planPKI(spec, time.Now())
+	if err != nil {
+		return err
+	}
+	printPlan(actions)
+
+	changes := 0
+	for _, a := range actions {
+		if a.Action != keepAction {
+			changes++
+		}
+	}
+	switch {
+	case changes == 0:
+		ui.Println("The PKI is up to date.")
+		return nil
+	case ctx.Bool("plan"):
+		return nil
+	case !ctx.Bool("force"):
+		str, err := ui.Prompt(fmt.Sprintf("Would you like to apply %d change(s) [y/n]", changes), ui.WithValidateYesNo())
+		if err != nil {
+			return err
+		}
+		if s := strings.ToLower(strings.TrimSpace(str)); s != "y" && s != "yes" {
+			return nil
+		}
+	}
+
+	return applyPlan(actions)
+}
+
+// printPlan prints the planned action for each certificate.
+func printPlan(actions []*pkiAction) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tACTION\tREASON")
+	for _, a := range actions {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", a.Name, a.spec.Type, a.Action, a.Reason)
+	}
+	w.Flush()
+}
+
+// identity is a certificate and its private key.
+type identity struct {
+	crt *x509.Certificate
+	key crypto.PrivateKey
+}
+
+// applyPlan executes the given actions. The actions must be sorted so issuers
+// are always before the certificates they sign.
+func applyPlan(actions []*pkiAction) error {
+	byName := make(map[string]*pkiAction, len(actions))
+	identities := make(map[string]*identity, len(actions))
+
+	// getIssuer returns the identity of an issuer, loading it from disk if it
+	// has not been created in this run.
+	getIssuer := func(name string) (*identity, error) {
+		if id, ok := identities[name]; ok {
+			return id, nil
+		}
+		c := byName[name].spec
+		crt, err := pemutil.ReadCertificate(c.Crt, pemutil.WithFirstBlock())
+		if err != nil {
+			return nil, err
+		}
+		key, err := readKey(c)
+		if err != nil {
+			return nil, err
+		}
+		id := &identity{crt: crt, key: key}
+		identities[name] = id
+		return id, nil
+	}
+
+	for _, a := range actions {
+		byName[a.Name] = a
+		if a.Action == keepAction {
+			// The signature cannot be checked when planning if the issuer is
+			// created with an existing key, check it against the new issuer.
+			iss, ok := identities[a.spec.Issuer]
+			if !ok || a.crt.CheckSignatureFrom(iss.crt) == nil {
+				continue
+			}
+			a.Action, a.Reason = reissueAction, fmt.Sprintf("certificate is not signed by %s", a.spec.Issuer)
+			ui.Printf("Certificate %s will be re-issued: %s.\n", a.Name, a.Reason)
+		}
+
+		c := a.spec
+		var iss *identity
+		if c.Type != rootType {
+			var err error
+			if iss, err = getIssuer(c.Issuer); err != nil {
+				return errors.Wrapf(err, "certificate %s", c.Name)
+			}
+		}
+
+		id, err := issueCertificate(c, a.NewKey, iss)
+		if err != nil {
+			return errors.Wrapf(err, "certificate %s", c.Name)
+		}
+		identities[c.Name] = id
+
+		// Write the certificate with the intermediates if required.
+		b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: id.crt.Raw})
+		if c.Bundle {
+			for p := byName[c.Issuer].spec; p.Type != rootType; p = byName[p.Issuer].spec {
+				var crt *x509.Certificate
+				if pid, ok := identities[p.Name]; ok {
+					crt = pid.crt
+				} else if crt, err = pemutil.ReadCertificate(p.Crt, pemutil.WithFirstBlock()); err != nil {
+					return errors.Wrapf(err, "certificate %s", c.Name)
+				}
+				b = append(b, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw})...)
+			}
+		}
+		if err := ioutil.WriteFile(c.Crt, b, 0600); err != nil {
+			return errs.FileError(err, c.Crt)
+		}
+		ui.Printf("Your certificate has been saved in %s.\n", c.Crt)
+	}
+	return nil
+}
+
+// issueCertificate creates a new certificate for the given specification,
+// signed by the issuer or self-signed if the issuer is nil. If newKey is true
+// a new key is generated and written to disk, otherwise the existing key is
+// used.
+func issueCertificate(c *certificateSpec, newKey bool, iss *identity) (*identity, error) {
+	var (
+		key crypto.PrivateKey
+		err error
+	)
+	if newKey {
+		if key, err = keys.GenerateKey(c.KTY, c.Curve, c.Size); err != nil {
+			return nil, err
+		}
+		if err := writeKey(c, key); err != nil {
+			return nil, err
+		}
+	} else if key, err = readKey(c); err != nil {
+		return nil, err
+	}
+	pub, err := keys.PublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	opts := []x509util.WithOption{
+		func(p x509util.Profile) error {
+			p.SetSubjectPublicKey(pub)
+			p.SetSubjectPrivateKey(key)
+			return nil
+		},
+		x509util.WithNotBeforeAfterDuration(now, now.Add(c.Validity.Duration), 0),
+	}
+	if c.isCA() {
+		opts = append(opts, x509util.WithMaxPathLen(c.maxPathLen()))
+		if c.NameConstraints != nil {
+			nc, err := c.nameConstraints()
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, x509util.WithNameConstraints(nc))
+		}
+	}
+	if len(c.SANs) > 0 {
+		dnsNames, ips, emails, uris := x509util.SplitSANsWithURIs(c.SANs)
+		opts = append(opts, x509util.WithDNSNames(dnsNames), x509util.WithIPAddresses(ips),
+			x509util.WithEmailAddresses(emails), x509util.WithURIs(uris))
+	}
+
+	var p x509util.Profile
+	switch c.Type {
+	case rootType:
+		p, err = x509util.NewRootProfile(c.Subject, opts...)
+	case intermediateType:
+		p, err = x509util.NewIntermediateProfile(c.Subject, iss.crt, iss.key, opts...)
+	default:
+		p, err = x509util.NewLeafProfile(c.Subject, iss.crt, iss.key, opts...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	b, err := p.CreateCertificate()
+	if err != nil {
+		return nil, err
+	}
+	crt, err := x509.ParseCertificate(b)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing certificate")
+	}
+	return &identity{crt: crt, key: key}, nil
+}
+
+// readKey reads the private key of a certificate and checks that it matches
+// the key type in the specification.
+func readKey(c *certificateSpec) (crypto.PrivateKey, error) {
+	var opts []pemutil.Options
+	if c.PasswordFile != "" {
+		opts = append(opts, pemutil.WithPasswordFile(c.PasswordFile))
+	}
+	key, err := pemutil.Read(c.Key, opts...)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := keys.PublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if kt := x509util.PublicKeyString(pub); kt != c.keyType() {
+		return nil, errors.Errorf("key %s is %s, expected %s", c.Key, kt, c.keyType())
+	}
+	return key, nil
+}
+
+// writeKey writes the private key of a certificate, encrypted with the
+// password in the password file, a prompted password, or unencrypted if
+// noPassword is set.
+func writeKey(c *certificateSpec, key crypto.PrivateKey) error {
+	var opts []pemutil.Options
+	switch {
+	case c.NoPassword:
+	case c.PasswordFile != "":
+		pass, err := utils.ReadPasswordFromFile(c.PasswordFile)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, pemutil.WithPassword(pass))
+	default:
+		pass, err := ui.PromptPassword(fmt.Sprintf("Please enter the password to encrypt %s", c.Key))
+		if err != nil {
+			return err
+		}
+		opts = append(opts, pemutil.WithPassword(pass))
+	}
+	block, err := pemutil.Serialize(key, opts...)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(c.Key, pem.EncodeToMemory(block), 0600); err != nil {
+		return errs.FileError(err, c.Key)
+	}
+	ui.Printf("Your private key has been saved in %s.\n", c.Key)
+	return nil
+}
@@ -0,0 +1,236 @@
+package pki
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/cli/crypto/pemutil"
+)
+
+const testSpec = `renewBefore: 1h
+certificates:
+  - name: leaf
+    type: leaf
+    issuer: intermediate
+    subject: www.example.com
+    sans: [www.example.com, 10.0.0.1]
+    noPassword: true
+    bundle: true
+  - name: intermediate
+    type: intermediate
+    issuer: root
+    kty: RSA
+    noPassword: true
+  - name: root
+    type: root
+    subject: Root CA
+    crv: P-384
+    validity: 3650d
+    noPassword: true
+`
+
+func writeSpec(t *testing.T, dir, name, content string) string {
+	filename := filepath.Join(dir, name)
+	assert.FatalError(t, ioutil.WriteFile(filename, []byte(content), 0600))
+	return filename
+}
+
+func planActions(actions []*pkiAction) map[string]string {
+	m := make(map[string]string, len(actions))
+	for _, a := range actions {
+		m[a.Name] = a.Action
+	}
+	return m
+}
+
+func TestReadSpec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pki")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+
+	spec, err := readSpec(writeSpec(t, dir, "pki.yaml", testSpec))
+	assert.FatalError(t, err)
+	assert.Equals(t, time.Hour, spec.RenewBefore.Duration)
+	assert.Len(t, 3, spec.Certificates)
+
+	root, intermediate, leaf := spec.Certificates[0], spec.Certificates[1], spec.Certificates[2]
+	assert.Equals(t, "root", root.Name)
+	assert.Equals(t, "ECDSA P-384", root.keyType())
+	assert.Equals(t, 3650*24*time.Hour, root.Validity.Duration)
+	assert.Equals(t, 1, root.maxPathLen())
+	assert.Equals(t, filepath.Join(dir, "root.crt"), root.Crt)
+	assert.Equals(t, filepath.Join(dir, "root.key"), root.Key)
+	assert.Equals(t, "intermediate", intermediate.Name)
+	assert.Equals(t, "intermediate", intermediate.Subject)
+	assert.Equals(t, "RSA 2048", intermediate.keyType())
+	assert.Equals(t, 0, intermediate.maxPathLen())
+	assert.Equals(t, "leaf", leaf.Name)
+	assert.Equals(t, "ECDSA P-256", leaf.keyType())
+	assert.Equals(t, 24*time.Hour, leaf.Validity.Duration)
+
+	json := `{"certificates": [{"name": "root", "type": "root", "kty": "OKP", "crt": "/tmp/root.crt"}]}`
+	spec, err = readSpec(writeSpec(t, dir, "pki.json", json))
+	assert.FatalError(t, err)
+	assert.Equals(t, "Ed25519", spec.Certificates[0].keyType())
+	assert.Equals(t, "/tmp/root.crt", spec.Certificates[0].Crt)
+	assert.Equals(t, filepath.Join(dir, "root.key"), spec.Certificates[0].Key)
+}
+
+func TestReadSpecErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pki")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+
+	tests := map[string]struct {
+		spec string
+		err  string
+	}{
+		"empty":          {"certificates: []", "no certificates found"},
+		"unknown field":  {"certificates: [{name: root, type: root, foo: bar}]", "field foo not found"},
+		"no name":        {"certificates: [{type: root}]", "certificate #1: name cannot be empty"},
+		"duplicated":     {"certificates: [{name: root, type: root}, {name: root, type: root}]", "certificate root: name is duplicated"},
+		"bad type":       {"certificates: [{name: root, type: ca}]", "certificate root: unsupported type 'ca'"},
+		"root issuer":    {"certificates: [{name: root, type: root, issuer: other}]", "certificate root: root certificates cannot have an issuer"},
+		"no issuer":      {"certificates: [{name: leaf, type: leaf}]", "certificate leaf: issuer cannot be empty"},
+		"issuer missing": {"certificates: [{name: leaf, type: leaf, issuer: root}]", "certificate leaf: issuer root not found"},
+		"issuer leaf": {"certificates: [{name: root, type: root}, {name: a, type: leaf, issuer: root}, {name: b, type: leaf, issuer: a}]",
+			"certificate b: issuer a is not a root or an intermediate"},
+		"loop": {"certificates: [{name: a, type: intermediate, issuer: b}, {name: b, type: intermediate, issuer: a}]",
+			"certificate a: issuers do not chain to a root"},
+		"leaf path len": {"certificates: [{name: root, type: root}, {name: leaf, type: leaf, issuer: root, maxPathLen: 1}]",
+			"certificate leaf: path length constraints can only be used"},
+		"bad kty":      {"certificates: [{name: root, type: root, kty: DSA}]", "certificate root: unsupported kty 'DSA'"},
+		"bad curve":    {"certificates: [{name: root, type: root, crv: P-224}]", "certificate root: unsupported curve 'P-224'"},
+		"small rsa":    {"certificates: [{name: root, type: root, kty: RSA, size: 1024}]", "certificate root: size must be at least 2048 bits"},
+		"bad validity": {"certificates: [{name: root, type: root, validity: 10y}]", "invalid duration 10y"},
+		"leaf name constraints": {"certificates: [{name: root, type: root}, {name: leaf, type: leaf, issuer: root, nameConstraints: {permitted: {dns: [example.com]}}}]",
+			"certificate leaf: name constraints can only be used"},
+		"bad name constraints": {"certificates: [{name: root, type: root, nameConstraints: {excluded: {ips: [10.0.0.0/33]}}}]",
+			"certificate root: invalid IP range '10.0.0.0/33'"},
+		"passwords": {"certificates: [{name: root, type: root, noPassword: true, passwordFile: pass.txt}]",
+			"certificate root: noPassword and passwordFile cannot be used together"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := readSpec(writeSpec(t, dir, "pki.yaml", tt.spec))
+			if assert.Error(t, err) {
+				assert.HasPrefix(t, err.Error(), "error ")
+				assert.True(t, strings.Contains(err.Error(), tt.err), err.Error())
+			}
+		})
+	}
+}
+
+func TestPlanAndApply(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pki")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := writeSpec(t, dir, "pki.yaml", testSpec)
+	spec, err := readSpec(filename)
+	assert.FatalError(t, err)
+
+	// Create everything.
+	actions, err := planPKI(spec, time.Now())
+	assert.FatalError(t, err)
+	assert.Equals(t, map[string]string{"root": createAction, "intermediate": createAction, "leaf": createAction}, planActions(actions))
+	assert.FatalError(t, applyPlan(actions))
+
+	certs, err := pemutil.ReadCertificateBundle(filepath.Join(dir, "leaf.crt"))
+	assert.FatalError(t, err)
+	assert.Len(t, 2, certs)
+	assert.Equals(t, "www.example.com", certs[0].Subject.CommonName)
+	assert.Equals(t, []string{"www.example.com"}, certs[0].DNSNames)
+	assert.Equals(t, "10.0.0.1", certs[0].IPAddresses[0].String())
+	assert.Equals(t, "intermediate", certs[1].Subject.CommonName)
+	root, err := pemutil.ReadCertificate(filepath.Join(dir, "root.crt"))
+	assert.FatalError(t, err)
+	assert.Equals(t, "Root CA", root.Subject.CommonName)
+	assert.True(t, root.IsCA)
+	assert.Equals(t, 1, root.MaxPathLen)
+	assert.FatalError(t, certs[1].CheckSignatureFrom(root))
+	assert.FatalError(t, certs[0].CheckSignatureFrom(certs[1]))
+
+	// Nothing to do.
+	actions, err = planPKI(spec, time.Now())
+	assert.FatalError(t, err)
+	assert.Equals(t, map[string]string{"root": keepAction, "intermediate": keepAction, "leaf": keepAction}, planActions(actions))
+
+	// Renewal window.
+	actions, err = planPKI(spec, time.Now().Add(23*time.Hour+30*time.Minute))
+	assert.FatalError(t, err)
+	assert.Equals(t, map[string]string{"root": keepAction, "intermediate": keepAction, "leaf": reissueAction}, planActions(actions))
+	assert.False(t, actions[2].NewKey)
+
+	// Changes in the specification.
+	spec, err = readSpec(writeSpec(t, dir, "pki.yaml", strings.Replace(testSpec, "Root CA", "New Root CA", 1)))
+	assert.FatalError(t, err)
+	actions, err = planPKI(spec, time.Now())
+	assert.FatalError(t, err)
+	assert.Equals(t, map[string]string{"root": reissueAction, "intermediate": reissueAction, "leaf": reissueAction}, planActions(actions))
+	assert.Equals(t, "subject changed from Root CA to New Root CA", actions[0].Reason)
+	assert.Equals(t, "issuer changed from Root CA to New Root CA", actions[1].Reason)
+	assert.Equals(t, "issuer intermediate will be re-issued", actions[2].Reason)
+
+	spec, err = readSpec(writeSpec(t, dir, "pki.yaml", strings.Replace(testSpec, "crv: P-384", "kty: OKP", 1)))
+	assert.FatalError(t, err)
+	actions, err = planPKI(spec, time.Now())
+	assert.FatalError(t, err)
+	assert.Equals(t, map[string]string{"root": reissueAction, "intermediate": reissueAction, "leaf": reissueAction}, planActions(actions))
+	assert.True(t, actions[0].NewKey)
+	assert.Equals(t, "issuer root will have a new key", actions[1].Reason)
+	assert.FatalError(t, applyPlan(actions))
+
+	actions, err = planPKI(spec, time.Now())
+	assert.FatalError(t, err)
+	assert.Equals(t, map[string]string{"root": keepAction, "intermediate": keepAction, "leaf": keepAction}, planActions(actions))
+
+	// Missing key.
+	assert.FatalError(t, os.Remove(filepath.Join(dir, "intermediate.key")))
+	actions, err = planPKI(spec, time.Now())
+	assert.FatalError(t, err)
+	assert.Equals(t, map[string]string{"root": keepAction, "intermediate": createAction, "leaf": reissueAction}, planActions(actions))
+	assert.Equals(t, "private key not found", actions[1].Reason)
+	assert.True(t, actions[1].NewKey)
+	assert.FatalError(t, applyPlan(actions))
+
+	// Missing certificate, the key is reused.
+	key, err := ioutil.ReadFile(filepath.Join(dir, "intermediate.key"))
+	assert.FatalError(t, err)
+	assert.FatalError(t, os.Remove(filepath.Join(dir, "intermediate.crt")))
+	actions, err = planPKI(spec, time.Now())
+	assert.FatalError(t, err)
+	assert.Equals(t, map[string]string{"root": keepAction, "intermediate": createAction, "leaf": reissueAction}, planActions(actions))
+	assert.Equals(t, "certificate not found", actions[1].Reason)
+	assert.False(t, actions[1].NewKey)
+	assert.Equals(t, "issuer intermediate will be re-issued", actions[2].Reason)
+	assert.FatalError(t, applyPlan(actions))
+	newKey, err := ioutil.ReadFile(filepath.Join(dir, "intermediate.key"))
+	assert.FatalError(t, err)
+	assert.Equals(t, key, newKey)
+
+	// Name constraints.
+	nameConstraints := "    nameConstraints:\n      permitted:\n        dns: [.example.com]\n        ips: [10.0.0.0/8]\n    noPassword: true\n  - name: root"
+	spec, err = readSpec(writeSpec(t, dir, "pki.yaml", strings.Replace(strings.Replace(testSpec, "crv: P-384", "kty: OKP", 1),
+		"    noPassword: true\n  - name: root", nameConstraints, 1)))
+	assert.FatalError(t, err)
+	actions, err = planPKI(spec, time.Now())
+	assert.FatalError(t, err)
+	assert.Equals(t, map[string]string{"root": keepAction, "intermediate": reissueAction, "leaf": reissueAction}, planActions(actions))
+	assert.Equals(t, "name constraints changed", actions[1].Reason)
+	assert.False(t, actions[1].NewKey)
+	assert.FatalError(t, applyPlan(actions))
+
+	intermediate, err := pemutil.ReadCertificate(filepath.Join(dir, "intermediate.crt"))
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{".example.com"}, intermediate.PermittedDNSDomains)
+	assert.Equals(t, "10.0.0.0/8", intermediate.PermittedIPRanges[0].String())
+	actions, err = planPKI(spec, time.Now())
+	assert.FatalError(t, err)
+	assert.Equals(t, map[string]string{"root": keepAction, "intermediate": keepAction, "leaf": keepAction}, planActions(actions))
+}
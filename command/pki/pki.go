@@ -0,0 +1,35 @@
+package pki
+
+import (
+	"github.com/smallstep/cli/command"
+	"github.com/urfave/cli"
+)
+
+// init creates and registers the pki command
+func init() {
+	cmd := cli.Command{
+		Name:      "pki",
+		Usage:     "build and maintain a public key infrastructure from a specification",
+		UsageText: "step pki SUBCOMMAND [ARGUMENTS] [GLOBAL_FLAGS] [SUBCOMMAND_FLAGS]",
+		Description: `**step pki** command group provides facilities to create and maintain a
+hierarchy of root, intermediate and leaf certificates described in a
+specification file.
+
+## EXAMPLES
+
+Show the changes required to build the PKI described in pki.yaml:
+'''
+$ step pki apply pki.yaml --plan
+'''
+
+Create or re-issue the certificates described in pki.yaml:
+'''
+$ step pki apply pki.yaml
+'''`,
+		Subcommands: cli.Commands{
+			applyCommand(),
+		},
+	}
+
+	command.Register(cmd)
+}
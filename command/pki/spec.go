@@ -0,0 +1,506 @@
+package pki
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"github.com/smallstep/cli/crypto/x509util"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/utils"
+	"gopkg.in/yaml.v2"
+)
+
+// Certificate types supported in a specification.
+const (
+	rootType         = "root"
+	intermediateType = "intermediate"
+	leafType         = "leaf"
+)
+
+// Actions in a plan.
+const (
+	createAction  = "create"
+	reissueAction = "reissue"
+	keepAction    = "keep"
+)
+
+// pkiSpec is the specification of a PKI, the list of certificates to create
+// and the policy used to re-issue them.
+type pkiSpec struct {
+	// RenewBefore is the time before the expiration when certificates are
+	// re-issued, it defaults to a third of the validity of each certificate.
+	RenewBefore  specDuration       `json:"renewBefore" yaml:"renewBefore"`
+	Certificates []*certificateSpec `json:"certificates" yaml:"certificates"`
+}
+
+// certificateSpec is the specification of a certificate and its key.
+type certificateSpec struct {
+	Name       string       `json:"name" yaml:"name"`
+	Type       string       `json:"type" yaml:"type"`
+	Issuer     string       `json:"issuer" yaml:"issuer"`
+	Subject    string       `json:"subject" yaml:"subject"`
+	SANs       []string     `json:"sans" yaml:"sans"`
+	KTY        string       `json:"kty" yaml:"kty"`
+	Curve      string       `json:"crv" yaml:"crv"`
+	Size       int          `json:"size" yaml:"size"`
+	Validity   specDuration `json:"validity" yaml:"validity"`
+	MaxPathLen *int         `json:"maxPathLen" yaml:"maxPathLen"`
+	// NameConstraints are the name constraints of a root or an intermediate.
+	NameConstraints *specNameConstraints `json:"nameConstraints" yaml:"nameConstraints"`
+	Crt             string               `json:"crt" yaml:"crt"`
+	Key             string               `json:"key" yaml:"key"`
+	PasswordFile    string               `json:"passwordFile" yaml:"passwordFile"`
+	NoPassword      bool                 `json:"noPassword" yaml:"noPassword"`
+	Bundle          bool                 `json:"bundle" yaml:"bundle"`
+}
+
+// specNameConstraints are the permitted and excluded names of a certificate
+// authority.
+type specNameConstraints struct {
+	Permitted specNames `json:"permitted" yaml:"permitted"`
+	Excluded  specNames `json:"excluded" yaml:"excluded"`
+}
+
+// specNames is a list of names of each type used in the name constraints.
+type specNames struct {
+	DNS    []string `json:"dns" yaml:"dns"`
+	IPs    []string `json:"ips" yaml:"ips"`
+	Emails []string `json:"emails" yaml:"emails"`
+	URIs   []string `json:"uris" yaml:"uris"`
+}
+
+// specDuration is a duration that can be written as a Go duration, e.g.
+// "720h", or in days, e.g. "3650d".
+type specDuration struct {
+	time.Duration
+}
+
+func (d *specDuration) parse(s string) error {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return errors.Errorf("invalid duration %s", s)
+		}
+		d.Duration = time.Duration(days) * 24 * time.Hour
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return errors.Errorf("invalid duration %s", s)
+	}
+	d.Duration = v
+	return nil
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (d *specDuration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return errors.Wrap(err, "error parsing duration")
+	}
+	return d.parse(s)
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (d *specDuration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return errors.Wrap(err, "error parsing duration")
+	}
+	return d.parse(s)
+}
+
+// isCA returns true if the certificate is a root or an intermediate.
+func (c *certificateSpec) isCA() bool {
+	return c.Type == rootType || c.Type == intermediateType
+}
+
+// maxPathLen returns the expected path length constraint, -1 if there is no
+// constraint.
+func (c *certificateSpec) maxPathLen() int {
+	switch {
+	case c.MaxPathLen != nil:
+		return *c.MaxPathLen
+	case c.Type == rootType:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// nameConstraints returns the name constraints in the format used by
+// x509util.WithNameConstraints.
+func (c *certificateSpec) nameConstraints() (x509util.NameConstraints, error) {
+	var nc x509util.NameConstraints
+	if c.NameConstraints == nil {
+		return nc, nil
+	}
+	permitted, excluded := c.NameConstraints.Permitted, c.NameConstraints.Excluded
+	nc.PermittedDNSDomains, nc.ExcludedDNSDomains = permitted.DNS, excluded.DNS
+	nc.PermittedEmailAddresses, nc.ExcludedEmailAddresses = permitted.Emails, excluded.Emails
+	nc.PermittedURIDomains, nc.ExcludedURIDomains = permitted.URIs, excluded.URIs
+	for _, s := range permitted.IPs {
+		ipNet, err := x509util.ParseIPRange(s)
+		if err != nil {
+			return nc, err
+		}
+		nc.PermittedIPRanges = append(nc.PermittedIPRanges, ipNet)
+	}
+	for _, s := range excluded.IPs {
+		ipNet, err := x509util.ParseIPRange(s)
+		if err != nil {
+			return nc, err
+		}
+		nc.ExcludedIPRanges = append(nc.ExcludedIPRanges, ipNet)
+	}
+	return nc, nil
+}
+
+// keyType returns the public key type in the format used by
+// x509util.PublicKeyString.
+func (c *certificateSpec) keyType() string {
+	switch c.KTY {
+	case "RSA":
+		return fmt.Sprintf("RSA %d", c.Size)
+	case "OKP":
+		return c.Curve
+	default:
+		return "ECDSA " + c.Curve
+	}
+}
+
+// renewBefore returns the time before the expiration when the certificate
+// will be re-issued.
+func (c *certificateSpec) renewBefore(spec *pkiSpec) time.Duration {
+	if spec.RenewBefore.Duration > 0 {
+		return spec.RenewBefore.Duration
+	}
+	return c.Validity.Duration / 3
+}
+
+// readSpec reads and validates the specification in the given file. JSON
+// files are parsed if the file has the .json extension, YAML files otherwise.
+// Relative paths in the specification are relative to the directory of the
+// file.
+func readSpec(filename string) (*pkiSpec, error) {
+	b, err := utils.ReadFile(filename)
+	if err != nil {
+		return nil, errs.FileError(err, filename)
+	}
+
+	spec := new(pkiSpec)
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(spec)
+	} else {
+		err = yaml.UnmarshalStrict(b, spec)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s", filename)
+	}
+	if err := spec.validate(filepath.Dir(filename)); err != nil {
+		return nil, errors.Wrapf(err, "error validating %s", filename)
+	}
+	return spec, nil
+}
+
+// validate checks the specification, sets the default values and sorts the
+// certificates so issuers are always before the certificates they sign.
+func (s *pkiSpec) validate(dir string) error {
+	if len(s.Certificates) == 0 {
+		return errors.New("no certificates found")
+	}
+
+	byName := make(map[string]*certificateSpec, len(s.Certificates))
+	for i, c := range s.Certificates {
+		if c.Name == "" {
+			return errors.Errorf("certificate #%d: name cannot be empty", i+1)
+		}
+		if _, ok := byName[c.Name]; ok {
+			return errors.Errorf("certificate %s: name is duplicated", c.Name)
+		}
+		byName[c.Name] = c
+		if err := c.validate(dir); err != nil {
+			return errors.Wrapf(err, "certificate %s", c.Name)
+		}
+	}
+
+	// Sort the certificates by the depth in the hierarchy, keeping the order
+	// of the specification for certificates with the same depth.
+	depths := make(map[string]int, len(s.Certificates))
+	for _, c := range s.Certificates {
+		depth := 0
+		for cur := c; cur.Type != rootType; depth++ {
+			iss, ok := byName[cur.Issuer]
+			switch {
+			case !ok:
+				return errors.Errorf("certificate %s: issuer %s not found", cur.Name, cur.Issuer)
+			case !iss.isCA():
+				return errors.Errorf("certificate %s: issuer %s is not a root or an intermediate", cur.Name, cur.Issuer)
+			case depth >= len(s.Certificates):
+				return errors.Errorf("certificate %s: issuers do not chain to a root", c.Name)
+			}
+			cur = iss
+		}
+		depths[c.Name] = depth
+	}
+	sort.SliceStable(s.Certificates, func(i, j int) bool {
+		return depths[s.Certificates[i].Name] < depths[s.Certificates[j].Name]
+	})
+	return nil
+}
+
+// validate checks the certificate specification and sets the default values.
+func (c *certificateSpec) validate(dir string) error {
+	switch c.Type {
+	case rootType:
+		if c.Issuer != "" {
+			return errors.New("root certificates cannot have an issuer")
+		}
+		if c.Bundle {
+			return errors.New("root certificates cannot be bundled")
+		}
+	case intermediateType, leafType:
+		if c.Issuer == "" {
+			return errors.New("issuer cannot be empty")
+		}
+	default:
+		return errors.Errorf("unsupported type '%s', options are root, intermediate or leaf", c.Type)
+	}
+	if c.Subject == "" {
+		c.Subject = c.Name
+	}
+	if c.Type == leafType && len(c.SANs) == 0 {
+		c.SANs = []string{c.Subject}
+	}
+	if c.MaxPathLen != nil && !c.isCA() {
+		return errors.New("path length constraints can only be used in roots and intermediates")
+	}
+	if c.NameConstraints != nil {
+		if !c.isCA() {
+			return errors.New("name constraints can only be used in roots and intermediates")
+		}
+		if _, err := c.nameConstraints(); err != nil {
+			return err
+		}
+	}
+	if c.NoPassword && c.PasswordFile != "" {
+		return errors.New("noPassword and passwordFile cannot be used together")
+	}
+
+	switch c.KTY {
+	case "", "EC":
+		if c.Size != 0 {
+			return errors.New("size cannot be used with EC keys")
+		}
+		c.KTY = "EC"
+		if c.Curve == "" {
+			c.Curve = utils.DefaultECCurve
+		}
+		switch c.Curve {
+		case "P-256", "P-384", "P-521":
+		default:
+			return errors.Errorf("unsupported curve '%s', options are P-256, P-384 or P-521", c.Curve)
+		}
+	case "RSA":
+		if c.Curve != "" {
+			return errors.New("crv cannot be used with RSA keys")
+		}
+		if c.Size == 0 {
+			c.Size = utils.DefaultRSASize
+		}
+		if c.Size < 2048 {
+			return errors.New("size must be at least 2048 bits")
+		}
+	case "OKP":
+		if c.Size != 0 {
+			return errors.New("size cannot be used with OKP keys")
+		}
+		if c.Curve == "" {
+			c.Curve = "Ed25519"
+		}
+		if c.Curve != "Ed25519" {
+			return errors.Errorf("unsupported curve '%s', options are Ed25519", c.Curve)
+		}
+	default:
+		return errors.Errorf("unsupported kty '%s', options are EC, RSA or OKP", c.KTY)
+	}
+
+	if c.Validity.Duration < 0 {
+		return errors.New("validity cannot be negative")
+	}
+	if c.Validity.Duration == 0 {
+		switch c.Type {
+		case rootType:
+			c.Validity.Duration = x509util.DefaultRootCertValidity
+		case intermediateType:
+			c.Validity.Duration = x509util.DefaultIntermediateCertValidity
+		default:
+			c.Validity.Duration = x509util.DefaultCertValidity
+		}
+	}
+
+	if c.Crt == "" {
+		c.Crt = c.Name + ".crt"
+	}
+	if c.Key == "" {
+		c.Key = c.Name + ".key"
+	}
+	for _, p := range []*string{&c.Crt, &c.Key, &c.PasswordFile} {
+		if *p != "" && !filepath.IsAbs(*p) {
+			*p = filepath.Join(dir, *p)
+		}
+	}
+	return nil
+}
+
+// pkiAction is the action planned for a certificate in the specification.
+type pkiAction struct {
+	spec   *certificateSpec
+	Name   string
+	Action string
+	Reason string
+	// NewKey indicates that a new key will be generated.
+	NewKey bool
+	// crt is the current certificate.
+	crt *x509.Certificate
+}
+
+// planPKI compares the specification with the certificates on disk and
+// returns the actions required to build the PKI.
+func planPKI(spec *pkiSpec, now time.Time) ([]*pkiAction, error) {
+	var actions []*pkiAction
+	byName := make(map[string]*pkiAction, len(spec.Certificates))
+	for _, c := range spec.Certificates {
+		a, err := planCertificate(spec, c, byName, now)
+		if err != nil {
+			return nil, errors.Wrapf(err, "certificate %s", c.Name)
+		}
+		byName[c.Name] = a
+		actions = append(actions, a)
+	}
+	return actions, nil
+}
+
+func planCertificate(spec *pkiSpec, c *certificateSpec, planned map[string]*pkiAction, now time.Time) (*pkiAction, error) {
+	a := &pkiAction{spec: c, Name: c.Name}
+	create := func(newKey bool, reason string) (*pkiAction, error) {
+		a.Action, a.Reason, a.NewKey = createAction, reason, newKey
+		return a, nil
+	}
+	reissue := func(newKey bool, format string, args ...interface{}) (*pkiAction, error) {
+		a.Action, a.Reason, a.NewKey = reissueAction, fmt.Sprintf(format, args...), newKey
+		return a, nil
+	}
+
+	// The existing key is reused if only the certificate is missing.
+	if _, err := os.Stat(c.Key); os.IsNotExist(err) {
+		return create(true, "private key not found")
+	}
+	if _, err := os.Stat(c.Crt); os.IsNotExist(err) {
+		return create(false, "certificate not found")
+	}
+	crt, err := pemutil.ReadCertificate(c.Crt, pemutil.WithFirstBlock())
+	if err != nil {
+		return nil, err
+	}
+	a.crt = crt
+
+	if kt := x509util.PublicKeyString(crt.PublicKey); kt != c.keyType() {
+		return reissue(true, "key type changed from %s to %s", kt, c.keyType())
+	}
+	if crt.Subject.CommonName != c.Subject {
+		return reissue(false, "subject changed from %s to %s", crt.Subject.CommonName, c.Subject)
+	}
+	if c.Type == leafType || len(c.SANs) > 0 {
+		if !equalStrings(x509util.SANs(crt), c.SANs) {
+			return reissue(false, "subject alternative names changed")
+		}
+	}
+	if crt.IsCA != c.isCA() || (c.isCA() && crt.MaxPathLen != c.maxPathLen()) {
+		return reissue(false, "basic constraints changed")
+	}
+	if c.isCA() {
+		nc, err := c.nameConstraints()
+		if err != nil {
+			return nil, err
+		}
+		if !equalNameConstraints(crt, nc) {
+			return reissue(false, "name constraints changed")
+		}
+	}
+
+	if c.Type != rootType {
+		iss := planned[c.Issuer]
+		switch {
+		case iss.NewKey:
+			return reissue(false, "issuer %s will have a new key", c.Issuer)
+		case crt.Issuer.CommonName != iss.spec.Subject:
+			return reissue(false, "issuer changed from %s to %s", crt.Issuer.CommonName, iss.spec.Subject)
+		case iss.crt != nil && crt.CheckSignatureFrom(iss.crt) != nil:
+			return reissue(false, "certificate is not signed by %s", c.Issuer)
+		case c.Bundle && iss.Action != keepAction:
+			return reissue(false, "issuer %s will be re-issued", c.Issuer)
+		}
+	}
+
+	switch left := crt.NotAfter.Sub(now); {
+	case left <= 0:
+		return reissue(false, "certificate expired on %s", crt.NotAfter.UTC().Format(time.RFC3339))
+	case left <= c.renewBefore(spec):
+		return reissue(false, "certificate expires in %s", left.Round(time.Minute))
+	}
+
+	a.Action = keepAction
+	return a, nil
+}
+
+// equalNameConstraints returns true if the certificate has the given name
+// constraints.
+func equalNameConstraints(crt *x509.Certificate, nc x509util.NameConstraints) bool {
+	ipRanges := func(ipNets []*net.IPNet) []string {
+		ss := make([]string, len(ipNets))
+		for i, ipNet := range ipNets {
+			ss[i] = ipNet.String()
+		}
+		return ss
+	}
+	return equalStrings(crt.PermittedDNSDomains, nc.PermittedDNSDomains) &&
+		equalStrings(crt.ExcludedDNSDomains, nc.ExcludedDNSDomains) &&
+		equalStrings(ipRanges(crt.PermittedIPRanges), ipRanges(nc.PermittedIPRanges)) &&
+		equalStrings(ipRanges(crt.ExcludedIPRanges), ipRanges(nc.ExcludedIPRanges)) &&
+		equalStrings(crt.PermittedEmailAddresses, nc.PermittedEmailAddresses) &&
+		equalStrings(crt.ExcludedEmailAddresses, nc.ExcludedEmailAddresses) &&
+		equalStrings(crt.PermittedURIDomains, nc.PermittedURIDomains) &&
+		equalStrings(crt.ExcludedURIDomains, nc.ExcludedURIDomains)
+}
+
+// equalStrings returns true if the two lists contain the same strings in any
+// order.
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string{}, a...)
+	b = append([]string{}, b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -9,7 +9,7 @@ import (
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/ca"
 	"github.com/smallstep/cli/command"
-	cmdca "github.com/smallstep/cli/command/ca"
+	"github.com/smallstep/cli/crypto/x509util"
 	"github.com/smallstep/cli/errs"
 	"github.com/smallstep/cli/flags"
 	"github.com/smallstep/cli/ui"
@@ -152,7 +152,7 @@ func revokeAction(ctx *cli.Context) error {
 
 	reason := ctx.String("reason")
 	// Convert the reasonCode flag to an OCSP revocation code.
-	reasonCode, err := cmdca.ReasonCodeToNum(ctx.String("reasonCode"))
+	reasonCode, err := x509util.ReasonCodeToNum(ctx.String("reasonCode"))
 	if err != nil {
 		return err
 	}
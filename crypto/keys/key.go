@@ -2,6 +2,7 @@ package keys
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/ed25519"
 	"crypto/elliptic"
@@ -40,6 +41,8 @@ func PublicKey(priv interface{}) (interface{}, error) {
 		return k.Public(), nil
 	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
 		return k, nil
+	case crypto.Signer:
+		return k.Public(), nil
 	default:
 		return nil, errors.Errorf("unrecognized key type: %T", priv)
 	}
@@ -91,6 +94,8 @@ func ExtractKey(in interface{}) (interface{}, error) {
 			return nil, errors.New("ssh public key could not be cast to ssh CryptoPublicKey")
 		}
 		return sshCryptoPubKey.CryptoPublicKey(), nil
+	case crypto.Signer:
+		return in, nil
 	default:
 		return nil, errors.Errorf("cannot extract the key from type '%T'", k)
 	}
@@ -100,8 +105,12 @@ func ExtractKey(in interface{}) (interface{}, error) {
 func VerifyPair(pubkey interface{}, key interface{}) error {
 	switch pub := pubkey.(type) {
 	case *rsa.PublicKey:
-		priv, ok := key.(*rsa.PrivateKey)
-		if !ok {
+		// RSA-PSS private keys are crypto.Signers with an RSA public key.
+		var priv *rsa.PublicKey
+		if signer, ok := key.(crypto.Signer); ok {
+			priv, _ = signer.Public().(*rsa.PublicKey)
+		}
+		if priv == nil {
 			return errors.New("private key type does not match public key type")
 		}
 		if pub.N.Cmp(priv.N) != 0 {
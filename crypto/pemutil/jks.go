@@ -0,0 +1,544 @@
+package pemutil
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+	"unicode/utf16"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/ui"
+)
+
+// DefaultJKSAlias is the alias used for the entries of a Java KeyStore if
+// none is given, it's the same default used by keytool.
+const DefaultJKSAlias = "mykey"
+
+// JCEKSIterations is the number of iterations used to derive the key that
+// protects the private keys in JCEKS keystores.
+const JCEKSIterations = 200000
+
+const (
+	jksMagic   uint32 = 0xfeedfeed
+	jceksMagic uint32 = 0xcececece
+	jksVersion uint32 = 2
+
+	jksPrivateKeyTag  uint32 = 1
+	jksTrustedCertTag uint32 = 2
+	jksSecretKeyTag   uint32 = 3
+
+	// jksIntegritySalt is the string appended to the password to compute the
+	// integrity check of a keystore.
+	jksIntegritySalt = "Mighty Aphrodite"
+	jksSaltSize      = 20
+	jksCertType      = "X.509"
+)
+
+var (
+	// oidJKSKeyProtector is the Sun proprietary algorithm used to protect the
+	// private keys in JKS keystores.
+	oidJKSKeyProtector = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 42, 2, 17, 1, 1}
+	// oidPBEWithMD5AndTripleDES is the Sun proprietary algorithm used to
+	// protect the private keys in JCEKS keystores.
+	oidPBEWithMD5AndTripleDES = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 42, 2, 19, 1}
+)
+
+// ErrJKSIncorrectPassword is returned when the password of a Java KeyStore is
+// not correct.
+var ErrJKSIncorrectPassword = errors.New("jks: keystore password incorrect")
+
+// JKSOptions are the options used to encode a Java KeyStore.
+type JKSOptions struct {
+	// Alias is the name of the entry with the private key, or the name of the
+	// first trusted certificate. It defaults to DefaultJKSAlias.
+	Alias string
+	// JCEKS encodes a JCEKS keystore instead of a JKS one. JCEKS keystores
+	// protect the private keys with 3DES instead of the weak JKS algorithm.
+	JCEKS bool
+}
+
+type jksEntry struct {
+	alias     string
+	tag       uint32
+	timestamp time.Time
+	key       []byte
+	certs     []*x509.Certificate
+}
+
+// IsJKS returns true if the given bytes look like a JKS or JCEKS keystore.
+func IsJKS(b []byte) bool {
+	if len(b) < 8 {
+		return false
+	}
+	magic := binary.BigEndian.Uint32(b)
+	return magic == jksMagic || magic == jceksMagic
+}
+
+// EncodeJKS encodes the given private key, certificate and chain in a Java
+// KeyStore protected with the given password. If the key is nil, the
+// certificate and the chain are added as trusted certificates, creating a
+// truststore. If opts is nil the defaults are used.
+func EncodeJKS(key interface{}, crt *x509.Certificate, chain []*x509.Certificate, password []byte, opts *JKSOptions) ([]byte, error) {
+	if opts == nil {
+		opts = new(JKSOptions)
+	}
+	if crt == nil {
+		return nil, errors.New("jks: certificate cannot be nil")
+	}
+	alias := opts.Alias
+	if alias == "" {
+		alias = DefaultJKSAlias
+	}
+
+	now := time.Now()
+	var entries []jksEntry
+	if key != nil {
+		der, err := MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		var protected []byte
+		if opts.JCEKS {
+			protected, err = jceksProtectKey(der, password)
+		} else {
+			protected, err = jksProtectKey(der, password)
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, jksEntry{
+			alias:     alias,
+			tag:       jksPrivateKeyTag,
+			timestamp: now,
+			key:       protected,
+			certs:     append([]*x509.Certificate{crt}, chain...),
+		})
+	} else {
+		for i, c := range append([]*x509.Certificate{crt}, chain...) {
+			name := alias
+			if i > 0 {
+				name = alias + "-" + strconv.Itoa(i)
+			}
+			entries = append(entries, jksEntry{
+				alias:     name,
+				tag:       jksTrustedCertTag,
+				timestamp: now,
+				certs:     []*x509.Certificate{c},
+			})
+		}
+	}
+
+	magic := jksMagic
+	if opts.JCEKS {
+		magic = jceksMagic
+	}
+	buf := new(bytes.Buffer)
+	writeUint32(buf, magic)
+	writeUint32(buf, jksVersion)
+	writeUint32(buf, uint32(len(entries)))
+	for _, e := range entries {
+		writeUint32(buf, e.tag)
+		if err := writeUTF(buf, e.alias); err != nil {
+			return nil, err
+		}
+		binary.Write(buf, binary.BigEndian, e.timestamp.UnixNano()/int64(time.Millisecond))
+		if e.tag == jksPrivateKeyTag {
+			writeUint32(buf, uint32(len(e.key)))
+			buf.Write(e.key)
+			writeUint32(buf, uint32(len(e.certs)))
+		}
+		for _, c := range e.certs {
+			writeUTF(buf, jksCertType)
+			writeUint32(buf, uint32(len(c.Raw)))
+			buf.Write(c.Raw)
+		}
+	}
+	buf.Write(jksDigest(buf.Bytes(), password))
+	return buf.Bytes(), nil
+}
+
+// DecodeJKS decodes a JKS or JCEKS keystore using the given password and
+// returns the private key, the certificate and the rest of the certificates
+// in the keystore. Like in DecodePKCS12, the certificate is the one of the
+// first private key entry, or the first trusted certificate if the keystore
+// does not contain keys. Secret key entries are not supported, they and the
+// entries after them are ignored.
+func DecodeJKS(b, password []byte) (interface{}, *x509.Certificate, []*x509.Certificate, error) {
+	if len(b) < sha1.Size || !IsJKS(b) {
+		return nil, nil, nil, errors.New("jks: invalid keystore")
+	}
+	data, sum := b[:len(b)-sha1.Size], b[len(b)-sha1.Size:]
+	if subtle.ConstantTimeCompare(sum, jksDigest(data, password)) != 1 {
+		return nil, nil, nil, ErrJKSIncorrectPassword
+	}
+	entries, err := decodeJKSEntries(data)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var (
+		key   interface{}
+		crt   *x509.Certificate
+		certs []*x509.Certificate
+	)
+	for _, e := range entries {
+		if e.tag == jksPrivateKeyTag && key == nil && len(e.certs) > 0 {
+			der, err := jksRecoverKey(e.key, password)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			if key, err = ParsePKCS8PrivateKey(der); err != nil {
+				return nil, nil, nil, errors.Wrap(err, "jks: error parsing private key")
+			}
+			crt = e.certs[0]
+			certs = append(certs, e.certs[1:]...)
+			continue
+		}
+		certs = append(certs, e.certs...)
+	}
+	if crt == nil {
+		if len(certs) == 0 {
+			return nil, nil, nil, errors.New("jks: keystore does not contain any certificate")
+		}
+		crt, certs = certs[0], certs[1:]
+	}
+	return key, crt, certs, nil
+}
+
+// DecodeJKSCertificates returns the trusted certificates in a JKS or JCEKS
+// keystore. The integrity of the keystore is verified using the password in
+// the options, if no password is given the user is prompted for one. It
+// returns ErrJKSIncorrectPassword if the password does not match.
+func DecodeJKSCertificates(b []byte, opts ...Options) ([]*x509.Certificate, error) {
+	ctx := newContext("keystore")
+	if err := ctx.apply(opts); err != nil {
+		return nil, err
+	}
+	if len(b) < sha1.Size || !IsJKS(b) {
+		return nil, errors.New("jks: invalid keystore")
+	}
+
+	password := ctx.password
+	if password == nil {
+		var err error
+		if password, err = ui.PromptPassword(fmt.Sprintf("Please enter the password of %s", ctx.filename)); err != nil {
+			return nil, err
+		}
+	}
+	data, sum := b[:len(b)-sha1.Size], b[len(b)-sha1.Size:]
+	if subtle.ConstantTimeCompare(sum, jksDigest(data, password)) != 1 {
+		return nil, ErrJKSIncorrectPassword
+	}
+	entries, err := decodeJKSEntries(data)
+	if err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	for _, e := range entries {
+		if e.tag == jksTrustedCertTag {
+			certs = append(certs, e.certs...)
+		}
+	}
+	return certs, nil
+}
+
+// decodeJKSEntries parses the entries in the given keystore without the
+// integrity check.
+func decodeJKSEntries(b []byte) ([]jksEntry, error) {
+	r := &jksReader{b: b}
+	magic := r.uint32()
+	version := r.uint32()
+	count := r.uint32()
+	if r.err != nil || (magic != jksMagic && magic != jceksMagic) {
+		return nil, errors.New("jks: invalid keystore")
+	}
+	if version != 1 && version != 2 {
+		return nil, errors.Errorf("jks: unsupported keystore version %d", version)
+	}
+
+	readCertificate := func() *x509.Certificate {
+		if version == 2 {
+			if typ := r.utf(); r.err == nil && typ != jksCertType {
+				r.err = errors.Errorf("jks: unsupported certificate type %s", typ)
+			}
+		}
+		der := r.bytes(int(r.uint32()))
+		if r.err != nil {
+			return nil
+		}
+		crt, err := x509.ParseCertificate(der)
+		if err != nil {
+			r.err = errors.Wrap(err, "jks: error parsing certificate")
+		}
+		return crt
+	}
+
+	var entries []jksEntry
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		e := jksEntry{tag: r.uint32(), alias: r.utf()}
+		e.timestamp = time.Unix(0, int64(r.uint64())*int64(time.Millisecond))
+		switch e.tag {
+		case jksPrivateKeyTag:
+			e.key = r.bytes(int(r.uint32()))
+			n := r.uint32()
+			for j := uint32(0); j < n && r.err == nil; j++ {
+				e.certs = append(e.certs, readCertificate())
+			}
+		case jksTrustedCertTag:
+			e.certs = []*x509.Certificate{readCertificate()}
+		case jksSecretKeyTag:
+			// Secret keys are serialized Java objects that cannot be skipped
+			// without parsing them, the rest of the keystore is ignored.
+			return entries, r.err
+		default:
+			return nil, errors.Errorf("jks: unsupported entry type %d", e.tag)
+		}
+		entries = append(entries, e)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return entries, nil
+}
+
+// jksDigest returns the integrity check of a keystore, the SHA-1 of the
+// password, a well-known salt and the data.
+func jksDigest(data, password []byte) []byte {
+	h := sha1.New()
+	h.Write(jksPassword(password))
+	h.Write([]byte(jksIntegritySalt))
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// jksPassword returns the password as Java characters, UTF-16 big endian.
+func jksPassword(password []byte) []byte {
+	runes := utf16.Encode([]rune(string(password)))
+	b := make([]byte, 2*len(runes))
+	for i, r := range runes {
+		binary.BigEndian.PutUint16(b[2*i:], r)
+	}
+	return b
+}
+
+// jksProtectKey encrypts a PKCS#8 private key using the JKS key protector.
+// The key is XORed with a key stream created by chaining SHA-1 digests of the
+// password and a random salt, and the SHA-1 of the password and the key is
+// appended to check its integrity.
+func jksProtectKey(der, password []byte) ([]byte, error) {
+	salt, err := randomBytes(jksSaltSize)
+	if err != nil {
+		return nil, err
+	}
+	passwd := jksPassword(password)
+	data := make([]byte, 0, jksSaltSize+len(der)+sha1.Size)
+	data = append(data, salt...)
+	data = append(data, jksXOR(der, salt, passwd)...)
+	check := sha1.Sum(append(passwd, der...))
+	data = append(data, check[:]...)
+	return asn1.Marshal(pkcs12EncryptedPrivateKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  oidJKSKeyProtector,
+			Parameters: asn1.NullRawValue,
+		},
+		Data: data,
+	})
+}
+
+// jceksProtectKey encrypts a PKCS#8 private key using
+// PBEWithMD5AndTripleDES.
+func jceksProtectKey(der, password []byte) ([]byte, error) {
+	salt, err := randomBytes(8)
+	if err != nil {
+		return nil, err
+	}
+	params, err := asn1.Marshal(pbeParams{Salt: salt, Iterations: JCEKSIterations})
+	if err != nil {
+		return nil, errors.Wrap(err, "jks: error marshaling parameters")
+	}
+	block, iv, err := jceksCipher(password, salt, JCEKSIterations)
+	if err != nil {
+		return nil, err
+	}
+	bs := block.BlockSize()
+	pad := bs - len(der)%bs
+	encrypted := make([]byte, len(der), len(der)+pad)
+	copy(encrypted, der)
+	encrypted = append(encrypted, bytes.Repeat([]byte{byte(pad)}, pad)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+	return asn1.Marshal(pkcs12EncryptedPrivateKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  oidPBEWithMD5AndTripleDES,
+			Parameters: asn1.RawValue{FullBytes: params},
+		},
+		Data: encrypted,
+	})
+}
+
+// jksRecoverKey decrypts a private key protected with the JKS or the JCEKS
+// key protectors.
+func jksRecoverKey(b, password []byte) ([]byte, error) {
+	var info pkcs12EncryptedPrivateKeyInfo
+	if err := unmarshalDER(b, &info); err != nil {
+		return nil, errors.Wrap(err, "jks: error parsing private key")
+	}
+
+	switch {
+	case info.Algorithm.Algorithm.Equal(oidJKSKeyProtector):
+		if len(info.Data) < jksSaltSize+sha1.Size {
+			return nil, errors.New("jks: invalid private key")
+		}
+		passwd := jksPassword(password)
+		salt := info.Data[:jksSaltSize]
+		check := info.Data[len(info.Data)-sha1.Size:]
+		der := jksXOR(info.Data[jksSaltSize:len(info.Data)-sha1.Size], salt, passwd)
+		sum := sha1.Sum(append(passwd, der...))
+		if subtle.ConstantTimeCompare(sum[:], check) != 1 {
+			return nil, ErrJKSIncorrectPassword
+		}
+		return der, nil
+	case info.Algorithm.Algorithm.Equal(oidPBEWithMD5AndTripleDES):
+		var params pbeParams
+		if err := unmarshalDER(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+			return nil, errors.Wrap(err, "jks: error parsing parameters")
+		}
+		if len(params.Salt) != 8 || params.Iterations <= 0 || params.Iterations > 5000000 {
+			return nil, errors.New("jks: invalid parameters")
+		}
+		block, iv, err := jceksCipher(password, params.Salt, params.Iterations)
+		if err != nil {
+			return nil, err
+		}
+		bs := block.BlockSize()
+		if len(info.Data) == 0 || len(info.Data)%bs != 0 {
+			return nil, errors.New("jks: invalid private key")
+		}
+		decrypted := make([]byte, len(info.Data))
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, info.Data)
+		pad := int(decrypted[len(decrypted)-1])
+		if pad == 0 || pad > bs {
+			return nil, ErrJKSIncorrectPassword
+		}
+		for _, b := range decrypted[len(decrypted)-pad:] {
+			if int(b) != pad {
+				return nil, ErrJKSIncorrectPassword
+			}
+		}
+		return decrypted[:len(decrypted)-pad], nil
+	default:
+		return nil, errors.Errorf("jks: unsupported key protection algorithm %s", info.Algorithm.Algorithm)
+	}
+}
+
+// jksXOR XORs the data with the key stream of the JKS key protector.
+func jksXOR(data, salt, passwd []byte) []byte {
+	out := make([]byte, len(data))
+	digest := salt
+	for i := 0; i < len(data); i += sha1.Size {
+		sum := sha1.Sum(append(append([]byte{}, passwd...), digest...))
+		digest = sum[:]
+		for j := 0; j < sha1.Size && i+j < len(data); j++ {
+			out[i+j] = data[i+j] ^ digest[j]
+		}
+	}
+	return out
+}
+
+// jceksCipher returns the 3DES cipher and the IV derived from the password
+// and the salt as PBEWithMD5AndTripleDES does. Each half of the salt is hashed
+// with the password using MD5 the given number of iterations, the first 24
+// bytes are the key and the last 8 the IV. The password must be ASCII.
+func jceksCipher(password, salt []byte, iterations int) (cipher.Block, []byte, error) {
+	s := make([]byte, len(salt))
+	copy(s, salt)
+	// If the two halves of the salt are the same, the first one is inverted.
+	if bytes.Equal(s[:4], s[4:]) {
+		s[0], s[1], s[2], s[3] = s[3], s[2], s[1], s[0]
+	}
+	derived := make([]byte, 0, 32)
+	for i := 0; i < 2; i++ {
+		sum := s[i*4 : (i+1)*4]
+		for j := 0; j < iterations; j++ {
+			h := md5.New()
+			h.Write(sum)
+			h.Write(password)
+			sum = h.Sum(nil)
+		}
+		derived = append(derived, sum...)
+	}
+	block, err := des.NewTripleDESCipher(derived[:24])
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "jks: error creating cipher")
+	}
+	return block, derived[24:], nil
+}
+
+// jksReader reads the big endian values in a keystore, keeping the first
+// error found.
+type jksReader struct {
+	b   []byte
+	err error
+}
+
+func (r *jksReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.b) {
+		r.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b
+}
+
+func (r *jksReader) uint32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *jksReader) uint64() uint64 {
+	if b := r.bytes(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *jksReader) utf() string {
+	b := r.bytes(2)
+	if b == nil {
+		return ""
+	}
+	return string(r.bytes(int(binary.BigEndian.Uint16(b))))
+}
+
+func writeUint32(w io.Writer, v uint32) {
+	binary.Write(w, binary.BigEndian, v)
+}
+
+// writeUTF writes a string prefixed by its length in two bytes, like Java's
+// DataOutput.writeUTF does for strings without null characters or
+// supplementary characters.
+func writeUTF(w io.Writer, s string) error {
+	if len(s) > math.MaxUint16 {
+		return errors.New("jks: string too long")
+	}
+	binary.Write(w, binary.BigEndian, uint16(len(s)))
+	_, err := io.WriteString(w, s)
+	return err
+}
@@ -0,0 +1,98 @@
+package pemutil
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/binary"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestEncodeDecodeJKS(t *testing.T) {
+	key, err := Read("testdata/openssl.p256.pem")
+	assert.FatalError(t, err)
+	crt, err := ReadCertificate("testdata/pkcs12.crt")
+	assert.FatalError(t, err)
+	ca, err := ReadCertificate("testdata/ca.crt")
+	assert.FatalError(t, err)
+	password := []byte("changeit")
+
+	tests := []struct {
+		name  string
+		opts  *JKSOptions
+		magic uint32
+	}{
+		{"jks", nil, jksMagic},
+		{"jceks", &JKSOptions{Alias: "foo", JCEKS: true}, jceksMagic},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := EncodeJKS(key, crt, []*x509.Certificate{ca}, password, tt.opts)
+			assert.FatalError(t, err)
+			assert.True(t, IsJKS(b))
+			assert.Equals(t, tt.magic, binary.BigEndian.Uint32(b))
+
+			k, c, chain, err := DecodeJKS(b, password)
+			assert.FatalError(t, err)
+			assert.Equals(t, key, k)
+			assert.Equals(t, crt.Raw, c.Raw)
+			assert.Len(t, 1, chain)
+			assert.Equals(t, ca.Raw, chain[0].Raw)
+
+			_, _, _, err = DecodeJKS(b, []byte("foobar"))
+			assert.Equals(t, ErrJKSIncorrectPassword, err)
+
+			// The certificates of private key entries are not trusted.
+			certs, err := DecodeJKSCertificates(b, WithPassword(password))
+			assert.FatalError(t, err)
+			assert.Len(t, 0, certs)
+		})
+	}
+
+	// Truststore
+	b, err := EncodeJKS(nil, ca, []*x509.Certificate{crt}, password, &JKSOptions{Alias: "root"})
+	assert.FatalError(t, err)
+	assert.True(t, bytes.Contains(b, []byte("root-1")))
+	k, c, chain, err := DecodeJKS(b, password)
+	assert.FatalError(t, err)
+	assert.Nil(t, k)
+	assert.Equals(t, ca.Raw, c.Raw)
+	assert.Len(t, 1, chain)
+	assert.Equals(t, crt.Raw, chain[0].Raw)
+	certs, err := DecodeJKSCertificates(b, WithPassword(password))
+	assert.FatalError(t, err)
+	assert.Len(t, 2, certs)
+	assert.Equals(t, ca.Raw, certs[0].Raw)
+	_, err = DecodeJKSCertificates(b, WithPassword([]byte("foobar")))
+	assert.Equals(t, ErrJKSIncorrectPassword, err)
+
+	// Corrupted keystore
+	b[len(b)/2] ^= 0xff
+	_, _, _, err = DecodeJKS(b, password)
+	assert.Equals(t, ErrJKSIncorrectPassword, err)
+	_, err = DecodeJKSCertificates(b, WithPassword(password))
+	assert.Equals(t, ErrJKSIncorrectPassword, err)
+	_, err = DecodeJKSCertificates(b[:40], WithPassword(password))
+	assert.Error(t, err)
+
+	assert.False(t, IsJKS(ca.Raw))
+	_, _, _, err = DecodeJKS(ca.Raw, password)
+	assert.Error(t, err)
+	_, err = EncodeJKS(key, nil, nil, password, nil)
+	assert.Error(t, err)
+}
+
+func TestJCEKSCipher(t *testing.T) {
+	// Salts with equal halves are modified before deriving the key.
+	b1, iv1, err := jceksCipher([]byte("password"), []byte{1, 2, 3, 4, 1, 2, 3, 4}, 10)
+	assert.FatalError(t, err)
+	b2, iv2, err := jceksCipher([]byte("password"), []byte{4, 3, 2, 1, 1, 2, 3, 4}, 10)
+	assert.FatalError(t, err)
+	assert.Equals(t, iv1, iv2)
+	src := []byte("12345678")
+	dst1, dst2 := make([]byte, 8), make([]byte, 8)
+	b1.Encrypt(dst1, src)
+	b2.Encrypt(dst2, src)
+	assert.Equals(t, dst1, dst2)
+}
@@ -159,13 +159,36 @@ func WithFirstBlock() Options {
 }
 
 // ReadCertificate returns a *x509.Certificate from the given filename. It
-// supports certificates formats PEM and DER.
+// supports certificates formats PEM, DER, PKCS#7 and PKCS#12. If a PKCS#7 file
+// is given the first certificate will be returned, and if a PKCS#12 file is
+// given the certificate matching the private key will be returned.
 func ReadCertificate(filename string, opts ...Options) (*x509.Certificate, error) {
 	b, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return nil, errs.FileError(err, filename)
 	}
 
+	// PKCS#12 format
+	if isPKCS12File(filename, b) {
+		_, crt, _, err := ParsePKCS12(b, append(opts, WithFilename(filename))...)
+		if err != nil {
+			return nil, err
+		}
+		if crt == nil {
+			return nil, errors.Errorf("error decoding PKCS#12: file '%s' does not contain a certificate", filename)
+		}
+		return crt, nil
+	}
+
+	// PKCS#7 format
+	if IsPKCS7(b) {
+		certs, err := ParsePKCS7(b)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing %s", filename)
+		}
+		return certs[0], nil
+	}
+
 	// PEM format
 	if bytes.HasPrefix(b, []byte("-----BEGIN ")) {
 		var crt interface{}
@@ -187,14 +210,34 @@ func ReadCertificate(filename string, opts ...Options) (*x509.Certificate, error
 }
 
 // ReadCertificateBundle returns a list of *x509.Certificate from the given
-// filename. It supports certificates formats PEM and DER. If a DER-formatted
-// file is given only one certificate will be returned.
-func ReadCertificateBundle(filename string) ([]*x509.Certificate, error) {
+// filename. It supports certificates formats PEM, DER, PKCS#7 and PKCS#12. If
+// a DER-formatted file is given only one certificate will be returned. If a
+// PKCS#12 file is given the certificate matching the private key will be the
+// first one in the list.
+func ReadCertificateBundle(filename string, opts ...Options) ([]*x509.Certificate, error) {
 	b, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return nil, errs.FileError(err, filename)
 	}
 
+	// PKCS#12 format
+	if isPKCS12File(filename, b) {
+		_, crt, chain, err := ParsePKCS12(b, append(opts, WithFilename(filename))...)
+		if err != nil {
+			return nil, err
+		}
+		if crt == nil {
+			return nil, errors.Errorf("error decoding PKCS#12: file '%s' does not contain a certificate", filename)
+		}
+		return append([]*x509.Certificate{crt}, chain...), nil
+	}
+
+	// PKCS#7 format
+	if IsPKCS7(b) {
+		bundle, err := ParsePKCS7(b)
+		return bundle, errors.Wrapf(err, "error parsing %s", filename)
+	}
+
 	// PEM format
 	if bytes.HasPrefix(b, []byte("-----BEGIN ")) {
 		var block *pem.Block
@@ -308,6 +351,9 @@ func ParseKey(b []byte, opts ...Options) (interface{}, error) {
 // Supported keys algorithms are RSA and EC. Supported standards for private
 // keys are PKCS#1, PKCS#8, RFC5915 for EC, and base64-encoded DER for
 // certificates and public keys.
+//
+// PKCS#12 files are also supported, in this case the private key will be
+// returned, or the certificate if the file does not contain a key.
 func Read(filename string, opts ...Options) (interface{}, error) {
 	b, err := ioutil.ReadFile(filename)
 	if err != nil {
@@ -316,6 +362,21 @@ func Read(filename string, opts ...Options) (interface{}, error) {
 
 	// force given filename
 	opts = append(opts, WithFilename(filename))
+
+	if isPKCS12File(filename, b) {
+		key, crt, _, err := ParsePKCS12(b, opts...)
+		switch {
+		case err != nil:
+			return nil, err
+		case key != nil:
+			return key, nil
+		case crt != nil:
+			return crt, nil
+		default:
+			return nil, errors.Errorf("error decoding PKCS#12: file '%s' does not contain a key or certificate", filename)
+		}
+	}
+
 	return Parse(b, opts...)
 }
 
@@ -380,6 +441,17 @@ func Serialize(in interface{}, opts ...Options) (*pem.Block, error) {
 				Bytes: b,
 			}
 		}
+	case *RSAPSSPrivateKey:
+		// RSA-PSS keys can only be serialized using PKCS#8
+		ctx.pkcs8 = true
+		b, err := MarshalPKCS8PrivateKey(k)
+		if err != nil {
+			return nil, err
+		}
+		p = &pem.Block{
+			Type:  "PRIVATE KEY",
+			Bytes: b,
+		}
 	case ed25519.PrivateKey:
 		switch {
 		case !ctx.pkcs8 && ctx.openSSH:
@@ -32,6 +32,7 @@ const (
 	ed25519PrivateKey
 	rsaPublicKey
 	rsaPrivateKey
+	rsaPSSPrivateKey
 )
 
 const (
@@ -71,56 +72,62 @@ type testdata struct {
 }
 
 var files = map[string]testdata{
-	"testdata/openssl.p256.pem":              {ecdsaPrivateKey, false},
-	"testdata/openssl.p256.pub.pem":          {ecdsaPublicKey, false},
-	"testdata/openssl.p256.enc.pem":          {ecdsaPrivateKey, true},
-	"testdata/openssl.p384.pem":              {ecdsaPrivateKey, false},
-	"testdata/openssl.p384.pub.pem":          {ecdsaPublicKey, false},
-	"testdata/openssl.p384.enc.pem":          {ecdsaPrivateKey, true},
-	"testdata/openssl.p521.pem":              {ecdsaPrivateKey, false},
-	"testdata/openssl.p521.pub.pem":          {ecdsaPublicKey, false},
-	"testdata/openssl.p521.enc.pem":          {ecdsaPrivateKey, true},
-	"testdata/openssl.rsa1024.pem":           {rsaPrivateKey, false},
-	"testdata/openssl.rsa1024.pub.pem":       {rsaPublicKey, false},
-	"testdata/openssl.rsa1024.enc.pem":       {rsaPrivateKey, true},
-	"testdata/openssl.rsa2048.pem":           {rsaPrivateKey, false},
-	"testdata/openssl.rsa2048.pub.pem":       {rsaPublicKey, false},
-	"testdata/openssl.rsa2048.enc.pem":       {rsaPrivateKey, true},
-	"testdata/openssh.ed25519.enc.pem":       {ed25519PrivateKey, true},
-	"testdata/openssh.ed25519.pem":           {ed25519PrivateKey, false},
-	"testdata/openssh.ed25519.pub.pem":       {ed25519PublicKey, false},
-	"testdata/openssh.p256.enc.pem":          {ecdsaPrivateKey, true},
-	"testdata/openssh.p256.pem":              {ecdsaPrivateKey, false},
-	"testdata/openssh.p256.pub.pem":          {ecdsaPublicKey, false},
-	"testdata/openssh.p384.enc.pem":          {ecdsaPrivateKey, true},
-	"testdata/openssh.p384.pem":              {ecdsaPrivateKey, false},
-	"testdata/openssh.p384.pub.pem":          {ecdsaPublicKey, false},
-	"testdata/openssh.p521.enc.pem":          {ecdsaPrivateKey, true},
-	"testdata/openssh.p521.pem":              {ecdsaPrivateKey, false},
-	"testdata/openssh.p521.pub.pem":          {ecdsaPublicKey, false},
-	"testdata/openssh.rsa1024.enc.pem":       {rsaPrivateKey, true},
-	"testdata/openssh.rsa1024.pem":           {rsaPrivateKey, false},
-	"testdata/openssh.rsa1024.pub.pem":       {rsaPublicKey, false},
-	"testdata/openssh.rsa2048.enc.pem":       {rsaPrivateKey, true},
-	"testdata/openssh.rsa2048.pem":           {rsaPrivateKey, false},
-	"testdata/openssh.rsa2048.pub.pem":       {rsaPublicKey, false},
-	"testdata/pkcs8/openssl.ed25519.pem":     {ed25519PrivateKey, false},
-	"testdata/pkcs8/openssl.ed25519.pub.pem": {ed25519PublicKey, false},
-	"testdata/pkcs8/openssl.ed25519.enc.pem": {ed25519PrivateKey, true},
-	"testdata/pkcs8/openssl.p256.pem":        {ecdsaPrivateKey, false},
-	"testdata/pkcs8/openssl.p256.pub.pem":    {ecdsaPublicKey, false},
-	"testdata/pkcs8/openssl.p256.enc.pem":    {ecdsaPrivateKey, true},
-	"testdata/pkcs8/openssl.p384.pem":        {ecdsaPrivateKey, false},
-	"testdata/pkcs8/openssl.p384.pub.pem":    {ecdsaPublicKey, false},
-	"testdata/pkcs8/openssl.p384.enc.pem":    {ecdsaPrivateKey, true},
-	"testdata/pkcs8/openssl.p521.pem":        {ecdsaPrivateKey, false},
-	"testdata/pkcs8/openssl.p521.pub.pem":    {ecdsaPublicKey, false},
-	"testdata/pkcs8/openssl.p521.enc.pem":    {ecdsaPrivateKey, true},
-	"testdata/pkcs8/openssl.rsa2048.pem":     {rsaPrivateKey, false},
-	"testdata/pkcs8/openssl.rsa2048.pub.pem": {rsaPublicKey, false},
-	"testdata/pkcs8/openssl.rsa2048.enc.pem": {rsaPrivateKey, true},
-	"testdata/pkcs8/openssl.rsa4096.pem":     {rsaPrivateKey, false},
-	"testdata/pkcs8/openssl.rsa4096.pub.pem": {rsaPublicKey, false},
+	"testdata/openssl.p256.pem":                {ecdsaPrivateKey, false},
+	"testdata/openssl.p256.pub.pem":            {ecdsaPublicKey, false},
+	"testdata/openssl.p256.enc.pem":            {ecdsaPrivateKey, true},
+	"testdata/openssl.p384.pem":                {ecdsaPrivateKey, false},
+	"testdata/openssl.p384.pub.pem":            {ecdsaPublicKey, false},
+	"testdata/openssl.p384.enc.pem":            {ecdsaPrivateKey, true},
+	"testdata/openssl.p521.pem":                {ecdsaPrivateKey, false},
+	"testdata/openssl.p521.pub.pem":            {ecdsaPublicKey, false},
+	"testdata/openssl.p521.enc.pem":            {ecdsaPrivateKey, true},
+	"testdata/openssl.rsa1024.pem":             {rsaPrivateKey, false},
+	"testdata/openssl.rsa1024.pub.pem":         {rsaPublicKey, false},
+	"testdata/openssl.rsa1024.enc.pem":         {rsaPrivateKey, true},
+	"testdata/openssl.rsa2048.pem":             {rsaPrivateKey, false},
+	"testdata/openssl.rsa2048.pub.pem":         {rsaPublicKey, false},
+	"testdata/openssl.rsa2048.enc.pem":         {rsaPrivateKey, true},
+	"testdata/openssh.ed25519.enc.pem":         {ed25519PrivateKey, true},
+	"testdata/openssh.ed25519.pem":             {ed25519PrivateKey, false},
+	"testdata/openssh.ed25519.pub.pem":         {ed25519PublicKey, false},
+	"testdata/openssh.p256.enc.pem":            {ecdsaPrivateKey, true},
+	"testdata/openssh.p256.pem":                {ecdsaPrivateKey, false},
+	"testdata/openssh.p256.pub.pem":            {ecdsaPublicKey, false},
+	"testdata/openssh.p384.enc.pem":            {ecdsaPrivateKey, true},
+	"testdata/openssh.p384.pem":                {ecdsaPrivateKey, false},
+	"testdata/openssh.p384.pub.pem":            {ecdsaPublicKey, false},
+	"testdata/openssh.p521.enc.pem":            {ecdsaPrivateKey, true},
+	"testdata/openssh.p521.pem":                {ecdsaPrivateKey, false},
+	"testdata/openssh.p521.pub.pem":            {ecdsaPublicKey, false},
+	"testdata/openssh.rsa1024.enc.pem":         {rsaPrivateKey, true},
+	"testdata/openssh.rsa1024.pem":             {rsaPrivateKey, false},
+	"testdata/openssh.rsa1024.pub.pem":         {rsaPublicKey, false},
+	"testdata/openssh.rsa2048.enc.pem":         {rsaPrivateKey, true},
+	"testdata/openssh.rsa2048.pem":             {rsaPrivateKey, false},
+	"testdata/openssh.rsa2048.pub.pem":         {rsaPublicKey, false},
+	"testdata/pkcs8/openssl.ed25519.pem":       {ed25519PrivateKey, false},
+	"testdata/pkcs8/openssl.ed25519.pub.pem":   {ed25519PublicKey, false},
+	"testdata/pkcs8/openssl.ed25519.enc.pem":   {ed25519PrivateKey, true},
+	"testdata/pkcs8/openssl.p256.pem":          {ecdsaPrivateKey, false},
+	"testdata/pkcs8/openssl.p256.pub.pem":      {ecdsaPublicKey, false},
+	"testdata/pkcs8/openssl.p256.enc.pem":      {ecdsaPrivateKey, true},
+	"testdata/pkcs8/openssl.p384.pem":          {ecdsaPrivateKey, false},
+	"testdata/pkcs8/openssl.p384.pub.pem":      {ecdsaPublicKey, false},
+	"testdata/pkcs8/openssl.p384.enc.pem":      {ecdsaPrivateKey, true},
+	"testdata/pkcs8/openssl.p521.pem":          {ecdsaPrivateKey, false},
+	"testdata/pkcs8/openssl.p521.pub.pem":      {ecdsaPublicKey, false},
+	"testdata/pkcs8/openssl.p521.enc.pem":      {ecdsaPrivateKey, true},
+	"testdata/pkcs8/openssl.rsa2048.pem":       {rsaPrivateKey, false},
+	"testdata/pkcs8/openssl.rsa2048.pub.pem":   {rsaPublicKey, false},
+	"testdata/pkcs8/openssl.rsa2048.enc.pem":   {rsaPrivateKey, true},
+	"testdata/pkcs8/openssl.rsa4096.pem":       {rsaPrivateKey, false},
+	"testdata/pkcs8/openssl.rsa4096.pub.pem":   {rsaPublicKey, false},
+	"testdata/pkcs8/openssl.rsapss.pem":        {rsaPSSPrivateKey, false},
+	"testdata/pkcs8/openssl.rsapss.pub.pem":    {rsaPublicKey, false},
+	"testdata/pkcs8/openssl.rsapss.enc.pem":    {rsaPSSPrivateKey, true},
+	"testdata/pkcs8/openssl.rsapss384.pem":     {rsaPSSPrivateKey, false},
+	"testdata/pkcs8/openssl.rsapss384.pub.pem": {rsaPublicKey, false},
+	"testdata/pkcs8/openssl.rsapss384.enc.pem": {rsaPSSPrivateKey, true},
 }
 
 func readOrParseSSH(fn string) (interface{}, error) {
@@ -162,6 +169,8 @@ func TestRead(t *testing.T) {
 				assert.Type(t, &rsa.PublicKey{}, key)
 			case rsaPrivateKey:
 				assert.Type(t, &rsa.PrivateKey{}, key)
+			case rsaPSSPrivateKey:
+				assert.Type(t, &RSAPSSPrivateKey{}, key)
 			default:
 				t.Errorf("type %T not supported", key)
 			}
@@ -175,7 +184,7 @@ func TestRead(t *testing.T) {
 
 			// Check against public
 			switch td.typ {
-			case ecdsaPrivateKey, ed25519PrivateKey, rsaPrivateKey:
+			case ecdsaPrivateKey, ed25519PrivateKey, rsaPrivateKey, rsaPSSPrivateKey:
 				pub := strings.Replace(fn, ".enc", "", 1)
 				pub = strings.Replace(pub, "pem", "pub.pem", 1)
 
@@ -186,9 +195,19 @@ func TestRead(t *testing.T) {
 					assert.Equals(t, k, pk.Public())
 
 					var signature, digest []byte
+					var pssOpts *rsa.PSSOptions
 					message := []byte("message")
 					if _, ok := pk.(ed25519.PrivateKey); ok {
 						signature, err = pk.Sign(rand.Reader, message, crypto.Hash(0))
+					} else if k, ok := pk.(*RSAPSSPrivateKey); ok {
+						pssOpts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: k.Hash}
+						if k.Hash == 0 {
+							pssOpts.Hash = crypto.SHA256
+						}
+						h := pssOpts.Hash.New()
+						h.Write(message)
+						digest = h.Sum(nil)
+						signature, err = pk.Sign(rand.Reader, digest, pssOpts)
 					} else {
 						sum := sha256.Sum256(message)
 						digest = sum[:]
@@ -208,8 +227,13 @@ func TestRead(t *testing.T) {
 						verified := ed25519.Verify(k, []byte("message"), signature)
 						assert.True(t, verified)
 					case *rsa.PublicKey:
-						err := rsa.VerifyPKCS1v15(k, crypto.SHA256, digest, signature)
-						assert.NoError(t, err)
+						if pssOpts != nil {
+							err := rsa.VerifyPSS(k, pssOpts.Hash, digest, signature, pssOpts)
+							assert.NoError(t, err)
+						} else {
+							err := rsa.VerifyPKCS1v15(k, crypto.SHA256, digest, signature)
+							assert.NoError(t, err)
+						}
 					}
 
 				} else {
@@ -680,6 +704,8 @@ func TestParseKey(t *testing.T) {
 				assert.Type(t, &rsa.PublicKey{}, key)
 			case rsaPrivateKey:
 				assert.Type(t, &rsa.PrivateKey{}, key)
+			case rsaPSSPrivateKey:
+				assert.Type(t, &RSAPSSPrivateKey{}, key)
 			default:
 				t.Errorf("type %T not supported", key)
 			}
@@ -739,7 +765,8 @@ func TestParseSSH(t *testing.T) {
 
 func TestOpenSSH(t *testing.T) {
 	for fn, td := range files {
-		if strings.HasSuffix(fn, ".pub.pem") {
+		// OpenSSH does not support RSA-PSS keys
+		if strings.HasSuffix(fn, ".pub.pem") || td.typ == rsaPSSPrivateKey {
 			continue
 		}
 		t.Run(fn, func(t *testing.T) {
@@ -0,0 +1,905 @@
+package pemutil
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	_ "crypto/sha512" // register SHA-384 and SHA-512
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/keys"
+	"github.com/smallstep/cli/ui"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/pkcs12"
+)
+
+// PKCS12Iterations is the default number of iterations used in the key
+// derivation functions of PKCS#12 files.
+const PKCS12Iterations = 2048
+
+// PKCS#12 object identifiers as defined in RFC 7292 and RFC 2315.
+var (
+	oidDataContentType          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEncryptedDataContentType = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+
+	oidKeyBag              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 1}
+	oidPKCS8ShroudedKeyBag = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidCertBag             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidCertTypeX509        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+
+	oidFriendlyName = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 20}
+	oidLocalKeyID   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 21}
+
+	oidPBEWithSHAAnd3KeyTripleDESCBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}
+
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+)
+
+var pkcs12MACHashes = []struct {
+	hash crypto.Hash
+	oid  asn1.ObjectIdentifier
+}{
+	{crypto.SHA1, oidSHA1},
+	{crypto.SHA256, oidSHA256},
+	{crypto.SHA384, oidSHA384},
+	{crypto.SHA512, oidSHA512},
+}
+
+// ErrPKCS12IncorrectPassword is returned when the password of a PKCS#12 file
+// is not correct.
+var ErrPKCS12IncorrectPassword = errors.New("pkcs12: decryption password incorrect")
+
+// errPKCS12Unsupported is returned when a PKCS#12 file uses an algorithm that
+// is only supported by the legacy decoder.
+var errPKCS12Unsupported = errors.New("pkcs12: unsupported algorithm")
+
+// PKCS12Options are the algorithms and attributes used to encode a PKCS#12
+// file.
+type PKCS12Options struct {
+	// Cipher is the algorithm used to encrypt the certificates and the
+	// private key. AES ciphers will use PBES2 with PBKDF2 and HMAC-SHA256,
+	// x509.PEMCipher3DES will use the legacy pbeWithSHAAnd3-KeyTripleDES-CBC.
+	Cipher x509.PEMCipher
+	// MAC is the hash function used in the HMAC integrity check.
+	MAC crypto.Hash
+	// Iterations is the number of iterations used in the key derivation
+	// functions, it defaults to PKCS12Iterations.
+	Iterations int
+	// FriendlyName is an optional name added to the certificate and the key.
+	FriendlyName string
+}
+
+// DefaultPKCS12Options returns the options used by default to encode PKCS#12
+// files, AES-256-CBC with PBKDF2 and an HMAC-SHA256 integrity check.
+func DefaultPKCS12Options() *PKCS12Options {
+	return &PKCS12Options{
+		Cipher:     x509.PEMCipherAES256,
+		MAC:        crypto.SHA256,
+		Iterations: PKCS12Iterations,
+	}
+}
+
+// LegacyPKCS12Options returns the options used to encode PKCS#12 files for
+// legacy software, 3DES with an HMAC-SHA1 integrity check.
+func LegacyPKCS12Options() *PKCS12Options {
+	return &PKCS12Options{
+		Cipher:     x509.PEMCipher3DES,
+		MAC:        crypto.SHA1,
+		Iterations: PKCS12Iterations,
+	}
+}
+
+type pfxPdu struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  macData `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0,explicit,optional"`
+}
+
+type encryptedData struct {
+	Version              int
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           []byte `asn1:"tag:0,optional"`
+}
+
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue     `asn1:"tag:0,explicit"`
+	Attributes []pkcs12Attribute `asn1:"set,optional"`
+}
+
+type pkcs12Attribute struct {
+	ID    asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"set"`
+}
+
+type certBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+type pkcs12EncryptedPrivateKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Data      []byte
+}
+
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int `asn1:"optional,default:1"`
+}
+
+type digestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type pbeParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+// IsPKCS12 returns true if the given bytes look like a DER encoded PKCS#12
+// file.
+func IsPKCS12(b []byte) bool {
+	var pfx pfxPdu
+	rest, err := asn1.Unmarshal(b, &pfx)
+	return err == nil && len(rest) == 0 && pfx.Version == 3 && len(pfx.AuthSafe.ContentType) > 0
+}
+
+// isPKCS12File returns true if the file has the .p12 or .pfx extensions or
+// if the content is a PKCS#12 file.
+func isPKCS12File(filename string, b []byte) bool {
+	if bytes.HasPrefix(b, []byte("-----BEGIN ")) {
+		return false
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".p12", ".pfx":
+		return true
+	default:
+		return IsPKCS12(b)
+	}
+}
+
+// ParsePKCS12 parses a PKCS#12 file and returns the private key, the
+// certificate and the rest of the certificates in the file. The password can
+// be set using the WithPassword or WithPasswordFile options, if none is given
+// an empty password is tried first and then the user is prompted for one. A
+// warning is printed if the file does not have a MAC, as its integrity cannot
+// be verified.
+func ParsePKCS12(b []byte, opts ...Options) (interface{}, *x509.Certificate, []*x509.Certificate, error) {
+	ctx := newContext("PKCS#12")
+	if err := ctx.apply(opts); err != nil {
+		return nil, nil, nil, err
+	}
+	if IsPKCS12(b) && !hasPKCS12MAC(b) {
+		ui.Printf("Warning: %s does not have a MAC, its integrity cannot be verified\n", ctx.filename)
+	}
+
+	password := ctx.password
+	if len(password) == 0 {
+		key, crt, chain, err := DecodePKCS12(b, nil)
+		if err != ErrPKCS12IncorrectPassword {
+			return key, crt, chain, errors.Wrapf(err, "error parsing %s", ctx.filename)
+		}
+		if password, err = ui.PromptPassword(fmt.Sprintf("Please enter the password to decrypt %s", ctx.filename)); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	key, crt, chain, err := DecodePKCS12(b, password)
+	if err != nil {
+		return nil, nil, nil, errors.Wrapf(err, "error parsing %s", ctx.filename)
+	}
+	return key, crt, chain, nil
+}
+
+// DecodePKCS12 decodes a PKCS#12 file using the given password and returns
+// the private key, the certificate and the rest of the certificates in the
+// file. The certificate is the one matching the private key, or the first one
+// in the file if there is no key. The private key will be nil if the file does
+// not contain one.
+//
+// PKCS#12 files encrypted with PBES2 (PBKDF2 and AES or 3DES) and with the
+// legacy PKCS#12 algorithms are supported. Files without a MAC are accepted,
+// but their integrity is not verified.
+func DecodePKCS12(b, password []byte) (interface{}, *x509.Certificate, []*x509.Certificate, error) {
+	bags, err := decodePKCS12Bags(b, password)
+	if err == errPKCS12Unsupported {
+		return decodeLegacyPKCS12(b, password)
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var (
+		key    interface{}
+		keyID  []byte
+		crts   []*x509.Certificate
+		crtIDs [][]byte
+	)
+	for _, bag := range bags {
+		switch {
+		case bag.ID.Equal(oidKeyBag), bag.ID.Equal(oidPKCS8ShroudedKeyBag):
+			if key != nil {
+				return nil, nil, nil, errors.New("pkcs12: file contains more than one private key")
+			}
+			der := bag.Value.Bytes
+			if bag.ID.Equal(oidPKCS8ShroudedKeyBag) {
+				var info pkcs12EncryptedPrivateKeyInfo
+				if err := unmarshalDER(bag.Value.Bytes, &info); err != nil {
+					return nil, nil, nil, errors.Wrap(err, "pkcs12: error parsing private key")
+				}
+				if der, err = pkcs12Decrypt(info.Algorithm, info.Data, password); err != nil {
+					return nil, nil, nil, err
+				}
+			}
+			if key, err = ParsePKCS8PrivateKey(der); err != nil {
+				return nil, nil, nil, errors.Wrap(err, "pkcs12: error parsing private key")
+			}
+			keyID = localKeyID(bag.Attributes)
+		case bag.ID.Equal(oidCertBag):
+			var cb certBag
+			if err := unmarshalDER(bag.Value.Bytes, &cb); err != nil {
+				return nil, nil, nil, errors.Wrap(err, "pkcs12: error parsing certificate")
+			}
+			if !cb.ID.Equal(oidCertTypeX509) {
+				continue
+			}
+			crt, err := x509.ParseCertificate(cb.Data)
+			if err != nil {
+				return nil, nil, nil, errors.Wrap(err, "pkcs12: error parsing certificate")
+			}
+			crts = append(crts, crt)
+			crtIDs = append(crtIDs, localKeyID(bag.Attributes))
+		}
+	}
+
+	crt, chain := selectPKCS12Certificate(key, keyID, crts, crtIDs)
+	return key, crt, chain, nil
+}
+
+// selectPKCS12Certificate returns the certificate of the given key and the
+// rest of certificates. The certificate is selected by the local key id
+// attribute, by the public key, or the first one is used.
+func selectPKCS12Certificate(key interface{}, keyID []byte, crts []*x509.Certificate, crtIDs [][]byte) (*x509.Certificate, []*x509.Certificate) {
+	if len(crts) == 0 {
+		return nil, nil
+	}
+	index := 0
+	if key != nil {
+		found := false
+		if len(keyID) > 0 {
+			for i, id := range crtIDs {
+				if bytes.Equal(id, keyID) {
+					index, found = i, true
+					break
+				}
+			}
+		}
+		if !found {
+			for i, crt := range crts {
+				if keys.VerifyPair(crt.PublicKey, key) == nil {
+					index = i
+					break
+				}
+			}
+		}
+	}
+
+	var chain []*x509.Certificate
+	for i, crt := range crts {
+		if i != index {
+			chain = append(chain, crt)
+		}
+	}
+	return crts[index], chain
+}
+
+// hasPKCS12MAC returns true if the PKCS#12 file has a MAC to verify its
+// integrity.
+func hasPKCS12MAC(b []byte) bool {
+	var pfx pfxPdu
+	if err := unmarshalDER(b, &pfx); err != nil {
+		return false
+	}
+	return len(pfx.MacData.Mac.Algorithm.Algorithm) > 0
+}
+
+// decodePKCS12Bags verifies the integrity of a PKCS#12 file and returns all
+// the safe bags in it.
+func decodePKCS12Bags(b, password []byte) ([]safeBag, error) {
+	var pfx pfxPdu
+	if err := unmarshalDER(b, &pfx); err != nil {
+		return nil, errors.Wrap(err, "pkcs12: error parsing file")
+	}
+	if pfx.Version != 3 {
+		return nil, errors.Errorf("pkcs12: unsupported version %d", pfx.Version)
+	}
+	if !pfx.AuthSafe.ContentType.Equal(oidDataContentType) {
+		return nil, errors.New("pkcs12: only password-protected files are supported")
+	}
+
+	var authSafeData []byte
+	if err := unmarshalDER(pfx.AuthSafe.Content.Bytes, &authSafeData); err != nil {
+		return nil, errors.Wrap(err, "pkcs12: error parsing file")
+	}
+	if len(pfx.MacData.Mac.Algorithm.Algorithm) > 0 {
+		if err := verifyPKCS12MAC(&pfx.MacData, authSafeData, password); err != nil {
+			return nil, err
+		}
+	}
+
+	var authSafe []contentInfo
+	if err := unmarshalDER(authSafeData, &authSafe); err != nil {
+		return nil, errors.Wrap(err, "pkcs12: error parsing file")
+	}
+
+	var bags []safeBag
+	for _, ci := range authSafe {
+		var data []byte
+		switch {
+		case ci.ContentType.Equal(oidDataContentType):
+			if err := unmarshalDER(ci.Content.Bytes, &data); err != nil {
+				return nil, errors.Wrap(err, "pkcs12: error parsing file")
+			}
+		case ci.ContentType.Equal(oidEncryptedDataContentType):
+			var ed encryptedData
+			if err := unmarshalDER(ci.Content.Bytes, &ed); err != nil {
+				return nil, errors.Wrap(err, "pkcs12: error parsing file")
+			}
+			var err error
+			info := ed.EncryptedContentInfo
+			if data, err = pkcs12Decrypt(info.ContentEncryptionAlgorithm, info.EncryptedContent, password); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, errors.Errorf("pkcs12: unsupported content type %s", ci.ContentType)
+		}
+
+		var safeContents []safeBag
+		if err := unmarshalDER(data, &safeContents); err != nil {
+			return nil, errors.Wrap(err, "pkcs12: error parsing file")
+		}
+		bags = append(bags, safeContents...)
+	}
+	return bags, nil
+}
+
+// decodeLegacyPKCS12 decodes a PKCS#12 file using golang.org/x/crypto/pkcs12,
+// used for files encrypted with RC2.
+func decodeLegacyPKCS12(b, password []byte) (interface{}, *x509.Certificate, []*x509.Certificate, error) {
+	blocks, err := pkcs12.ToPEM(b, string(password))
+	if err != nil {
+		if err == pkcs12.ErrIncorrectPassword {
+			return nil, nil, nil, ErrPKCS12IncorrectPassword
+		}
+		return nil, nil, nil, errors.Wrap(err, "pkcs12: error parsing file")
+	}
+
+	var (
+		key    interface{}
+		keyID  []byte
+		crts   []*x509.Certificate
+		crtIDs [][]byte
+	)
+	for _, block := range blocks {
+		id, _ := hex.DecodeString(block.Headers["localKeyId"])
+		switch block.Type {
+		case "CERTIFICATE":
+			crt, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, nil, nil, errors.Wrap(err, "pkcs12: error parsing certificate")
+			}
+			crts = append(crts, crt)
+			crtIDs = append(crtIDs, id)
+		case "PRIVATE KEY":
+			if key != nil {
+				return nil, nil, nil, errors.New("pkcs12: file contains more than one private key")
+			}
+			if key, err = ParseDER(block.Bytes); err != nil {
+				return nil, nil, nil, errors.Wrap(err, "pkcs12: error parsing private key")
+			}
+			keyID = id
+		}
+	}
+
+	crt, chain := selectPKCS12Certificate(key, keyID, crts, crtIDs)
+	return key, crt, chain, nil
+}
+
+// EncodePKCS12 encodes the given private key, certificate and chain in a
+// PKCS#12 file encrypted with the given password. The key and the chain are
+// optional. If opts is nil DefaultPKCS12Options are used.
+func EncodePKCS12(key interface{}, crt *x509.Certificate, chain []*x509.Certificate, password []byte, opts *PKCS12Options) ([]byte, error) {
+	if opts == nil {
+		opts = DefaultPKCS12Options()
+	}
+	if opts.Iterations <= 0 {
+		opts.Iterations = PKCS12Iterations
+	}
+	if crt == nil {
+		return nil, errors.New("pkcs12: certificate cannot be nil")
+	}
+	macOID, err := pkcs12MACOID(opts.MAC)
+	if err != nil {
+		return nil, err
+	}
+
+	// The local key id links the key with its certificate.
+	sum := sha1.Sum(crt.Raw)
+	attrs, err := pkcs12Attributes(sum[:], opts.FriendlyName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Certificates are encrypted in an encryptedData content.
+	var certBags []safeBag
+	for i, c := range append([]*x509.Certificate{crt}, chain...) {
+		b, err := asn1.Marshal(certBag{ID: oidCertTypeX509, Data: c.Raw})
+		if err != nil {
+			return nil, errors.Wrap(err, "pkcs12: error marshaling certificate")
+		}
+		bag := safeBag{ID: oidCertBag, Value: explicitRawValue(b)}
+		if i == 0 {
+			bag.Attributes = attrs
+		}
+		certBags = append(certBags, bag)
+	}
+	certsData, err := asn1.Marshal(certBags)
+	if err != nil {
+		return nil, errors.Wrap(err, "pkcs12: error marshaling certificates")
+	}
+	algo, encrypted, err := pkcs12Encrypt(certsData, password, opts)
+	if err != nil {
+		return nil, err
+	}
+	b, err := asn1.Marshal(encryptedData{
+		EncryptedContentInfo: encryptedContentInfo{
+			ContentType:                oidDataContentType,
+			ContentEncryptionAlgorithm: algo,
+			EncryptedContent:           encrypted,
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "pkcs12: error marshaling certificates")
+	}
+	authSafe := []contentInfo{{
+		ContentType: oidEncryptedDataContentType,
+		Content:     explicitRawValue(b),
+	}}
+
+	// The private key is in a shrouded key bag.
+	if key != nil {
+		der, err := MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		algo, encrypted, err := pkcs12Encrypt(der, password, opts)
+		if err != nil {
+			return nil, err
+		}
+		b, err := asn1.Marshal(pkcs12EncryptedPrivateKeyInfo{Algorithm: algo, Data: encrypted})
+		if err != nil {
+			return nil, errors.Wrap(err, "pkcs12: error marshaling private key")
+		}
+		keyData, err := asn1.Marshal([]safeBag{{
+			ID:         oidPKCS8ShroudedKeyBag,
+			Value:      explicitRawValue(b),
+			Attributes: attrs,
+		}})
+		if err != nil {
+			return nil, errors.Wrap(err, "pkcs12: error marshaling private key")
+		}
+		if b, err = asn1.Marshal(keyData); err != nil {
+			return nil, errors.Wrap(err, "pkcs12: error marshaling private key")
+		}
+		authSafe = append(authSafe, contentInfo{
+			ContentType: oidDataContentType,
+			Content:     explicitRawValue(b),
+		})
+	}
+
+	authSafeData, err := asn1.Marshal(authSafe)
+	if err != nil {
+		return nil, errors.Wrap(err, "pkcs12: error marshaling file")
+	}
+
+	salt, err := randomBytes(PBKDF2SaltSize)
+	if err != nil {
+		return nil, err
+	}
+	pfx := pfxPdu{
+		Version: 3,
+		MacData: macData{
+			Mac: digestInfo{
+				Algorithm: pkix.AlgorithmIdentifier{
+					Algorithm:  macOID,
+					Parameters: asn1.NullRawValue,
+				},
+				Digest: pkcs12MAC(opts.MAC, authSafeData, salt, opts.Iterations, password),
+			},
+			MacSalt:    salt,
+			Iterations: opts.Iterations,
+		},
+	}
+	if b, err = asn1.Marshal(authSafeData); err != nil {
+		return nil, errors.Wrap(err, "pkcs12: error marshaling file")
+	}
+	pfx.AuthSafe = contentInfo{
+		ContentType: oidDataContentType,
+		Content:     explicitRawValue(b),
+	}
+
+	b, err = asn1.Marshal(pfx)
+	return b, errors.Wrap(err, "pkcs12: error marshaling file")
+}
+
+// pkcs12Encrypt encrypts the data with the cipher in the options and returns
+// the algorithm identifier and the encrypted data.
+func pkcs12Encrypt(data, password []byte, opts *PKCS12Options) (pkix.AlgorithmIdentifier, []byte, error) {
+	var (
+		block cipher.Block
+		iv    []byte
+		algo  pkix.AlgorithmIdentifier
+	)
+
+	salt, err := randomBytes(PBKDF2SaltSize)
+	if err != nil {
+		return algo, nil, err
+	}
+
+	switch opts.Cipher {
+	case x509.PEMCipher3DES:
+		params, err := asn1.Marshal(pbeParams{Salt: salt, Iterations: opts.Iterations})
+		if err != nil {
+			return algo, nil, errors.Wrap(err, "pkcs12: error marshaling parameters")
+		}
+		algo = pkix.AlgorithmIdentifier{
+			Algorithm:  oidPBEWithSHAAnd3KeyTripleDESCBC,
+			Parameters: asn1.RawValue{FullBytes: params},
+		}
+		bmpPassword, err := bmpString(password)
+		if err != nil {
+			return algo, nil, err
+		}
+		key := pkcs12KDF(crypto.SHA1, bmpPassword, salt, opts.Iterations, 1, 24)
+		iv = pkcs12KDF(crypto.SHA1, bmpPassword, salt, opts.Iterations, 2, des.BlockSize)
+		if block, err = des.NewTripleDESCipher(key); err != nil {
+			return algo, nil, errors.Wrap(err, "pkcs12: error creating cipher")
+		}
+	case x509.PEMCipherAES128, x509.PEMCipherAES192, x509.PEMCipherAES256:
+		ciph := cipherByKey(opts.Cipher)
+		if iv, err = randomBytes(ciph.blockSize); err != nil {
+			return algo, nil, err
+		}
+		params, err := asn1.Marshal(pbes2Params{
+			KeyDerivationFunc: pbkdf2Algorithms{
+				Algo: oidPKCS5PBKDF2,
+				PBKDF2Params: pbkdf2Params{
+					Salt:           salt,
+					IterationCount: opts.Iterations,
+					PrfParam: prfParam{
+						Algo:      oidHMACWithSHA256,
+						NullParam: asn1.NullRawValue,
+					},
+				},
+			},
+			EncryptionScheme: pbkdf2Encs{
+				EncryAlgo: ciph.identifier,
+				IV:        iv,
+			},
+		})
+		if err != nil {
+			return algo, nil, errors.Wrap(err, "pkcs12: error marshaling parameters")
+		}
+		algo = pkix.AlgorithmIdentifier{
+			Algorithm:  oidPBES2,
+			Parameters: asn1.RawValue{FullBytes: params},
+		}
+		key := pbkdf2.Key(password, salt, opts.Iterations, ciph.keySize, sha256.New)
+		if block, err = ciph.cipherFunc(key); err != nil {
+			return algo, nil, errors.Wrap(err, "pkcs12: error creating cipher")
+		}
+	default:
+		return algo, nil, errors.Errorf("pkcs12: unsupported cipher %v", opts.Cipher)
+	}
+
+	bs := block.BlockSize()
+	pad := bs - len(data)%bs
+	encrypted := make([]byte, len(data), len(data)+pad)
+	copy(encrypted, data)
+	encrypted = append(encrypted, bytes.Repeat([]byte{byte(pad)}, pad)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+	return algo, encrypted, nil
+}
+
+// pkcs12Decrypt decrypts the data encrypted with the given algorithm.
+func pkcs12Decrypt(algo pkix.AlgorithmIdentifier, data, password []byte) ([]byte, error) {
+	var (
+		block cipher.Block
+		iv    []byte
+		err   error
+	)
+
+	switch {
+	case algo.Algorithm.Equal(oidPBEWithSHAAnd3KeyTripleDESCBC):
+		var params pbeParams
+		if err := unmarshalDER(algo.Parameters.FullBytes, &params); err != nil {
+			return nil, errors.Wrap(err, "pkcs12: error parsing parameters")
+		}
+		bmpPassword, err := bmpString(password)
+		if err != nil {
+			return nil, err
+		}
+		key := pkcs12KDF(crypto.SHA1, bmpPassword, params.Salt, params.Iterations, 1, 24)
+		iv = pkcs12KDF(crypto.SHA1, bmpPassword, params.Salt, params.Iterations, 2, des.BlockSize)
+		if block, err = des.NewTripleDESCipher(key); err != nil {
+			return nil, errors.Wrap(err, "pkcs12: error creating cipher")
+		}
+	case algo.Algorithm.Equal(oidPBES2):
+		var params pbes2Params
+		if err := unmarshalDER(algo.Parameters.FullBytes, &params); err != nil {
+			return nil, errors.Wrap(err, "pkcs12: error parsing parameters")
+		}
+		if !params.KeyDerivationFunc.Algo.Equal(oidPKCS5PBKDF2) {
+			return nil, errors.Errorf("pkcs12: unsupported key derivation function %s", params.KeyDerivationFunc.Algo)
+		}
+		kdf := params.KeyDerivationFunc.PBKDF2Params
+		var prf func() hash.Hash
+		switch {
+		case len(kdf.PrfParam.Algo) == 0:
+			prf = sha1.New
+		case kdf.PrfParam.Algo.Equal(oidHMACWithSHA256):
+			prf = sha256.New
+		default:
+			return nil, errors.Errorf("pkcs12: unsupported pseudorandom function %s", kdf.PrfParam.Algo)
+		}
+		var ciph *rfc1423Algo
+		for i := range rfc1423Algos {
+			if rfc1423Algos[i].identifier.Equal(params.EncryptionScheme.EncryAlgo) {
+				ciph = &rfc1423Algos[i]
+			}
+		}
+		if ciph == nil {
+			return nil, errors.Errorf("pkcs12: unsupported cipher %s", params.EncryptionScheme.EncryAlgo)
+		}
+		iv = params.EncryptionScheme.IV
+		key := pbkdf2.Key(password, kdf.Salt, kdf.IterationCount, ciph.keySize, prf)
+		if block, err = ciph.cipherFunc(key); err != nil {
+			return nil, errors.Wrap(err, "pkcs12: error creating cipher")
+		}
+	default:
+		return nil, errPKCS12Unsupported
+	}
+
+	bs := block.BlockSize()
+	if len(data) == 0 || len(data)%bs != 0 || len(iv) != bs {
+		return nil, errors.New("pkcs12: invalid encrypted data")
+	}
+	decrypted := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, data)
+
+	pad := int(decrypted[len(decrypted)-1])
+	if pad == 0 || pad > bs || pad > len(decrypted) {
+		return nil, ErrPKCS12IncorrectPassword
+	}
+	for _, b := range decrypted[len(decrypted)-pad:] {
+		if int(b) != pad {
+			return nil, ErrPKCS12IncorrectPassword
+		}
+	}
+	return decrypted[:len(decrypted)-pad], nil
+}
+
+// verifyPKCS12MAC verifies the HMAC of the given data.
+func verifyPKCS12MAC(md *macData, data, password []byte) error {
+	var h crypto.Hash
+	for _, m := range pkcs12MACHashes {
+		if m.oid.Equal(md.Mac.Algorithm.Algorithm) {
+			h = m.hash
+		}
+	}
+	if h == 0 {
+		return errors.Errorf("pkcs12: unsupported MAC algorithm %s", md.Mac.Algorithm.Algorithm)
+	}
+	if hmac.Equal(md.Mac.Digest, pkcs12MAC(h, data, md.MacSalt, md.Iterations, password)) {
+		return nil
+	}
+	// Some implementations use an empty string instead of two zero bytes for
+	// empty passwords.
+	if len(password) == 0 {
+		key := pkcs12KDF(h, nil, md.MacSalt, md.Iterations, 3, h.Size())
+		mac := hmac.New(h.New, key)
+		mac.Write(data)
+		if hmac.Equal(md.Mac.Digest, mac.Sum(nil)) {
+			return nil
+		}
+	}
+	return ErrPKCS12IncorrectPassword
+}
+
+// pkcs12MAC returns the HMAC of the given data using a key derived from the
+// password.
+func pkcs12MAC(h crypto.Hash, data, salt []byte, iterations int, password []byte) []byte {
+	bmpPassword, err := bmpString(password)
+	if err != nil {
+		return nil
+	}
+	key := pkcs12KDF(h, bmpPassword, salt, iterations, 3, h.Size())
+	mac := hmac.New(h.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func pkcs12MACOID(h crypto.Hash) (asn1.ObjectIdentifier, error) {
+	for _, m := range pkcs12MACHashes {
+		if m.hash == h {
+			return m.oid, nil
+		}
+	}
+	return nil, errors.Errorf("pkcs12: unsupported MAC hash %v", h)
+}
+
+// pkcs12KDF implements the key derivation function defined in RFC 7292,
+// appendix B.2. The password must be a BMPString with two zero bytes at the
+// end.
+func pkcs12KDF(h crypto.Hash, password, salt []byte, iterations int, id byte, size int) []byte {
+	v := h.New().BlockSize()
+
+	d := bytes.Repeat([]byte{id}, v)
+	i := append(fillBlocks(salt, v), fillBlocks(password, v)...)
+	one := big.NewInt(1)
+
+	var a []byte
+	for len(a) < size {
+		hh := h.New()
+		hh.Write(d)
+		hh.Write(i)
+		ai := hh.Sum(nil)
+		for j := 1; j < iterations; j++ {
+			hh.Reset()
+			hh.Write(ai)
+			ai = hh.Sum(ai[:0])
+		}
+		a = append(a, ai...)
+		if len(a) >= size {
+			break
+		}
+
+		// I_j = (I_j + B + 1) mod 2^v for each v-byte block of I
+		bb := new(big.Int).SetBytes(fillBlocks(ai, v)[:v])
+		bb.Add(bb, one)
+		for j := 0; j < len(i); j += v {
+			ij := new(big.Int).SetBytes(i[j : j+v])
+			ij.Add(ij, bb)
+			sum := ij.Bytes()
+			if len(sum) > v {
+				sum = sum[len(sum)-v:]
+			}
+			block := i[j : j+v]
+			for k := range block {
+				block[k] = 0
+			}
+			copy(block[v-len(sum):], sum)
+		}
+	}
+	return a[:size]
+}
+
+// fillBlocks concatenates copies of b to create a string of length v*ceil(len(b)/v).
+func fillBlocks(b []byte, v int) []byte {
+	if len(b) == 0 {
+		return nil
+	}
+	out := make([]byte, v*((len(b)+v-1)/v))
+	for i := range out {
+		out[i] = b[i%len(b)]
+	}
+	return out
+}
+
+// bmpString returns the password encoded as a null-terminated BMPString
+// (UTF-16 big endian).
+func bmpString(password []byte) ([]byte, error) {
+	s := string(password)
+	ret := make([]byte, 0, 2*len(s)+2)
+	for _, r := range s {
+		if t, _ := utf16.EncodeRune(r); t != 0xfffd {
+			return nil, errors.New("pkcs12: password contains characters outside the basic multilingual plane")
+		}
+		ret = append(ret, byte(r/256), byte(r%256))
+	}
+	return append(ret, 0, 0), nil
+}
+
+// pkcs12Attributes returns the local key id and friendly name attributes.
+func pkcs12Attributes(keyID []byte, friendlyName string) ([]pkcs12Attribute, error) {
+	b, err := asn1.Marshal(keyID)
+	if err != nil {
+		return nil, errors.Wrap(err, "pkcs12: error marshaling attributes")
+	}
+	attrs := []pkcs12Attribute{{
+		ID:    oidLocalKeyID,
+		Value: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: b},
+	}}
+	if friendlyName != "" {
+		bmpName, err := bmpString([]byte(friendlyName))
+		if err != nil {
+			return nil, err
+		}
+		b, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagBMPString, Bytes: bmpName[:len(bmpName)-2]})
+		if err != nil {
+			return nil, errors.Wrap(err, "pkcs12: error marshaling attributes")
+		}
+		attrs = append(attrs, pkcs12Attribute{
+			ID:    oidFriendlyName,
+			Value: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: b},
+		})
+	}
+	return attrs, nil
+}
+
+// localKeyID returns the value of the local key id attribute.
+func localKeyID(attrs []pkcs12Attribute) []byte {
+	for _, attr := range attrs {
+		if attr.ID.Equal(oidLocalKeyID) {
+			var id []byte
+			if err := unmarshalDER(attr.Value.Bytes, &id); err == nil {
+				return id
+			}
+		}
+	}
+	return nil
+}
+
+// explicitRawValue returns a raw value with the given DER bytes wrapped with
+// the context-specific tag 0.
+func explicitRawValue(b []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b}
+}
+
+// unmarshalDER unmarshals the given bytes failing if there is trailing data.
+func unmarshalDER(b []byte, v interface{}) error {
+	rest, err := asn1.Unmarshal(b, v)
+	if err == nil && len(rest) > 0 {
+		return errors.New("trailing data after ASN.1 value")
+	}
+	return err
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return nil, errors.Wrap(err, "error generating random bytes")
+	}
+	return b, nil
+}
@@ -0,0 +1,171 @@
+package pemutil
+
+import (
+	"crypto"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/cli/crypto/keys"
+	"golang.org/x/crypto/pkcs12"
+)
+
+func TestDecodePKCS12(t *testing.T) {
+	key, err := Read("testdata/openssl.p256.pem")
+	assert.FatalError(t, err)
+	crt, err := ReadCertificate("testdata/pkcs12.crt")
+	assert.FatalError(t, err)
+	ca, err := ReadCertificate("testdata/ca.crt")
+	assert.FatalError(t, err)
+
+	for _, fn := range []string{"testdata/pkcs12.aes.p12", "testdata/pkcs12.3des.p12", "testdata/pkcs12.rc2.p12"} {
+		t.Run(fn, func(t *testing.T) {
+			b, err := ioutil.ReadFile(fn)
+			assert.FatalError(t, err)
+			assert.True(t, IsPKCS12(b))
+
+			k, c, chain, err := DecodePKCS12(b, []byte("mypassword"))
+			assert.FatalError(t, err)
+			assert.Equals(t, key, k)
+			assert.Equals(t, crt.Raw, c.Raw)
+			assert.Len(t, 1, chain)
+			assert.Equals(t, ca.Raw, chain[0].Raw)
+
+			_, _, _, err = DecodePKCS12(b, []byte("foobar"))
+			assert.Equals(t, ErrPKCS12IncorrectPassword, err)
+		})
+	}
+
+	// Files without a MAC are accepted.
+	b, err := ioutil.ReadFile("testdata/pkcs12.nomac.p12")
+	assert.FatalError(t, err)
+	assert.False(t, hasPKCS12MAC(b))
+	k, c, chain, err := DecodePKCS12(b, []byte("mypassword"))
+	assert.FatalError(t, err)
+	assert.Equals(t, key, k)
+	assert.Equals(t, crt.Raw, c.Raw)
+	assert.Len(t, 1, chain)
+
+	b, err = ioutil.ReadFile("testdata/pkcs12.nokey.p12")
+	assert.FatalError(t, err)
+	assert.True(t, hasPKCS12MAC(b))
+	k, c, chain, err = DecodePKCS12(b, nil)
+	assert.FatalError(t, err)
+	assert.Nil(t, k)
+	assert.Equals(t, crt.Raw, c.Raw)
+	assert.Len(t, 0, chain)
+
+	b, err = ioutil.ReadFile("testdata/ca.der")
+	assert.FatalError(t, err)
+	assert.False(t, IsPKCS12(b))
+	_, _, _, err = DecodePKCS12(b, nil)
+	assert.Error(t, err)
+}
+
+func TestEncodePKCS12(t *testing.T) {
+	crt, err := ReadCertificate("testdata/pkcs12.crt")
+	assert.FatalError(t, err)
+	ca, err := ReadCertificate("testdata/ca.crt")
+	assert.FatalError(t, err)
+
+	for name, opts := range map[string]*PKCS12Options{
+		"default": nil,
+		"legacy":  LegacyPKCS12Options(),
+		"aes128":  {Cipher: x509.PEMCipherAES128, MAC: crypto.SHA512, FriendlyName: "leaf"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			key, err := Read("testdata/openssl.p256.pem")
+			assert.FatalError(t, err)
+			password := []byte("mypassword")
+
+			b, err := EncodePKCS12(key, crt, []*x509.Certificate{ca}, password, opts)
+			assert.FatalError(t, err)
+			assert.True(t, IsPKCS12(b))
+
+			k, c, chain, err := DecodePKCS12(b, password)
+			assert.FatalError(t, err)
+			assert.Equals(t, key, k)
+			assert.Equals(t, crt.Raw, c.Raw)
+			assert.Len(t, 1, chain)
+			assert.Equals(t, ca.Raw, chain[0].Raw)
+
+			_, _, _, err = DecodePKCS12(b, []byte("foobar"))
+			assert.Equals(t, ErrPKCS12IncorrectPassword, err)
+
+			// Without private key or password
+			b, err = EncodePKCS12(nil, crt, nil, nil, opts)
+			assert.FatalError(t, err)
+			k, c, chain, err = DecodePKCS12(b, nil)
+			assert.FatalError(t, err)
+			assert.Nil(t, k)
+			assert.Equals(t, crt.Raw, c.Raw)
+			assert.Len(t, 0, chain)
+		})
+	}
+
+	// Legacy files must be readable by other implementations.
+	key, err := Read("testdata/openssl.p256.pem")
+	assert.FatalError(t, err)
+	b, err := EncodePKCS12(key, crt, nil, []byte("mypassword"), LegacyPKCS12Options())
+	assert.FatalError(t, err)
+	k, c, err := pkcs12.Decode(b, "mypassword")
+	assert.FatalError(t, err)
+	assert.Equals(t, key, k)
+	assert.Equals(t, crt.Raw, c.Raw)
+
+	// Other key types
+	for _, kty := range []string{"RSA", "OKP"} {
+		priv, err := keys.GenerateKey(kty, "Ed25519", 2048)
+		assert.FatalError(t, err)
+		b, err := EncodePKCS12(priv, crt, nil, []byte("mypassword"), nil)
+		assert.FatalError(t, err)
+		k, _, _, err := DecodePKCS12(b, []byte("mypassword"))
+		assert.FatalError(t, err)
+		assert.Equals(t, priv, k)
+	}
+
+	_, err = EncodePKCS12(key, nil, nil, []byte("mypassword"), nil)
+	assert.Error(t, err)
+	_, err = EncodePKCS12(key, crt, nil, []byte("mypassword"), &PKCS12Options{Cipher: x509.PEMCipherDES, MAC: crypto.SHA256})
+	assert.Error(t, err)
+	_, err = EncodePKCS12(key, crt, nil, []byte("mypassword"), &PKCS12Options{Cipher: x509.PEMCipherAES256, MAC: crypto.MD5})
+	assert.Error(t, err)
+}
+
+func TestReadPKCS12(t *testing.T) {
+	key, err := Read("testdata/openssl.p256.pem")
+	assert.FatalError(t, err)
+	crt, err := ReadCertificate("testdata/pkcs12.crt")
+	assert.FatalError(t, err)
+
+	k, err := Read("testdata/pkcs12.aes.p12", WithPassword([]byte("mypassword")))
+	assert.FatalError(t, err)
+	assert.Equals(t, key, k)
+
+	c, err := ReadCertificate("testdata/pkcs12.3des.p12", WithPassword([]byte("mypassword")))
+	assert.FatalError(t, err)
+	assert.Equals(t, crt.Raw, c.Raw)
+
+	bundle, err := ReadCertificateBundle("testdata/pkcs12.rc2.p12", WithPassword([]byte("mypassword")))
+	assert.FatalError(t, err)
+	assert.Len(t, 2, bundle)
+	assert.Equals(t, crt.Raw, bundle[0].Raw)
+
+	// Without password and extension
+	dir, err := ioutil.TempDir("", "pkcs12")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+	b, err := ioutil.ReadFile("testdata/pkcs12.nokey.p12")
+	assert.FatalError(t, err)
+	fn := filepath.Join(dir, "nokey")
+	assert.FatalError(t, ioutil.WriteFile(fn, b, 0600))
+	v, err := Read(fn)
+	assert.FatalError(t, err)
+	assert.Equals(t, crt.Raw, v.(*x509.Certificate).Raw)
+
+	_, err = Read("testdata/pkcs12.aes.p12", WithPassword([]byte("foobar")))
+	assert.Error(t, err)
+}
@@ -0,0 +1,103 @@
+package pemutil
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+
+	"github.com/pkg/errors"
+)
+
+// PKCS7Type is the type of the PEM blocks containing PKCS#7 data.
+const PKCS7Type = "PKCS7"
+
+var oidSignedDataContentType = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+
+// signedData is the PKCS#7 SignedData defined in RFC 2315. Only degenerate
+// SignedData, without content and signatures, is supported.
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      contentInfo
+	Certificates     asn1.RawValue   `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue   `asn1:"optional,tag:1"`
+	SignerInfos      []asn1.RawValue `asn1:"set"`
+}
+
+// IsPKCS7 returns true if the given bytes are a PKCS#7 SignedData, in PEM or
+// DER format.
+func IsPKCS7(b []byte) bool {
+	if block, _ := pem.Decode(b); block != nil {
+		return block.Type == PKCS7Type
+	}
+	var ci contentInfo
+	rest, err := asn1.Unmarshal(b, &ci)
+	return err == nil && len(rest) == 0 && ci.ContentType.Equal(oidSignedDataContentType)
+}
+
+// ParsePKCS7 returns the certificates in the given PKCS#7 SignedData, also
+// known as .p7b or .p7c files. The data can be in PEM or DER format.
+func ParsePKCS7(b []byte) ([]*x509.Certificate, error) {
+	if block, _ := pem.Decode(b); block != nil {
+		if block.Type != PKCS7Type {
+			return nil, errors.Errorf("error decoding PKCS#7: unexpected PEM type %s", block.Type)
+		}
+		b = block.Bytes
+	}
+
+	var ci contentInfo
+	if err := unmarshalDER(b, &ci); err != nil {
+		return nil, errors.Wrap(err, "error decoding PKCS#7")
+	}
+	if !ci.ContentType.Equal(oidSignedDataContentType) {
+		return nil, errors.Errorf("error decoding PKCS#7: unsupported content type %s", ci.ContentType)
+	}
+
+	var sd signedData
+	if err := unmarshalDER(ci.Content.Bytes, &sd); err != nil {
+		return nil, errors.Wrap(err, "error decoding PKCS#7")
+	}
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing PKCS#7 certificates")
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("error decoding PKCS#7: data does not contain certificates")
+	}
+	return certs, nil
+}
+
+// EncodePKCS7 returns the DER encoding of a degenerate PKCS#7 SignedData with
+// the given certificates.
+func EncodePKCS7(certs []*x509.Certificate) ([]byte, error) {
+	if len(certs) == 0 {
+		return nil, errors.New("error encoding PKCS#7: certificates cannot be empty")
+	}
+
+	var raw []byte
+	for _, crt := range certs {
+		raw = append(raw, crt.Raw...)
+	}
+	b, err := asn1.Marshal(signedData{
+		Version: 1,
+		ContentInfo: contentInfo{
+			ContentType: oidDataContentType,
+		},
+		Certificates: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        0,
+			IsCompound: true,
+			Bytes:      raw,
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error encoding PKCS#7")
+	}
+
+	b, err = asn1.Marshal(contentInfo{
+		ContentType: oidSignedDataContentType,
+		Content:     explicitRawValue(b),
+	})
+	return b, errors.Wrap(err, "error encoding PKCS#7")
+}
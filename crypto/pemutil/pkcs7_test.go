@@ -0,0 +1,65 @@
+package pemutil
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestParsePKCS7(t *testing.T) {
+	crt, err := ReadCertificate("testdata/pkcs12.crt")
+	assert.FatalError(t, err)
+	ca, err := ReadCertificate("testdata/ca.crt")
+	assert.FatalError(t, err)
+
+	for _, fn := range []string{"testdata/bundle.p7b", "testdata/bundle.p7c"} {
+		b, err := ioutil.ReadFile(fn)
+		assert.FatalError(t, err)
+		assert.True(t, IsPKCS7(b))
+
+		certs, err := ParsePKCS7(b)
+		assert.FatalError(t, err)
+		assert.Len(t, 2, certs)
+		assert.Equals(t, crt.Raw, certs[0].Raw)
+		assert.Equals(t, ca.Raw, certs[1].Raw)
+
+		certs, err = ReadCertificateBundle(fn)
+		assert.FatalError(t, err)
+		assert.Len(t, 2, certs)
+
+		c, err := ReadCertificate(fn)
+		assert.FatalError(t, err)
+		assert.Equals(t, crt.Raw, c.Raw)
+	}
+
+	for _, fn := range []string{"testdata/ca.crt", "testdata/ca.der", "testdata/pkcs12.aes.p12"} {
+		b, err := ioutil.ReadFile(fn)
+		assert.FatalError(t, err)
+		assert.False(t, IsPKCS7(b))
+		_, err = ParsePKCS7(b)
+		assert.Error(t, err)
+	}
+}
+
+func TestEncodePKCS7(t *testing.T) {
+	crt, err := ReadCertificate("testdata/pkcs12.crt")
+	assert.FatalError(t, err)
+	ca, err := ReadCertificate("testdata/ca.crt")
+	assert.FatalError(t, err)
+
+	b, err := EncodePKCS7([]*x509.Certificate{crt, ca})
+	assert.FatalError(t, err)
+	expected, err := ioutil.ReadFile("testdata/bundle.p7c")
+	assert.FatalError(t, err)
+	assert.Equals(t, expected, b)
+
+	certs, err := ParsePKCS7(pem.EncodeToMemory(&pem.Block{Type: PKCS7Type, Bytes: b}))
+	assert.FatalError(t, err)
+	assert.Len(t, 2, certs)
+
+	_, err = EncodePKCS7(nil)
+	assert.Error(t, err)
+}
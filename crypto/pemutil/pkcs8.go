@@ -1,6 +1,7 @@
 package pemutil
 
 import (
+	"crypto"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/des"
@@ -89,6 +90,10 @@ var (
 	// oidX25519  = asn1.ObjectIdentifier{1, 3, 101, 110}
 	oidEd25519 = asn1.ObjectIdentifier{1, 3, 101, 112}
 
+	// RSASSA-PSS keys as defined in RFC 4055
+	oidRSAPSS = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+	oidMGF1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 8}
+
 	// key derivation functions
 	oidPKCS5PBKDF2    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
 	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
@@ -102,6 +107,124 @@ var (
 	oidD3DESCBC  = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
 )
 
+// pssParameters reflects the RSASSA-PSS-params structure defined in RFC 4055.
+type pssParameters struct {
+	Hash         pkix.AlgorithmIdentifier `asn1:"explicit,tag:0,optional"`
+	MGF          pkix.AlgorithmIdentifier `asn1:"explicit,tag:1,optional"`
+	SaltLength   int                      `asn1:"explicit,tag:2,optional,default:20"`
+	TrailerField int                      `asn1:"explicit,tag:3,optional,default:1"`
+}
+
+// pssHashes maps the hash functions supported in RSA-PSS keys to their OIDs.
+var pssHashes = []struct {
+	hash crypto.Hash
+	oid  asn1.ObjectIdentifier
+}{
+	{crypto.SHA1, oidSHA1},
+	{crypto.SHA256, oidSHA256},
+	{crypto.SHA384, oidSHA384},
+	{crypto.SHA512, oidSHA512},
+}
+
+// RSAPSSPrivateKey is an RSA private key that can only be used to create
+// RSASSA-PSS signatures, as defined in RFC 4055. If the key has parameters,
+// Hash is the only hash function allowed and SaltLength the minimum salt
+// length, otherwise both are 0 and any hash function can be used.
+type RSAPSSPrivateKey struct {
+	*rsa.PrivateKey
+	Hash       crypto.Hash
+	SaltLength int
+}
+
+// Sign signs the digest using RSASSA-PSS. It fails if opts is not an
+// *rsa.PSSOptions or if the options do not comply with the key restrictions.
+func (k *RSAPSSPrivateKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	pssOpts, ok := opts.(*rsa.PSSOptions)
+	if !ok {
+		return nil, errors.New("RSA-PSS keys can only create RSA-PSS signatures")
+	}
+	if k.Hash != 0 && pssOpts.HashFunc() != k.Hash {
+		return nil, errors.Errorf("RSA-PSS key can only be used with %s", k.Hash)
+	}
+	saltLength := pssOpts.SaltLength
+	if saltLength == rsa.PSSSaltLengthEqualsHash {
+		saltLength = pssOpts.HashFunc().Size()
+	}
+	if saltLength != rsa.PSSSaltLengthAuto && saltLength < k.SaltLength {
+		return nil, errors.Errorf("RSA-PSS key requires a salt length of at least %d", k.SaltLength)
+	}
+	return k.PrivateKey.Sign(rand, digest, opts)
+}
+
+// parsePSSParameters parses the RSASSA-PSS-params of a key and sets the hash
+// and salt length restrictions. Keys without parameters have no restrictions.
+func parsePSSParameters(params asn1.RawValue, key *RSAPSSPrivateKey) error {
+	if len(params.FullBytes) == 0 || params.Tag == asn1.TagNull {
+		return nil
+	}
+	var pss pssParameters
+	if rest, err := asn1.Unmarshal(params.FullBytes, &pss); err != nil {
+		return errors.Wrap(err, "error parsing RSA-PSS parameters")
+	} else if len(rest) != 0 {
+		return errors.New("error parsing RSA-PSS parameters: trailing data")
+	}
+
+	// The default hash function is SHA-1.
+	key.Hash = crypto.SHA1
+	if len(pss.Hash.Algorithm) > 0 {
+		key.Hash = 0
+		for _, h := range pssHashes {
+			if pss.Hash.Algorithm.Equal(h.oid) {
+				key.Hash = h.hash
+				break
+			}
+		}
+		if key.Hash == 0 {
+			return errors.Errorf("unsupported RSA-PSS hash algorithm %s", pss.Hash.Algorithm)
+		}
+	}
+	key.SaltLength = pss.SaltLength
+	return nil
+}
+
+// marshalPSSParameters returns the RSASSA-PSS-params with the restrictions of
+// the key, or an empty value if the key has no restrictions.
+func marshalPSSParameters(key *RSAPSSPrivateKey) (asn1.RawValue, error) {
+	if key.Hash == 0 {
+		return asn1.RawValue{}, nil
+	}
+	var hashOID asn1.ObjectIdentifier
+	for _, h := range pssHashes {
+		if h.hash == key.Hash {
+			hashOID = h.oid
+		}
+	}
+	if hashOID == nil {
+		return asn1.RawValue{}, errors.Errorf("unsupported RSA-PSS hash algorithm %s", key.Hash)
+	}
+	hashAlgo := pkix.AlgorithmIdentifier{
+		Algorithm:  hashOID,
+		Parameters: asn1.NullRawValue,
+	}
+	mgfParams, err := asn1.Marshal(hashAlgo)
+	if err != nil {
+		return asn1.RawValue{}, errors.Wrap(err, "error marshaling RSA-PSS parameters")
+	}
+	b, err := asn1.Marshal(pssParameters{
+		Hash: hashAlgo,
+		MGF: pkix.AlgorithmIdentifier{
+			Algorithm:  oidMGF1,
+			Parameters: asn1.RawValue{FullBytes: mgfParams},
+		},
+		SaltLength:   key.SaltLength,
+		TrailerField: 1,
+	})
+	if err != nil {
+		return asn1.RawValue{}, errors.Wrap(err, "error marshaling RSA-PSS parameters")
+	}
+	return asn1.RawValue{FullBytes: b}, nil
+}
+
 // rfc1423Algo holds a method for enciphering a PEM block.
 type rfc1423Algo struct {
 	cipher     x509.PEMCipher
@@ -172,11 +295,11 @@ func (c rfc1423Algo) deriveKey(password, salt []byte, h func() hash.Hash) []byte
 // ParsePKCS8PrivateKey parses an unencrypted, PKCS#8 private key. See RFC
 // 5208.
 //
-// Supported key types include RSA, ECDSA, and Ed25519. Unknown key types
-// result in an error.
+// Supported key types include RSA, RSA-PSS, ECDSA, and Ed25519. Unknown key
+// types result in an error.
 //
-// On success, key will be of type *rsa.PrivateKey, *ecdsa.PublicKey, or
-// ed25519.PrivateKey.
+// On success, key will be of type *rsa.PrivateKey, *RSAPSSPrivateKey,
+// *ecdsa.PublicKey, or ed25519.PrivateKey.
 func ParsePKCS8PrivateKey(der []byte) (key interface{}, err error) {
 	var privKey pkcs8
 	if _, err := asn1.Unmarshal(der, &privKey); err != nil {
@@ -189,6 +312,16 @@ func ParsePKCS8PrivateKey(der []byte) (key interface{}, err error) {
 		copy(seed, privKey.PrivateKey[2:])
 		key = ed25519.NewKeyFromSeed(seed)
 		return key, nil
+	case privKey.Algo.Algorithm.Equal(oidRSAPSS):
+		k, err := x509.ParsePKCS1PrivateKey(privKey.PrivateKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing RSA-PSS private key")
+		}
+		key := &RSAPSSPrivateKey{PrivateKey: k}
+		if err := parsePSSParameters(privKey.Algo.Parameters, key); err != nil {
+			return nil, err
+		}
+		return key, nil
 	// Proof of concept for key agreement algorithm X25519.
 	// A real implementation would use their own types.
 	//
@@ -209,8 +342,10 @@ func ParsePKCS8PrivateKey(der []byte) (key interface{}, err error) {
 // ParsePKIXPublicKey parses a DER encoded public key. These values are
 // typically found in PEM blocks with "BEGIN PUBLIC KEY".
 //
-// Supported key types include RSA, DSA, ECDSA, and Ed25519. Unknown key types
-// result in an error.
+// Supported key types include RSA, RSA-PSS, DSA, ECDSA, and Ed25519. Unknown
+// key types result in an error. RSA-PSS public keys are returned as
+// *rsa.PublicKey and the parameters are ignored, the restrictions are only
+// enforced by the private key, see RSAPSSPrivateKey.
 //
 // On success, pub will be of type *rsa.PublicKey, *dsa.PublicKey,
 // *ecdsa.PublicKey, or ed25519.PublicKey.
@@ -226,6 +361,12 @@ func ParsePKIXPublicKey(derBytes []byte) (pub interface{}, err error) {
 	case pki.Algo.Algorithm.Equal(oidEd25519):
 		pub = ed25519.PublicKey(pki.PublicKey.Bytes)
 		return pub, nil
+	case pki.Algo.Algorithm.Equal(oidRSAPSS):
+		k, err := x509.ParsePKCS1PublicKey(pki.PublicKey.RightAlign())
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing RSA-PSS public key")
+		}
+		return k, nil
 	// Prove of concept for key agreement algorithm X25519.
 	// A real implementation would use their own types.
 	//
@@ -259,13 +400,27 @@ func MarshalPKIXPublicKey(pub interface{}) ([]byte, error) {
 }
 
 // MarshalPKCS8PrivateKey converts a private key to PKCS#8 encoded form. The
-// following key types are supported: *rsa.PrivateKey, *ecdsa.PublicKey,
-// ed25519.PrivateKey. Unsupported key types result in an error.
+// following key types are supported: *rsa.PrivateKey, *RSAPSSPrivateKey,
+// *ecdsa.PublicKey, ed25519.PrivateKey. Unsupported key types result in an
+// error.
 func MarshalPKCS8PrivateKey(key interface{}) ([]byte, error) {
 	switch k := key.(type) {
 	case *rsa.PrivateKey, *ecdsa.PrivateKey:
 		b, err := x509.MarshalPKCS8PrivateKey(key)
 		return b, errors.Wrap(err, "error marshaling PKCS#8")
+	case *RSAPSSPrivateKey:
+		params, err := marshalPSSParameters(k)
+		if err != nil {
+			return nil, err
+		}
+		var priv pkcs8
+		priv.PrivateKey = x509.MarshalPKCS1PrivateKey(k.PrivateKey)
+		priv.Algo = pkix.AlgorithmIdentifier{
+			Algorithm:  oidRSAPSS,
+			Parameters: params,
+		}
+		b, err := asn1.Marshal(priv)
+		return b, errors.Wrap(err, "error marshaling PKCS#8")
 	case ed25519.PrivateKey:
 		var priv pkcs8
 		priv.PrivateKey = append([]byte{4, 32}, k.Seed()...)[:34]
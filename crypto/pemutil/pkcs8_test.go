@@ -1,9 +1,14 @@
 package pemutil
 
 import (
+	"crypto"
 	"crypto/ed25519"
 	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
 	"crypto/x509"
+	"encoding/pem"
 	"io/ioutil"
 	"reflect"
 	"testing"
@@ -120,6 +125,16 @@ func TestMarshalPKCS8PrivateKey(t *testing.T) {
 	assert.FatalError(t, err)
 	edPrivDer, err := ioutil.ReadFile("testdata/pkcs8/openssl.ed25519.der")
 	assert.FatalError(t, err)
+	pssKey, err := Read("testdata/pkcs8/openssl.rsapss.pem")
+	assert.FatalError(t, err)
+	pss384Key, err := Read("testdata/pkcs8/openssl.rsapss384.pem")
+	assert.FatalError(t, err)
+	mustDER := func(fn string) []byte {
+		b, err := ioutil.ReadFile(fn)
+		assert.FatalError(t, err)
+		block, _ := pem.Decode(b)
+		return block.Bytes
+	}
 
 	type args struct {
 		key interface{}
@@ -133,6 +148,8 @@ func TestMarshalPKCS8PrivateKey(t *testing.T) {
 		{"rsa", args{rsaKey}, mustPKCS8(rsaKey), false},
 		{"ecdsa", args{ecdsaKey}, mustPKCS8(ecdsaKey), false},
 		{"ed25519", args{edKey}, edPrivDer, false},
+		{"rsapss", args{pssKey}, mustDER("testdata/pkcs8/openssl.rsapss.pem"), false},
+		{"rsapss384", args{pss384Key}, mustDER("testdata/pkcs8/openssl.rsapss384.pem"), false},
 		{"fail", args{edKey.(ed25519.PrivateKey).Public()}, nil, true},
 	}
 	for _, tt := range tests {
@@ -148,3 +165,38 @@ func TestMarshalPKCS8PrivateKey(t *testing.T) {
 		})
 	}
 }
+
+func TestRSAPSSPrivateKey_Sign(t *testing.T) {
+	key, err := Read("testdata/pkcs8/openssl.rsapss384.pem")
+	assert.FatalError(t, err)
+	pssKey, ok := key.(*RSAPSSPrivateKey)
+	assert.Fatal(t, ok)
+	assert.Equals(t, crypto.SHA384, pssKey.Hash)
+	assert.Equals(t, 48, pssKey.SaltLength)
+
+	sum256 := sha256.Sum256([]byte("message"))
+	sum384 := sha512.Sum384([]byte("message"))
+	tests := []struct {
+		name    string
+		digest  []byte
+		opts    crypto.SignerOpts
+		wantErr bool
+	}{
+		{"ok", sum384[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA384}, false},
+		{"ok auto", sum384[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto, Hash: crypto.SHA384}, false},
+		{"fail pkcs1", sum384[:], crypto.SHA384, true},
+		{"fail hash", sum256[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}, true},
+		{"fail salt", sum384[:], &rsa.PSSOptions{SaltLength: 32, Hash: crypto.SHA384}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sig, err := pssKey.Sign(rand.Reader, tt.digest, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RSAPSSPrivateKey.Sign() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				assert.NoError(t, rsa.VerifyPSS(&pssKey.PublicKey, crypto.SHA384, tt.digest, sig, nil))
+			}
+		})
+	}
+}
@@ -19,8 +19,12 @@ $OPENSSL genpkey -outform PEM -algorithm ED25519 -out pkcs8/openssl.ed25519.pem
 $OPENSSL genpkey -outform PEM -algorithm RSA -pkeyopt rsa_keygen_bits:2048 -out pkcs8/openssl.rsa2048.pem
 $OPENSSL genpkey -outform PEM -algorithm RSA -pkeyopt rsa_keygen_bits:4096 -out pkcs8/openssl.rsa4096.pem
 
+# RSA-PSS
+$OPENSSL genpkey -outform PEM -algorithm RSA-PSS -pkeyopt rsa_keygen_bits:2048 -out pkcs8/openssl.rsapss.pem
+$OPENSSL genpkey -outform PEM -algorithm RSA-PSS -pkeyopt rsa_keygen_bits:2048 -pkeyopt rsa_pss_keygen_md:sha384 -pkeyopt rsa_pss_keygen_mgf1_md:sha384 -pkeyopt rsa_pss_keygen_saltlen:48 -out pkcs8/openssl.rsapss384.pem
+
 # Public
-NAMES="p256 p384 p521 ed25519 rsa2048 rsa4096"
+NAMES="p256 p384 p521 ed25519 rsa2048 rsa4096 rsapss rsapss384"
 for name in $NAMES
 do
 	$OPENSSL pkey -outform PEM -in "pkcs8/openssl.$name.pem" -pubout -out "pkcs8/openssl.$name.pub.pem"
@@ -30,6 +34,8 @@ done
 $OPENSSL pkey -outform PEM -in pkcs8/openssl.p256.pem -aes-128-cbc -passout pass:mypassword  -out pkcs8/openssl.p256.enc.pem
 $OPENSSL pkey -outform PEM -in pkcs8/openssl.ed25519.pem -aes-192-cbc -passout pass:mypassword  -out pkcs8/openssl.ed25519.enc.pem
 $OPENSSL pkey -outform PEM -in pkcs8/openssl.rsa2048.pem -aes-256-cbc -passout pass:mypassword  -out pkcs8/openssl.rsa2048.enc.pem
+$OPENSSL pkey -outform PEM -in pkcs8/openssl.rsapss.pem -aes-256-cbc -passout pass:mypassword  -out pkcs8/openssl.rsapss.enc.pem
+$OPENSSL pkey -outform PEM -in pkcs8/openssl.rsapss384.pem -aes-256-cbc -passout pass:mypassword  -out pkcs8/openssl.rsapss384.enc.pem
 $OPENSSL pkey -outform PEM -in pkcs8/openssl.p384.pem -des -passout pass:mypassword -out pkcs8/openssl.p384.enc.pem
 $OPENSSL pkey -outform PEM -in pkcs8/openssl.p521.pem -des3 -passout pass:mypassword -out pkcs8/openssl.p521.enc.pem
 
@@ -95,3 +101,21 @@ do
    cp openssh.rsa$size.pem openssh.rsa$size.enc.pem
    $SSH_KEYGEN -p -N mypassword -f openssh.rsa$size.enc.pem
 done
+
+#######################################
+# PKCS#12                             #
+#######################################
+
+$OPENSSL req -new -x509 -key openssl.p256.pem -subj /CN=leaf -days 36500 -out pkcs12.crt
+$OPENSSL pkcs12 -export -in pkcs12.crt -inkey openssl.p256.pem -certfile ca.crt -passout pass:mypassword -out pkcs12.aes.p12
+$OPENSSL pkcs12 -export -in pkcs12.crt -inkey openssl.p256.pem -certfile ca.crt -passout pass:mypassword -certpbe PBE-SHA1-3DES -keypbe PBE-SHA1-3DES -macalg sha1 -out pkcs12.3des.p12
+$OPENSSL pkcs12 -export -in pkcs12.crt -inkey openssl.p256.pem -certfile ca.crt -passout pass:mypassword -legacy -out pkcs12.rc2.p12
+$OPENSSL pkcs12 -export -in pkcs12.crt -nokeys -passout pass: -out pkcs12.nokey.p12
+$OPENSSL pkcs12 -export -in pkcs12.crt -inkey openssl.p256.pem -certfile ca.crt -passout pass:mypassword -nomac -out pkcs12.nomac.p12
+
+#######################################
+# PKCS#7                              #
+#######################################
+
+$OPENSSL crl2pkcs7 -nocrl -certfile pkcs12.crt -certfile ca.crt -out bundle.p7b
+$OPENSSL crl2pkcs7 -nocrl -certfile pkcs12.crt -certfile ca.crt -outform DER -out bundle.p7c
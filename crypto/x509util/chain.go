@@ -0,0 +1,263 @@
+package x509util
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/pemutil"
+)
+
+// aiaTimeout is the maximum time to wait for the download of an issuer
+// certificate.
+const aiaTimeout = 30 * time.Second
+
+// maxIssuersSize is the maximum size of the response with the issuer
+// certificates.
+const maxIssuersSize = 64 * 1024
+
+// maxChainLength is the maximum number of certificates in a chain built by
+// FixChain.
+const maxChainLength = 10
+
+// ChainOptions are the options used to fix a certificate chain.
+type ChainOptions struct {
+	// Intermediates are additional certificates used to complete the chain.
+	Intermediates []*x509.Certificate
+	// FetchIssuers enables the download of the missing issuers using the
+	// caIssuers URLs in the authority information access extension.
+	FetchIssuers bool
+	// RemoveRoot removes the self-signed root from the chain.
+	RemoveRoot bool
+}
+
+// ChainChange describes a change made by FixChain.
+type ChainChange struct {
+	Action  string
+	Subject string
+	Reason  string
+}
+
+// String implements the fmt.Stringer interface.
+func (c ChainChange) String() string {
+	if c.Subject == "" {
+		return fmt.Sprintf("%s: %s", c.Action, c.Reason)
+	}
+	return fmt.Sprintf("%s %s: %s", c.Action, c.Subject, c.Reason)
+}
+
+// FixChain builds a chain from the given certificates, ordered from the leaf
+// to the root. Duplicated certificates and the ones not part of the chain of
+// the leaf are removed, and missing intermediates are added from the options.
+// It returns the new chain and the list of changes made.
+func FixChain(certs []*x509.Certificate, opts ChainOptions) ([]*x509.Certificate, []ChainChange, error) {
+	var (
+		unique  []*x509.Certificate
+		changes []ChainChange
+	)
+	for _, crt := range certs {
+		if containsCertificate(unique, crt) {
+			changes = append(changes, ChainChange{"removed", crt.Subject.String(), "duplicated certificate"})
+			continue
+		}
+		unique = append(unique, crt)
+	}
+	if len(unique) == 0 {
+		return nil, nil, errors.New("no certificates found")
+	}
+
+	// Build the chain from the leaf
+	chain := []*x509.Certificate{findLeaf(unique)}
+	for crt := chain[0]; !isSelfSigned(crt) && len(chain) < maxChainLength; {
+		issuer := findIssuer(crt, unique, chain)
+		if issuer == nil {
+			if issuer = findIssuer(crt, opts.Intermediates, chain); issuer != nil {
+				changes = append(changes, ChainChange{"added", issuer.Subject.String(), "issuer found in local intermediates"})
+			}
+		}
+		if issuer == nil && opts.FetchIssuers {
+			for _, url := range crt.IssuingCertificateURL {
+				candidates, err := FetchIssuers(url)
+				if err != nil {
+					changes = append(changes, ChainChange{"skipped", "", err.Error()})
+					continue
+				}
+				if issuer = findIssuer(crt, candidates, chain); issuer != nil {
+					changes = append(changes, ChainChange{"added", issuer.Subject.String(), "issuer downloaded from " + url})
+					break
+				}
+			}
+		}
+		if issuer == nil {
+			break
+		}
+		chain = append(chain, issuer)
+		crt = issuer
+	}
+
+	for _, crt := range unique {
+		if !containsCertificate(chain, crt) {
+			changes = append(changes, ChainChange{"removed", crt.Subject.String(), "certificate not part of the chain"})
+		}
+	}
+
+	// Report the new order if the certificates in the input are not in the
+	// same order.
+	var kept, ordered []*x509.Certificate
+	for _, crt := range unique {
+		if containsCertificate(chain, crt) {
+			kept = append(kept, crt)
+		}
+	}
+	for _, crt := range chain {
+		if containsCertificate(unique, crt) {
+			ordered = append(ordered, crt)
+		}
+	}
+	for i, crt := range kept {
+		if !bytes.Equal(crt.Raw, ordered[i].Raw) {
+			changes = append(changes, ChainChange{"reordered", "", "certificates sorted from leaf to root"})
+			break
+		}
+	}
+
+	if last := chain[len(chain)-1]; opts.RemoveRoot && len(chain) > 1 && isSelfSigned(last) {
+		chain = chain[:len(chain)-1]
+		changes = append(changes, ChainChange{"removed", last.Subject.String(), "root certificate"})
+	}
+
+	return chain, changes, nil
+}
+
+// ChainIsComplete returns true if the last certificate in the chain is a
+// self-signed root or if it's issued by a root in the system trust store.
+func ChainIsComplete(chain []*x509.Certificate) bool {
+	if len(chain) == 0 {
+		return false
+	}
+	last := chain[len(chain)-1]
+	return isSelfSigned(last) || systemAnchor(last) != nil
+}
+
+// FetchIssuers downloads the certificates in the given caIssuers URL. The
+// response can be a DER certificate, PEM certificates or a PKCS#7 bundle.
+func FetchIssuers(url string) ([]*x509.Certificate, error) {
+	client := &http.Client{Timeout: aiaTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error downloading %s", url)
+	}
+	defer resp.Body.Close()
+	b, err := readResponse(resp, maxIssuersSize)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error downloading %s", url)
+	}
+	certs, err := parseIssuers(b)
+	return certs, errors.Wrapf(err, "error parsing %s", url)
+}
+
+func parseIssuers(b []byte) ([]*x509.Certificate, error) {
+	switch {
+	case pemutil.IsPKCS7(b):
+		return pemutil.ParsePKCS7(b)
+	case bytes.HasPrefix(b, []byte("-----BEGIN ")):
+		var certs []*x509.Certificate
+		for len(b) > 0 {
+			var block *pem.Block
+			if block, b = pem.Decode(b); block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			crt, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			certs = append(certs, crt)
+		}
+		return certs, nil
+	default:
+		crt, err := x509.ParseCertificate(b)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return []*x509.Certificate{crt}, nil
+	}
+}
+
+// findLeaf returns the certificate that has not issued any of the other
+// certificates. Certificates that are not a CA are preferred, and if there are
+// multiple candidates, the one with the longest chain in the given
+// certificates is returned.
+func findLeaf(certs []*x509.Certificate) *x509.Certificate {
+	var candidates, leaves []*x509.Certificate
+	for _, crt := range certs {
+		isIssuer := false
+		for _, c := range certs {
+			if c != crt && isIssuerOf(c, crt) {
+				isIssuer = true
+				break
+			}
+		}
+		if !isIssuer {
+			candidates = append(candidates, crt)
+			if !crt.IsCA {
+				leaves = append(leaves, crt)
+			}
+		}
+	}
+	if len(leaves) > 0 {
+		candidates = leaves
+	}
+	if len(candidates) == 0 {
+		return certs[0]
+	}
+
+	var leaf *x509.Certificate
+	var max int
+	for _, crt := range candidates {
+		if n := len(buildChain(crt, certs)); n > max {
+			leaf, max = crt, n
+		}
+	}
+	return leaf
+}
+
+// buildChain returns the chain of the certificate using only the given
+// certificates.
+func buildChain(crt *x509.Certificate, certs []*x509.Certificate) []*x509.Certificate {
+	chain := []*x509.Certificate{crt}
+	for !isSelfSigned(crt) && len(chain) < maxChainLength {
+		if crt = findIssuer(crt, certs, chain); crt == nil {
+			break
+		}
+		chain = append(chain, crt)
+	}
+	return chain
+}
+
+// findIssuer returns the issuer of the certificate in the candidates that is
+// not already in the chain.
+func findIssuer(crt *x509.Certificate, candidates, chain []*x509.Certificate) *x509.Certificate {
+	for _, c := range candidates {
+		if isIssuerOf(crt, c) && !containsCertificate(chain, c) {
+			return c
+		}
+	}
+	return nil
+}
+
+// isIssuerOf returns true if the issuer signed the certificate.
+func isIssuerOf(crt, issuer *x509.Certificate) bool {
+	return isIssuerCandidate(crt, issuer) && crt.CheckSignatureFrom(issuer) == nil
+}
+
+// isSelfSigned returns true if the certificate is signed by its own key.
+func isSelfSigned(crt *x509.Certificate) bool {
+	return bytes.Equal(crt.RawIssuer, crt.RawSubject) && crt.CheckSignature(crt.SignatureAlgorithm, crt.RawTBSCertificate, crt.Signature) == nil
+}
@@ -0,0 +1,151 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestFixChain(t *testing.T) {
+	mustCertificate := func(p Profile, err error) (*x509.Certificate, Profile) {
+		assert.FatalError(t, err)
+		b, err := p.CreateCertificate()
+		assert.FatalError(t, err)
+		crt, err := x509.ParseCertificate(b)
+		assert.FatalError(t, err)
+		return crt, p
+	}
+	withIssuingURL := func(url string) WithOption {
+		return func(p Profile) error {
+			p.Subject().IssuingCertificateURL = []string{url}
+			return nil
+		}
+	}
+
+	srv := httptest.NewServer(nil)
+	defer srv.Close()
+
+	root, rootProfile := mustCertificate(NewRootProfile("root"))
+	inter, interProfile := mustCertificate(NewIntermediateProfile("intermediate", root, rootProfile.SubjectPrivateKey(),
+		withIssuingURL(srv.URL+"/root.crt")))
+	leaf, _ := mustCertificate(NewLeafProfile("leaf", inter, interProfile.SubjectPrivateKey(),
+		withIssuingURL(srv.URL+"/intermediate.crt")))
+	other, otherProfile := mustCertificate(NewRootProfile("other"))
+	otherLeaf, _ := mustCertificate(NewLeafProfile("other leaf", other, otherProfile.SubjectPrivateKey()))
+
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/intermediate.crt":
+			w.Write(inter.Raw)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	type action struct {
+		action, subject string
+	}
+	tests := []struct {
+		name    string
+		certs   []*x509.Certificate
+		opts    ChainOptions
+		want    []*x509.Certificate
+		changes []action
+	}{
+		{"ok", []*x509.Certificate{leaf, inter, root}, ChainOptions{},
+			[]*x509.Certificate{leaf, inter, root}, nil},
+		{"ok without root", []*x509.Certificate{leaf, inter}, ChainOptions{},
+			[]*x509.Certificate{leaf, inter}, nil},
+		{"reorder", []*x509.Certificate{root, leaf, inter}, ChainOptions{},
+			[]*x509.Certificate{leaf, inter, root}, []action{{"reordered", ""}}},
+		{"duplicates", []*x509.Certificate{leaf, inter, inter, root, leaf}, ChainOptions{},
+			[]*x509.Certificate{leaf, inter, root}, []action{{"removed", "CN=intermediate"}, {"removed", "CN=leaf"}}},
+		{"unrelated", []*x509.Certificate{other, leaf, inter}, ChainOptions{},
+			[]*x509.Certificate{leaf, inter}, []action{{"removed", "CN=other"}}},
+		{"unrelated leaf", []*x509.Certificate{otherLeaf, inter, leaf, root}, ChainOptions{},
+			[]*x509.Certificate{leaf, inter, root}, []action{{"removed", "CN=other leaf"}, {"reordered", ""}}},
+		{"remove root", []*x509.Certificate{inter, root, leaf}, ChainOptions{RemoveRoot: true},
+			[]*x509.Certificate{leaf, inter}, []action{{"reordered", ""}, {"removed", "CN=root"}}},
+		{"complete with intermediates", []*x509.Certificate{leaf}, ChainOptions{Intermediates: []*x509.Certificate{other, inter, root}},
+			[]*x509.Certificate{leaf, inter, root}, []action{{"added", "CN=intermediate"}, {"added", "CN=root"}}},
+		{"complete with aia", []*x509.Certificate{leaf, root}, ChainOptions{FetchIssuers: true},
+			[]*x509.Certificate{leaf, inter, root}, []action{{"added", "CN=intermediate"}}},
+		{"complete with aia failure", []*x509.Certificate{leaf}, ChainOptions{Intermediates: []*x509.Certificate{inter}, FetchIssuers: true},
+			[]*x509.Certificate{leaf, inter}, []action{{"added", "CN=intermediate"}, {"skipped", ""}}},
+		{"no aia", []*x509.Certificate{leaf}, ChainOptions{},
+			[]*x509.Certificate{leaf}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain, changes, err := FixChain(tt.certs, tt.opts)
+			assert.FatalError(t, err)
+			assert.Len(t, len(tt.want), chain)
+			for i := range chain {
+				assert.Equals(t, tt.want[i].Raw, chain[i].Raw)
+			}
+			assert.Len(t, len(tt.changes), changes)
+			for i, c := range changes {
+				assert.Equals(t, tt.changes[i].action, c.Action)
+				assert.Equals(t, tt.changes[i].subject, c.Subject)
+			}
+		})
+	}
+
+	assert.True(t, ChainIsComplete([]*x509.Certificate{leaf, inter, root}))
+	assert.False(t, ChainIsComplete([]*x509.Certificate{leaf, inter}))
+	assert.False(t, ChainIsComplete(nil))
+
+	_, _, err := FixChain(nil, ChainOptions{})
+	assert.Error(t, err)
+}
+
+func TestFetchIssuers(t *testing.T) {
+	root, err := NewRootProfile("root")
+	assert.FatalError(t, err)
+	b, err := root.CreateCertificate()
+	assert.FatalError(t, err)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/root.crt":
+			w.Write(b)
+		case "/accepted.crt":
+			w.WriteHeader(http.StatusAccepted)
+			w.Write(b)
+		case "/moved.crt":
+			w.WriteHeader(http.StatusMultipleChoices)
+			w.Write(b)
+		case "/large.crt":
+			w.Write(make([]byte, maxIssuersSize+1))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		path    string
+		wantErr bool
+	}{
+		{"/root.crt", false},
+		{"/accepted.crt", false},
+		{"/moved.crt", true},
+		{"/missing.crt", true},
+		{"/large.crt", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			certs, err := FetchIssuers(srv.URL + tt.path)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Len(t, 1, certs)
+			assert.Equals(t, b, certs[0].Raw)
+		})
+	}
+}
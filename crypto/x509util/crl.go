@@ -0,0 +1,475 @@
+package x509util
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/utils"
+	"golang.org/x/crypto/ocsp"
+)
+
+var (
+	oidExtensionAuthorityKeyID    = asn1.ObjectIdentifier{2, 5, 29, 35}
+	oidExtensionCRLNumber         = asn1.ObjectIdentifier{2, 5, 29, 20}
+	oidExtensionDeltaCRLIndicator = asn1.ObjectIdentifier{2, 5, 29, 27}
+	oidExtensionReasonCode        = asn1.ObjectIdentifier{2, 5, 29, 21}
+
+	oidSignatureSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSignatureSHA384WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSignatureSHA512WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidSignatureRSAPSS          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+	oidSignatureECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidSignatureECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidSignatureECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+	oidSignatureEd25519         = asn1.ObjectIdentifier{1, 3, 101, 112}
+
+	oidMGF1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 8}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+)
+
+// maxCRLSize is the maximum size of a downloaded CRL.
+const maxCRLSize = 32 << 20
+
+// DefaultCRLValidity is the default time between the thisUpdate and
+// nextUpdate fields of a CRL.
+var DefaultCRLValidity = 7 * 24 * time.Hour
+
+// RevocationReasonCodes is a map between string reason codes
+// to integers as defined in RFC 5280
+var RevocationReasonCodes = map[string]int{
+	"unspecified":          ocsp.Unspecified,
+	"keycompromise":        ocsp.KeyCompromise,
+	"cacompromise":         ocsp.CACompromise,
+	"affiliationchanged":   ocsp.AffiliationChanged,
+	"superseded":           ocsp.Superseded,
+	"cessationofoperation": ocsp.CessationOfOperation,
+	"certificatehold":      ocsp.CertificateHold,
+	"removefromcrl":        ocsp.RemoveFromCRL,
+	"privilegewithdrawn":   ocsp.PrivilegeWithdrawn,
+	"aacompromise":         ocsp.AACompromise,
+}
+
+// reasonCodeNames are the names of the reason codes as defined in RFC 5280.
+var reasonCodeNames = map[int]string{
+	ocsp.Unspecified:          "Unspecified",
+	ocsp.KeyCompromise:        "Key Compromise",
+	ocsp.CACompromise:         "CA Compromise",
+	ocsp.AffiliationChanged:   "Affiliation Changed",
+	ocsp.Superseded:           "Superseded",
+	ocsp.CessationOfOperation: "Cessation Of Operation",
+	ocsp.CertificateHold:      "Certificate Hold",
+	ocsp.RemoveFromCRL:        "Remove From CRL",
+	ocsp.PrivilegeWithdrawn:   "Privilege Withdrawn",
+	ocsp.AACompromise:         "AA Compromise",
+}
+
+// ReasonCodeToNum converts a string encoded code to a number.
+// 1) "4" -> 4
+// 2) "key compromise" -> 1
+// 3) "keYComPromIse" -> 1
+func ReasonCodeToNum(rc string) (int, error) {
+	// default to 0
+	if rc == "" {
+		return 0, nil
+	}
+
+	if code, err := strconv.Atoi(rc); err == nil {
+		if code < ocsp.Unspecified || code > ocsp.AACompromise {
+			return -1, errors.Errorf("reasonCode out of bounds. Got %d, but want value between %d and %d",
+				code, ocsp.Unspecified, ocsp.AACompromise)
+		}
+		return code, nil
+	}
+
+	code, found := RevocationReasonCodes[strings.ToLower(strings.Replace(rc, " ", "", -1))]
+	if !found {
+		return 0, errors.Errorf("unrecognized revocation reason code '%s'", rc)
+	}
+
+	return code, nil
+}
+
+// ReasonCodeString returns the name of the given reason code, e.g. 1 ->
+// "Key Compromise".
+func ReasonCodeString(code int) string {
+	if s, ok := reasonCodeNames[code]; ok {
+		return s
+	}
+	return "Unknown (" + strconv.Itoa(code) + ")"
+}
+
+// ParseSerialNumber parses a certificate serial number in decimal, in
+// hexadecimal with the 0x prefix, or in hexadecimal with colon separated bytes,
+// e.g. "255", "0xff" and "00:ff" are the same serial number.
+func ParseSerialNumber(s string) (*big.Int, error) {
+	var (
+		n  = new(big.Int)
+		ok bool
+	)
+	switch {
+	case strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X"):
+		_, ok = n.SetString(s[2:], 16)
+	case strings.Contains(s, ":"):
+		_, ok = n.SetString(strings.Replace(s, ":", "", -1), 16)
+	default:
+		_, ok = n.SetString(s, 10)
+	}
+	if !ok || n.Sign() < 0 {
+		return nil, errors.Errorf("invalid serial number '%s'", s)
+	}
+	return n, nil
+}
+
+// CRL contains the fields used to create a certificate revocation list.
+type CRL struct {
+	// Number is the value of the CRL number extension.
+	Number *big.Int
+	// BaseNumber, if set, marks the CRL as a delta CRL of the CRL with the
+	// given number.
+	BaseNumber *big.Int
+	// ThisUpdate defaults to the current time.
+	ThisUpdate time.Time
+	// NextUpdate defaults to ThisUpdate plus DefaultCRLValidity.
+	NextUpdate time.Time
+	// RevokedCertificates is the list of revoked certificates.
+	RevokedCertificates []pkix.RevokedCertificate
+}
+
+// NewRevokedCertificate returns a CRL entry for the given serial number,
+// revocation time and reason code. The reason code extension is not added if
+// the reason is unspecified, as required by RFC 5280.
+func NewRevokedCertificate(serial *big.Int, revokedAt time.Time, reasonCode int) (pkix.RevokedCertificate, error) {
+	rc := pkix.RevokedCertificate{
+		SerialNumber:   serial,
+		RevocationTime: revokedAt.UTC(),
+	}
+	if reasonCode != ocsp.Unspecified {
+		b, err := asn1.Marshal(asn1.Enumerated(reasonCode))
+		if err != nil {
+			return rc, errors.Wrap(err, "error marshaling reason code")
+		}
+		rc.Extensions = []pkix.Extension{{Id: oidExtensionReasonCode, Value: b}}
+	}
+	return rc, nil
+}
+
+// CreateCRL creates a DER-encoded certificate revocation list signed by the
+// given issuer.
+func CreateCRL(template *CRL, iss *x509.Certificate, issPriv crypto.PrivateKey) ([]byte, error) {
+	signer, ok := issPriv.(crypto.Signer)
+	if !ok {
+		return nil, errors.Errorf("key of type %T is not a crypto.Signer", issPriv)
+	}
+	if iss.KeyUsage != 0 && iss.KeyUsage&x509.KeyUsageCRLSign == 0 {
+		return nil, errors.New("issuer certificate does not have the CRL signing key usage")
+	}
+	alg := DefaultSignatureAlgorithm(signer)
+	algo, err := signatureAlgorithmIdentifier(alg)
+	if err != nil {
+		return nil, err
+	}
+
+	thisUpdate := template.ThisUpdate
+	if thisUpdate.IsZero() {
+		thisUpdate = time.Now()
+	}
+	nextUpdate := template.NextUpdate
+	if nextUpdate.IsZero() {
+		nextUpdate = thisUpdate.Add(DefaultCRLValidity)
+	}
+	if template.Number == nil {
+		return nil, errors.New("CRL number cannot be nil")
+	}
+
+	issuer := iss.RawSubject
+	if len(issuer) == 0 {
+		if issuer, err = asn1.Marshal(iss.Subject.ToRDNSequence()); err != nil {
+			return nil, errors.Wrap(err, "error marshaling issuer")
+		}
+	}
+
+	tbs := tbsCertificateList{
+		Version:             1,
+		Signature:           algo,
+		Issuer:              asn1.RawValue{FullBytes: issuer},
+		ThisUpdate:          thisUpdate.UTC(),
+		NextUpdate:          nextUpdate.UTC(),
+		RevokedCertificates: template.RevokedCertificates,
+	}
+
+	if len(iss.SubjectKeyId) > 0 {
+		b, err := asn1.Marshal(authorityKeyID{ID: iss.SubjectKeyId})
+		if err != nil {
+			return nil, errors.Wrap(err, "error marshaling authority key identifier")
+		}
+		tbs.Extensions = append(tbs.Extensions, pkix.Extension{Id: oidExtensionAuthorityKeyID, Value: b})
+	}
+	b, err := asn1.Marshal(template.Number)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling CRL number")
+	}
+	tbs.Extensions = append(tbs.Extensions, pkix.Extension{Id: oidExtensionCRLNumber, Value: b})
+	if template.BaseNumber != nil {
+		b, err := asn1.Marshal(template.BaseNumber)
+		if err != nil {
+			return nil, errors.Wrap(err, "error marshaling delta CRL indicator")
+		}
+		tbs.Extensions = append(tbs.Extensions, pkix.Extension{Id: oidExtensionDeltaCRLIndicator, Critical: true, Value: b})
+	}
+
+	tbsBytes, err := asn1.Marshal(tbs)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling CRL")
+	}
+	signature, err := signData(signer, alg, tbsBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	crlBytes, err := asn1.Marshal(certificateList{
+		TBSCertList:        asn1.RawValue{FullBytes: tbsBytes},
+		SignatureAlgorithm: algo,
+		SignatureValue:     asn1.BitString{Bytes: signature, BitLength: len(signature) * 8},
+	})
+	return crlBytes, errors.Wrap(err, "error marshaling CRL")
+}
+
+// tbsCertificateList is the ASN.1 structure of the TBSCertList in RFC 5280,
+// pkix.TBSCertificateList is not used to keep the issuer name as it is encoded
+// in the issuer certificate.
+type tbsCertificateList struct {
+	Version             int `asn1:"optional,default:0"`
+	Signature           pkix.AlgorithmIdentifier
+	Issuer              asn1.RawValue
+	ThisUpdate          time.Time
+	NextUpdate          time.Time                 `asn1:"optional"`
+	RevokedCertificates []pkix.RevokedCertificate `asn1:"optional"`
+	Extensions          []pkix.Extension          `asn1:"tag:0,optional,explicit"`
+}
+
+type certificateList struct {
+	TBSCertList        asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	SignatureValue     asn1.BitString
+}
+
+type authorityKeyID struct {
+	ID []byte `asn1:"optional,tag:0"`
+}
+
+// ParseCRL parses a PEM or DER encoded certificate revocation list.
+func ParseCRL(b []byte) (*pkix.CertificateList, error) {
+	crl, err := x509.ParseCRL(b)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing CRL")
+	}
+	return crl, nil
+}
+
+// ReadCRL reads a certificate revocation list from a file or, if the name
+// starts with http:// or https://, from the given URL.
+func ReadCRL(name string) (*pkix.CertificateList, error) {
+	var (
+		b   []byte
+		err error
+	)
+	if lower := strings.ToLower(name); strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") {
+		b, err = fetchCRL(name)
+		if err != nil {
+			return nil, err
+		}
+	} else if b, err = utils.ReadFile(name); err != nil {
+		return nil, errs.FileError(err, name)
+	}
+	crl, err := ParseCRL(b)
+	return crl, errors.Wrapf(err, "error reading %s", name)
+}
+
+func fetchCRL(url string) ([]byte, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error downloading %s", url)
+	}
+	defer resp.Body.Close()
+	b, err := readResponse(resp, maxCRLSize)
+	return b, errors.Wrapf(err, "error downloading %s", url)
+}
+
+// CRLNumber returns the value of the CRL number extension, or nil if the CRL
+// does not have one.
+func CRLNumber(crl *pkix.CertificateList) *big.Int {
+	return crlIntegerExtension(crl, oidExtensionCRLNumber)
+}
+
+// CRLBaseNumber returns the value of the delta CRL indicator extension, or
+// nil if the CRL is not a delta CRL.
+func CRLBaseNumber(crl *pkix.CertificateList) *big.Int {
+	return crlIntegerExtension(crl, oidExtensionDeltaCRLIndicator)
+}
+
+// CRLAuthorityKeyID returns the value of the authority key identifier
+// extension, or nil if the CRL does not have one.
+func CRLAuthorityKeyID(crl *pkix.CertificateList) []byte {
+	for _, ext := range crl.TBSCertList.Extensions {
+		if ext.Id.Equal(oidExtensionAuthorityKeyID) {
+			var aki authorityKeyID
+			if _, err := asn1.Unmarshal(ext.Value, &aki); err == nil {
+				return aki.ID
+			}
+		}
+	}
+	return nil
+}
+
+func crlIntegerExtension(crl *pkix.CertificateList, oid asn1.ObjectIdentifier) *big.Int {
+	for _, ext := range crl.TBSCertList.Extensions {
+		if ext.Id.Equal(oid) {
+			n := new(big.Int)
+			if _, err := asn1.Unmarshal(ext.Value, &n); err == nil {
+				return n
+			}
+		}
+	}
+	return nil
+}
+
+// RevocationReason returns the reason code of the given CRL entry. If the
+// entry does not have a reason code extension the reason is unspecified.
+func RevocationReason(rc pkix.RevokedCertificate) int {
+	for _, ext := range rc.Extensions {
+		if ext.Id.Equal(oidExtensionReasonCode) {
+			var code asn1.Enumerated
+			if _, err := asn1.Unmarshal(ext.Value, &code); err == nil {
+				return int(code)
+			}
+		}
+	}
+	return ocsp.Unspecified
+}
+
+// FindRevokedCertificate returns the CRL entry for the given serial number,
+// or false if the serial number is not in the CRL.
+func FindRevokedCertificate(crl *pkix.CertificateList, serial *big.Int) (pkix.RevokedCertificate, bool) {
+	for _, rc := range crl.TBSCertList.RevokedCertificates {
+		if rc.SerialNumber != nil && rc.SerialNumber.Cmp(serial) == 0 {
+			return rc, true
+		}
+	}
+	return pkix.RevokedCertificate{}, false
+}
+
+// CRLIssuer returns the issuer name of the given CRL.
+func CRLIssuer(crl *pkix.CertificateList) pkix.Name {
+	var issuer pkix.Name
+	issuer.FillFromRDNSequence(&crl.TBSCertList.Issuer)
+	return issuer
+}
+
+// VerifyCRL checks that the CRL has been signed by the given issuer, that the
+// names and key identifiers match, and that the CRL is current at the given
+// time.
+func VerifyCRL(crl *pkix.CertificateList, iss *x509.Certificate, now time.Time) error {
+	if issuer := CRLIssuer(crl); issuer.String() != iss.Subject.String() {
+		return errors.Errorf("CRL issuer '%s' does not match certificate subject '%s'", issuer, iss.Subject)
+	}
+	if aki := CRLAuthorityKeyID(crl); aki != nil && len(iss.SubjectKeyId) > 0 && !bytes.Equal(aki, iss.SubjectKeyId) {
+		return errors.New("CRL authority key identifier does not match the certificate subject key identifier")
+	}
+	if err := iss.CheckCRLSignature(crl); err != nil {
+		return errors.Wrap(err, "error verifying CRL signature")
+	}
+	if now.Before(crl.TBSCertList.ThisUpdate) {
+		return errors.Errorf("CRL is not valid yet, thisUpdate is %s", crl.TBSCertList.ThisUpdate.Format(time.RFC3339))
+	}
+	if crl.HasExpired(now) {
+		return errors.Errorf("CRL has expired, nextUpdate was %s", crl.TBSCertList.NextUpdate.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// signatureAlgorithmIdentifier returns the ASN.1 algorithm identifier of the
+// given signature algorithm. RSA-PSS identifiers use the same hash for the
+// message digest and MGF1, and a salt of the size of the hash.
+func signatureAlgorithmIdentifier(alg x509.SignatureAlgorithm) (pkix.AlgorithmIdentifier, error) {
+	switch alg {
+	case x509.SHA256WithRSA:
+		return pkix.AlgorithmIdentifier{Algorithm: oidSignatureSHA256WithRSA, Parameters: asn1.NullRawValue}, nil
+	case x509.SHA384WithRSA:
+		return pkix.AlgorithmIdentifier{Algorithm: oidSignatureSHA384WithRSA, Parameters: asn1.NullRawValue}, nil
+	case x509.SHA512WithRSA:
+		return pkix.AlgorithmIdentifier{Algorithm: oidSignatureSHA512WithRSA, Parameters: asn1.NullRawValue}, nil
+	case x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS, x509.SHA512WithRSAPSS:
+		hash := signatureHash(alg)
+		hashAlgorithm := pkix.AlgorithmIdentifier{Algorithm: hashOID(hash), Parameters: asn1.NullRawValue}
+		mgf1Params, err := asn1.Marshal(hashAlgorithm)
+		if err != nil {
+			return pkix.AlgorithmIdentifier{}, errors.Wrap(err, "error marshaling RSA-PSS parameters")
+		}
+		params, err := asn1.Marshal(pssParameters{
+			Hash:         hashAlgorithm,
+			MGF:          pkix.AlgorithmIdentifier{Algorithm: oidMGF1, Parameters: asn1.RawValue{FullBytes: mgf1Params}},
+			SaltLength:   hash.Size(),
+			TrailerField: 1,
+		})
+		if err != nil {
+			return pkix.AlgorithmIdentifier{}, errors.Wrap(err, "error marshaling RSA-PSS parameters")
+		}
+		return pkix.AlgorithmIdentifier{Algorithm: oidSignatureRSAPSS, Parameters: asn1.RawValue{FullBytes: params}}, nil
+	case x509.ECDSAWithSHA256:
+		return pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSAWithSHA256}, nil
+	case x509.ECDSAWithSHA384:
+		return pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSAWithSHA384}, nil
+	case x509.ECDSAWithSHA512:
+		return pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSAWithSHA512}, nil
+	case x509.PureEd25519:
+		return pkix.AlgorithmIdentifier{Algorithm: oidSignatureEd25519}, nil
+	default:
+		return pkix.AlgorithmIdentifier{}, errors.Errorf("unsupported signature algorithm %s", alg)
+	}
+}
+
+// hashOID returns the object identifier of the given SHA-2 hash.
+func hashOID(hash crypto.Hash) asn1.ObjectIdentifier {
+	switch hash {
+	case crypto.SHA384:
+		return oidSHA384
+	case crypto.SHA512:
+		return oidSHA512
+	default:
+		return oidSHA256
+	}
+}
+
+// pssParameters is the ASN.1 structure of the RSASSA-PSS-params in RFC 4055.
+type pssParameters struct {
+	Hash         pkix.AlgorithmIdentifier `asn1:"explicit,tag:0"`
+	MGF          pkix.AlgorithmIdentifier `asn1:"explicit,tag:1"`
+	SaltLength   int                      `asn1:"explicit,tag:2"`
+	TrailerField int                      `asn1:"optional,explicit,tag:3,default:1"`
+}
+
+// sign signs the data with the given signer, hashing it first if required.
+func sign(signer crypto.Signer, hash crypto.Hash, data []byte) ([]byte, error) {
+	digest := data
+	if hash != 0 {
+		h := hash.New()
+		h.Write(data)
+		digest = h.Sum(nil)
+	}
+	signature, err := signer.Sign(rand.Reader, digest, hash)
+	return signature, errors.Wrap(err, "error signing")
+}
@@ -0,0 +1,183 @@
+package x509util
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestReasonCodeToNum(t *testing.T) {
+	tests := map[string]struct {
+		rc   string
+		want int
+		err  bool
+	}{
+		"empty":        {"", ocsp.Unspecified, false},
+		"number":       {"4", ocsp.Superseded, false},
+		"name":         {"key compromise", ocsp.KeyCompromise, false},
+		"mixed case":   {"keYComPromIse", ocsp.KeyCompromise, false},
+		"out of range": {"11", -1, true},
+		"unknown":      {"foo", 0, true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ReasonCodeToNum(tc.rc)
+			if tc.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equals(t, tc.want, got)
+		})
+	}
+}
+
+func TestParseSerialNumber(t *testing.T) {
+	tests := map[string]struct {
+		s    string
+		want *big.Int
+	}{
+		"decimal":     {"255", big.NewInt(255)},
+		"hex":         {"0xff", big.NewInt(255)},
+		"colons":      {"00:ff", big.NewInt(255)},
+		"fail/empty":  {"", nil},
+		"fail/hex":    {"0xzz", nil},
+		"fail/neg":    {"-1", nil},
+		"fail/number": {"1.5", nil},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseSerialNumber(tc.s)
+			if tc.want == nil {
+				assert.Error(t, err)
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, 0, tc.want.Cmp(got))
+		})
+	}
+}
+
+func TestCreateCRL(t *testing.T) {
+	root, err := NewProfileFromTemplate(testCATemplate, TemplateData{"Subject": "root", "pathLen": 1}, nil, nil)
+	assert.FatalError(t, err)
+	b, err := root.CreateCertificate()
+	assert.FatalError(t, err)
+	rootCrt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+
+	now := time.Now().Truncate(time.Second)
+	keyCompromise, err := NewRevokedCertificate(big.NewInt(1), now, ocsp.KeyCompromise)
+	assert.FatalError(t, err)
+	unspecified, err := NewRevokedCertificate(big.NewInt(2), now, ocsp.Unspecified)
+	assert.FatalError(t, err)
+	assert.Len(t, 0, unspecified.Extensions)
+
+	b, err = CreateCRL(&CRL{
+		Number:              big.NewInt(43),
+		BaseNumber:          big.NewInt(42),
+		ThisUpdate:          now.Add(-time.Minute),
+		RevokedCertificates: []pkix.RevokedCertificate{keyCompromise, unspecified},
+	}, rootCrt, root.SubjectPrivateKey())
+	assert.FatalError(t, err)
+
+	crl, err := ParseCRL(b)
+	assert.FatalError(t, err)
+	assert.NoError(t, VerifyCRL(crl, rootCrt, now))
+	assert.Equals(t, big.NewInt(43), CRLNumber(crl))
+	assert.Equals(t, big.NewInt(42), CRLBaseNumber(crl))
+	assert.Equals(t, rootCrt.SubjectKeyId, CRLAuthorityKeyID(crl))
+	assert.Equals(t, now.Add(-time.Minute).Add(DefaultCRLValidity).UTC(), crl.TBSCertList.NextUpdate)
+
+	revoked := crl.TBSCertList.RevokedCertificates
+	assert.Len(t, 2, revoked)
+	assert.Equals(t, ocsp.KeyCompromise, RevocationReason(revoked[0]))
+	assert.Equals(t, ocsp.Unspecified, RevocationReason(revoked[1]))
+
+	// Expired and not yet valid
+	assert.Error(t, VerifyCRL(crl, rootCrt, now.Add(DefaultCRLValidity)))
+	assert.Error(t, VerifyCRL(crl, rootCrt, now.Add(-time.Hour)))
+
+	// Wrong issuer
+	other, err := NewProfileFromTemplate(testCATemplate, TemplateData{"Subject": "root", "pathLen": 1}, nil, nil)
+	assert.FatalError(t, err)
+	b, err = other.CreateCertificate()
+	assert.FatalError(t, err)
+	otherCrt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+	assert.Error(t, VerifyCRL(crl, otherCrt, now))
+
+	// Missing number
+	_, err = CreateCRL(&CRL{}, rootCrt, root.SubjectPrivateKey())
+	assert.Error(t, err)
+}
+
+func TestCreateCRL_rsaPSS(t *testing.T) {
+	rsaKey := mustGenerateKey(t, "RSA", "", 2048)
+	for _, key := range []*pemutil.RSAPSSPrivateKey{
+		{PrivateKey: rsaKey.(*rsa.PrivateKey)},
+		{PrivateKey: rsaKey.(*rsa.PrivateKey), Hash: crypto.SHA384, SaltLength: 48},
+	} {
+		t.Run(DefaultSignatureAlgorithm(key).String(), func(t *testing.T) {
+			root, err := NewRootProfile("root", func(p Profile) error {
+				p.SetSubjectPublicKey(key.Public())
+				p.SetSubjectPrivateKey(key)
+				return nil
+			})
+			assert.FatalError(t, err)
+			b, err := root.CreateCertificate()
+			assert.FatalError(t, err)
+			rootCrt, err := x509.ParseCertificate(b)
+			assert.FatalError(t, err)
+
+			now := time.Now()
+			b, err = CreateCRL(&CRL{Number: big.NewInt(1), ThisUpdate: now}, rootCrt, key)
+			assert.FatalError(t, err)
+			crl, err := ParseCRL(b)
+			assert.FatalError(t, err)
+			assert.NoError(t, VerifyCRL(crl, rootCrt, now))
+		})
+	}
+}
+
+func TestReadCRL_url(t *testing.T) {
+	root, err := NewProfileFromTemplate(testCATemplate, TemplateData{"Subject": "root", "pathLen": 1}, nil, nil)
+	assert.FatalError(t, err)
+	b, err := root.CreateCertificate()
+	assert.FatalError(t, err)
+	rootCrt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+	der, err := CreateCRL(&CRL{Number: big.NewInt(1)}, rootCrt, root.SubjectPrivateKey())
+	assert.FatalError(t, err)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/root.crl":
+			w.Write(der)
+		case "/redirect.crl":
+			w.WriteHeader(http.StatusMultipleChoices)
+			w.Write(der)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	crl, err := ReadCRL(srv.URL + "/root.crl")
+	assert.FatalError(t, err)
+	assert.Equals(t, big.NewInt(1), CRLNumber(crl))
+	_, err = ReadCRL(srv.URL + "/redirect.crl")
+	assert.Error(t, err)
+	_, err = ReadCRL(srv.URL + "/missing.crl")
+	assert.Error(t, err)
+}
@@ -0,0 +1,181 @@
+package x509util
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// crossSignSkipExtensions are the extensions that are not copied from the
+// original certificate, because they are either set by the x509 package from
+// the certificate properties, or they are bound to the original issuer.
+var crossSignSkipExtensions = []asn1.ObjectIdentifier{
+	{2, 5, 29, 14},                     // subject key identifier
+	{2, 5, 29, 15},                     // key usage
+	{2, 5, 29, 17},                     // subject alternative name
+	{2, 5, 29, 19},                     // basic constraints
+	{2, 5, 29, 30},                     // name constraints
+	{2, 5, 29, 31},                     // CRL distribution points
+	{2, 5, 29, 32},                     // certificate policies
+	{2, 5, 29, 35},                     // authority key identifier
+	{2, 5, 29, 37},                     // extended key usage
+	{1, 3, 6, 1, 5, 5, 7, 1, 1},        // authority information access
+	{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}, // signed certificate timestamps
+	{1, 3, 6, 1, 4, 1, 11129, 2, 4, 3}, // certificate transparency poison
+}
+
+// NewIntermediateProfileWithTemplate returns a new intermediate x509
+// Certificate Profile with Subject Certificate set to the value of the
+// template argument. A public/private keypair **WILL NOT** be generated for
+// this profile because the public key will be populated from the Subject
+// Certificate parameter.
+func NewIntermediateProfileWithTemplate(sub *x509.Certificate, iss *x509.Certificate, issPriv crypto.PrivateKey, withOps ...WithOption) (Profile, error) {
+	withOps = append(withOps, WithPublicKey(sub.PublicKey))
+	return newProfile(&Intermediate{}, sub, iss, issPriv, withOps...)
+}
+
+// NewCrossSignedProfile returns a new intermediate x509 Certificate Profile
+// that certifies the subject and public key of the given certificate
+// authority using a different issuer. The subject key identifier, the
+// validity, and the extensions of the original certificate are preserved,
+// except the ones bound to the original issuer. The NotAfter of the new
+// certificate is limited to the NotAfter of the issuer.
+func NewCrossSignedProfile(crt *x509.Certificate, iss *x509.Certificate, issPriv crypto.PrivateKey, withOps ...WithOption) (Profile, error) {
+	if !crt.IsCA {
+		return nil, errors.New("cross-signed certificates must be certificate authorities")
+	}
+	if !iss.IsCA {
+		return nil, errors.New("issuing certificate is not a certificate authority")
+	}
+
+	sub := &x509.Certificate{
+		RawSubject:                  crt.RawSubject,
+		Subject:                     crt.Subject,
+		NotBefore:                   crt.NotBefore,
+		NotAfter:                    crt.NotAfter,
+		SubjectKeyId:                crt.SubjectKeyId,
+		KeyUsage:                    crt.KeyUsage,
+		ExtKeyUsage:                 crt.ExtKeyUsage,
+		UnknownExtKeyUsage:          crt.UnknownExtKeyUsage,
+		BasicConstraintsValid:       crt.BasicConstraintsValid,
+		IsCA:                        crt.IsCA,
+		MaxPathLen:                  crt.MaxPathLen,
+		MaxPathLenZero:              crt.MaxPathLenZero,
+		DNSNames:                    crt.DNSNames,
+		EmailAddresses:              crt.EmailAddresses,
+		IPAddresses:                 crt.IPAddresses,
+		URIs:                        crt.URIs,
+		PermittedDNSDomainsCritical: crt.PermittedDNSDomainsCritical,
+		PermittedDNSDomains:         crt.PermittedDNSDomains,
+		ExcludedDNSDomains:          crt.ExcludedDNSDomains,
+		PermittedIPRanges:           crt.PermittedIPRanges,
+		ExcludedIPRanges:            crt.ExcludedIPRanges,
+		PermittedEmailAddresses:     crt.PermittedEmailAddresses,
+		ExcludedEmailAddresses:      crt.ExcludedEmailAddresses,
+		PermittedURIDomains:         crt.PermittedURIDomains,
+		ExcludedURIDomains:          crt.ExcludedURIDomains,
+		PolicyIdentifiers:           crt.PolicyIdentifiers,
+		PublicKey:                   crt.PublicKey,
+	}
+	if sub.MaxPathLen == 0 && !sub.MaxPathLenZero {
+		sub.MaxPathLen = -1
+	}
+	for _, ext := range crt.Extensions {
+		if !containsOID(crossSignSkipExtensions, ext.Id) {
+			sub.ExtraExtensions = append(sub.ExtraExtensions, ext)
+		}
+	}
+
+	p, err := NewIntermediateProfileWithTemplate(sub, iss, issPriv, withOps...)
+	if err != nil {
+		return nil, err
+	}
+
+	// A certificate cannot outlive its issuer.
+	if sub := p.Subject(); sub.NotAfter.After(iss.NotAfter) {
+		sub.NotAfter = iss.NotAfter
+		if !sub.NotBefore.Before(sub.NotAfter) {
+			return nil, errors.New("cross-signed certificate validity starts after the issuer expires")
+		}
+	}
+	return p, nil
+}
+
+// VerifyCrossSigned checks that the cross-signed certificate has been signed
+// by the issuer, and that it can be used in place of the original
+// certificate: both have the same subject, public key and subject key
+// identifier, so any certificate issued by the original certificate authority
+// will chain to either of them.
+//
+// Both paths are verified, the cross-signed certificate using the issuer as
+// the root, and the original certificate using the given chain. The chain
+// contains the root of the original certificate and the intermediates between
+// them, and it can be empty if the original certificate is a root.
+func VerifyCrossSigned(crossCrt, crt, iss *x509.Certificate, chain []*x509.Certificate) error {
+	if err := crossCrt.CheckSignatureFrom(iss); err != nil {
+		return errors.Wrap(err, "cross-signed certificate is not signed by the issuer")
+	}
+	if !bytes.Equal(crossCrt.RawSubject, crt.RawSubject) {
+		return errors.New("cross-signed certificate subject does not match the original certificate")
+	}
+	if !bytes.Equal(crossCrt.RawSubjectPublicKeyInfo, crt.RawSubjectPublicKeyInfo) {
+		return errors.New("cross-signed certificate public key does not match the original certificate")
+	}
+	if !bytes.Equal(crossCrt.SubjectKeyId, crt.SubjectKeyId) {
+		return errors.New("cross-signed certificate subject key identifier does not match the original certificate")
+	}
+
+	// Verify the certificate now, or at the beginning of its validity if it
+	// is not valid yet.
+	now := time.Now()
+	if now.Before(crossCrt.NotBefore) {
+		now = crossCrt.NotBefore
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(iss)
+	if _, err := crossCrt.Verify(x509.VerifyOptions{
+		Roots:       roots,
+		CurrentTime: now,
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return errors.Wrap(err, "error verifying cross-signed certificate")
+	}
+
+	// Verify the original certificate with its own root.
+	roots = x509.NewCertPool()
+	intermediates := x509.NewCertPool()
+	hasRoot := false
+	for _, c := range append([]*x509.Certificate{crt}, chain...) {
+		if bytes.Equal(c.RawSubject, c.RawIssuer) {
+			roots.AddCert(c)
+			hasRoot = true
+		} else if c != crt {
+			intermediates.AddCert(c)
+		}
+	}
+	if !hasRoot {
+		return errors.New("the root of the original certificate is required to verify it")
+	}
+	if _, err := crt.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return errors.Wrap(err, "error verifying the original certificate")
+	}
+	return nil
+}
+
+func containsOID(oids []asn1.ObjectIdentifier, oid asn1.ObjectIdentifier) bool {
+	for _, o := range oids {
+		if o.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+func TestNewCrossSignedProfile(t *testing.T) {
+	createRoot := func(name string) (*x509.Certificate, Profile) {
+		p, err := NewRootProfile(name, WithPolicyIdentifiers([]string{"1.2.3.4"}))
+		assert.FatalError(t, err)
+		b, err := p.CreateCertificate()
+		assert.FatalError(t, err)
+		crt, err := x509.ParseCertificate(b)
+		assert.FatalError(t, err)
+		return crt, p
+	}
+
+	oldRoot, oldProfile := createRoot("old")
+	newRoot, newProfile := createRoot("new")
+
+	// Certificate issued by the new root.
+	inter, err := NewIntermediateProfile("intermediate", newRoot, newProfile.SubjectPrivateKey())
+	assert.FatalError(t, err)
+	b, err := inter.CreateCertificate()
+	assert.FatalError(t, err)
+	interCrt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+
+	// Cross-sign the new root with the old root.
+	cross, err := NewCrossSignedProfile(newRoot, oldRoot, oldProfile.SubjectPrivateKey())
+	assert.FatalError(t, err)
+	b, err = cross.CreateCertificate()
+	assert.FatalError(t, err)
+	crossCrt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+	assert.NoError(t, VerifyCrossSigned(crossCrt, newRoot, oldRoot, nil))
+	assert.Equals(t, newRoot.RawSubject, crossCrt.RawSubject)
+	assert.Equals(t, newRoot.SubjectKeyId, crossCrt.SubjectKeyId)
+	assert.Equals(t, oldRoot.SubjectKeyId, crossCrt.AuthorityKeyId)
+	assert.Equals(t, newRoot.PolicyIdentifiers, crossCrt.PolicyIdentifiers)
+	assert.Equals(t, newRoot.NotAfter, crossCrt.NotAfter)
+	assert.True(t, crossCrt.IsCA)
+	assert.NotEquals(t, newRoot.SerialNumber, crossCrt.SerialNumber)
+
+	// Clients trusting only the old root can verify the intermediate.
+	roots := x509.NewCertPool()
+	roots.AddCert(oldRoot)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(crossCrt)
+	_, err = interCrt.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	assert.NoError(t, err)
+
+	// The cross-signed certificate is not interchangeable with a different
+	// certificate authority.
+	assert.Error(t, VerifyCrossSigned(crossCrt, oldRoot, oldRoot, nil))
+	assert.Error(t, VerifyCrossSigned(crossCrt, newRoot, newRoot, nil))
+
+	// Cross-sign the intermediate with the old root, the original certificate
+	// must verify with its own root.
+	cross, err = NewCrossSignedProfile(interCrt, oldRoot, oldProfile.SubjectPrivateKey())
+	assert.FatalError(t, err)
+	b, err = cross.CreateCertificate()
+	assert.FatalError(t, err)
+	crossInter, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+	assert.NoError(t, VerifyCrossSigned(crossInter, interCrt, oldRoot, []*x509.Certificate{newRoot}))
+	assert.Error(t, VerifyCrossSigned(crossInter, interCrt, oldRoot, nil))
+	assert.Error(t, VerifyCrossSigned(crossInter, interCrt, oldRoot, []*x509.Certificate{oldRoot}))
+
+	// The validity is limited to the validity of the issuer.
+	shortRoot, err := NewRootProfile("short", WithNotBeforeAfterDuration(time.Time{}, time.Time{}, 24*time.Hour))
+	assert.FatalError(t, err)
+	b, err = shortRoot.CreateCertificate()
+	assert.FatalError(t, err)
+	shortCrt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+	cross, err = NewCrossSignedProfile(newRoot, shortCrt, shortRoot.SubjectPrivateKey())
+	assert.FatalError(t, err)
+	b, err = cross.CreateCertificate()
+	assert.FatalError(t, err)
+	crossShort, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+	assert.Equals(t, shortCrt.NotAfter, crossShort.NotAfter)
+	assert.NoError(t, VerifyCrossSigned(crossShort, newRoot, shortCrt, nil))
+	_, err = NewCrossSignedProfile(newRoot, shortCrt, shortRoot.SubjectPrivateKey(),
+		WithNotBeforeAfterDuration(shortCrt.NotAfter.Add(time.Hour), shortCrt.NotAfter.Add(48*time.Hour), 0))
+	assert.Error(t, err)
+
+	// Leaf certificates cannot be cross-signed.
+	leaf, err := NewLeafProfile("leaf", newRoot, newProfile.SubjectPrivateKey())
+	assert.FatalError(t, err)
+	b, err = leaf.CreateCertificate()
+	assert.FatalError(t, err)
+	leafCrt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+	_, err = NewCrossSignedProfile(leafCrt, oldRoot, oldProfile.SubjectPrivateKey())
+	assert.Error(t, err)
+}
@@ -1,17 +1,24 @@
 package x509util
 
 import (
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/hex"
 	"encoding/pem"
+	"fmt"
 	"io/ioutil"
 	"net"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/pemutil"
 	"github.com/smallstep/cli/errs"
 )
 
@@ -21,6 +28,50 @@ func Fingerprint(cert *x509.Certificate) string {
 	return strings.ToLower(hex.EncodeToString(sum[:]))
 }
 
+// PublicKeyString returns the algorithm and size of a public key, e.g. "RSA
+// 2048" or "ECDSA P-256".
+func PublicKeyString(pub interface{}) string {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", k.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA " + k.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "Ed25519"
+	case *dsa.PublicKey:
+		return fmt.Sprintf("DSA %d", k.P.BitLen())
+	default:
+		return fmt.Sprintf("unknown %T", pub)
+	}
+}
+
+// SANs returns all the Subject Alternative Names of the certificate as
+// strings.
+func SANs(cert *x509.Certificate) []string {
+	return joinSANs(cert.DNSNames, cert.IPAddresses, cert.EmailAddresses, cert.URIs)
+}
+
+// CSRSANs returns the Subject Alternative Names of a certificate request in
+// the same format as SANs.
+func CSRSANs(csr *x509.CertificateRequest) []string {
+	return joinSANs(csr.DNSNames, csr.IPAddresses, csr.EmailAddresses, csr.URIs)
+}
+
+// joinSANs returns the DNS names, IP addresses, email addresses and URIs as a
+// list of strings.
+func joinSANs(dnsNames []string, ips []net.IP, emails []string, uris []*url.URL) []string {
+	var sans []string
+	sans = append(sans, dnsNames...)
+	for _, ip := range ips {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, emails...)
+	for _, u := range uris {
+		sans = append(sans, u.String())
+	}
+	return sans
+}
+
 // SplitSANs splits a slice of Subject Alternative Names into slices of
 // IP Addresses and DNS Names. If an element is not an IP address, then it
 // is bucketed as a DNS Name.
@@ -44,18 +95,103 @@ func SplitSANs(sans []string) (dnsNames []string, ips []net.IP, emails []string)
 	return
 }
 
+// uriSchemes are the schemes of the URIs without an authority that are
+// bucketed as URIs, e.g. urn:uuid:ddfe62ba-7e99-4bc1-83b3-8f57fe3e9959.
+var uriSchemes = []string{"spiffe", "urn"}
+
+// SplitSANsWithURIs splits a slice of Subject Alternative Names into slices of
+// DNS Names, IP Addresses, Email Addresses and URIs. An element is bucketed as
+// an URI if it contains "://" (e.g. spiffe://example.org/foo) or it uses a
+// known scheme like urn, so values like host:8443 are not URIs. If an element
+// is not an IP address, an URI or an email, then it is bucketed as a DNS Name.
+func SplitSANsWithURIs(sans []string) (dnsNames []string, ips []net.IP, emails []string, uris []*url.URL) {
+	uris = []*url.URL{}
+	var rest []string
+	for _, san := range sans {
+		if u, ok := parseURISAN(san); ok {
+			uris = append(uris, u)
+		} else {
+			rest = append(rest, san)
+		}
+	}
+	dnsNames, ips, emails = SplitSANs(rest)
+	return
+}
+
+// parseURISAN returns the URI and true if the SAN is an URI.
+func parseURISAN(san string) (*url.URL, bool) {
+	if net.ParseIP(san) != nil {
+		return nil, false
+	}
+	u, err := url.Parse(san)
+	if err != nil || u.Scheme == "" {
+		return nil, false
+	}
+	if strings.Contains(san, "://") {
+		return u, true
+	}
+	for _, scheme := range uriSchemes {
+		if strings.EqualFold(u.Scheme, scheme) {
+			return u, true
+		}
+	}
+	return nil, false
+}
+
 // ReadCertPool loads a certificate pool from disk.
-// *path*: a file, a directory, or a comma-separated list of files.
-func ReadCertPool(path string) (*x509.CertPool, error) {
+// *path*: a file, a directory, or a comma-separated list of files. Files can
+// contain PEM certificates or be JKS or JCEKS truststores.
+// *opts*: the options used to read the truststores, the integrity of a
+// truststore is verified using the password in the options, or the user is
+// prompted for one.
+func ReadCertPool(path string, opts ...pemutil.Options) (*x509.CertPool, error) {
+	blocks, err := readCertificateBlocks(path, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var pems []byte
+	pool := x509.NewCertPool()
+	for _, block := range blocks {
+		pems = append(pems, pem.EncodeToMemory(block)...)
+	}
+	if ok := pool.AppendCertsFromPEM(pems); !ok {
+		return nil, errors.Errorf("error loading Root certificates")
+	}
+	return pool, nil
+}
+
+// ReadCertificates loads the certificates in the given path. Like in
+// ReadCertPool, the path can be a file, a directory, or a comma-separated list
+// of files, and the options are used to read the truststores. PEM blocks that
+// cannot be parsed are ignored.
+func ReadCertificates(path string, opts ...pemutil.Options) ([]*x509.Certificate, error) {
+	blocks, err := readCertificateBlocks(path, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []*x509.Certificate
+	for _, block := range blocks {
+		if crt, err := x509.ParseCertificate(block.Bytes); err == nil {
+			certs = append(certs, crt)
+		}
+	}
+	if len(certs) == 0 {
+		return nil, errors.Errorf("error loading certificates from %s", path)
+	}
+	return certs, nil
+}
+
+// readCertificateBlocks returns the CERTIFICATE PEM blocks in the given
+// path.
+func readCertificateBlocks(path string, opts []pemutil.Options) ([]*pem.Block, error) {
 	info, err := os.Stat(path)
 	if err != nil && !os.IsNotExist(err) {
 		return nil, errors.Wrapf(err, "os.Stat %s failed", path)
 	}
 
-	var (
-		files []string
-		pool  = x509.NewCertPool()
-	)
+	var files []string
 	if info != nil && info.IsDir() {
 		finfos, err := ioutil.ReadDir(path)
 		if err != nil {
@@ -71,12 +207,23 @@ func ReadCertPool(path string) (*x509.CertPool, error) {
 		}
 	}
 
-	var pems []byte
+	var blocks []*pem.Block
 	for _, f := range files {
 		bytes, err := ioutil.ReadFile(f)
 		if err != nil {
 			return nil, errs.FileError(err, f)
 		}
+		// Only the trusted certificates of Java truststores are used.
+		if pemutil.IsJKS(bytes) {
+			certs, err := pemutil.DecodeJKSCertificates(bytes, append([]pemutil.Options{pemutil.WithFilename(f)}, opts...)...)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error reading %s", f)
+			}
+			for _, crt := range certs {
+				blocks = append(blocks, &pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw})
+			}
+			continue
+		}
 		for len(bytes) > 0 {
 			var block *pem.Block
 			block, bytes = pem.Decode(bytes)
@@ -88,11 +235,8 @@ func ReadCertPool(path string) (*x509.CertPool, error) {
 			if block.Type != "CERTIFICATE" {
 				continue
 			}
-			pems = append(pems, pem.EncodeToMemory(block)...)
+			blocks = append(blocks, block)
 		}
 	}
-	if ok := pool.AppendCertsFromPEM(pems); !ok {
-		return nil, errors.Errorf("error loading Root certificates")
-	}
-	return pool, nil
+	return blocks, nil
 }
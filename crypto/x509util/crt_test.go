@@ -1,13 +1,23 @@
 package x509util
 
 import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
 	"io/ioutil"
 	"net"
+	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/pkg/errors"
 	"github.com/smallstep/assert"
+	"github.com/smallstep/cli/crypto/pemutil"
 )
 
 func TestFingerprint(t *testing.T) {
@@ -89,3 +99,149 @@ func TestSplitSANs(t *testing.T) {
 		})
 	}
 }
+
+func TestSplitSANsWithURIs(t *testing.T) {
+	mustParse := func(s string) *url.URL {
+		u, err := url.Parse(s)
+		assert.FatalError(t, err)
+		return u
+	}
+	tests := []struct {
+		name              string
+		sans, dns, emails []string
+		ips               []net.IP
+		uris              []*url.URL
+	}{
+		{name: "empty", sans: []string{}, dns: []string{}, ips: []net.IP{}, emails: []string{}, uris: []*url.URL{}},
+		{
+			name:   "all-dns",
+			sans:   []string{"foo.internal", "bar.internal"},
+			dns:    []string{"foo.internal", "bar.internal"},
+			ips:    []net.IP{},
+			emails: []string{},
+			uris:   []*url.URL{},
+		},
+		{
+			name:   "all-ip",
+			sans:   []string{"0.0.0.0", "127.0.0.1", "::1"},
+			dns:    []string{},
+			ips:    []net.IP{net.ParseIP("0.0.0.0"), net.ParseIP("127.0.0.1"), net.ParseIP("::1")},
+			emails: []string{},
+			uris:   []*url.URL{},
+		},
+		{
+			name:   "all-email",
+			sans:   []string{"max@smallstep.com", "mariano@smallstep.com"},
+			dns:    []string{},
+			ips:    []net.IP{},
+			emails: []string{"max@smallstep.com", "mariano@smallstep.com"},
+			uris:   []*url.URL{},
+		},
+		{
+			name:   "all-uri",
+			sans:   []string{"spiffe://example.org/foo", "https://user@example.com/", "urn:uuid:ddfe62ba-7e99-4bc1-83b3-8f57fe3e9959"},
+			dns:    []string{},
+			ips:    []net.IP{},
+			emails: []string{},
+			uris:   []*url.URL{mustParse("spiffe://example.org/foo"), mustParse("https://user@example.com/"), mustParse("urn:uuid:ddfe62ba-7e99-4bc1-83b3-8f57fe3e9959")},
+		},
+		{
+			name:   "host-port",
+			sans:   []string{"host:8443", "localhost:1", "example.com:443"},
+			dns:    []string{"host:8443", "localhost:1", "example.com:443"},
+			ips:    []net.IP{},
+			emails: []string{},
+			uris:   []*url.URL{},
+		},
+		{
+			name:   "mix",
+			sans:   []string{"foo.internal", "max@smallstep.com", "mariano@smallstep.com", "1.1.1.1", "bar.internal", "spiffe://example.org/foo"},
+			dns:    []string{"foo.internal", "bar.internal"},
+			ips:    []net.IP{net.ParseIP("1.1.1.1")},
+			emails: []string{"max@smallstep.com", "mariano@smallstep.com"},
+			uris:   []*url.URL{mustParse("spiffe://example.org/foo")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dns, ips, emails, uris := SplitSANsWithURIs(tt.sans)
+			assert.Equals(t, dns, tt.dns)
+			assert.Equals(t, ips, tt.ips)
+			assert.Equals(t, emails, tt.emails)
+			assert.Equals(t, uris, tt.uris)
+		})
+	}
+}
+
+func TestPublicKeyString(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.FatalError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.FatalError(t, err)
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name string
+		pub  interface{}
+		want string
+	}{
+		{"rsa", rsaKey.Public(), "RSA 1024"},
+		{"ecdsa", ecKey.Public(), "ECDSA P-384"},
+		{"ed25519", edPub, "Ed25519"},
+		{"unknown", "foo", "unknown string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equals(t, tt.want, PublicKeyString(tt.pub))
+		})
+	}
+}
+
+func TestSANs(t *testing.T) {
+	u, err := url.Parse("spiffe://example.org/foo")
+	assert.FatalError(t, err)
+	crt := &x509.Certificate{
+		DNSNames:       []string{"example.com"},
+		IPAddresses:    []net.IP{net.ParseIP("127.0.0.1")},
+		EmailAddresses: []string{"jane@example.com"},
+		URIs:           []*url.URL{u},
+	}
+	assert.Equals(t, []string{"example.com", "127.0.0.1", "jane@example.com", "spiffe://example.org/foo"}, SANs(crt))
+	assert.Len(t, 0, SANs(&x509.Certificate{}))
+
+	csr := &x509.CertificateRequest{
+		DNSNames:       crt.DNSNames,
+		IPAddresses:    crt.IPAddresses,
+		EmailAddresses: crt.EmailAddresses,
+		URIs:           crt.URIs,
+	}
+	assert.Equals(t, SANs(crt), CSRSANs(csr))
+	assert.Len(t, 0, CSRSANs(&x509.CertificateRequest{}))
+}
+
+func TestReadCertPool(t *testing.T) {
+	ca := mustParseCertificate(t, "test_files/ca.crt")
+	b, err := pemutil.EncodeJKS(nil, ca, nil, []byte("changeit"), nil)
+	assert.FatalError(t, err)
+	dir, err := ioutil.TempDir("", "x509util")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+	truststore := filepath.Join(dir, "truststore.jks")
+	assert.FatalError(t, ioutil.WriteFile(truststore, b, 0600))
+
+	for _, path := range []string{"test_files/ca.crt", truststore, "test_files/ca.crt," + truststore} {
+		t.Run(path, func(t *testing.T) {
+			pool, err := ReadCertPool(path, pemutil.WithPassword([]byte("changeit")))
+			assert.FatalError(t, err)
+			assert.Equals(t, [][]byte{ca.RawSubject}, pool.Subjects()[:1])
+		})
+	}
+
+	// The integrity of the truststore is verified.
+	_, err = ReadCertPool(truststore, pemutil.WithPassword([]byte("foobar")))
+	assert.Equals(t, pemutil.ErrJKSIncorrectPassword, errors.Cause(err))
+
+	_, err = ReadCertPool("test_files/ca.key")
+	assert.Error(t, err)
+}
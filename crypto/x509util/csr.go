@@ -1,8 +1,15 @@
 package x509util
 
 import (
+	"crypto"
+	"crypto/rand"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
 	"encoding/pem"
+	"strconv"
+	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -19,3 +26,394 @@ func LoadCSRFromBytes(der []byte) (*x509.CertificateRequest, error) {
 	}
 	return csr, nil
 }
+
+var (
+	oidExtensionSubjectKeyID     = asn1.ObjectIdentifier{2, 5, 29, 14}
+	oidExtensionKeyUsage         = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtensionSubjectAltName   = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidExtensionBasicConstraints = asn1.ObjectIdentifier{2, 5, 29, 19}
+
+	// PKCS #9 attributes defined in RFC 2985.
+	oidChallengePassword = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 7}
+	oidUnstructuredName  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 2}
+)
+
+// Modes used to copy the extensions requested in a certificate request to the
+// certificate.
+const (
+	// CopyExtensionsNone ignores the requested extensions, only the subject
+	// alternative names are copied.
+	CopyExtensionsNone = "none"
+	// CopyExtensions copies the requested extensions not already defined in
+	// the certificate, except the basic constraints, name constraints and key
+	// usage.
+	CopyExtensions = "copy"
+	// CopyAllExtensions copies all the requested extensions, replacing the
+	// ones defined in the certificate, except the basic constraints, name
+	// constraints and key usage.
+	CopyAllExtensions = "copyall"
+)
+
+// RequestAttributes are the PKCS #9 attributes that can be added to a
+// certificate request, used by enrollment protocols like SCEP.
+type RequestAttributes struct {
+	ChallengePassword string
+	UnstructuredName  string
+}
+
+// certificateRequest is the ASN.1 structure of a certificate request defined
+// in RFC 2986, the signed content is kept raw to be able to re-sign it.
+type certificateRequest struct {
+	TBSCSR             asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	SignatureValue     asn1.BitString
+}
+
+type tbsCertificateRequest struct {
+	Version       int
+	Subject       asn1.RawValue
+	PublicKey     asn1.RawValue
+	RawAttributes []asn1.RawValue `asn1:"tag:0"`
+}
+
+type requestAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// CreateCertificateRequest creates a new DER encoded certificate request like
+// x509.CreateCertificateRequest, adding the challengePassword and
+// unstructuredName attributes if they are set.
+func CreateCertificateRequest(template *x509.CertificateRequest, attrs RequestAttributes, priv crypto.Signer) ([]byte, error) {
+	// Use the signature algorithm matching the key if none is set.
+	if template.SignatureAlgorithm == x509.UnknownSignatureAlgorithm {
+		tmpl := *template
+		tmpl.SignatureAlgorithm = DefaultSignatureAlgorithm(priv)
+		template = &tmpl
+	}
+	if err := CheckSignatureAlgorithm(template.SignatureAlgorithm, priv); err != nil {
+		return nil, err
+	}
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, priv)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating certificate request")
+	}
+	if attrs.ChallengePassword == "" && attrs.UnstructuredName == "" {
+		return der, nil
+	}
+
+	// Add the attributes and sign the request again.
+	var csr certificateRequest
+	if _, err := asn1.Unmarshal(der, &csr); err != nil {
+		return nil, errors.Wrap(err, "error parsing certificate request")
+	}
+	var tbs tbsCertificateRequest
+	if _, err := asn1.Unmarshal(csr.TBSCSR.FullBytes, &tbs); err != nil {
+		return nil, errors.Wrap(err, "error parsing certificate request")
+	}
+	for _, attr := range []struct {
+		oid   asn1.ObjectIdentifier
+		value string
+	}{
+		{oidChallengePassword, attrs.ChallengePassword},
+		{oidUnstructuredName, attrs.UnstructuredName},
+	} {
+		if attr.value == "" {
+			continue
+		}
+		raw, err := marshalRequestAttribute(attr.oid, attr.value)
+		if err != nil {
+			return nil, err
+		}
+		tbs.RawAttributes = append(tbs.RawAttributes, raw)
+	}
+	tbsBytes, err := asn1.Marshal(tbs)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling certificate request")
+	}
+
+	parsed, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing certificate request")
+	}
+	signature, err := signData(priv, parsed.SignatureAlgorithm, tbsBytes)
+	if err != nil {
+		return nil, err
+	}
+	b, err := asn1.Marshal(certificateRequest{
+		TBSCSR:             asn1.RawValue{FullBytes: tbsBytes},
+		SignatureAlgorithm: csr.SignatureAlgorithm,
+		SignatureValue:     asn1.BitString{Bytes: signature, BitLength: len(signature) * 8},
+	})
+	return b, errors.Wrap(err, "error marshaling certificate request")
+}
+
+// marshalRequestAttribute returns the attribute with the given string value.
+// Printable strings are encoded as PrintableString and the rest as
+// UTF8String.
+func marshalRequestAttribute(oid asn1.ObjectIdentifier, value string) (asn1.RawValue, error) {
+	params := "utf8"
+	if isPrintable(value) {
+		params = "printable"
+	}
+	v, err := asn1.MarshalWithParams(value, params)
+	if err != nil {
+		return asn1.RawValue{}, errors.Wrap(err, "error marshaling attribute")
+	}
+	b, err := asn1.Marshal(requestAttribute{Type: oid, Values: []asn1.RawValue{{FullBytes: v}}})
+	if err != nil {
+		return asn1.RawValue{}, errors.Wrap(err, "error marshaling attribute")
+	}
+	return asn1.RawValue{FullBytes: b}, nil
+}
+
+// isPrintable returns true if the string only contains characters allowed in
+// an ASN.1 PrintableString.
+func isPrintable(s string) bool {
+	for _, c := range s {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.ContainsRune(" '()+,-./:=?", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ParseRequestAttributes returns the challengePassword and unstructuredName
+// attributes of a certificate request.
+func ParseRequestAttributes(csr *x509.CertificateRequest) (RequestAttributes, error) {
+	var attrs RequestAttributes
+	var tbs tbsCertificateRequest
+	if _, err := asn1.Unmarshal(csr.RawTBSCertificateRequest, &tbs); err != nil {
+		return attrs, errors.Wrap(err, "error parsing certificate request")
+	}
+	for _, raw := range tbs.RawAttributes {
+		var attr requestAttribute
+		if _, err := asn1.Unmarshal(raw.FullBytes, &attr); err != nil {
+			return attrs, errors.Wrap(err, "error parsing certificate request attribute")
+		}
+		var dst *string
+		switch {
+		case attr.Type.Equal(oidChallengePassword):
+			dst = &attrs.ChallengePassword
+		case attr.Type.Equal(oidUnstructuredName):
+			dst = &attrs.UnstructuredName
+		default:
+			continue
+		}
+		if len(attr.Values) != 1 {
+			return attrs, errors.Errorf("error parsing certificate request attribute %s: invalid number of values", attr.Type)
+		}
+		if _, err := asn1.Unmarshal(attr.Values[0].FullBytes, dst); err != nil {
+			return attrs, errors.Wrapf(err, "error parsing certificate request attribute %s", attr.Type)
+		}
+	}
+	return attrs, nil
+}
+
+// NewKeyUsageExtension returns a critical key usage extension with the given
+// usages, e.g. digitalSignature or key-encipherment.
+func NewKeyUsageExtension(names []string) (pkix.Extension, error) {
+	ku, err := parseKeyUsage(names)
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+	var a [2]byte
+	a[0] = reverseBits(byte(ku))
+	a[1] = reverseBits(byte(ku >> 8))
+	n := 1
+	if a[1] != 0 {
+		n = 2
+	}
+	bitLength := n * 8
+	for bitLength > 0 && a[(bitLength-1)/8]&(1<<uint(7-(bitLength-1)%8)) == 0 {
+		bitLength--
+	}
+	b, err := asn1.Marshal(asn1.BitString{Bytes: a[:n], BitLength: bitLength})
+	if err != nil {
+		return pkix.Extension{}, errors.Wrap(err, "error marshaling key usage extension")
+	}
+	return pkix.Extension{Id: oidExtensionKeyUsage, Critical: true, Value: b}, nil
+}
+
+// reverseBits returns the byte with the bits in the reverse order, the bit 0
+// of the key usage is the most significant bit in the bit string.
+func reverseBits(b byte) byte {
+	var r byte
+	for i := 0; i < 8; i++ {
+		r = r<<1 | b&1
+		b >>= 1
+	}
+	return r
+}
+
+// NewExtKeyUsageExtension returns an extended key usage extension with the
+// given usages. The values can be names, e.g. serverAuth or code-signing, or
+// object identifiers in the dotted notation.
+func NewExtKeyUsageExtension(names []string) (pkix.Extension, error) {
+	ekus, oids, err := parseExtKeyUsages(names)
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+	return marshalExtKeyUsage(ekus, oids)
+}
+
+// NewBasicConstraintsExtension returns a critical basic constraints
+// extension. The path length is only used in certificate authorities, a
+// negative value means that the path length is not constrained.
+func NewBasicConstraintsExtension(isCA bool, maxPathLen int) (pkix.Extension, error) {
+	bc := struct {
+		IsCA       bool `asn1:"optional"`
+		MaxPathLen int  `asn1:"optional,default:-1"`
+	}{IsCA: isCA, MaxPathLen: -1}
+	if isCA && maxPathLen >= 0 {
+		bc.MaxPathLen = maxPathLen
+	}
+	b, err := asn1.Marshal(bc)
+	if err != nil {
+		return pkix.Extension{}, errors.Wrap(err, "error marshaling basic constraints extension")
+	}
+	return pkix.Extension{Id: oidExtensionBasicConstraints, Critical: true, Value: b}, nil
+}
+
+// ParseBasicConstraints parses basic constraints in the format used by
+// OpenSSL, e.g. "CA:TRUE", "CA:TRUE,pathlen:0" or "CA:FALSE", and returns the
+// extension.
+func ParseBasicConstraints(s string) (pkix.Extension, error) {
+	isCA, maxPathLen := false, -1
+	for i, part := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), ":", 2)
+		if len(kv) != 2 {
+			return pkix.Extension{}, errors.Errorf("invalid basic constraints '%s'", s)
+		}
+		key, value := strings.ToLower(kv[0]), strings.TrimSpace(kv[1])
+		switch {
+		case i == 0 && key == "ca" && strings.EqualFold(value, "true"):
+			isCA = true
+		case i == 0 && key == "ca" && strings.EqualFold(value, "false"):
+		case i == 1 && key == "pathlen" && isCA:
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return pkix.Extension{}, errors.Errorf("invalid basic constraints '%s'", s)
+			}
+			maxPathLen = n
+		default:
+			return pkix.Extension{}, errors.Errorf("invalid basic constraints '%s'", s)
+		}
+	}
+	return NewBasicConstraintsExtension(isCA, maxPathLen)
+}
+
+// ParseExtension parses an extension in the format <oid>=[critical,]<value>,
+// where the value is the base64 encoding of the DER-encoded extension value,
+// e.g. "1.2.3.4=critical,DAVoZWxsbw==".
+func ParseExtension(s string) (pkix.Extension, error) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 {
+		return pkix.Extension{}, errors.Errorf("invalid extension '%s': the format is <oid>=[critical,]<value>", s)
+	}
+	oid, err := parseObjectIdentifier(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return pkix.Extension{}, errors.Wrapf(err, "invalid extension '%s'", s)
+	}
+	value := strings.TrimSpace(parts[1])
+	ext := pkix.Extension{Id: oid}
+	if strings.HasPrefix(value, "critical,") {
+		ext.Critical = true
+		value = strings.TrimPrefix(value, "critical,")
+	}
+	if ext.Value, err = base64.StdEncoding.DecodeString(value); err != nil {
+		return pkix.Extension{}, errors.Errorf("invalid extension '%s': the value is not valid base64", s)
+	}
+	var v asn1.RawValue
+	if rest, err := asn1.Unmarshal(ext.Value, &v); err != nil || len(rest) > 0 {
+		return pkix.Extension{}, errors.Errorf("invalid extension '%s': the value is not valid DER", s)
+	}
+	return ext, nil
+}
+
+// WithRequestedExtensions returns a Profile modifier that copies the
+// extensions requested in the certificate request to the certificate using
+// the given mode: CopyExtensionsNone, CopyExtensions or CopyAllExtensions.
+// The subject alternative names are always copied by NewLeafProfileWithCSR,
+// and the key identifiers are always set by the issuer. The basic
+// constraints, name constraints and key usage are never copied, a certificate
+// request cannot turn the certificate into a certificate authority. Neither
+// are the CRL distribution points and the authority information access, they
+// are defined by the issuer.
+func WithRequestedExtensions(csr *x509.CertificateRequest, mode string) WithOption {
+	return func(p Profile) error {
+		switch mode {
+		case "", CopyExtensionsNone:
+			return nil
+		case CopyExtensions, CopyAllExtensions:
+		default:
+			return errors.Errorf("unsupported copy extensions mode '%s'", mode)
+		}
+
+		crt := p.Subject()
+		for _, ext := range csr.Extensions {
+			switch {
+			case ext.Id.Equal(oidExtensionSubjectAltName), ext.Id.Equal(oidExtensionSubjectKeyID),
+				ext.Id.Equal(oidExtensionAuthorityKeyID):
+				continue
+			case ext.Id.Equal(oidExtensionBasicConstraints), ext.Id.Equal(oidExtensionNameConstraints),
+				ext.Id.Equal(oidExtensionKeyUsage):
+				continue
+			case ext.Id.Equal(oidExtensionCRLDistributionPoints), ext.Id.Equal(oidExtensionAuthorityInfoAccess):
+				continue
+			case mode == CopyExtensions && hasExtension(crt, ext.Id):
+				continue
+			}
+			p.RemoveExtension(ext.Id)
+			crt.ExtraExtensions = append(crt.ExtraExtensions, ext)
+		}
+		return nil
+	}
+}
+
+// hasExtension returns true if the certificate template defines the
+// extension with the given object identifier, using the certificate fields or
+// the extra extensions.
+func hasExtension(crt *x509.Certificate, oid asn1.ObjectIdentifier) bool {
+	switch {
+	case oid.Equal(oidExtensionKeyUsage):
+		return crt.KeyUsage != 0
+	case oid.Equal(oidExtensionExtendedKeyUsage):
+		return len(crt.ExtKeyUsage) > 0 || len(crt.UnknownExtKeyUsage) > 0
+	case oid.Equal(oidExtensionBasicConstraints):
+		return crt.BasicConstraintsValid
+	case oid.Equal(oidExtensionSubjectKeyID):
+		if len(crt.SubjectKeyId) > 0 {
+			return true
+		}
+	case oid.Equal(oidExtensionNameConstraints):
+		if len(crt.PermittedDNSDomains) > 0 || len(crt.ExcludedDNSDomains) > 0 ||
+			len(crt.PermittedIPRanges) > 0 || len(crt.ExcludedIPRanges) > 0 ||
+			len(crt.PermittedEmailAddresses) > 0 || len(crt.ExcludedEmailAddresses) > 0 ||
+			len(crt.PermittedURIDomains) > 0 || len(crt.ExcludedURIDomains) > 0 {
+			return true
+		}
+	case oid.Equal(oidExtensionCertificatePolicies):
+		if len(crt.PolicyIdentifiers) > 0 {
+			return true
+		}
+	case oid.Equal(oidExtensionCRLDistributionPoints):
+		if len(crt.CRLDistributionPoints) > 0 {
+			return true
+		}
+	case oid.Equal(oidExtensionAuthorityInfoAccess):
+		if len(crt.OCSPServer) > 0 || len(crt.IssuingCertificateURL) > 0 {
+			return true
+		}
+	}
+	for _, e := range crt.ExtraExtensions {
+		if e.Id.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
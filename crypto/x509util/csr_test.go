@@ -1,10 +1,12 @@
 package x509util
 
 import (
+	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
 	"testing"
 
@@ -76,3 +78,295 @@ func TestCSR_LoadCSRFromBytes(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateCertificateRequest(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   crypto.Signer
+		alg   x509.SignatureAlgorithm
+		attrs RequestAttributes
+	}{
+		{"ec no attributes", mustGenerateKey(t, "EC", "P-256", 0), 0, RequestAttributes{}},
+		{"ec", mustGenerateKey(t, "EC", "P-384", 0), 0, RequestAttributes{ChallengePassword: "secret", UnstructuredName: "device-01"}},
+		{"rsa pss", mustGenerateKey(t, "RSA", "", 2048), x509.SHA256WithRSAPSS, RequestAttributes{ChallengePassword: "pässword"}},
+		{"ed25519", mustGenerateKey(t, "OKP", "Ed25519", 0), 0, RequestAttributes{UnstructuredName: "device-02"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ext, err := NewBasicConstraintsExtension(false, -1)
+			assert.FatalError(t, err)
+			der, err := CreateCertificateRequest(&x509.CertificateRequest{
+				Subject:            pkix.Name{CommonName: "foo"},
+				DNSNames:           []string{"foo.example.com"},
+				ExtraExtensions:    []pkix.Extension{ext},
+				SignatureAlgorithm: tt.alg,
+			}, tt.attrs, tt.key)
+			assert.FatalError(t, err)
+			csr, err := x509.ParseCertificateRequest(der)
+			assert.FatalError(t, err)
+			assert.FatalError(t, csr.CheckSignature())
+			assert.Equals(t, "foo", csr.Subject.CommonName)
+			assert.Equals(t, []string{"foo.example.com"}, csr.DNSNames)
+			assert.True(t, hasRequestedExtension(csr, oidExtensionBasicConstraints))
+
+			attrs, err := ParseRequestAttributes(csr)
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.attrs, attrs)
+		})
+	}
+}
+
+func hasRequestedExtension(csr *x509.CertificateRequest, oid asn1.ObjectIdentifier) bool {
+	for _, ext := range csr.Extensions {
+		if ext.Id.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestParseBasicConstraints(t *testing.T) {
+	tests := []struct {
+		value      string
+		isCA       bool
+		maxPathLen int
+		wantErr    bool
+	}{
+		{"CA:FALSE", false, -1, false},
+		{"CA:TRUE", true, -1, false},
+		{"ca:true, pathlen:0", true, 0, false},
+		{"CA:TRUE,pathlen:2", true, 2, false},
+		{"CA:FALSE,pathlen:2", false, 0, true},
+		{"CA:TRUE,pathlen:-1", false, 0, true},
+		{"CA:yes", false, 0, true},
+		{"pathlen:1", false, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			ext, err := ParseBasicConstraints(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.FatalError(t, err)
+			assert.True(t, ext.Critical)
+			crt := mustCertificateWithExtension(t, ext)
+			assert.True(t, crt.BasicConstraintsValid)
+			assert.Equals(t, tt.isCA, crt.IsCA)
+			if tt.isCA {
+				assert.Equals(t, tt.maxPathLen, crt.MaxPathLen)
+				assert.Equals(t, tt.maxPathLen == 0, crt.MaxPathLenZero)
+			}
+		})
+	}
+}
+
+func TestNewKeyUsageExtension(t *testing.T) {
+	tests := []struct {
+		names []string
+		want  x509.KeyUsage
+	}{
+		{[]string{"digitalSignature"}, x509.KeyUsageDigitalSignature},
+		{[]string{"digital-signature", "keyEncipherment"}, x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment},
+		{[]string{"certSign", "crlSign"}, x509.KeyUsageCertSign | x509.KeyUsageCRLSign},
+		{[]string{"keyAgreement", "decipherOnly"}, x509.KeyUsageKeyAgreement | x509.KeyUsageDecipherOnly},
+	}
+	for _, tt := range tests {
+		ext, err := NewKeyUsageExtension(tt.names)
+		assert.FatalError(t, err)
+		assert.True(t, ext.Critical)
+		assert.Equals(t, tt.want, mustCertificateWithExtension(t, ext).KeyUsage)
+	}
+	_, err := NewKeyUsageExtension([]string{"foo"})
+	assert.Error(t, err)
+
+	ext, err := NewExtKeyUsageExtension([]string{"serverAuth", "1.3.6.1.5.5.7.3.17"})
+	assert.FatalError(t, err)
+	crt := mustCertificateWithExtension(t, ext)
+	assert.Equals(t, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, crt.ExtKeyUsage)
+	assert.Equals(t, []asn1.ObjectIdentifier{{1, 3, 6, 1, 5, 5, 7, 3, 17}}, crt.UnknownExtKeyUsage)
+}
+
+func TestParseExtension(t *testing.T) {
+	ext, err := ParseExtension("1.2.3.4=critical,DAVoZWxsbw==")
+	assert.FatalError(t, err)
+	assert.Equals(t, pkix.Extension{Id: asn1.ObjectIdentifier{1, 2, 3, 4}, Critical: true, Value: []byte("\x0c\x05hello")}, ext)
+
+	ext, err = ParseExtension("1.2.3.4=DAVoZWxsbw==")
+	assert.FatalError(t, err)
+	assert.False(t, ext.Critical)
+
+	for _, s := range []string{"1.2.3.4", "foo=DAVoZWxsbw==", "1.2.3.4=not-base64", "1.2.3.4=aGVsbG8="} {
+		_, err := ParseExtension(s)
+		assert.Error(t, err)
+	}
+}
+
+// mustCertificateWithExtension returns a self-signed certificate with the
+// given extension parsed by the standard library.
+func mustCertificateWithExtension(t *testing.T, ext pkix.Extension) *x509.Certificate {
+	t.Helper()
+	p, err := NewRootProfile("Test", WithKeyUsage(nil), func(p Profile) error {
+		crt := p.Subject()
+		crt.BasicConstraintsValid = false
+		crt.ExtraExtensions = []pkix.Extension{ext}
+		return nil
+	})
+	assert.FatalError(t, err)
+	b, err := p.CreateCertificate()
+	assert.FatalError(t, err)
+	crt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+	return crt
+}
+
+func TestWithRequestedExtensions(t *testing.T) {
+	iss, err := NewRootProfile("Test Root")
+	assert.FatalError(t, err)
+	b, err := iss.CreateCertificate()
+	assert.FatalError(t, err)
+	issCrt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+
+	// The request asks for a certificate authority.
+	key := mustGenerateKey(t, "EC", "P-256", 0)
+	ku, err := NewKeyUsageExtension([]string{"certSign", "crlSign"})
+	assert.FatalError(t, err)
+	bc, err := NewBasicConstraintsExtension(true, 0)
+	assert.FatalError(t, err)
+	eku, err := NewExtKeyUsageExtension([]string{"clientAuth"})
+	assert.FatalError(t, err)
+	custom, err := ParseExtension("1.2.3.4=DAVoZWxsbw==")
+	assert.FatalError(t, err)
+	der, err := CreateCertificateRequest(&x509.CertificateRequest{
+		Subject:         pkix.Name{CommonName: "foo"},
+		DNSNames:        []string{"foo.example.com"},
+		ExtraExtensions: []pkix.Extension{ku, bc, eku, custom},
+	}, RequestAttributes{}, key)
+	assert.FatalError(t, err)
+	csr, err := x509.ParseCertificateRequest(der)
+	assert.FatalError(t, err)
+
+	defaultEKU := []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	tests := []struct {
+		mode    string
+		eku     []x509.ExtKeyUsage
+		custom  bool
+		wantErr bool
+	}{
+		{CopyExtensionsNone, defaultEKU, false, false},
+		{CopyExtensions, defaultEKU, true, false},
+		{CopyAllExtensions, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, true, false},
+		{"foo", nil, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			p, err := NewLeafProfileWithCSR(csr, issCrt, iss.SubjectPrivateKey(), WithRequestedExtensions(csr, tt.mode))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.FatalError(t, err)
+			b, err := p.CreateCertificate()
+			assert.FatalError(t, err)
+			crt, err := x509.ParseCertificate(b)
+			assert.FatalError(t, err)
+			assert.Equals(t, []string{"foo.example.com"}, crt.DNSNames)
+			assert.Equals(t, x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment, crt.KeyUsage)
+			assert.Equals(t, tt.eku, crt.ExtKeyUsage)
+			assert.False(t, crt.IsCA)
+			assert.False(t, crt.BasicConstraintsValid)
+			var hasCustom bool
+			for _, ext := range crt.Extensions {
+				if ext.Id.Equal(custom.Id) {
+					hasCustom = true
+				}
+			}
+			assert.Equals(t, tt.custom, hasCustom)
+			assert.FatalError(t, crt.CheckSignatureFrom(issCrt))
+		})
+	}
+}
+
+func TestWithRequestedExtensions_issuerExtensions(t *testing.T) {
+	iss, err := NewRootProfile("Test Root")
+	assert.FatalError(t, err)
+	b, err := iss.CreateCertificate()
+	assert.FatalError(t, err)
+	issCrt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+
+	// Get the extensions requested in the certificate request from a
+	// certificate with the same fields.
+	requested, err := NewRootProfile("Requested", func(p Profile) error {
+		crt := p.Subject()
+		crt.CRLDistributionPoints = []string{"http://evil.example.com/crl"}
+		crt.OCSPServer = []string{"http://evil.example.com/ocsp"}
+		crt.PolicyIdentifiers = []asn1.ObjectIdentifier{{1, 2, 3, 4}}
+		return nil
+	})
+	assert.FatalError(t, err)
+	b, err = requested.CreateCertificate()
+	assert.FatalError(t, err)
+	requestedCrt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+	var exts []pkix.Extension
+	for _, ext := range requestedCrt.Extensions {
+		switch {
+		case ext.Id.Equal(oidExtensionCRLDistributionPoints), ext.Id.Equal(oidExtensionAuthorityInfoAccess),
+			ext.Id.Equal(oidExtensionCertificatePolicies):
+			exts = append(exts, ext)
+		}
+	}
+	assert.Len(t, 3, exts)
+
+	key := mustGenerateKey(t, "EC", "P-256", 0)
+	der, err := CreateCertificateRequest(&x509.CertificateRequest{
+		Subject:         pkix.Name{CommonName: "foo"},
+		ExtraExtensions: exts,
+	}, RequestAttributes{}, key)
+	assert.FatalError(t, err)
+	csr, err := x509.ParseCertificateRequest(der)
+	assert.FatalError(t, err)
+
+	withIssuerExtensions := func(p Profile) error {
+		crt := p.Subject()
+		crt.CRLDistributionPoints = []string{"http://ca.example.com/crl"}
+		crt.OCSPServer = []string{"http://ca.example.com/ocsp"}
+		crt.IssuingCertificateURL = []string{"http://ca.example.com/ca.crt"}
+		crt.PolicyIdentifiers = []asn1.ObjectIdentifier{{2, 23, 140, 1, 2, 1}}
+		return nil
+	}
+	noop := func(p Profile) error { return nil }
+
+	tests := []struct {
+		name     string
+		mode     string
+		issuer   WithOption
+		crldp    []string
+		ocsp     []string
+		policies []asn1.ObjectIdentifier
+	}{
+		{"copy", CopyExtensions, withIssuerExtensions,
+			[]string{"http://ca.example.com/crl"}, []string{"http://ca.example.com/ocsp"}, []asn1.ObjectIdentifier{{2, 23, 140, 1, 2, 1}}},
+		{"copyall", CopyAllExtensions, withIssuerExtensions,
+			[]string{"http://ca.example.com/crl"}, []string{"http://ca.example.com/ocsp"}, []asn1.ObjectIdentifier{{1, 2, 3, 4}}},
+		{"copy without issuer extensions", CopyExtensions, noop,
+			nil, nil, []asn1.ObjectIdentifier{{1, 2, 3, 4}}},
+		{"copyall without issuer extensions", CopyAllExtensions, noop,
+			nil, nil, []asn1.ObjectIdentifier{{1, 2, 3, 4}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewLeafProfileWithCSR(csr, issCrt, iss.SubjectPrivateKey(), tt.issuer, WithRequestedExtensions(csr, tt.mode))
+			assert.FatalError(t, err)
+			b, err := p.CreateCertificate()
+			assert.FatalError(t, err)
+			crt, err := x509.ParseCertificate(b)
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.crldp, crt.CRLDistributionPoints)
+			assert.Equals(t, tt.ocsp, crt.OCSPServer)
+			assert.Equals(t, tt.policies, crt.PolicyIdentifiers)
+		})
+	}
+}
@@ -0,0 +1,432 @@
+package x509util
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/errs"
+	"github.com/smallstep/cli/utils"
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/crypto/ocsp"
+)
+
+var (
+	// oidExtensionSCTList is the OID for the embedded signed certificate
+	// timestamp list extension defined in RFC6962.
+	oidExtensionSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+	// oidExtensionOCSPSCTList is the OID for the signed certificate timestamp
+	// list extension in OCSP responses defined in RFC6962.
+	oidExtensionOCSPSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 5}
+)
+
+// Sources of a signed certificate timestamp.
+const (
+	SCTSourceEmbedded = "embedded"
+	SCTSourceTLS      = "tls"
+	SCTSourceOCSP     = "ocsp"
+)
+
+// Values of the digitally-signed struct defined in RFC5246 used in signed
+// certificate timestamps.
+const (
+	sctHashSHA256 = 4
+	sctSigRSA     = 1
+	sctSigECDSA   = 3
+)
+
+// Types of log entries defined in RFC6962.
+const (
+	ctX509Entry    = 0
+	ctPrecertEntry = 1
+)
+
+// SignedCertificateTimestamp is a signed certificate timestamp (SCT) as
+// defined in RFC6962. It is the promise of a certificate transparency log to
+// include a certificate in the log.
+type SignedCertificateTimestamp struct {
+	Version            uint8
+	LogID              [sha256.Size]byte
+	Timestamp          time.Time
+	Extensions         []byte
+	HashAlgorithm      uint8
+	SignatureAlgorithm uint8
+	Signature          []byte
+	// Source is where the SCT was found: embedded in the certificate, in the
+	// TLS extension or in the OCSP response.
+	Source string
+}
+
+// LogIDString returns the log id encoded in base64, the format used by the
+// log lists.
+func (s *SignedCertificateTimestamp) LogIDString() string {
+	return base64.StdEncoding.EncodeToString(s.LogID[:])
+}
+
+// SignatureAlgorithmString returns the name of the signature algorithm of the
+// SCT.
+func (s *SignedCertificateTimestamp) SignatureAlgorithmString() string {
+	var hash, sig string
+	switch s.HashAlgorithm {
+	case sctHashSHA256:
+		hash = "SHA256"
+	default:
+		hash = fmt.Sprintf("hash(%d)", s.HashAlgorithm)
+	}
+	switch s.SignatureAlgorithm {
+	case sctSigRSA:
+		sig = "RSA"
+	case sctSigECDSA:
+		sig = "ECDSA"
+	default:
+		sig = fmt.Sprintf("signature(%d)", s.SignatureAlgorithm)
+	}
+	return sig + "-" + hash
+}
+
+// ParseSCT parses a signed certificate timestamp in the TLS encoding defined
+// in RFC6962.
+func ParseSCT(b []byte) (*SignedCertificateTimestamp, error) {
+	var (
+		sct       SignedCertificateTimestamp
+		logID     []byte
+		timestamp []byte
+		ext, sig  cryptobyte.String
+	)
+	s := cryptobyte.String(b)
+	if !s.ReadUint8(&sct.Version) {
+		return nil, errors.New("error parsing SCT: invalid version")
+	}
+	if sct.Version != 0 {
+		return nil, errors.Errorf("error parsing SCT: unsupported version %d", sct.Version)
+	}
+	if !s.ReadBytes(&logID, sha256.Size) || !s.ReadBytes(&timestamp, 8) ||
+		!s.ReadUint16LengthPrefixed(&ext) || !s.ReadUint8(&sct.HashAlgorithm) ||
+		!s.ReadUint8(&sct.SignatureAlgorithm) || !s.ReadUint16LengthPrefixed(&sig) || !s.Empty() {
+		return nil, errors.New("error parsing SCT: malformed data")
+	}
+	copy(sct.LogID[:], logID)
+	ms := binary.BigEndian.Uint64(timestamp)
+	sct.Timestamp = time.Unix(int64(ms/1000), int64(ms%1000)*int64(time.Millisecond)).UTC()
+	sct.Extensions = []byte(ext)
+	sct.Signature = []byte(sig)
+	return &sct, nil
+}
+
+// ParseSCTList parses a list of signed certificate timestamps in the TLS
+// encoding defined in RFC6962.
+func ParseSCTList(b []byte) ([]*SignedCertificateTimestamp, error) {
+	var list cryptobyte.String
+	s := cryptobyte.String(b)
+	if !s.ReadUint16LengthPrefixed(&list) || !s.Empty() {
+		return nil, errors.New("error parsing SCT list: malformed data")
+	}
+	var scts []*SignedCertificateTimestamp
+	for !list.Empty() {
+		var b cryptobyte.String
+		if !list.ReadUint16LengthPrefixed(&b) {
+			return nil, errors.New("error parsing SCT list: malformed data")
+		}
+		sct, err := ParseSCT(b)
+		if err != nil {
+			return nil, err
+		}
+		scts = append(scts, sct)
+	}
+	return scts, nil
+}
+
+// parseSCTListExtension parses the value of an extension with an SCT list, a
+// DER octet string with the TLS encoded list.
+func parseSCTListExtension(value []byte, source string) ([]*SignedCertificateTimestamp, error) {
+	var b []byte
+	if rest, err := asn1.Unmarshal(value, &b); err != nil || len(rest) > 0 {
+		return nil, errors.New("error parsing SCT list extension: malformed data")
+	}
+	scts, err := ParseSCTList(b)
+	if err != nil {
+		return nil, err
+	}
+	for _, sct := range scts {
+		sct.Source = source
+	}
+	return scts, nil
+}
+
+// CertificateSCTs returns the signed certificate timestamps embedded in the
+// given certificate.
+func CertificateSCTs(crt *x509.Certificate) ([]*SignedCertificateTimestamp, error) {
+	for _, ext := range crt.Extensions {
+		if ext.Id.Equal(oidExtensionSCTList) {
+			return parseSCTListExtension(ext.Value, SCTSourceEmbedded)
+		}
+	}
+	return nil, nil
+}
+
+// TLSSCTs parses the signed certificate timestamps sent in the TLS extension
+// during the handshake.
+func TLSSCTs(list [][]byte) ([]*SignedCertificateTimestamp, error) {
+	var scts []*SignedCertificateTimestamp
+	for _, b := range list {
+		sct, err := ParseSCT(b)
+		if err != nil {
+			return nil, err
+		}
+		sct.Source = SCTSourceTLS
+		scts = append(scts, sct)
+	}
+	return scts, nil
+}
+
+// OCSPResponseSCTs returns the signed certificate timestamps in the single
+// extensions of the given OCSP response.
+func OCSPResponseSCTs(resp *ocsp.Response) ([]*SignedCertificateTimestamp, error) {
+	for _, ext := range resp.Extensions {
+		if ext.Id.Equal(oidExtensionOCSPSCTList) {
+			return parseSCTListExtension(ext.Value, SCTSourceOCSP)
+		}
+	}
+	return nil, nil
+}
+
+// CTLog is a certificate transparency log.
+type CTLog struct {
+	Description string
+	Operator    string
+	URL         string
+	LogID       [sha256.Size]byte
+	Key         crypto.PublicKey
+}
+
+// CTLogList is a list of certificate transparency logs.
+type CTLogList struct {
+	Logs []*CTLog
+}
+
+// Find returns the log with the given id or nil if it's not in the list.
+func (l *CTLogList) Find(logID [sha256.Size]byte) *CTLog {
+	for _, log := range l.Logs {
+		if log.LogID == logID {
+			return log
+		}
+	}
+	return nil
+}
+
+type ctLogJSON struct {
+	Description string `json:"description"`
+	LogID       string `json:"log_id"`
+	Key         string `json:"key"`
+	URL         string `json:"url"`
+}
+
+type ctLogListJSON struct {
+	Operators []struct {
+		Name string      `json:"name"`
+		Logs []ctLogJSON `json:"logs"`
+	} `json:"operators"`
+	Logs []ctLogJSON `json:"logs"`
+}
+
+// ParseCTLogList parses a list of certificate transparency logs in the JSON
+// formats used by the Chrome log lists: the current format with the logs
+// grouped by operator, and the older format with a top level list of logs.
+func ParseCTLogList(b []byte) (*CTLogList, error) {
+	var v ctLogListJSON
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, errors.Wrap(err, "error parsing CT log list")
+	}
+	list := new(CTLogList)
+	for _, op := range v.Operators {
+		for _, l := range op.Logs {
+			log, err := newCTLog(l, op.Name)
+			if err != nil {
+				return nil, err
+			}
+			list.Logs = append(list.Logs, log)
+		}
+	}
+	for _, l := range v.Logs {
+		log, err := newCTLog(l, "")
+		if err != nil {
+			return nil, err
+		}
+		list.Logs = append(list.Logs, log)
+	}
+	if len(list.Logs) == 0 {
+		return nil, errors.New("error parsing CT log list: the list does not contain any log")
+	}
+	return list, nil
+}
+
+// ReadCTLogList reads a list of certificate transparency logs from a file.
+func ReadCTLogList(filename string) (*CTLogList, error) {
+	b, err := utils.ReadFile(filename)
+	if err != nil {
+		return nil, errs.FileError(err, filename)
+	}
+	list, err := ParseCTLogList(b)
+	return list, errors.Wrapf(err, "error reading %s", filename)
+}
+
+func newCTLog(l ctLogJSON, operator string) (*CTLog, error) {
+	der, err := base64.StdEncoding.DecodeString(l.Key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing CT log list: invalid key for log '%s'", l.Description)
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing CT log list: invalid key for log '%s'", l.Description)
+	}
+	log := &CTLog{
+		Description: l.Description,
+		Operator:    operator,
+		URL:         l.URL,
+		Key:         key,
+		LogID:       sha256.Sum256(der),
+	}
+	if l.LogID != "" {
+		id, err := base64.StdEncoding.DecodeString(l.LogID)
+		if err != nil || len(id) != sha256.Size || !bytes.Equal(id, log.LogID[:]) {
+			return nil, errors.Errorf("error parsing CT log list: invalid log id for log '%s'", l.Description)
+		}
+	}
+	return log, nil
+}
+
+// VerifySCT verifies the signature of the signed certificate timestamp using
+// the key of the given log. Embedded SCTs are signed over the precertificate,
+// and the issuer of the certificate is required to verify them.
+func VerifySCT(sct *SignedCertificateTimestamp, log *CTLog, crt, issuer *x509.Certificate) error {
+	if sct.LogID != log.LogID {
+		return errors.New("error verifying SCT: log id does not match")
+	}
+	if sct.HashAlgorithm != sctHashSHA256 {
+		return errors.Errorf("error verifying SCT: unsupported signature algorithm %s", sct.SignatureAlgorithmString())
+	}
+
+	data, err := sctSignedData(sct, crt, issuer)
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(data)
+
+	switch key := log.Key.(type) {
+	case *ecdsa.PublicKey:
+		if sct.SignatureAlgorithm != sctSigECDSA {
+			return errors.Errorf("error verifying SCT: signature algorithm %s does not match the log key", sct.SignatureAlgorithmString())
+		}
+		var sig struct {
+			R, S *big.Int
+		}
+		if rest, err := asn1.Unmarshal(sct.Signature, &sig); err != nil || len(rest) > 0 {
+			return errors.New("error verifying SCT: malformed signature")
+		}
+		if !ecdsa.Verify(key, hash[:], sig.R, sig.S) {
+			return errors.New("error verifying SCT: invalid signature")
+		}
+	case *rsa.PublicKey:
+		if sct.SignatureAlgorithm != sctSigRSA {
+			return errors.Errorf("error verifying SCT: signature algorithm %s does not match the log key", sct.SignatureAlgorithmString())
+		}
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], sct.Signature); err != nil {
+			return errors.New("error verifying SCT: invalid signature")
+		}
+	default:
+		return errors.Errorf("error verifying SCT: unsupported log key type %T", key)
+	}
+	return nil
+}
+
+// sctSignedData returns the data signed by the log as defined in section 3.2
+// of RFC6962.
+func sctSignedData(sct *SignedCertificateTimestamp, crt, issuer *x509.Certificate) ([]byte, error) {
+	var timestamp [8]byte
+	binary.BigEndian.PutUint64(timestamp[:], uint64(sct.Timestamp.UnixNano()/int64(time.Millisecond)))
+
+	var b cryptobyte.Builder
+	b.AddUint8(sct.Version)
+	b.AddUint8(0) // certificate_timestamp
+	b.AddBytes(timestamp[:])
+	if sct.Source == SCTSourceEmbedded {
+		if issuer == nil {
+			return nil, errors.New("error verifying SCT: the issuer is required to verify embedded SCTs")
+		}
+		tbs, err := removeTBSExtension(crt.RawTBSCertificate, oidExtensionSCTList)
+		if err != nil {
+			return nil, err
+		}
+		issuerKeyHash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+		b.AddUint16(ctPrecertEntry)
+		b.AddBytes(issuerKeyHash[:])
+		b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes(tbs)
+		})
+	} else {
+		b.AddUint16(ctX509Entry)
+		b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes(crt.Raw)
+		})
+	}
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(sct.Extensions)
+	})
+	data, err := b.Bytes()
+	return data, errors.Wrap(err, "error verifying SCT")
+}
+
+// tbsCertificate is used to remove an extension from a TBSCertificate keeping
+// the rest of the fields as they are.
+type tbsCertificate struct {
+	Raw                asn1.RawContent
+	Version            int `asn1:"optional,explicit,default:0,tag:0"`
+	SerialNumber       asn1.RawValue
+	SignatureAlgorithm asn1.RawValue
+	Issuer             asn1.RawValue
+	Validity           asn1.RawValue
+	Subject            asn1.RawValue
+	PublicKey          asn1.RawValue
+	IssuerUniqueID     asn1.RawValue   `asn1:"optional,tag:1"`
+	SubjectUniqueID    asn1.RawValue   `asn1:"optional,tag:2"`
+	Extensions         []asn1.RawValue `asn1:"optional,explicit,tag:3"`
+}
+
+// removeTBSExtension returns the DER encoding of the given TBSCertificate
+// without the extension with the given oid.
+func removeTBSExtension(der []byte, oid asn1.ObjectIdentifier) ([]byte, error) {
+	var tbs tbsCertificate
+	if rest, err := asn1.Unmarshal(der, &tbs); err != nil || len(rest) > 0 {
+		return nil, errors.New("error parsing certificate: malformed TBSCertificate")
+	}
+	exts := tbs.Extensions[:0]
+	for _, ext := range tbs.Extensions {
+		var e pkix.Extension
+		if _, err := asn1.Unmarshal(ext.FullBytes, &e); err != nil {
+			return nil, errors.New("error parsing certificate: malformed extension")
+		}
+		if !e.Id.Equal(oid) {
+			exts = append(exts, ext)
+		}
+	}
+	if len(exts) == 0 {
+		exts = nil
+	}
+	tbs.Raw = nil
+	tbs.Extensions = exts
+	b, err := asn1.Marshal(tbs)
+	return b, errors.Wrap(err, "error marshaling TBSCertificate")
+}
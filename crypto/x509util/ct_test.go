@@ -0,0 +1,232 @@
+package x509util
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	ct "github.com/google/certificate-transparency-go"
+	cttestdata "github.com/google/certificate-transparency-go/testdata"
+	cttls "github.com/google/certificate-transparency-go/tls"
+	ctx509 "github.com/google/certificate-transparency-go/x509"
+	"github.com/smallstep/assert"
+	"github.com/smallstep/cli/crypto/pemutil"
+)
+
+// testCTLog is a certificate transparency log used to sign test SCTs.
+type testCTLog struct {
+	signer crypto.Signer
+	log    *CTLog
+	der    []byte
+}
+
+func newTestCTLog(t *testing.T, signer crypto.Signer) *testCTLog {
+	der, err := x509.MarshalPKIXPublicKey(signer.Public())
+	assert.FatalError(t, err)
+	return &testCTLog{
+		signer: signer,
+		der:    der,
+		log:    &CTLog{Description: "test", LogID: sha256.Sum256(der), Key: signer.Public()},
+	}
+}
+
+// sign returns a TLS encoded SCT for the given certificate. If an issuer is
+// given the SCT is signed over the precertificate entry, as embedded SCTs are,
+// otherwise it is signed over the certificate, as SCTs sent in the TLS
+// extension are. The encoding is done by certificate-transparency-go, so it
+// does not depend on sctSignedData.
+func (l *testCTLog) sign(t *testing.T, crt, issuer *x509.Certificate) []byte {
+	sct := ct.SignedCertificateTimestamp{
+		SCTVersion: ct.V1,
+		LogID:      ct.LogID{KeyID: l.log.LogID},
+		Timestamp:  uint64(time.Now().UnixNano() / int64(time.Millisecond)),
+	}
+	entry := &ct.TimestampedEntry{Timestamp: sct.Timestamp}
+	if issuer != nil {
+		entry.EntryType = ct.PrecertLogEntryType
+		entry.PrecertEntry = &ct.PreCert{
+			IssuerKeyHash:  sha256.Sum256(issuer.RawSubjectPublicKeyInfo),
+			TBSCertificate: crt.RawTBSCertificate,
+		}
+	} else {
+		entry.EntryType = ct.X509LogEntryType
+		entry.X509Entry = &ct.ASN1Cert{Data: crt.Raw}
+	}
+	data, err := ct.SerializeSCTSignatureInput(sct, ct.LogEntry{
+		Leaf: ct.MerkleTreeLeaf{LeafType: ct.TimestampedEntryLeafType, TimestampedEntry: entry},
+	})
+	assert.FatalError(t, err)
+	hash := sha256.Sum256(data)
+	sig, err := l.signer.Sign(rand.Reader, hash[:], crypto.SHA256)
+	assert.FatalError(t, err)
+	sct.Signature.Algorithm.Hash = cttls.SHA256
+	sct.Signature.Signature = sig
+	switch l.signer.Public().(type) {
+	case *ecdsa.PublicKey:
+		sct.Signature.Algorithm.Signature = cttls.ECDSA
+	case *rsa.PublicKey:
+		sct.Signature.Algorithm.Signature = cttls.RSA
+	}
+	b, err := cttls.Marshal(sct)
+	assert.FatalError(t, err)
+	return b
+}
+
+func encodeSCTList(t *testing.T, scts ...[]byte) []byte {
+	var list ctx509.SignedCertificateTimestampList
+	for _, sct := range scts {
+		list.SCTList = append(list.SCTList, ctx509.SerializedSCT{Val: sct})
+	}
+	b, err := cttls.Marshal(list)
+	assert.FatalError(t, err)
+	return b
+}
+
+func TestVerifySCT(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	ecLog := newTestCTLog(t, ecKey)
+	rsaLog := newTestCTLog(t, rsaKey)
+
+	root, err := NewRootProfile("root")
+	assert.FatalError(t, err)
+	b, err := root.CreateCertificate()
+	assert.FatalError(t, err)
+	rootCrt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+
+	// Create the certificate without SCTs and sign the SCTs over its
+	// TBSCertificate, that will be the same once the SCT list is added.
+	leaf, err := NewLeafProfile("foo.internal", rootCrt, root.SubjectPrivateKey())
+	assert.FatalError(t, err)
+	b, err = leaf.CreateCertificate()
+	assert.FatalError(t, err)
+	precert, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+
+	list, err := asn1.Marshal(encodeSCTList(t,
+		ecLog.sign(t, precert, rootCrt),
+		rsaLog.sign(t, precert, rootCrt),
+	))
+	assert.FatalError(t, err)
+	leaf.Subject().ExtraExtensions = []pkix.Extension{{Id: oidExtensionSCTList, Value: list}}
+	b, err = leaf.CreateCertificate()
+	assert.FatalError(t, err)
+	crt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+
+	scts, err := CertificateSCTs(crt)
+	assert.FatalError(t, err)
+	assert.Len(t, 2, scts)
+	assert.Equals(t, SCTSourceEmbedded, scts[0].Source)
+	assert.Equals(t, "ECDSA-SHA256", scts[0].SignatureAlgorithmString())
+	assert.Equals(t, "RSA-SHA256", scts[1].SignatureAlgorithmString())
+	assert.Equals(t, base64.StdEncoding.EncodeToString(ecLog.log.LogID[:]), scts[0].LogIDString())
+	assert.NoError(t, VerifySCT(scts[0], ecLog.log, crt, rootCrt))
+	assert.NoError(t, VerifySCT(scts[1], rsaLog.log, crt, rootCrt))
+	assert.Error(t, VerifySCT(scts[0], rsaLog.log, crt, rootCrt))
+	assert.Error(t, VerifySCT(scts[0], ecLog.log, crt, nil))
+	assert.Error(t, VerifySCT(scts[0], ecLog.log, crt, crt))
+
+	// SCTs sent in the TLS extension are signed over the certificate.
+	tlsSCTs, err := TLSSCTs([][]byte{ecLog.sign(t, crt, nil)})
+	assert.FatalError(t, err)
+	assert.Len(t, 1, tlsSCTs)
+	assert.Equals(t, SCTSourceTLS, tlsSCTs[0].Source)
+	assert.NoError(t, VerifySCT(tlsSCTs[0], ecLog.log, crt, nil))
+	assert.Error(t, VerifySCT(tlsSCTs[0], ecLog.log, rootCrt, nil))
+
+	// Certificates without SCTs
+	scts, err = CertificateSCTs(rootCrt)
+	assert.FatalError(t, err)
+	assert.Len(t, 0, scts)
+}
+
+// TestVerifySCT_testVector verifies the certificate with an embedded SCT
+// issued by the test log of the certificate-transparency project.
+func TestVerifySCT_testVector(t *testing.T) {
+	parse := func(s string) interface{} {
+		v, err := pemutil.Parse([]byte(s))
+		assert.FatalError(t, err)
+		return v
+	}
+	issuer := parse(cttestdata.CACertPEM).(*x509.Certificate)
+	crt := parse(cttestdata.TestEmbeddedCertPEM).(*x509.Certificate)
+	invalid := parse(cttestdata.TestInvalidEmbeddedCertPEM).(*x509.Certificate)
+	key := parse(cttestdata.LogPublicKeyPEM)
+	der, err := base64.StdEncoding.DecodeString(cttestdata.LogPublicKeyB64)
+	assert.FatalError(t, err)
+	log := &CTLog{Description: "test", LogID: sha256.Sum256(der), Key: key}
+
+	scts, err := CertificateSCTs(crt)
+	assert.FatalError(t, err)
+	assert.Len(t, 1, scts)
+	assert.Equals(t, SCTSourceEmbedded, scts[0].Source)
+	assert.Equals(t, log.LogID, scts[0].LogID)
+	assert.Equals(t, "ECDSA-SHA256", scts[0].SignatureAlgorithmString())
+	assert.NoError(t, VerifySCT(scts[0], log, crt, issuer))
+	assert.Error(t, VerifySCT(scts[0], log, crt, crt))
+
+	// The SCT embedded in this certificate was issued for another
+	// precertificate.
+	scts, err = CertificateSCTs(invalid)
+	assert.FatalError(t, err)
+	assert.Len(t, 1, scts)
+	assert.Error(t, VerifySCT(scts[0], log, invalid, issuer))
+}
+
+func TestParseSCTList(t *testing.T) {
+	_, err := ParseSCTList([]byte{0x00})
+	assert.Error(t, err)
+	_, err = ParseSCTList([]byte{0x00, 0x03, 0x00, 0x01, 0x00})
+	assert.Error(t, err)
+	_, err = ParseSCT([]byte{0x01})
+	assert.Error(t, err)
+	scts, err := ParseSCTList([]byte{0x00, 0x00})
+	assert.FatalError(t, err)
+	assert.Len(t, 0, scts)
+}
+
+func TestParseCTLogList(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	l := newTestCTLog(t, ecKey)
+	key := base64.StdEncoding.EncodeToString(l.der)
+	logID := base64.StdEncoding.EncodeToString(l.log.LogID[:])
+
+	list, err := ParseCTLogList([]byte(fmt.Sprintf(`{"operators": [{"name": "Smallstep", "logs": [
+		{"description": "Smallstep Log", "log_id": %q, "key": %q, "url": "https://ct.smallstep.com/"}
+	]}]}`, logID, key)))
+	assert.FatalError(t, err)
+	assert.Len(t, 1, list.Logs)
+	assert.Equals(t, "Smallstep", list.Logs[0].Operator)
+	assert.Equals(t, "Smallstep Log", list.Logs[0].Description)
+	assert.Equals(t, list.Logs[0], list.Find(l.log.LogID))
+	assert.Nil(t, list.Find([32]byte{}))
+
+	list, err = ParseCTLogList([]byte(fmt.Sprintf(`{"logs": [{"description": "Old Log", "key": %q}]}`, key)))
+	assert.FatalError(t, err)
+	assert.Len(t, 1, list.Logs)
+	assert.Equals(t, l.log.LogID, list.Logs[0].LogID)
+
+	_, err = ParseCTLogList([]byte(`{"logs": []}`))
+	assert.Error(t, err)
+	_, err = ParseCTLogList([]byte(`{"logs": [{"key": "Zm9v"}]}`))
+	assert.Error(t, err)
+	_, err = ParseCTLogList([]byte(fmt.Sprintf(`{"logs": [{"key": %q, "log_id": "Zm9v"}]}`, key)))
+	assert.Error(t, err)
+	_, err = ParseCTLogList([]byte(`{`))
+	assert.Error(t, err)
+}
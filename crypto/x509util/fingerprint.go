@@ -0,0 +1,63 @@
+package x509util
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// FingerprintEncodings are the encodings supported by EncodeFingerprint.
+var FingerprintEncodings = []string{"hex", "base64", "base64url", "emoji"}
+
+// SPKIFingerprint returns the SHA-256 fingerprint of the subject public key
+// info of the certificate. This is the value used in HPKP-style pins.
+func SPKIFingerprint(cert *x509.Certificate) []byte {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return sum[:]
+}
+
+// EncodeFingerprint encodes the given fingerprint using one of the supported
+// encodings: hex, base64, base64url or emoji.
+func EncodeFingerprint(fp []byte, encoding string) (string, error) {
+	switch encoding {
+	case "hex":
+		return strings.ToLower(hex.EncodeToString(fp)), nil
+	case "base64":
+		return base64.StdEncoding.EncodeToString(fp), nil
+	case "base64url":
+		return base64.RawURLEncoding.EncodeToString(fp), nil
+	case "emoji":
+		var sb strings.Builder
+		for _, b := range fp {
+			sb.WriteString(emojiTable[b])
+		}
+		return sb.String(), nil
+	default:
+		return "", errors.Errorf("unsupported fingerprint encoding %s", encoding)
+	}
+}
+
+// emojiTable maps each byte to a different emoji. It is used to encode
+// fingerprints in a format that is easy to compare visually.
+var emojiTable = [256]string{
+	"🐀", "🐁", "🐂", "🐃", "🐄", "🐅", "🐆", "🐇", "🐈", "🐉", "🐊", "🐋", "🐌", "🐍", "🐎", "🐏",
+	"🐐", "🐑", "🐒", "🐓", "🐔", "🐕", "🐖", "🐗", "🐘", "🐙", "🐚", "🐛", "🐜", "🐝", "🐞", "🐟",
+	"🐠", "🐡", "🐢", "🐣", "🐤", "🐥", "🐦", "🐧", "🐨", "🐩", "🐪", "🐫", "🐬", "🐭", "🐮", "🐯",
+	"🐰", "🐱", "🐲", "🐳", "🐴", "🐵", "🐶", "🐷", "🐸", "🐹", "🐺", "🐻", "🐼", "🐽", "🐾", "😀",
+	"👀", "😎", "👂", "👃", "👄", "👅", "👆", "👇", "👈", "👉", "👊", "👋", "👌", "👍", "👎", "👏",
+	"👐", "👑", "👒", "👓", "👔", "👕", "👖", "👗", "👘", "👙", "👚", "👛", "👜", "👝", "👞", "👟",
+	"👠", "👡", "👢", "👣", "👤", "👥", "👦", "👧", "👨", "👩", "👪", "👫", "👬", "👭", "👮", "👯",
+	"👰", "👱", "👲", "👳", "👴", "👵", "👶", "👷", "👸", "👹", "👺", "👻", "👼", "👽", "👾", "👿",
+	"💀", "💁", "💂", "💃", "💄", "💅", "💆", "💇", "💈", "💉", "💊", "💋", "💌", "💍", "💎", "💏",
+	"💐", "💑", "💒", "💓", "💔", "💕", "💖", "💗", "💘", "💙", "💚", "💛", "💜", "💝", "💞", "💟",
+	"💠", "💡", "💢", "💣", "💤", "💥", "💦", "💧", "💨", "💩", "💪", "💫", "💬", "💭", "💮", "💯",
+	"💰", "💱", "💲", "💳", "💴", "💵", "💶", "💷", "💸", "💹", "💺", "💻", "💼", "💽", "💾", "💿",
+	"📀", "📁", "📂", "📃", "📄", "📅", "📆", "📇", "📈", "📉", "📊", "📋", "📌", "📍", "📎", "📏",
+	"📐", "📑", "📒", "📓", "📔", "📕", "📖", "📗", "📘", "📙", "📚", "📛", "📜", "📝", "📞", "📟",
+	"📠", "📡", "📢", "📣", "📤", "📥", "📦", "📧", "📨", "📩", "📪", "📫", "📬", "📭", "📮", "📯",
+	"📰", "📱", "📲", "📳", "📴", "📵", "📶", "📷", "📸", "📹", "📺", "📻", "📼", "🚀", "🌈", "📿",
+}
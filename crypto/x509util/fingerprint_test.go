@@ -0,0 +1,53 @@
+package x509util
+
+import (
+	"encoding/hex"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/smallstep/assert"
+)
+
+func TestSPKIFingerprint(t *testing.T) {
+	cert := mustParseCertificate(t, "test_files/ca.crt")
+	assert.Equals(t, "ef0fb6ceff01045db8983cfc9dac8efd74a43488084469684cb8a682b00864db", hex.EncodeToString(SPKIFingerprint(cert)))
+}
+
+func TestEncodeFingerprint(t *testing.T) {
+	fp, err := hex.DecodeString("ef0fb6ceff01045db8983cfc9dac8efd74a43488084469684cb8a682b00864db")
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		encoding string
+		want     string
+		wantErr  bool
+	}{
+		{"hex", "ef0fb6ceff01045db8983cfc9dac8efd74a43488084469684cb8a682b00864db", false},
+		{"base64", "7w+2zv8BBF24mDz8nayO/XSkNIgIRGloTLimgrAIZNs=", false},
+		{"base64url", "7w-2zv8BBF24mDz8nayO_XSkNIgIRGloTLimgrAIZNs", false},
+		{"emoji", "", false},
+		{"foo", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoding, func(t *testing.T) {
+			got, err := EncodeFingerprint(fp, tt.encoding)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("EncodeFingerprint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.encoding == "emoji" {
+				assert.Equals(t, len(fp), utf8.RuneCountInString(got))
+				assert.Equals(t, emojiTable[0xef]+emojiTable[0x0f], string([]rune(got)[:2]))
+				return
+			}
+			assert.Equals(t, tt.want, got)
+		})
+	}
+
+	seen := make(map[string]bool)
+	for _, s := range emojiTable {
+		if s == "" || seen[s] {
+			t.Errorf("emoji %q is empty or duplicated", s)
+		}
+		seen[s] = true
+	}
+}
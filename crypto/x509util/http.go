@@ -0,0 +1,25 @@
+package x509util
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// readResponse returns the body of the given HTTP response. It fails if the
+// status code is not 2xx or if the body is larger than maxSize bytes.
+func readResponse(resp *http.Response, maxSize int64) ([]byte, error) {
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, errors.New(resp.Status)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if int64(len(b)) > maxSize {
+		return nil, errors.Errorf("response is larger than %d bytes", maxSize)
+	}
+	return b, nil
+}
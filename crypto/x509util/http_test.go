@@ -0,0 +1,52 @@
+package x509util
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestReadResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			w.Write([]byte("0123456789"))
+		case "/multiple-choices":
+			// Redirections without a location are not followed.
+			w.WriteHeader(http.StatusMultipleChoices)
+			w.Write([]byte("0123456789"))
+		case "/large":
+			w.Write([]byte("0123456789a"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		path    string
+		want    []byte
+		wantErr bool
+	}{
+		{"/ok", []byte("0123456789"), false},
+		{"/multiple-choices", nil, true},
+		{"/large", nil, true},
+		{"/missing", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := http.Get(srv.URL + tt.path)
+			assert.FatalError(t, err)
+			defer resp.Body.Close()
+			got, err := readResponse(resp, 10)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
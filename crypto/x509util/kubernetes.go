@@ -0,0 +1,97 @@
+package x509util
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/pemutil"
+)
+
+// kubernetesNameRegexp matches the names of Kubernetes objects, DNS subdomain
+// names as defined in RFC 1123.
+var kubernetesNameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+
+// EncodeKubernetesSecret returns the YAML manifest of a Kubernetes Secret of
+// type kubernetes.io/tls with the certificate and chain in the tls.crt key and
+// the private key in the tls.key key. If the name is empty, it is derived from
+// the common name of the certificate.
+func EncodeKubernetesSecret(name string, key interface{}, crt *x509.Certificate, chain []*x509.Certificate) ([]byte, error) {
+	if key == nil || crt == nil {
+		return nil, errors.New("a certificate and a private key are required")
+	}
+	name, err := kubernetesName(name, crt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := pemutil.Serialize(key)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "apiVersion: v1\nkind: Secret\nmetadata:\n  name: %s\ntype: kubernetes.io/tls\ndata:\n", name)
+	fmt.Fprintf(buf, "  tls.crt: %s\n", base64.StdEncoding.EncodeToString(encodeCertificates(crt, chain)))
+	fmt.Fprintf(buf, "  tls.key: %s\n", base64.StdEncoding.EncodeToString(pem.EncodeToMemory(block)))
+	return buf.Bytes(), nil
+}
+
+// EncodeKubernetesConfigMap returns the YAML manifest of a Kubernetes
+// ConfigMap with the certificates in PEM format in the ca.crt key, useful to
+// distribute trust bundles. If the name is empty, it is derived from the
+// common name of the first certificate.
+func EncodeKubernetesConfigMap(name string, certs []*x509.Certificate) ([]byte, error) {
+	if len(certs) == 0 {
+		return nil, errors.New("a certificate is required")
+	}
+	name, err := kubernetesName(name, certs[0])
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: %s\ndata:\n  ca.crt: |\n", name)
+	for _, line := range strings.SplitAfter(string(encodeCertificates(certs[0], certs[1:])), "\n") {
+		if line != "" {
+			buf.WriteString("    " + line)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// kubernetesName validates the given name, or creates one from the common
+// name of the certificate if it's empty.
+func kubernetesName(name string, crt *x509.Certificate) (string, error) {
+	if name == "" {
+		name = strings.Map(func(r rune) rune {
+			switch {
+			case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.':
+				return r
+			default:
+				return '-'
+			}
+		}, strings.ToLower(crt.Subject.CommonName))
+		name = strings.Trim(name, "-.")
+		if name == "" {
+			name = "tls"
+		}
+	}
+	if len(name) > 253 || !kubernetesNameRegexp.MatchString(name) {
+		return "", errors.Errorf("%s is not a valid Kubernetes name", name)
+	}
+	return name, nil
+}
+
+// encodeCertificates returns the certificate and the chain in PEM format.
+func encodeCertificates(crt *x509.Certificate, chain []*x509.Certificate) []byte {
+	var b []byte
+	for _, c := range append([]*x509.Certificate{crt}, chain...) {
+		b = append(b, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+	}
+	return b
+}
@@ -0,0 +1,87 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/cli/crypto/pemutil"
+)
+
+func TestEncodeKubernetesSecret(t *testing.T) {
+	root, err := NewRootProfile("Smallstep Root CA")
+	assert.FatalError(t, err)
+	b, err := root.CreateCertificate()
+	assert.FatalError(t, err)
+	crt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+
+	manifest, err := EncodeKubernetesSecret("", root.SubjectPrivateKey(), crt, nil)
+	assert.FatalError(t, err)
+	lines := strings.Split(string(manifest), "\n")
+	assert.Equals(t, []string{"apiVersion: v1", "kind: Secret", "metadata:", "  name: smallstep-root-ca",
+		"type: kubernetes.io/tls", "data:"}, lines[:6])
+	assert.True(t, strings.HasPrefix(lines[6], "  tls.crt: "))
+	assert.True(t, strings.HasPrefix(lines[7], "  tls.key: "))
+
+	pemCrt, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(lines[6], "  tls.crt: "))
+	assert.FatalError(t, err)
+	assert.Equals(t, encodeCertificates(crt, nil), pemCrt)
+	pemKey, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(lines[7], "  tls.key: "))
+	assert.FatalError(t, err)
+	key, err := pemutil.ParseKey(pemKey)
+	assert.FatalError(t, err)
+	assert.Equals(t, root.SubjectPrivateKey(), key)
+
+	_, err = EncodeKubernetesSecret("", nil, crt, nil)
+	assert.Error(t, err)
+	_, err = EncodeKubernetesSecret("Invalid_Name", root.SubjectPrivateKey(), crt, nil)
+	assert.Error(t, err)
+}
+
+func TestEncodeKubernetesConfigMap(t *testing.T) {
+	ca := mustParseCertificate(t, "test_files/ca.crt")
+	manifest, err := EncodeKubernetesConfigMap("trust-bundle", []*x509.Certificate{ca, ca})
+	assert.FatalError(t, err)
+
+	want := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: trust-bundle\ndata:\n  ca.crt: |\n"
+	for _, line := range strings.SplitAfter(string(encodeCertificates(ca, []*x509.Certificate{ca})), "\n") {
+		if line != "" {
+			want += "    " + line
+		}
+	}
+	assert.Equals(t, want, string(manifest))
+
+	_, err = EncodeKubernetesConfigMap("", nil)
+	assert.Error(t, err)
+}
+
+func TestKubernetesName(t *testing.T) {
+	tests := []struct {
+		name    string
+		cn      string
+		want    string
+		wantErr bool
+	}{
+		{"foo", "", "foo", false},
+		{"foo.example.com", "", "foo.example.com", false},
+		{"", "*.example.com", "example.com", false},
+		{"", "Smallstep Intermediate CA", "smallstep-intermediate-ca", false},
+		{"", "", "tls", false},
+		{"Foo", "", "", true},
+		{"-foo", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+tt.cn, func(t *testing.T) {
+			crt := &x509.Certificate{}
+			crt.Subject.CommonName = tt.cn
+			got, err := kubernetesName(tt.name, crt)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("kubernetesName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
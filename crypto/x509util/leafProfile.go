@@ -49,6 +49,8 @@ func NewSelfSignedLeafProfile(cn string, withOps ...WithOption) (Profile, error)
 // Subject Certificate fields populated directly from the CSR.
 // A public/private keypair **WILL NOT** be generated for this profile because
 // the public key will be populated from the CSR.
+// Use WithPolicy to reject certificates that do not comply with an issuance
+// policy.
 func NewLeafProfileWithCSR(csr *x509.CertificateRequest, iss *x509.Certificate, issPriv crypto.PrivateKey, withOps ...WithOption) (Profile, error) {
 	if csr.PublicKey == nil {
 		return nil, errors.Errorf("CSR must have PublicKey")
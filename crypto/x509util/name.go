@@ -0,0 +1,120 @@
+package x509util
+
+import (
+	"bytes"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// oidEmailAddress is the OID of the emailAddress attribute defined in PKCS #9.
+var oidEmailAddress = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 1}
+
+// ParseDistinguishedName parses a distinguished name like
+// "CN=example.com,O=Smallstep,C=US" or the OpenSSL format
+// "/CN=example.com/O=Smallstep/C=US". The attribute types are
+// case-insensitive and can be CN, C, O, OU, L, ST, STREET, POSTALCODE,
+// SERIALNUMBER, EMAILADDRESS (or E), or an object identifier in the dotted
+// notation. Separators can be escaped with a backslash, e.g. "O=Acme\, Inc.".
+func ParseDistinguishedName(s string) (pkix.Name, error) {
+	var name pkix.Name
+
+	sep := ','
+	if strings.HasPrefix(s, "/") {
+		sep, s = '/', s[1:]
+	}
+	parts, err := splitEscaped(s, sep)
+	if err != nil {
+		return name, errors.Wrapf(err, "invalid distinguished name '%s'", s)
+	}
+
+	for _, part := range parts {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return name, errors.Errorf("invalid distinguished name attribute '%s'", part)
+		}
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		if value == "" {
+			return name, errors.Errorf("invalid distinguished name attribute '%s': value cannot be empty", part)
+		}
+		switch strings.ToUpper(key) {
+		case "CN":
+			if name.CommonName != "" {
+				return name, errors.Errorf("invalid distinguished name '%s': CN cannot be repeated", s)
+			}
+			name.CommonName = value
+		case "C":
+			name.Country = append(name.Country, value)
+		case "O":
+			name.Organization = append(name.Organization, value)
+		case "OU":
+			name.OrganizationalUnit = append(name.OrganizationalUnit, value)
+		case "L":
+			name.Locality = append(name.Locality, value)
+		case "ST":
+			name.Province = append(name.Province, value)
+		case "STREET":
+			name.StreetAddress = append(name.StreetAddress, value)
+		case "POSTALCODE":
+			name.PostalCode = append(name.PostalCode, value)
+		case "SERIALNUMBER":
+			name.SerialNumber = value
+		case "EMAILADDRESS", "E":
+			name.ExtraNames = append(name.ExtraNames, pkix.AttributeTypeAndValue{
+				Type: oidEmailAddress, Value: value,
+			})
+		default:
+			oid, err := parseObjectIdentifier(key)
+			if err != nil {
+				return name, errors.Errorf("invalid distinguished name attribute '%s': unsupported type '%s'", part, key)
+			}
+			name.ExtraNames = append(name.ExtraNames, pkix.AttributeTypeAndValue{
+				Type: oid, Value: value,
+			})
+		}
+	}
+	return name, nil
+}
+
+// splitEscaped splits the string using the given separator, a backslash can
+// be used to escape the separator or a backslash.
+func splitEscaped(s string, sep rune) ([]string, error) {
+	var parts []string
+	var buf bytes.Buffer
+	escaped := false
+	for _, c := range s {
+		switch {
+		case escaped:
+			buf.WriteRune(c)
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == sep:
+			parts = append(parts, buf.String())
+			buf.Reset()
+		default:
+			buf.WriteRune(c)
+		}
+	}
+	if escaped {
+		return nil, errors.New("unexpected end of string after escape character")
+	}
+	return append(parts, buf.String()), nil
+}
+
+// ParseSubject parses a subject in JSON format, with the same fields used in
+// the subject of a certificate template, e.g.
+//
+//	{"commonName": "example.com", "organization": "Smallstep", "country": "US"}
+func ParseSubject(b []byte) (pkix.Name, error) {
+	var dn ASN1DN
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&dn); err != nil {
+		return pkix.Name{}, errors.Wrap(err, "error parsing subject")
+	}
+	return dn.pkixName(), nil
+}
@@ -0,0 +1,62 @@
+package x509util
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestParseDistinguishedName(t *testing.T) {
+	tests := []struct {
+		name    string
+		dn      string
+		want    pkix.Name
+		wantErr bool
+	}{
+		{"comma", "CN=foo,O=Smallstep,OU=Engineering,C=US", pkix.Name{
+			CommonName: "foo", Organization: []string{"Smallstep"}, OrganizationalUnit: []string{"Engineering"}, Country: []string{"US"},
+		}, false},
+		{"openssl", "/CN=foo/O=Smallstep/L=San Francisco/ST=CA", pkix.Name{
+			CommonName: "foo", Organization: []string{"Smallstep"}, Locality: []string{"San Francisco"}, Province: []string{"CA"},
+		}, false},
+		{"escaped", `cn=foo, o=Acme\, Inc., ou=a, ou=b`, pkix.Name{
+			CommonName: "foo", Organization: []string{"Acme, Inc."}, OrganizationalUnit: []string{"a", "b"},
+		}, false},
+		{"other attributes", "STREET=1 Main St,POSTALCODE=94110,SERIALNUMBER=1234,E=jane@example.com,1.2.3.4=bar", pkix.Name{
+			StreetAddress: []string{"1 Main St"}, PostalCode: []string{"94110"}, SerialNumber: "1234",
+			ExtraNames: []pkix.AttributeTypeAndValue{
+				{Type: oidEmailAddress, Value: "jane@example.com"},
+				{Type: asn1.ObjectIdentifier{1, 2, 3, 4}, Value: "bar"},
+			},
+		}, false},
+		{"fail type", "CN=foo,X=bar", pkix.Name{}, true},
+		{"fail format", "CN=foo,bar", pkix.Name{}, true},
+		{"fail empty", "CN=foo,O=", pkix.Name{}, true},
+		{"fail repeated cn", "CN=foo,CN=bar", pkix.Name{}, true},
+		{"fail escape", `CN=foo\`, pkix.Name{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDistinguishedName(tt.dn)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseSubject(t *testing.T) {
+	got, err := ParseSubject([]byte(`{"commonName": "foo", "organization": "Smallstep", "country": "US"}`))
+	assert.FatalError(t, err)
+	assert.Equals(t, pkix.Name{CommonName: "foo", Organization: []string{"Smallstep"}, Country: []string{"US"}}, got)
+
+	_, err = ParseSubject([]byte(`{"commonName": "foo", "foo": "bar"}`))
+	assert.Error(t, err)
+	_, err = ParseSubject([]byte(`not json`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,197 @@
+package x509util
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/pemutil"
+	"golang.org/x/crypto/ocsp"
+)
+
+// ocspTimeout is the maximum time to wait for an OCSP responder.
+const ocspTimeout = 30 * time.Second
+
+// maxOCSPResponseSize is the maximum size of an OCSP response.
+const maxOCSPResponseSize = 64 * 1024
+
+// QueryOCSP sends an OCSP request for the given certificate to the responder
+// in the given URL and returns the parsed response. The response signature is
+// verified using the issuer certificate.
+func QueryOCSP(server string, crt, issuer *x509.Certificate) (*ocsp.Response, error) {
+	req, err := ocsp.CreateRequest(crt, issuer, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating OCSP request")
+	}
+	client := &http.Client{Timeout: ocspTimeout}
+	resp, err := client.Post(server, "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error querying OCSP responder %s", server)
+	}
+	defer resp.Body.Close()
+	b, err := readResponse(resp, maxOCSPResponseSize)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error querying OCSP responder %s", server)
+	}
+	return ParseOCSPResponse(b, crt, issuer)
+}
+
+// ParseOCSPResponse parses a DER encoded OCSP response for the given
+// certificate and verifies its signature using the issuer certificate.
+// Responses signed with RSA-PSS are also supported.
+func ParseOCSPResponse(b []byte, crt, issuer *x509.Certificate) (*ocsp.Response, error) {
+	var resp ocspResponse
+	var basic basicOCSPResponse
+	if _, err := asn1.Unmarshal(b, &resp); err == nil {
+		asn1.Unmarshal(resp.Response.Response, &basic)
+	}
+	if !basic.SignatureAlgorithm.Algorithm.Equal(oidSignatureRSAPSS) {
+		ret, err := ocsp.ParseResponseForCert(b, crt, issuer)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing OCSP response")
+		}
+		return ret, nil
+	}
+
+	// golang.org/x/crypto/ocsp does not support RSA-PSS, the response is
+	// parsed without the responder certificate and verified here.
+	alg := pssSignatureAlgorithm(basic.SignatureAlgorithm)
+	if alg == x509.UnknownSignatureAlgorithm {
+		return nil, errors.New("error parsing OCSP response: unsupported RSA-PSS parameters")
+	}
+	certs := basic.Certificates
+	basic.Certificates = nil
+	var err error
+	if resp.Response.Response, err = asn1.Marshal(basic); err != nil {
+		return nil, errors.Wrap(err, "error parsing OCSP response")
+	}
+	unsigned, err := asn1.Marshal(resp)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing OCSP response")
+	}
+	ret, err := ocsp.ParseResponseForCert(unsigned, crt, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing OCSP response")
+	}
+	ret.SignatureAlgorithm = alg
+
+	responder := issuer
+	if len(certs) > 0 {
+		if ret.Certificate, err = x509.ParseCertificate(certs[0].FullBytes); err != nil {
+			return nil, errors.Wrap(err, "error parsing OCSP response")
+		}
+		if issuer != nil {
+			if err := issuer.CheckSignature(ret.Certificate.SignatureAlgorithm, ret.Certificate.RawTBSCertificate, ret.Certificate.Signature); err != nil {
+				return nil, errors.Wrap(err, "error parsing OCSP response: bad signature on embedded certificate")
+			}
+		}
+		responder = ret.Certificate
+	}
+	if responder != nil {
+		if err := ret.CheckSignatureFrom(responder); err != nil {
+			return nil, errors.Wrap(err, "error parsing OCSP response: bad signature")
+		}
+	}
+	return ret, nil
+}
+
+// pssSignatureAlgorithm returns the RSA-PSS signature algorithm with the given
+// identifier, or x509.UnknownSignatureAlgorithm if the parameters are not the
+// ones used by signatureAlgorithmIdentifier.
+func pssSignatureAlgorithm(ai pkix.AlgorithmIdentifier) x509.SignatureAlgorithm {
+	for _, alg := range []x509.SignatureAlgorithm{x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS, x509.SHA512WithRSAPSS} {
+		if v, err := signatureAlgorithmIdentifier(alg); err == nil && bytes.Equal(v.Parameters.FullBytes, ai.Parameters.FullBytes) {
+			return alg
+		}
+	}
+	return x509.UnknownSignatureAlgorithm
+}
+
+// CreateOCSPResponse returns a DER encoded OCSP response for the given
+// template signed by the responder. Responses are signed with the default
+// signature algorithm of the signer, see DefaultSignatureAlgorithm.
+func CreateOCSPResponse(issuer, responder *x509.Certificate, template ocsp.Response, signer crypto.Signer) ([]byte, error) {
+	if _, ok := signer.(*pemutil.RSAPSSPrivateKey); !ok {
+		b, err := ocsp.CreateResponse(issuer, responder, template, signer)
+		return b, errors.Wrap(err, "error creating OCSP response")
+	}
+
+	// golang.org/x/crypto/ocsp does not support RSA-PSS, the response is
+	// created with an empty signature and signed again.
+	b, err := ocsp.CreateResponse(issuer, responder, template, unsignedSigner{signer})
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating OCSP response")
+	}
+	var resp ocspResponse
+	if _, err := asn1.Unmarshal(b, &resp); err != nil {
+		return nil, errors.Wrap(err, "error parsing OCSP response")
+	}
+	var basic basicOCSPResponse
+	if _, err := asn1.Unmarshal(resp.Response.Response, &basic); err != nil {
+		return nil, errors.Wrap(err, "error parsing OCSP response")
+	}
+
+	alg := DefaultSignatureAlgorithm(signer)
+	if basic.SignatureAlgorithm, err = signatureAlgorithmIdentifier(alg); err != nil {
+		return nil, err
+	}
+	signature, err := signData(signer, alg, basic.TBSResponseData.FullBytes)
+	if err != nil {
+		return nil, err
+	}
+	basic.Signature = asn1.BitString{Bytes: signature, BitLength: len(signature) * 8}
+	if resp.Response.Response, err = asn1.Marshal(basic); err != nil {
+		return nil, errors.Wrap(err, "error marshaling OCSP response")
+	}
+	b, err = asn1.Marshal(resp)
+	return b, errors.Wrap(err, "error marshaling OCSP response")
+}
+
+// unsignedSigner is a crypto.Signer that returns an empty signature.
+type unsignedSigner struct {
+	crypto.Signer
+}
+
+func (s unsignedSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return []byte{}, nil
+}
+
+// ocspResponse is the ASN.1 structure of the OCSPResponse in RFC 6960.
+type ocspResponse struct {
+	Status   asn1.Enumerated
+	Response ocspResponseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+// basicOCSPResponse is the ASN.1 structure of the BasicOCSPResponse in RFC
+// 6960.
+type basicOCSPResponse struct {
+	TBSResponseData    asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+// OCSPStatusString returns the name of the given OCSP certificate status.
+func OCSPStatusString(status int) string {
+	switch status {
+	case ocsp.Good:
+		return "good"
+	case ocsp.Revoked:
+		return "revoked"
+	case ocsp.Unknown:
+		return "unknown"
+	default:
+		return "invalid"
+	}
+}
@@ -0,0 +1,44 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestQueryOCSP_httpErrors(t *testing.T) {
+	root, err := NewRootProfile("root")
+	assert.FatalError(t, err)
+	b, err := root.CreateCertificate()
+	assert.FatalError(t, err)
+	rootCrt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+	leaf, err := NewLeafProfile("leaf", rootCrt, root.SubjectPrivateKey())
+	assert.FatalError(t, err)
+	b, err = leaf.CreateCertificate()
+	assert.FatalError(t, err)
+	leafCrt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/multiple-choices":
+			w.WriteHeader(http.StatusMultipleChoices)
+		case "/large":
+			w.Write(make([]byte, maxOCSPResponseSize+1))
+		default:
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	for _, path := range []string{"/multiple-choices", "/large", "/error"} {
+		t.Run(path, func(t *testing.T) {
+			_, err := QueryOCSP(srv.URL+path, leafCrt, rootCrt)
+			assert.Error(t, err)
+		})
+	}
+}
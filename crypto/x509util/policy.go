@@ -0,0 +1,449 @@
+package x509util
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Policy defines what a signer is allowed to issue. The names in a
+// certificate, including a common name that looks like a name, must match one
+// of the patterns for their type; if the list of patterns of a type is empty,
+// names of that type are not allowed.
+type Policy struct {
+	// DNS are the allowed DNS names. A pattern like "*.example.com" matches
+	// one label, a pattern with a leading period like ".example.com" matches
+	// any subdomain, other patterns must match exactly.
+	DNS []string `json:"dns,omitempty"`
+	// IPs are the allowed IP addresses or networks in CIDR notation.
+	IPs []string `json:"ips,omitempty"`
+	// Emails are the allowed email addresses, e.g. "jane@example.com", or
+	// domains, using the same patterns as DNS names, e.g. "example.com".
+	Emails []string `json:"emails,omitempty"`
+	// URIs are the allowed URI prefixes, e.g. "spiffe://example.org/". A
+	// prefix without a trailing slash only matches a full path segment.
+	URIs []string `json:"uris,omitempty"`
+	// AllowWildcardNames allows DNS names like "*.example.com", they must
+	// still match one of the DNS patterns.
+	AllowWildcardNames bool `json:"allowWildcardNames,omitempty"`
+	// MaxValidity is the maximum validity of a certificate, e.g. "2160h" or
+	// "90d". There is no maximum if it is not set.
+	MaxValidity PolicyDuration `json:"maxValidity,omitempty"`
+	// Keys are the allowed key types. Any key is allowed if it is empty.
+	Keys []KeyPolicy `json:"keys,omitempty"`
+	// ForbiddenExtensions are the extensions that a certificate cannot
+	// contain, using an object identifier in the dotted notation or a name
+	// like basicConstraints or nameConstraints.
+	ForbiddenExtensions []string `json:"forbiddenExtensions,omitempty"`
+
+	ipNets     []*net.IPNet
+	extensions []asn1.ObjectIdentifier
+}
+
+// KeyPolicy defines an allowed key type, with an optional curve for EC keys
+// and a minimum size for RSA keys.
+type KeyPolicy struct {
+	Type    string `json:"kty"`
+	Curve   string `json:"crv,omitempty"`
+	MinSize int    `json:"minSize,omitempty"`
+}
+
+// PolicyDuration is a time.Duration that is encoded as a string in JSON. It
+// supports a "d" suffix for days.
+type PolicyDuration struct {
+	time.Duration
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (d *PolicyDuration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.Errorf("invalid duration %s", data)
+	}
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil || days < 0 {
+			return errors.Errorf("invalid duration %s", s)
+		}
+		d.Duration = time.Duration(days) * 24 * time.Hour
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil || v < 0 {
+		return errors.Errorf("invalid duration %s", s)
+	}
+	d.Duration = v
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (d PolicyDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.Duration.String())
+}
+
+// extensionNames are the names that can be used in the forbidden extensions of
+// a policy.
+var extensionNames = map[string]asn1.ObjectIdentifier{
+	"keyusage":              oidExtensionKeyUsage,
+	"subjectaltname":        oidExtensionSubjectAltName,
+	"basicconstraints":      oidExtensionBasicConstraints,
+	"nameconstraints":       oidExtensionNameConstraints,
+	"crldistributionpoints": oidExtensionCRLDistributionPoints,
+	"certificatepolicies":   oidExtensionCertificatePolicies,
+	"extkeyusage":           oidExtensionExtendedKeyUsage,
+	"authorityinfoaccess":   oidExtensionAuthorityInfoAccess,
+	"inhibitanypolicy":      oidExtensionInhibitAnyPolicy,
+	"ctpoison":              oidExtensionCTPoison,
+}
+
+var (
+	oidExtensionNameConstraints       = asn1.ObjectIdentifier{2, 5, 29, 30}
+	oidExtensionCRLDistributionPoints = asn1.ObjectIdentifier{2, 5, 29, 31}
+	oidExtensionCertificatePolicies   = asn1.ObjectIdentifier{2, 5, 29, 32}
+	oidExtensionAuthorityInfoAccess   = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 1}
+)
+
+// ParsePolicy parses and validates a policy in JSON format.
+func ParsePolicy(b []byte) (*Policy, error) {
+	p := new(Policy)
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(p); err != nil {
+		return nil, errors.Wrap(err, "error parsing policy")
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Validate validates the policy and prepares it to be used.
+func (p *Policy) Validate() error {
+	for _, s := range p.DNS {
+		if err := validateDNSPattern(s); err != nil {
+			return errors.Wrap(err, "error validating policy")
+		}
+	}
+	for _, s := range p.Emails {
+		if i := strings.LastIndex(s, "@"); i >= 0 {
+			if i == 0 || i == len(s)-1 {
+				return errors.Errorf("error validating policy: invalid email '%s'", s)
+			}
+			continue
+		}
+		if err := validateDNSPattern(s); err != nil {
+			return errors.Wrap(err, "error validating policy")
+		}
+	}
+	for _, s := range p.URIs {
+		if !strings.Contains(s, "://") {
+			return errors.Errorf("error validating policy: invalid URI prefix '%s'", s)
+		}
+	}
+
+	p.ipNets = make([]*net.IPNet, len(p.IPs))
+	for i, s := range p.IPs {
+		ipNet, err := ParseIPRange(s)
+		if err != nil {
+			return errors.Wrap(err, "error validating policy")
+		}
+		p.ipNets[i] = ipNet
+	}
+
+	for _, k := range p.Keys {
+		switch {
+		case k.Type == "RSA" && k.Curve == "":
+		case k.Type == "EC" && k.MinSize == 0:
+			switch k.Curve {
+			case "", "P-256", "P-384", "P-521":
+			default:
+				return errors.Errorf("error validating policy: unsupported curve '%s'", k.Curve)
+			}
+		case k.Type == "OKP" && k.MinSize == 0 && (k.Curve == "" || k.Curve == "Ed25519"):
+		default:
+			return errors.Errorf("error validating policy: invalid key %s", k)
+		}
+	}
+
+	p.extensions = make([]asn1.ObjectIdentifier, len(p.ForbiddenExtensions))
+	for i, s := range p.ForbiddenExtensions {
+		oid, ok := extensionNames[strings.ToLower(s)]
+		if !ok {
+			var err error
+			if oid, err = parseObjectIdentifier(s); err != nil {
+				return errors.Errorf("error validating policy: invalid extension '%s'", s)
+			}
+		}
+		p.extensions[i] = oid
+	}
+	return nil
+}
+
+// String returns the key policy in a format like "EC P-256" or "RSA >= 3072".
+func (k KeyPolicy) String() string {
+	s := k.Type
+	if k.Curve != "" {
+		s += " " + k.Curve
+	}
+	if k.MinSize > 0 {
+		s += fmt.Sprintf(" >= %d", k.MinSize)
+	}
+	return s
+}
+
+// PolicyError is the error returned when a certificate does not comply with a
+// policy, it contains all the violations found.
+type PolicyError struct {
+	Violations []string
+}
+
+// Error implements the error interface, it returns all the violations, one
+// per line.
+func (e *PolicyError) Error() string {
+	return "certificate does not comply with the issuance policy:\n  - " + strings.Join(e.Violations, "\n  - ")
+}
+
+// CheckCertificate checks that the certificate, or certificate template, is
+// allowed by the policy, it returns a *PolicyError with all the violations
+// found.
+func (p *Policy) CheckCertificate(crt *x509.Certificate) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	var v []string
+
+	for _, name := range crt.DNSNames {
+		if msg := p.checkDNSName(name); msg != "" {
+			v = append(v, msg)
+		}
+	}
+	for _, ip := range crt.IPAddresses {
+		if msg := p.checkIP(ip); msg != "" {
+			v = append(v, msg)
+		}
+	}
+	for _, email := range crt.EmailAddresses {
+		if msg := p.checkEmail(email); msg != "" {
+			v = append(v, msg)
+		}
+	}
+	for _, u := range crt.URIs {
+		if msg := p.checkURI(u.String()); msg != "" {
+			v = append(v, msg)
+		}
+	}
+	if msg := p.checkCommonName(crt); msg != "" {
+		v = append(v, msg)
+	}
+
+	if p.MaxValidity.Duration > 0 {
+		if d := crt.NotAfter.Sub(crt.NotBefore); d > p.MaxValidity.Duration {
+			v = append(v, fmt.Sprintf("validity %s exceeds the maximum of %s", d, p.MaxValidity.Duration))
+		}
+	}
+
+	if msg := p.checkKey(crt.PublicKey); msg != "" {
+		v = append(v, msg)
+	}
+
+	for i, oid := range p.extensions {
+		if certificateHasExtension(crt, oid) {
+			v = append(v, fmt.Sprintf("extension %s is forbidden", p.ForbiddenExtensions[i]))
+		}
+	}
+
+	if len(v) > 0 {
+		return &PolicyError{Violations: v}
+	}
+	return nil
+}
+
+func (p *Policy) checkDNSName(name string) string {
+	if strings.Contains(name, "*") && !p.AllowWildcardNames {
+		return fmt.Sprintf("DNS name %s is not allowed: wildcard names are not allowed", name)
+	}
+	for _, pattern := range p.DNS {
+		if matchDNSPattern(pattern, name) {
+			return ""
+		}
+	}
+	return fmt.Sprintf("DNS name %s is not allowed", name)
+}
+
+func (p *Policy) checkIP(ip net.IP) string {
+	for _, ipNet := range p.ipNets {
+		if ipNet.Contains(ip) {
+			return ""
+		}
+	}
+	return fmt.Sprintf("IP address %s is not allowed", ip)
+}
+
+func (p *Policy) checkEmail(email string) string {
+	i := strings.LastIndex(email, "@")
+	if i < 0 {
+		return fmt.Sprintf("email address %s is not allowed", email)
+	}
+	for _, pattern := range p.Emails {
+		if strings.Contains(pattern, "@") {
+			if strings.EqualFold(pattern, email) {
+				return ""
+			}
+		} else if !strings.Contains(email[i+1:], "*") && matchDNSPattern(pattern, email[i+1:]) {
+			return ""
+		}
+	}
+	return fmt.Sprintf("email address %s is not allowed", email)
+}
+
+func (p *Policy) checkURI(uri string) string {
+	for _, prefix := range p.URIs {
+		if uri == prefix || (strings.HasPrefix(uri, prefix) &&
+			(strings.HasSuffix(prefix, "/") || uri[len(prefix)] == '/')) {
+			return ""
+		}
+	}
+	return fmt.Sprintf("URI %s is not allowed", uri)
+}
+
+// checkCommonName checks the common name if it is not one of the SANs and it
+// looks like a DNS name, an IP address, an email address or a URI.
+func (p *Policy) checkCommonName(crt *x509.Certificate) string {
+	cn := crt.Subject.CommonName
+	if cn == "" {
+		return ""
+	}
+	for _, san := range SANs(crt) {
+		if cn == san {
+			return ""
+		}
+	}
+
+	var msg string
+	switch {
+	case net.ParseIP(cn) != nil:
+		msg = p.checkIP(net.ParseIP(cn))
+	case strings.Contains(cn, "://"):
+		msg = p.checkURI(cn)
+	case strings.Contains(cn, "@"):
+		msg = p.checkEmail(cn)
+	case strings.ContainsAny(cn, ".*") && !strings.ContainsAny(cn, " \t"):
+		msg = p.checkDNSName(cn)
+	}
+	if msg != "" {
+		return "common name: " + msg
+	}
+	return ""
+}
+
+func (p *Policy) checkKey(pub interface{}) string {
+	if len(p.Keys) == 0 {
+		return ""
+	}
+	for _, k := range p.Keys {
+		switch key := pub.(type) {
+		case *rsa.PublicKey:
+			if k.Type == "RSA" && key.N.BitLen() >= k.MinSize {
+				return ""
+			}
+		case *ecdsa.PublicKey:
+			if k.Type == "EC" && (k.Curve == "" || k.Curve == key.Curve.Params().Name) {
+				return ""
+			}
+		case ed25519.PublicKey:
+			if k.Type == "OKP" {
+				return ""
+			}
+		}
+	}
+	return fmt.Sprintf("key %s is not allowed", PublicKeyString(pub))
+}
+
+// certificateHasExtension returns true if the certificate, or the certificate
+// template, contains the extension with the given object identifier.
+func certificateHasExtension(crt *x509.Certificate, oid asn1.ObjectIdentifier) bool {
+	for _, ext := range crt.Extensions {
+		if ext.Id.Equal(oid) {
+			return true
+		}
+	}
+	if oid.Equal(oidExtensionSubjectAltName) && len(SANs(crt)) > 0 {
+		return true
+	}
+	return hasExtension(crt, oid)
+}
+
+// validateDNSPattern returns an error if the DNS pattern is not valid.
+func validateDNSPattern(pattern string) error {
+	name := strings.TrimPrefix(strings.TrimPrefix(pattern, "*"), ".")
+	if name == "" || strings.Contains(name, "*") || strings.Contains(name, "..") ||
+		strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".") {
+		return errors.Errorf("invalid DNS pattern '%s'", pattern)
+	}
+	if strings.HasPrefix(pattern, "*") && !strings.HasPrefix(pattern, "*.") {
+		return errors.Errorf("invalid DNS pattern '%s'", pattern)
+	}
+	return nil
+}
+
+// matchDNSPattern returns true if the name matches the pattern. Patterns like
+// "*.example.com" match one label, patterns like ".example.com" match any
+// subdomain, and other patterns must match exactly.
+func matchDNSPattern(pattern, name string) bool {
+	pattern = strings.ToLower(pattern)
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	switch {
+	case strings.HasPrefix(pattern, "*."):
+		prefix := strings.TrimSuffix(name, pattern[1:])
+		return prefix != name && prefix != "" && !strings.Contains(prefix, ".")
+	case strings.HasPrefix(pattern, "."):
+		return strings.HasSuffix(name, pattern) && len(name) > len(pattern)
+	default:
+		return name == pattern
+	}
+}
+
+// ParseIPRange parses an IP address or a network in CIDR notation. IP
+// addresses are converted to a network with a single address.
+func ParseIPRange(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, errors.Errorf("invalid IP range '%s'", s)
+		}
+		return ipNet, nil
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, errors.Errorf("invalid IP address '%s'", s)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// WithPolicy returns a Profile modifier that enforces the policy when the
+// certificate is created.
+func WithPolicy(policy *Policy) WithOption {
+	return func(p Profile) error {
+		pp, ok := p.(interface{ setPolicy(*Policy) })
+		if !ok {
+			return errors.Errorf("profile %T does not support policies", p)
+		}
+		pp.setPolicy(policy)
+		return nil
+	}
+}
@@ -0,0 +1,203 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+const testPolicy = `{
+	"dns": ["*.example.com", ".internal.example.com", "example.org"],
+	"ips": ["10.0.0.0/8", "192.168.1.10"],
+	"emails": ["jane@example.org", "example.com"],
+	"uris": ["spiffe://example.org/ns/default", "https://example.com/"],
+	"maxValidity": "90d",
+	"keys": [{"kty": "EC", "crv": "P-256"}, {"kty": "RSA", "minSize": 3072}],
+	"forbiddenExtensions": ["basicConstraints", "1.2.3.4"]
+}`
+
+func mustParsePolicy(t *testing.T, s string) *Policy {
+	t.Helper()
+	p, err := ParsePolicy([]byte(s))
+	assert.FatalError(t, err)
+	return p
+}
+
+func TestParsePolicy(t *testing.T) {
+	p := mustParsePolicy(t, testPolicy)
+	assert.Equals(t, 90*24*time.Hour, p.MaxValidity.Duration)
+	assert.Len(t, 2, p.Keys)
+	assert.Equals(t, "RSA >= 3072", p.Keys[1].String())
+
+	tests := map[string]string{
+		"unknown field": `{"foo": "bar"}`,
+		"dns":           `{"dns": ["foo.*.example.com"]}`,
+		"dns wildcard":  `{"dns": ["*example.com"]}`,
+		"email":         `{"emails": ["jane@"]}`,
+		"uri":           `{"uris": ["example.com"]}`,
+		"ip":            `{"ips": ["10.0.0.0/33"]}`,
+		"duration":      `{"maxValidity": "1y"}`,
+		"kty":           `{"keys": [{"kty": "DSA"}]}`,
+		"crv":           `{"keys": [{"kty": "EC", "crv": "P-224"}]}`,
+		"size":          `{"keys": [{"kty": "EC", "minSize": 256}]}`,
+		"extension":     `{"forbiddenExtensions": ["foo"]}`,
+	}
+	for name, s := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParsePolicy([]byte(s))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestMatchDNSPattern(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.example.com", "foo.example.com", true},
+		{"*.example.com", "FOO.Example.com.", true},
+		{"*.example.com", "example.com", false},
+		{"*.example.com", "foo.bar.example.com", false},
+		{"*.example.com", "fooexample.com", false},
+		{".example.com", "foo.bar.example.com", true},
+		{".example.com", "example.com", false},
+		{".example.com", "fooexample.com", false},
+		{"example.com", "example.com", true},
+		{"example.com", "foo.example.com", false},
+	}
+	for _, tt := range tests {
+		assert.Equals(t, tt.want, matchDNSPattern(tt.pattern, tt.name), tt.pattern+" "+tt.name)
+	}
+}
+
+func TestPolicy_CheckCertificate(t *testing.T) {
+	p := mustParsePolicy(t, testPolicy)
+	ecKey := mustGenerateKey(t, "EC", "P-256", 0)
+	now := time.Now()
+
+	valid := func() *x509.Certificate {
+		return &x509.Certificate{
+			Subject:        pkix.Name{CommonName: "Jane Doe"},
+			DNSNames:       []string{"foo.example.com", "a.b.internal.example.com", "example.org"},
+			IPAddresses:    []net.IP{net.ParseIP("10.1.2.3"), net.ParseIP("192.168.1.10")},
+			EmailAddresses: []string{"jane@example.org", "joe@example.com"},
+			URIs: []*url.URL{
+				{Scheme: "spiffe", Host: "example.org", Path: "/ns/default/sa/foo"},
+				{Scheme: "https", Host: "example.com", Path: "/foo"},
+			},
+			NotBefore: now,
+			NotAfter:  now.Add(90 * 24 * time.Hour),
+			PublicKey: ecKey.Public(),
+		}
+	}
+	assert.FatalError(t, p.CheckCertificate(valid()))
+
+	tests := map[string]struct {
+		modify func(crt *x509.Certificate)
+		want   string
+	}{
+		"dns": {func(crt *x509.Certificate) {
+			crt.DNSNames = append(crt.DNSNames, "foo.example.net")
+		}, "DNS name foo.example.net is not allowed"},
+		"wildcard": {func(crt *x509.Certificate) {
+			crt.DNSNames = append(crt.DNSNames, "*.example.com")
+		}, "DNS name *.example.com is not allowed: wildcard names are not allowed"},
+		"ip": {func(crt *x509.Certificate) {
+			crt.IPAddresses = append(crt.IPAddresses, net.ParseIP("192.168.1.11"))
+		}, "IP address 192.168.1.11 is not allowed"},
+		"email": {func(crt *x509.Certificate) {
+			crt.EmailAddresses = append(crt.EmailAddresses, "joe@example.org")
+		}, "email address joe@example.org is not allowed"},
+		"uri segment": {func(crt *x509.Certificate) {
+			crt.URIs = append(crt.URIs, &url.URL{Scheme: "spiffe", Host: "example.org", Path: "/ns/defaults"})
+		}, "URI spiffe://example.org/ns/defaults is not allowed"},
+		"common name": {func(crt *x509.Certificate) {
+			crt.Subject.CommonName = "*.corp"
+		}, "common name: DNS name *.corp is not allowed: wildcard names are not allowed"},
+		"validity": {func(crt *x509.Certificate) {
+			crt.NotAfter = crt.NotBefore.Add(91 * 24 * time.Hour)
+		}, "validity 2184h0m0s exceeds the maximum of 2160h0m0s"},
+		"key": {func(crt *x509.Certificate) {
+			crt.PublicKey = mustGenerateKey(t, "RSA", "", 2048).Public()
+		}, "key RSA 2048 is not allowed"},
+		"basic constraints": {func(crt *x509.Certificate) {
+			crt.BasicConstraintsValid = true
+		}, "extension basicConstraints is forbidden"},
+		"extension": {func(crt *x509.Certificate) {
+			crt.ExtraExtensions = []pkix.Extension{{Id: []int{1, 2, 3, 4}, Value: []byte{5, 0}}}
+		}, "extension 1.2.3.4 is forbidden"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			crt := valid()
+			tt.modify(crt)
+			err := p.CheckCertificate(crt)
+			if assert.Error(t, err) {
+				perr, ok := err.(*PolicyError)
+				assert.True(t, ok)
+				assert.Equals(t, []string{tt.want}, perr.Violations)
+			}
+		})
+	}
+
+	// Wildcards and multiple violations.
+	p.AllowWildcardNames = true
+	crt := valid()
+	crt.Subject.CommonName = "*.corp"
+	crt.DNSNames = append(crt.DNSNames, "*.example.com")
+	crt.NotAfter = crt.NotBefore.Add(365 * 24 * time.Hour)
+	err := p.CheckCertificate(crt)
+	if assert.Error(t, err) {
+		assert.Equals(t, "certificate does not comply with the issuance policy:\n"+
+			"  - common name: DNS name *.corp is not allowed\n"+
+			"  - validity 8760h0m0s exceeds the maximum of 2160h0m0s", err.Error())
+	}
+}
+
+func TestWithPolicy(t *testing.T) {
+	iss, err := NewRootProfile("Test Root")
+	assert.FatalError(t, err)
+	b, err := iss.CreateCertificate()
+	assert.FatalError(t, err)
+	issCrt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+
+	key := mustGenerateKey(t, "EC", "P-256", 0)
+	csrFor := func(names ...string) *x509.CertificateRequest {
+		der, err := CreateCertificateRequest(&x509.CertificateRequest{
+			Subject:  pkix.Name{CommonName: names[0]},
+			DNSNames: names,
+		}, RequestAttributes{}, key)
+		assert.FatalError(t, err)
+		csr, err := x509.ParseCertificateRequest(der)
+		assert.FatalError(t, err)
+		return csr
+	}
+
+	policy := mustParsePolicy(t, `{"dns": [".team.internal"], "maxValidity": "12h"}`)
+
+	p, err := NewLeafProfileWithCSR(csrFor("foo.team.internal"), issCrt, iss.SubjectPrivateKey(),
+		WithPolicy(policy), WithNotBeforeAfterDuration(time.Time{}, time.Time{}, time.Hour))
+	assert.FatalError(t, err)
+	_, err = p.CreateCertificate()
+	assert.FatalError(t, err)
+
+	// The default validity of a leaf certificate exceeds the maximum.
+	p, err = NewLeafProfileWithCSR(csrFor("*.corp", "foo.team.internal"), issCrt, iss.SubjectPrivateKey(), WithPolicy(policy))
+	assert.FatalError(t, err)
+	_, err = p.CreateCertificate()
+	if assert.Error(t, err) {
+		perr, ok := err.(*PolicyError)
+		assert.True(t, ok)
+		assert.Len(t, 2, perr.Violations)
+		assert.True(t, strings.HasPrefix(perr.Violations[0], "DNS name *.corp is not allowed"))
+		assert.True(t, strings.HasPrefix(perr.Violations[1], "validity 24h0m0s exceeds"), perr.Violations[1])
+	}
+}
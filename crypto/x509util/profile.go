@@ -10,6 +10,7 @@ import (
 	"encoding/pem"
 	"math/big"
 	"net"
+	"net/url"
 	"strings"
 	"time"
 
@@ -53,6 +54,10 @@ var (
 	// oidExtensionCTPoison is the OID for the certificate transparency poison
 	// extension defined in RFC6962.
 	oidExtensionCTPoison = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 3}
+
+	// oidExtensionInhibitAnyPolicy is the OID for the inhibit anyPolicy
+	// extension defined in RFC5280.
+	oidExtensionInhibitAnyPolicy = asn1.ObjectIdentifier{2, 5, 29, 54}
 )
 
 // Profile is an interface that certificate profiles (e.g. leaf,
@@ -82,6 +87,7 @@ type base struct {
 	subPub  interface{}
 	subPriv interface{}
 	issPriv interface{}
+	policy  *Policy
 }
 
 // WithOption is a modifier function on base.
@@ -207,6 +213,16 @@ func WithEmailAddresses(emails []string) WithOption {
 	}
 }
 
+// WithURIs returns a Profile modifier which sets the URIs that will be bound
+// to the subject alternative name extension of the Certificate.
+func WithURIs(uris []*url.URL) WithOption {
+	return func(p Profile) error {
+		crt := p.Subject()
+		crt.URIs = uris
+		return nil
+	}
+}
+
 // WithHosts returns a Profile modifier which sets the DNS Names and IP Addresses
 // that will be bound to the subject Certificate.
 //
@@ -245,6 +261,103 @@ func WithCTPoison() WithOption {
 
 }
 
+// NameConstraints are the permitted and excluded subtrees of the name
+// constraints extension of a certificate authority.
+type NameConstraints struct {
+	PermittedDNSDomains     []string
+	ExcludedDNSDomains      []string
+	PermittedIPRanges       []*net.IPNet
+	ExcludedIPRanges        []*net.IPNet
+	PermittedEmailAddresses []string
+	ExcludedEmailAddresses  []string
+	PermittedURIDomains     []string
+	ExcludedURIDomains      []string
+}
+
+// WithNameConstraints returns a Profile modifier which sets the name
+// constraints extension of the Certificate. As required by RFC5280 the
+// extension will be marked as critical.
+func WithNameConstraints(nc NameConstraints) WithOption {
+	return func(p Profile) error {
+		crt := p.Subject()
+		if !crt.IsCA {
+			return errors.New("name constraints can only be used in certificate authorities")
+		}
+		crt.PermittedDNSDomainsCritical = true
+		crt.PermittedDNSDomains = nc.PermittedDNSDomains
+		crt.ExcludedDNSDomains = nc.ExcludedDNSDomains
+		crt.PermittedIPRanges = nc.PermittedIPRanges
+		crt.ExcludedIPRanges = nc.ExcludedIPRanges
+		crt.PermittedEmailAddresses = nc.PermittedEmailAddresses
+		crt.ExcludedEmailAddresses = nc.ExcludedEmailAddresses
+		crt.PermittedURIDomains = nc.PermittedURIDomains
+		crt.ExcludedURIDomains = nc.ExcludedURIDomains
+		return nil
+	}
+}
+
+// WithMaxPathLen returns a Profile modifier which sets the maximum number of
+// intermediate certificates that may follow the Certificate in a valid chain.
+// A negative value means that the path length is not constrained.
+func WithMaxPathLen(n int) WithOption {
+	return func(p Profile) error {
+		crt := p.Subject()
+		if !crt.IsCA {
+			return errors.New("path length constraints can only be used in certificate authorities")
+		}
+		if n < 0 {
+			crt.MaxPathLen, crt.MaxPathLenZero = -1, false
+		} else {
+			crt.MaxPathLen, crt.MaxPathLenZero = n, n == 0
+		}
+		return nil
+	}
+}
+
+// WithPolicyIdentifiers returns a Profile modifier which sets the certificate
+// policies of the Certificate. The policies are object identifiers in the
+// dotted notation, e.g. 2.23.140.1.2.1.
+func WithPolicyIdentifiers(oids []string) WithOption {
+	return func(p Profile) error {
+		crt := p.Subject()
+		crt.PolicyIdentifiers = nil
+		for _, s := range oids {
+			oid, err := parseObjectIdentifier(s)
+			if err != nil {
+				return err
+			}
+			crt.PolicyIdentifiers = append(crt.PolicyIdentifiers, oid)
+		}
+		return nil
+	}
+}
+
+// WithInhibitAnyPolicy returns a Profile modifier that adds the critical
+// inhibit anyPolicy extension defined in RFC5280. The skipCerts value is the
+// number of additional certificates that may appear in the path before
+// anyPolicy is no longer permitted.
+func WithInhibitAnyPolicy(skipCerts int) WithOption {
+	return func(p Profile) error {
+		crt := p.Subject()
+		if !crt.IsCA {
+			return errors.New("inhibit anyPolicy can only be used in certificate authorities")
+		}
+		if skipCerts < 0 {
+			return errors.New("inhibit anyPolicy skip certs cannot be negative")
+		}
+		b, err := asn1.Marshal(skipCerts)
+		if err != nil {
+			return errors.Wrap(err, "error marshaling inhibit anyPolicy extension")
+		}
+		crt.ExtraExtensions = append(crt.ExtraExtensions, pkix.Extension{
+			Id:       oidExtensionInhibitAnyPolicy,
+			Critical: true,
+			Value:    b,
+		})
+		return nil
+	}
+}
+
 // newProfile initializes the given profile.
 //
 // If the public/private key pair of the subject identity are not set by
@@ -355,6 +468,10 @@ func (b *base) RemoveExtension(oid asn1.ObjectIdentifier) {
 	}
 }
 
+func (b *base) setPolicy(policy *Policy) {
+	b.policy = policy
+}
+
 func (b *base) DefaultDuration() time.Duration {
 	return DefaultCertValidity
 }
@@ -395,6 +512,24 @@ func (b *base) CreateCertificate() ([]byte, error) {
 		sub.ExtraExtensions = append(sub.ExtraExtensions, b.ext...)
 	}
 
+	if b.policy != nil {
+		crt := *sub
+		crt.PublicKey = b.SubjectPublicKey()
+		if err := b.policy.CheckCertificate(&crt); err != nil {
+			return nil, err
+		}
+	}
+
+	// Use the signature algorithm matching the issuer key if none is set.
+	if _, ok := b.issPriv.(crypto.Signer); ok {
+		if sub.SignatureAlgorithm == x509.UnknownSignatureAlgorithm {
+			sub.SignatureAlgorithm = DefaultSignatureAlgorithm(b.issPriv)
+		}
+		if err := CheckSignatureAlgorithm(sub.SignatureAlgorithm, b.issPriv); err != nil {
+			return nil, err
+		}
+	}
+
 	bytes, err := x509.CreateCertificate(rand.Reader, sub, iss, b.SubjectPublicKey(), b.issPriv)
 	return bytes, errors.WithStack(err)
 }
@@ -0,0 +1,101 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"net"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestCAConstraintOptions(t *testing.T) {
+	_, ipNet, err := net.ParseCIDR("10.0.0.0/8")
+	assert.FatalError(t, err)
+
+	root, err := NewRootProfile("root",
+		WithMaxPathLen(-1),
+		WithPolicyIdentifiers([]string{"2.5.29.32.0"}))
+	assert.FatalError(t, err)
+	b, err := root.CreateCertificate()
+	assert.FatalError(t, err)
+	rootCrt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+	assert.Equals(t, -1, rootCrt.MaxPathLen)
+	assert.False(t, rootCrt.MaxPathLenZero)
+	assert.Equals(t, []asn1.ObjectIdentifier{{2, 5, 29, 32, 0}}, rootCrt.PolicyIdentifiers)
+
+	inter, err := NewIntermediateProfile("intermediate", rootCrt, root.SubjectPrivateKey(),
+		WithNameConstraints(NameConstraints{
+			PermittedDNSDomains:     []string{".team.internal"},
+			ExcludedDNSDomains:      []string{"secret.team.internal"},
+			PermittedIPRanges:       []*net.IPNet{ipNet},
+			PermittedEmailAddresses: []string{"team.internal"},
+			PermittedURIDomains:     []string{"team.internal"},
+		}),
+		WithMaxPathLen(2),
+		WithPolicyIdentifiers([]string{"2.23.140.1.2.1", "1.2.3.4"}),
+		WithInhibitAnyPolicy(0))
+	assert.FatalError(t, err)
+	b, err = inter.CreateCertificate()
+	assert.FatalError(t, err)
+	interCrt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+	assert.NoError(t, interCrt.CheckSignatureFrom(rootCrt))
+	assert.True(t, interCrt.PermittedDNSDomainsCritical)
+	assert.Equals(t, []string{".team.internal"}, interCrt.PermittedDNSDomains)
+	assert.Equals(t, []string{"secret.team.internal"}, interCrt.ExcludedDNSDomains)
+	assert.Equals(t, ipNet.String(), interCrt.PermittedIPRanges[0].String())
+	assert.Equals(t, []string{"team.internal"}, interCrt.PermittedEmailAddresses)
+	assert.Equals(t, []string{"team.internal"}, interCrt.PermittedURIDomains)
+	assert.Equals(t, 2, interCrt.MaxPathLen)
+	assert.Equals(t, []asn1.ObjectIdentifier{{2, 23, 140, 1, 2, 1}, {1, 2, 3, 4}}, interCrt.PolicyIdentifiers)
+
+	var found bool
+	for _, ext := range interCrt.Extensions {
+		if ext.Id.Equal(oidExtensionInhibitAnyPolicy) {
+			var skipCerts int
+			_, err := asn1.Unmarshal(ext.Value, &skipCerts)
+			assert.FatalError(t, err)
+			assert.True(t, ext.Critical)
+			assert.Equals(t, 0, skipCerts)
+			found = true
+		}
+	}
+	assert.True(t, found)
+
+	inter, err = NewIntermediateProfile("intermediate", rootCrt, root.SubjectPrivateKey(), WithMaxPathLen(0))
+	assert.FatalError(t, err)
+	b, err = inter.CreateCertificate()
+	assert.FatalError(t, err)
+	interCrt, err = x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+	assert.Equals(t, 0, interCrt.MaxPathLen)
+	assert.True(t, interCrt.MaxPathLenZero)
+}
+
+func TestCAConstraintOptionsErrors(t *testing.T) {
+	root, err := NewRootProfile("root")
+	assert.FatalError(t, err)
+	b, err := root.CreateCertificate()
+	assert.FatalError(t, err)
+	rootCrt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+
+	tests := map[string]WithOption{
+		"name-constraints":   WithNameConstraints(NameConstraints{PermittedDNSDomains: []string{"foo"}}),
+		"max-path-len":       WithMaxPathLen(1),
+		"inhibit-any-policy": WithInhibitAnyPolicy(1),
+	}
+	for name, opt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewLeafProfile("foo", rootCrt, root.SubjectPrivateKey(), opt)
+			assert.Error(t, err)
+		})
+	}
+
+	_, err = NewRootProfile("root", WithPolicyIdentifiers([]string{"foo.bar"}))
+	assert.Error(t, err)
+	_, err = NewRootProfile("root", WithInhibitAnyPolicy(-1))
+	assert.Error(t, err)
+}
@@ -0,0 +1,178 @@
+package x509util
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/crypto/pemutil"
+)
+
+// signatureAlgorithms are the signature algorithms supported to sign
+// certificates and certificate requests.
+var signatureAlgorithms = []x509.SignatureAlgorithm{
+	x509.SHA256WithRSA,
+	x509.SHA384WithRSA,
+	x509.SHA512WithRSA,
+	x509.SHA256WithRSAPSS,
+	x509.SHA384WithRSAPSS,
+	x509.SHA512WithRSAPSS,
+	x509.ECDSAWithSHA256,
+	x509.ECDSAWithSHA384,
+	x509.ECDSAWithSHA512,
+	x509.PureEd25519,
+}
+
+// SignatureAlgorithmNames returns the names of the supported signature
+// algorithms, e.g. SHA256-RSAPSS or ECDSA-SHA384.
+func SignatureAlgorithmNames() []string {
+	names := make([]string, len(signatureAlgorithms))
+	for i, alg := range signatureAlgorithms {
+		names[i] = alg.String()
+	}
+	return names
+}
+
+// ParseSignatureAlgorithm returns the signature algorithm with the given name.
+// The name is case-insensitive and has the format used by
+// x509.SignatureAlgorithm, e.g. SHA256-RSAPSS or ECDSA-SHA384.
+func ParseSignatureAlgorithm(name string) (x509.SignatureAlgorithm, error) {
+	for _, alg := range signatureAlgorithms {
+		if strings.EqualFold(alg.String(), name) {
+			return alg, nil
+		}
+	}
+	return x509.UnknownSignatureAlgorithm, errors.Errorf("unsupported signature algorithm %s", name)
+}
+
+// DefaultSignatureAlgorithm returns the signature algorithm used by default
+// with the given key, the key can be a public key or the private key used to
+// sign. RSA keys use SHA256-RSA, ECDSA keys use the hash matching the size of
+// the curve, and Ed25519 keys use Ed25519. RSA-PSS private keys use the
+// RSA-PSS algorithm with the hash the key is restricted to, or SHA256-RSAPSS
+// if the key has no restrictions.
+func DefaultSignatureAlgorithm(key interface{}) x509.SignatureAlgorithm {
+	if k, ok := key.(*pemutil.RSAPSSPrivateKey); ok {
+		switch k.Hash {
+		case 0, crypto.SHA256:
+			return x509.SHA256WithRSAPSS
+		case crypto.SHA384:
+			return x509.SHA384WithRSAPSS
+		case crypto.SHA512:
+			return x509.SHA512WithRSAPSS
+		default:
+			return x509.UnknownSignatureAlgorithm
+		}
+	}
+	if signer, ok := key.(crypto.Signer); ok {
+		key = signer.Public()
+	}
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return x509.SHA256WithRSA
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P384():
+			return x509.ECDSAWithSHA384
+		case elliptic.P521():
+			return x509.ECDSAWithSHA512
+		default:
+			return x509.ECDSAWithSHA256
+		}
+	case ed25519.PublicKey:
+		return x509.PureEd25519
+	default:
+		return x509.UnknownSignatureAlgorithm
+	}
+}
+
+// CheckSignatureAlgorithm returns an error if the signature algorithm cannot
+// be used with the given key, the key can be a public key or the private key
+// used to sign. RSA-PSS private keys can only be used with the RSA-PSS
+// algorithms, and only with the hash the key is restricted to.
+func CheckSignatureAlgorithm(alg x509.SignatureAlgorithm, key interface{}) error {
+	if k, ok := key.(*pemutil.RSAPSSPrivateKey); ok {
+		switch alg {
+		case x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS, x509.SHA512WithRSAPSS:
+			if k.Hash != 0 && k.Hash != signatureHash(alg) {
+				return errors.Errorf("signature algorithm %s cannot be used with RSA-PSS keys restricted to %s", alg, k.Hash)
+			}
+			return nil
+		default:
+			return errors.Errorf("signature algorithm %s cannot be used with RSA-PSS keys", alg)
+		}
+	}
+	if signer, ok := key.(crypto.Signer); ok {
+		key = signer.Public()
+	}
+
+	var ok bool
+	switch alg {
+	case x509.SHA256WithRSA, x509.SHA384WithRSA, x509.SHA512WithRSA,
+		x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS, x509.SHA512WithRSAPSS:
+		_, ok = key.(*rsa.PublicKey)
+	case x509.ECDSAWithSHA256, x509.ECDSAWithSHA384, x509.ECDSAWithSHA512:
+		_, ok = key.(*ecdsa.PublicKey)
+	case x509.PureEd25519:
+		_, ok = key.(ed25519.PublicKey)
+	default:
+		return errors.Errorf("unsupported signature algorithm %s", alg)
+	}
+	if !ok {
+		return errors.Errorf("signature algorithm %s cannot be used with %s keys", alg, PublicKeyString(key))
+	}
+	return nil
+}
+
+// signatureHash returns the hash function used by the signature algorithm.
+func signatureHash(alg x509.SignatureAlgorithm) crypto.Hash {
+	switch alg {
+	case x509.SHA256WithRSA, x509.SHA256WithRSAPSS, x509.ECDSAWithSHA256:
+		return crypto.SHA256
+	case x509.SHA384WithRSA, x509.SHA384WithRSAPSS, x509.ECDSAWithSHA384:
+		return crypto.SHA384
+	case x509.SHA512WithRSA, x509.SHA512WithRSAPSS, x509.ECDSAWithSHA512:
+		return crypto.SHA512
+	default:
+		return 0
+	}
+}
+
+// WithSignatureAlgorithm returns a Profile modifier that sets the algorithm
+// used by the issuer to sign the certificate. If it is not set, the algorithm
+// is chosen using the issuer key, see DefaultSignatureAlgorithm.
+func WithSignatureAlgorithm(alg x509.SignatureAlgorithm) WithOption {
+	return func(p Profile) error {
+		p.Subject().SignatureAlgorithm = alg
+		return nil
+	}
+}
+
+// signData signs the data with the given signer and signature algorithm.
+func signData(signer crypto.Signer, alg x509.SignatureAlgorithm, data []byte) ([]byte, error) {
+	if err := CheckSignatureAlgorithm(alg, signer); err != nil {
+		return nil, err
+	}
+
+	hash := signatureHash(alg)
+
+	switch alg {
+	case x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS, x509.SHA512WithRSAPSS:
+		h := hash.New()
+		h.Write(data)
+		signature, err := signer.Sign(rand.Reader, h.Sum(nil), &rsa.PSSOptions{
+			SaltLength: rsa.PSSSaltLengthEqualsHash,
+			Hash:       hash,
+		})
+		return signature, errors.Wrap(err, "error signing")
+	default:
+		return sign(signer, hash, data)
+	}
+}
@@ -0,0 +1,130 @@
+package x509util
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/cli/crypto/keys"
+	"github.com/smallstep/cli/crypto/pemutil"
+)
+
+func TestParseSignatureAlgorithm(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    x509.SignatureAlgorithm
+		wantErr bool
+	}{
+		{"SHA256-RSA", x509.SHA256WithRSA, false},
+		{"sha384-rsapss", x509.SHA384WithRSAPSS, false},
+		{"ECDSA-SHA512", x509.ECDSAWithSHA512, false},
+		{"ed25519", x509.PureEd25519, false},
+		{"SHA1-RSA", x509.UnknownSignatureAlgorithm, true},
+		{"foo", x509.UnknownSignatureAlgorithm, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSignatureAlgorithm(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSignatureAlgorithm() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equals(t, tt.want, got)
+		})
+	}
+	assert.Len(t, len(signatureAlgorithms), SignatureAlgorithmNames())
+}
+
+func mustGenerateKey(t *testing.T, kty, crv string, size int) crypto.Signer {
+	t.Helper()
+	key, err := keys.GenerateKey(kty, crv, size)
+	assert.FatalError(t, err)
+	return key.(crypto.Signer)
+}
+
+func TestSignatureAlgorithmProfile(t *testing.T) {
+	rsaKey := mustGenerateKey(t, "RSA", "", 2048)
+	p384Key := mustGenerateKey(t, "EC", "P-384", 0)
+	p521Key := mustGenerateKey(t, "EC", "P-521", 0)
+	edKey := mustGenerateKey(t, "OKP", "Ed25519", 0)
+	pssKey := &pemutil.RSAPSSPrivateKey{PrivateKey: rsaKey.(*rsa.PrivateKey)}
+	pss384Key := &pemutil.RSAPSSPrivateKey{PrivateKey: rsaKey.(*rsa.PrivateKey), Hash: crypto.SHA384, SaltLength: 48}
+
+	assert.Equals(t, x509.SHA256WithRSA, DefaultSignatureAlgorithm(rsaKey.Public()))
+	assert.Equals(t, x509.SHA256WithRSA, DefaultSignatureAlgorithm(rsaKey))
+	assert.Equals(t, x509.ECDSAWithSHA384, DefaultSignatureAlgorithm(p384Key.Public()))
+	assert.Equals(t, x509.ECDSAWithSHA512, DefaultSignatureAlgorithm(p521Key.Public()))
+	assert.Equals(t, x509.PureEd25519, DefaultSignatureAlgorithm(edKey.Public()))
+	assert.Equals(t, x509.SHA256WithRSAPSS, DefaultSignatureAlgorithm(pssKey))
+	assert.Equals(t, x509.SHA384WithRSAPSS, DefaultSignatureAlgorithm(pss384Key))
+
+	tests := []struct {
+		name    string
+		key     crypto.Signer
+		alg     x509.SignatureAlgorithm
+		want    x509.SignatureAlgorithm
+		wantErr bool
+	}{
+		{"rsa default", rsaKey, x509.UnknownSignatureAlgorithm, x509.SHA256WithRSA, false},
+		{"rsa pss", rsaKey, x509.SHA384WithRSAPSS, x509.SHA384WithRSAPSS, false},
+		{"rsa sha512", rsaKey, x509.SHA512WithRSA, x509.SHA512WithRSA, false},
+		{"p384 default", p384Key, x509.UnknownSignatureAlgorithm, x509.ECDSAWithSHA384, false},
+		{"p521 default", p521Key, x509.UnknownSignatureAlgorithm, x509.ECDSAWithSHA512, false},
+		{"p384 sha256", p384Key, x509.ECDSAWithSHA256, x509.ECDSAWithSHA256, false},
+		{"ed25519 default", edKey, x509.UnknownSignatureAlgorithm, x509.PureEd25519, false},
+		{"rsapss default", pssKey, x509.UnknownSignatureAlgorithm, x509.SHA256WithRSAPSS, false},
+		{"rsapss sha512", pssKey, x509.SHA512WithRSAPSS, x509.SHA512WithRSAPSS, false},
+		{"rsapss384 default", pss384Key, x509.UnknownSignatureAlgorithm, x509.SHA384WithRSAPSS, false},
+		{"rsapss384 sha384", pss384Key, x509.SHA384WithRSAPSS, x509.SHA384WithRSAPSS, false},
+		{"fail ecdsa pss", p384Key, x509.SHA256WithRSAPSS, 0, true},
+		{"fail rsa ecdsa", rsaKey, x509.ECDSAWithSHA256, 0, true},
+		{"fail ed25519 rsa", edKey, x509.SHA256WithRSA, 0, true},
+		{"fail rsapss pkcs1", pssKey, x509.SHA256WithRSA, 0, true},
+		{"fail rsapss384 sha256", pss384Key, x509.SHA256WithRSAPSS, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []WithOption
+			if tt.alg != x509.UnknownSignatureAlgorithm {
+				opts = append(opts, WithSignatureAlgorithm(tt.alg))
+			}
+			opts = append(opts, func(p Profile) error {
+				p.SetSubjectPublicKey(tt.key.Public())
+				p.SetSubjectPrivateKey(tt.key)
+				return nil
+			})
+			p, err := NewRootProfile("Test Root", opts...)
+			assert.FatalError(t, err)
+			b, err := p.CreateCertificate()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.FatalError(t, err)
+			crt, err := x509.ParseCertificate(b)
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.want, crt.SignatureAlgorithm)
+			assert.FatalError(t, crt.CheckSignatureFrom(crt))
+		})
+	}
+}
+
+func TestCreateCertificateRequest_rsaPSS(t *testing.T) {
+	rsaKey := mustGenerateKey(t, "RSA", "", 2048)
+	pss384Key := &pemutil.RSAPSSPrivateKey{PrivateKey: rsaKey.(*rsa.PrivateKey), Hash: crypto.SHA384, SaltLength: 48}
+
+	template := &x509.CertificateRequest{Subject: pkix.Name{CommonName: "test"}}
+	der, err := CreateCertificateRequest(template, RequestAttributes{ChallengePassword: "password"}, pss384Key)
+	assert.FatalError(t, err)
+	csr, err := x509.ParseCertificateRequest(der)
+	assert.FatalError(t, err)
+	assert.Equals(t, x509.SHA384WithRSAPSS, csr.SignatureAlgorithm)
+	assert.FatalError(t, csr.CheckSignature())
+	assert.Equals(t, x509.UnknownSignatureAlgorithm, template.SignatureAlgorithm)
+
+	template.SignatureAlgorithm = x509.SHA256WithRSA
+	_, err = CreateCertificateRequest(template, RequestAttributes{}, pss384Key)
+	assert.Error(t, err)
+}
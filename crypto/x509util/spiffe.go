@@ -0,0 +1,90 @@
+package x509util
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// spiffeScheme is the URI scheme of SPIFFE IDs.
+const spiffeScheme = "spiffe"
+
+// IsSPIFFEID returns true if the given URI uses the spiffe scheme.
+func IsSPIFFEID(u *url.URL) bool {
+	return u != nil && strings.EqualFold(u.Scheme, spiffeScheme)
+}
+
+// ValidateSPIFFEID validates the syntax of a SPIFFE ID as defined in the
+// SPIFFE ID specification. A SPIFFE ID has the form
+// spiffe://<trust-domain>/<path>, where the trust domain only contains lower
+// case letters, numbers, dots, dashes and underscores, and the path segments
+// only contain letters, numbers, dots, dashes and underscores.
+func ValidateSPIFFEID(u *url.URL) error {
+	id := u.String()
+	switch {
+	case u.Scheme != spiffeScheme:
+		return errors.Errorf("invalid SPIFFE ID '%s': scheme must be '%s'", id, spiffeScheme)
+	case u.Opaque != "" || u.Host == "":
+		return errors.Errorf("invalid SPIFFE ID '%s': trust domain cannot be empty", id)
+	case u.User != nil:
+		return errors.Errorf("invalid SPIFFE ID '%s': user info is not allowed", id)
+	case u.Port() != "":
+		return errors.Errorf("invalid SPIFFE ID '%s': port is not allowed", id)
+	case u.RawQuery != "" || u.ForceQuery:
+		return errors.Errorf("invalid SPIFFE ID '%s': query is not allowed", id)
+	case u.Fragment != "":
+		return errors.Errorf("invalid SPIFFE ID '%s': fragment is not allowed", id)
+	}
+
+	for _, c := range u.Host {
+		if !isSPIFFEChar(c) || ('A' <= c && c <= 'Z') {
+			return errors.Errorf("invalid SPIFFE ID '%s': trust domain contains an invalid character '%c'", id, c)
+		}
+	}
+
+	if u.Path == "" {
+		return nil
+	}
+	if u.RawPath != "" {
+		return errors.Errorf("invalid SPIFFE ID '%s': path cannot contain percent-encoded characters", id)
+	}
+	for _, segment := range strings.Split(u.Path[1:], "/") {
+		switch segment {
+		case "":
+			return errors.Errorf("invalid SPIFFE ID '%s': path cannot contain empty segments or a trailing slash", id)
+		case ".", "..":
+			return errors.Errorf("invalid SPIFFE ID '%s': path cannot contain relative segments", id)
+		}
+		for _, c := range segment {
+			if !isSPIFFEChar(c) {
+				return errors.Errorf("invalid SPIFFE ID '%s': path contains an invalid character '%c'", id, c)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateURIs validates the URIs used as Subject Alternative Names. SPIFFE
+// IDs must be syntactically valid and a certificate can only contain one
+// SPIFFE ID.
+func ValidateURIs(uris []*url.URL) error {
+	var spiffeIDs int
+	for _, u := range uris {
+		if IsSPIFFEID(u) {
+			if err := ValidateSPIFFEID(u); err != nil {
+				return err
+			}
+			spiffeIDs++
+		}
+	}
+	if spiffeIDs > 1 {
+		return errors.New("invalid Subject Alternative Names: only one SPIFFE ID is allowed")
+	}
+	return nil
+}
+
+func isSPIFFEChar(c rune) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') ||
+		c == '.' || c == '-' || c == '_'
+}
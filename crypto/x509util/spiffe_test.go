@@ -0,0 +1,65 @@
+package x509util
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestValidateSPIFFEID(t *testing.T) {
+	tests := []struct {
+		id      string
+		wantErr bool
+	}{
+		{"spiffe://example.org", false},
+		{"spiffe://example.org/foo", false},
+		{"spiffe://example.org/ns/default/sa/foo-bar_1.0", false},
+		{"spiffe://my-trust_domain.example.org/Foo", false},
+		{"https://example.org/foo", true},
+		{"spiffe:example.org/foo", true},
+		{"spiffe:///foo", true},
+		{"spiffe://Example.org/foo", true},
+		{"spiffe://user@example.org/foo", true},
+		{"spiffe://example.org:8443/foo", true},
+		{"spiffe://example.org/foo?bar=zar", true},
+		{"spiffe://example.org/foo#bar", true},
+		{"spiffe://example.org/", true},
+		{"spiffe://example.org/foo/", true},
+		{"spiffe://example.org/foo//bar", true},
+		{"spiffe://example.org/foo/../bar", true},
+		{"spiffe://example.org/./foo", true},
+		{"spiffe://example.org/foo%20bar", true},
+		{"spiffe://example.org/foo$bar", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			u, err := url.Parse(tt.id)
+			assert.FatalError(t, err)
+			err = ValidateSPIFFEID(u)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateURIs(t *testing.T) {
+	parse := func(ss ...string) []*url.URL {
+		var uris []*url.URL
+		for _, s := range ss {
+			u, err := url.Parse(s)
+			assert.FatalError(t, err)
+			uris = append(uris, u)
+		}
+		return uris
+	}
+
+	assert.NoError(t, ValidateURIs(nil))
+	assert.NoError(t, ValidateURIs(parse("https://example.org/foo", "urn:foo:bar")))
+	assert.NoError(t, ValidateURIs(parse("spiffe://example.org/foo", "https://example.org/foo")))
+	assert.Error(t, ValidateURIs(parse("spiffe://example.org/foo/")))
+	assert.Error(t, ValidateURIs(parse("spiffe://example.org/foo", "spiffe://example.org/bar")))
+}
@@ -0,0 +1,385 @@
+package x509util
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// Keys of the variables available in a certificate template besides the ones
+// defined by the user.
+const (
+	// SubjectKey is the key of the subject variable, usually the common name
+	// of the certificate.
+	SubjectKey = "Subject"
+	// SANsKey is the key of the list of Subject Alternative Names.
+	SANsKey = "SANs"
+)
+
+// TemplateData is the data used to render a certificate template.
+type TemplateData map[string]interface{}
+
+// Set sets the variable key to the given value.
+func (t TemplateData) Set(key string, v interface{}) {
+	t[key] = v
+}
+
+// SetSubject sets the subject variable in the template data.
+func (t TemplateData) SetSubject(v string) {
+	t.Set(SubjectKey, v)
+}
+
+// SetSANs sets the Subject Alternative Names variable in the template data.
+func (t TemplateData) SetSANs(sans []string) {
+	t.Set(SANsKey, sans)
+}
+
+// templateFuncs are the functions available in certificate templates.
+var templateFuncs = template.FuncMap{
+	"toJson": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"join": func(sep string, v []string) string {
+		return strings.Join(v, sep)
+	},
+	"split": func(sep, s string) []string {
+		return strings.Split(s, sep)
+	},
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+}
+
+// CertificateTemplate is the JSON representation of the fields of a
+// certificate that can be defined in a template.
+type CertificateTemplate struct {
+	Subject               ASN1DN              `json:"subject"`
+	SANs                  []string            `json:"sans"`
+	DNSNames              []string            `json:"dnsNames"`
+	IPAddresses           []string            `json:"ipAddresses"`
+	EmailAddresses        []string            `json:"emailAddresses"`
+	URIs                  []string            `json:"uris"`
+	KeyUsage              []string            `json:"keyUsage"`
+	ExtKeyUsage           []string            `json:"extKeyUsage"`
+	BasicConstraints      *BasicConstraints   `json:"basicConstraints"`
+	PolicyIdentifiers     []string            `json:"policyIdentifiers"`
+	OCSPServer            []string            `json:"ocspServer"`
+	IssuingCertificateURL []string            `json:"issuingCertificateURL"`
+	CRLDistributionPoints []string            `json:"crlDistributionPoints"`
+	Extensions            []ExtensionTemplate `json:"extensions"`
+}
+
+// BasicConstraints is the JSON representation of the basic constraints
+// extension. A nil MaxPathLen means that the path length is not constrained.
+type BasicConstraints struct {
+	IsCA       bool `json:"isCA"`
+	MaxPathLen *int `json:"maxPathLen"`
+}
+
+// ExtensionTemplate is the JSON representation of an arbitrary extension. The
+// value is the base64 encoding of the DER-encoded extension value.
+type ExtensionTemplate struct {
+	ID       string `json:"id"`
+	Critical bool   `json:"critical"`
+	Value    []byte `json:"value"`
+}
+
+// RenderTemplate executes the given text/template with the data and returns
+// the resulting certificate template.
+func RenderTemplate(text string, data TemplateData) (*CertificateTemplate, error) {
+	tmpl, err := template.New("certificate").Funcs(templateFuncs).
+		Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing certificate template")
+	}
+
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, map[string]interface{}(data)); err != nil {
+		return nil, errors.Wrap(err, "error executing certificate template")
+	}
+
+	ct := new(CertificateTemplate)
+	if err := json.Unmarshal(buf.Bytes(), ct); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling certificate template:\n%s", buf.String())
+	}
+	return ct, nil
+}
+
+// IsCA returns true if the template describes a certificate authority.
+func (ct *CertificateTemplate) IsCA() bool {
+	return ct.BasicConstraints != nil && ct.BasicConstraints.IsCA
+}
+
+// Modify sets the properties defined in the template in the given certificate.
+func (ct *CertificateTemplate) Modify(crt *x509.Certificate) error {
+	crt.Subject = ct.Subject.pkixName()
+
+	dnsNames, ips, emails, uris := SplitSANsWithURIs(ct.SANs)
+	for _, s := range ct.IPAddresses {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return errors.Errorf("error parsing certificate template: '%s' is not a valid IP address", s)
+		}
+		ips = append(ips, ip)
+	}
+	crt.DNSNames = append(dnsNames, ct.DNSNames...)
+	crt.IPAddresses = ips
+	crt.EmailAddresses = append(emails, ct.EmailAddresses...)
+	crt.URIs = uris
+	for _, s := range ct.URIs {
+		u, err := url.Parse(s)
+		if err != nil {
+			return errors.Wrapf(err, "error parsing certificate template: '%s' is not a valid URI", s)
+		}
+		crt.URIs = append(crt.URIs, u)
+	}
+	if err := ValidateURIs(crt.URIs); err != nil {
+		return errors.Wrap(err, "error parsing certificate template")
+	}
+
+	if ct.KeyUsage != nil {
+		ku, err := parseKeyUsage(ct.KeyUsage)
+		if err != nil {
+			return err
+		}
+		crt.KeyUsage = ku
+	}
+
+	if ct.ExtKeyUsage != nil {
+		ekus, oids, err := parseExtKeyUsages(ct.ExtKeyUsage)
+		if err != nil {
+			return err
+		}
+		crt.ExtKeyUsage, crt.UnknownExtKeyUsage = ekus, oids
+	}
+
+	if bc := ct.BasicConstraints; bc != nil {
+		crt.BasicConstraintsValid = true
+		crt.IsCA = bc.IsCA
+		switch {
+		case !bc.IsCA || bc.MaxPathLen == nil:
+			crt.MaxPathLen, crt.MaxPathLenZero = -1, false
+		case *bc.MaxPathLen < 0:
+			return errors.Errorf("error parsing certificate template: maxPathLen cannot be negative")
+		default:
+			crt.MaxPathLen = *bc.MaxPathLen
+			crt.MaxPathLenZero = *bc.MaxPathLen == 0
+		}
+	}
+
+	for _, s := range ct.PolicyIdentifiers {
+		oid, err := parseObjectIdentifier(s)
+		if err != nil {
+			return err
+		}
+		crt.PolicyIdentifiers = append(crt.PolicyIdentifiers, oid)
+	}
+
+	crt.OCSPServer = append(crt.OCSPServer, ct.OCSPServer...)
+	crt.IssuingCertificateURL = append(crt.IssuingCertificateURL, ct.IssuingCertificateURL...)
+	crt.CRLDistributionPoints = append(crt.CRLDistributionPoints, ct.CRLDistributionPoints...)
+
+	for _, e := range ct.Extensions {
+		oid, err := parseObjectIdentifier(e.ID)
+		if err != nil {
+			return err
+		}
+		crt.ExtraExtensions = append(crt.ExtraExtensions, pkix.Extension{
+			Id:       oid,
+			Critical: e.Critical,
+			Value:    e.Value,
+		})
+	}
+
+	return nil
+}
+
+// NewProfileFromTemplate returns a new x509 Certificate profile with the
+// properties defined in the rendered template. The profile will be a leaf or
+// an intermediate depending on the basic constraints of the template. If the
+// issuer is nil the profile will be self-signed, and it will be a root if the
+// template describes a certificate authority.
+//
+// A new public/private key pair will be generated for the Profile if not set
+// in the `withOps` profile modifiers.
+func NewProfileFromTemplate(text string, data TemplateData, iss *x509.Certificate, issPriv crypto.PrivateKey, withOps ...WithOption) (Profile, error) {
+	ct, err := RenderTemplate(text, data)
+	if err != nil {
+		return nil, err
+	}
+	return NewProfileFromCertificateTemplate(ct, iss, issPriv, withOps...)
+}
+
+// NewProfileFromCertificateTemplate is like NewProfileFromTemplate but uses an
+// already rendered template.
+func NewProfileFromCertificateTemplate(ct *CertificateTemplate, iss *x509.Certificate, issPriv crypto.PrivateKey, withOps ...WithOption) (Profile, error) {
+	var (
+		p   Profile
+		sub *x509.Certificate
+		err error
+	)
+	switch {
+	case iss == nil && ct.IsCA():
+		p, sub = &Root{}, defaultRootTemplate("")
+	case iss == nil:
+		p, sub = &Leaf{}, defaultLeafTemplate(pkix.Name{}, pkix.Name{})
+	case ct.IsCA():
+		p, sub = &Intermediate{}, defaultIntermediateTemplate("")
+	default:
+		p, sub = &Leaf{}, defaultLeafTemplate(pkix.Name{}, iss.Subject)
+	}
+	if err := ct.Modify(sub); err != nil {
+		return nil, err
+	}
+
+	if iss == nil {
+		sub.Issuer = sub.Subject
+		if p, err = newProfile(p, sub, sub, nil, withOps...); err != nil {
+			return nil, err
+		}
+		// self-signed certificate
+		p.SetIssuerPrivateKey(p.SubjectPrivateKey())
+		return p, nil
+	}
+
+	sub.Issuer = iss.Subject
+	return newProfile(p, sub, iss, issPriv, withOps...)
+}
+
+// pkixName returns the pkix.Name representation of the ASN1DN.
+func (d ASN1DN) pkixName() pkix.Name {
+	var name pkix.Name
+	name.CommonName = d.CommonName
+	if d.Country != "" {
+		name.Country = []string{d.Country}
+	}
+	if d.Organization != "" {
+		name.Organization = []string{d.Organization}
+	}
+	if d.OrganizationalUnit != "" {
+		name.OrganizationalUnit = []string{d.OrganizationalUnit}
+	}
+	if d.Locality != "" {
+		name.Locality = []string{d.Locality}
+	}
+	if d.Province != "" {
+		name.Province = []string{d.Province}
+	}
+	if d.StreetAddress != "" {
+		name.StreetAddress = []string{d.StreetAddress}
+	}
+	return name
+}
+
+var keyUsages = map[string]x509.KeyUsage{
+	"digitalsignature":  x509.KeyUsageDigitalSignature,
+	"contentcommitment": x509.KeyUsageContentCommitment,
+	"keyencipherment":   x509.KeyUsageKeyEncipherment,
+	"dataencipherment":  x509.KeyUsageDataEncipherment,
+	"keyagreement":      x509.KeyUsageKeyAgreement,
+	"certsign":          x509.KeyUsageCertSign,
+	"crlsign":           x509.KeyUsageCRLSign,
+	"encipheronly":      x509.KeyUsageEncipherOnly,
+	"decipheronly":      x509.KeyUsageDecipherOnly,
+}
+
+var extKeyUsages = map[string]x509.ExtKeyUsage{
+	"any":                            x509.ExtKeyUsageAny,
+	"serverauth":                     x509.ExtKeyUsageServerAuth,
+	"clientauth":                     x509.ExtKeyUsageClientAuth,
+	"codesigning":                    x509.ExtKeyUsageCodeSigning,
+	"emailprotection":                x509.ExtKeyUsageEmailProtection,
+	"ipsecendsystem":                 x509.ExtKeyUsageIPSECEndSystem,
+	"ipsectunnel":                    x509.ExtKeyUsageIPSECTunnel,
+	"ipsecuser":                      x509.ExtKeyUsageIPSECUser,
+	"timestamping":                   x509.ExtKeyUsageTimeStamping,
+	"ocspsigning":                    x509.ExtKeyUsageOCSPSigning,
+	"microsoftservergatedcrypto":     x509.ExtKeyUsageMicrosoftServerGatedCrypto,
+	"netscapeservergatedcrypto":      x509.ExtKeyUsageNetscapeServerGatedCrypto,
+	"microsoftcommercialcodesigning": x509.ExtKeyUsageMicrosoftCommercialCodeSigning,
+	"microsoftkernelcodesigning":     x509.ExtKeyUsageMicrosoftKernelCodeSigning,
+}
+
+// normalizeUsage removes dashes, underscores and spaces from a key usage name
+// and lowercases it, e.g. "Digital Signature" and "digital-signature" are
+// both "digitalsignature".
+func normalizeUsage(s string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", "_", "", " ", "").Replace(s))
+}
+
+// parseKeyUsage returns the key usage bits of the given list of names.
+func parseKeyUsage(names []string) (x509.KeyUsage, error) {
+	var ku x509.KeyUsage
+	for _, name := range names {
+		v, ok := keyUsages[normalizeUsage(name)]
+		if !ok {
+			return 0, errors.Errorf("unsupported key usage '%s'", name)
+		}
+		ku |= v
+	}
+	return ku, nil
+}
+
+// parseExtKeyUsage returns the extended key usage with the given name. If
+// the name is an object identifier not known by the x509 package the oid is
+// returned instead.
+func parseExtKeyUsage(name string) (x509.ExtKeyUsage, asn1.ObjectIdentifier, error) {
+	if v, ok := extKeyUsages[normalizeUsage(name)]; ok {
+		return v, nil, nil
+	}
+	oid, err := parseObjectIdentifier(name)
+	if err != nil {
+		return 0, nil, errors.Errorf("unsupported extended key usage '%s'", name)
+	}
+	return 0, oid, nil
+}
+
+// parseExtKeyUsages returns the extended key usages and the unknown extended
+// key usages of the given list of names and object identifiers.
+func parseExtKeyUsages(names []string) ([]x509.ExtKeyUsage, []asn1.ObjectIdentifier, error) {
+	var (
+		ekus []x509.ExtKeyUsage
+		oids []asn1.ObjectIdentifier
+	)
+	for _, name := range names {
+		eku, oid, err := parseExtKeyUsage(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if oid != nil {
+			oids = append(oids, oid)
+		} else {
+			ekus = append(ekus, eku)
+		}
+	}
+	return ekus, oids, nil
+}
+
+// parseObjectIdentifier parses an object identifier in dot notation, e.g.
+// "1.3.6.1.5.5.7.3.1".
+func parseObjectIdentifier(s string) (asn1.ObjectIdentifier, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 {
+		return nil, errors.Errorf("invalid object identifier '%s'", s)
+	}
+	oid := make(asn1.ObjectIdentifier, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, errors.Errorf("invalid object identifier '%s'", s)
+		}
+		oid[i] = n
+	}
+	return oid, nil
+}
@@ -0,0 +1,160 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"net"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+const testLeafTemplate = `{
+	"subject": {"commonName": {{ toJson .Subject }}, "organization": {{ toJson .org }}},
+	"sans": {{ toJson .SANs }},
+	"keyUsage": ["digitalSignature", "key-encipherment"],
+	"extKeyUsage": ["serverAuth", "1.2.3.4"],
+	"policyIdentifiers": ["2.23.140.1.2.1"],
+	"extensions": [{"id": "1.2.3.5", "critical": false, "value": "BQA="}]
+}`
+
+const testCATemplate = `{
+	"subject": {"commonName": {{ toJson .Subject }}},
+	"keyUsage": ["certSign", "crlSign"],
+	"basicConstraints": {"isCA": true, "maxPathLen": {{ .pathLen }}}
+}`
+
+func TestRenderTemplate(t *testing.T) {
+	tests := map[string]struct {
+		text string
+		data TemplateData
+		err  string
+	}{
+		"ok": {
+			text: testLeafTemplate,
+			data: TemplateData{"Subject": "foo", "SANs": []string{"foo"}, "org": "Smallstep"},
+		},
+		"fail/parse": {
+			text: `{"subject": {{ .Subject }`,
+			err:  "error parsing certificate template",
+		},
+		"fail/missing": {
+			text: testLeafTemplate,
+			data: TemplateData{"Subject": "foo", "SANs": []string{"foo"}},
+			err:  "error executing certificate template",
+		},
+		"fail/json": {
+			text: `{"subject": {{ .Subject }}}`,
+			data: TemplateData{"Subject": "foo"},
+			err:  "error unmarshaling certificate template",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ct, err := RenderTemplate(tc.text, tc.data)
+			if tc.err != "" {
+				if assert.Error(t, err) {
+					assert.HasPrefix(t, err.Error(), tc.err)
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, "foo", ct.Subject.CommonName)
+			assert.Equals(t, "Smallstep", ct.Subject.Organization)
+			assert.Equals(t, []string{"foo"}, ct.SANs)
+		})
+	}
+}
+
+func TestNewProfileFromTemplate(t *testing.T) {
+	root, err := NewProfileFromTemplate(testCATemplate, TemplateData{"Subject": "root", "pathLen": 1}, nil, nil)
+	assert.FatalError(t, err)
+	_, ok := root.(*Root)
+	assert.True(t, ok)
+	b, err := root.CreateCertificate()
+	assert.FatalError(t, err)
+	rootCrt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+	assert.True(t, rootCrt.IsCA)
+	assert.Equals(t, 1, rootCrt.MaxPathLen)
+	assert.Equals(t, "root", rootCrt.Issuer.CommonName)
+	assert.Equals(t, x509.KeyUsageCertSign|x509.KeyUsageCRLSign, rootCrt.KeyUsage)
+
+	inter, err := NewProfileFromTemplate(testCATemplate, TemplateData{"Subject": "intermediate", "pathLen": 0}, rootCrt, root.SubjectPrivateKey())
+	assert.FatalError(t, err)
+	_, ok = inter.(*Intermediate)
+	assert.True(t, ok)
+	b, err = inter.CreateCertificate()
+	assert.FatalError(t, err)
+	interCrt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+	assert.True(t, interCrt.MaxPathLenZero)
+	assert.Equals(t, "root", interCrt.Issuer.CommonName)
+	assert.NoError(t, interCrt.CheckSignatureFrom(rootCrt))
+
+	leaf, err := NewProfileFromTemplate(testLeafTemplate, TemplateData{
+		"Subject": "foo.internal",
+		"SANs":    []string{"foo.internal", "10.0.0.1", "foo@internal"},
+		"org":     "Smallstep",
+	}, interCrt, inter.SubjectPrivateKey())
+	assert.FatalError(t, err)
+	_, ok = leaf.(*Leaf)
+	assert.True(t, ok)
+	b, err = leaf.CreateCertificate()
+	assert.FatalError(t, err)
+	leafCrt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+	assert.NoError(t, leafCrt.CheckSignatureFrom(interCrt))
+	assert.Equals(t, "foo.internal", leafCrt.Subject.CommonName)
+	assert.Equals(t, []string{"Smallstep"}, leafCrt.Subject.Organization)
+	assert.Equals(t, []string{"foo.internal"}, leafCrt.DNSNames)
+	assert.True(t, net.ParseIP("10.0.0.1").Equal(leafCrt.IPAddresses[0]))
+	assert.Equals(t, []string{"foo@internal"}, leafCrt.EmailAddresses)
+	assert.Equals(t, x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment, leafCrt.KeyUsage)
+	assert.Equals(t, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, leafCrt.ExtKeyUsage)
+	assert.Equals(t, []asn1.ObjectIdentifier{{1, 2, 3, 4}}, leafCrt.UnknownExtKeyUsage)
+	assert.Equals(t, []asn1.ObjectIdentifier{{2, 23, 140, 1, 2, 1}}, leafCrt.PolicyIdentifiers)
+	assert.False(t, leafCrt.IsCA)
+
+	var found bool
+	for _, ext := range leafCrt.Extensions {
+		if ext.Id.Equal(asn1.ObjectIdentifier{1, 2, 3, 5}) {
+			found = true
+			assert.Equals(t, []byte{5, 0}, ext.Value)
+		}
+	}
+	assert.True(t, found)
+}
+
+func TestNewProfileFromCertificateTemplate(t *testing.T) {
+	ct, err := RenderTemplate(testCATemplate, TemplateData{"Subject": "root", "pathLen": 1})
+	assert.FatalError(t, err)
+	assert.True(t, ct.IsCA())
+	root, err := NewProfileFromCertificateTemplate(ct, nil, nil)
+	assert.FatalError(t, err)
+	_, ok := root.(*Root)
+	assert.True(t, ok)
+	b, err := root.CreateCertificate()
+	assert.FatalError(t, err)
+	rootCrt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+	assert.Equals(t, "root", rootCrt.Subject.CommonName)
+	assert.Equals(t, 1, rootCrt.MaxPathLen)
+}
+
+func TestNewProfileFromTemplate_errors(t *testing.T) {
+	tests := map[string]string{
+		"key usage":     `{"keyUsage": ["foo"]}`,
+		"ext key usage": `{"extKeyUsage": ["foo"]}`,
+		"ip":            `{"ipAddresses": ["foo"]}`,
+		"policy":        `{"policyIdentifiers": ["1.foo"]}`,
+		"extension":     `{"extensions": [{"id": "1"}]}`,
+		"path len":      `{"basicConstraints": {"isCA": true, "maxPathLen": -1}}`,
+	}
+	for name, text := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewProfileFromTemplate(text, TemplateData{}, nil, nil)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -46,6 +46,8 @@ func (v TLSVersion) String() string {
 		return "1.1"
 	case tls.VersionTLS12:
 		return "1.2"
+	case tls.VersionTLS13:
+		return "1.3"
 	default:
 		return fmt.Sprintf("unexpected value: %d", k)
 	}
@@ -59,6 +61,7 @@ var tlsVersions = map[TLSVersion]uint16{
 	1.0: tls.VersionTLS10,
 	1.1: tls.VersionTLS11,
 	1.2: tls.VersionTLS12,
+	1.3: tls.VersionTLS13,
 }
 
 // CipherSuites represents an array of string codes representing the cipher
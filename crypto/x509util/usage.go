@@ -0,0 +1,227 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// oidExtensionExtendedKeyUsage is the OID for the extended key usage
+// extension defined in RFC5280.
+var oidExtensionExtendedKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+
+// extKeyUsageOIDs maps the extended key usages defined in the x509 package to
+// their object identifiers.
+var extKeyUsageOIDs = map[x509.ExtKeyUsage]asn1.ObjectIdentifier{
+	x509.ExtKeyUsageAny:                            {2, 5, 29, 37, 0},
+	x509.ExtKeyUsageServerAuth:                     {1, 3, 6, 1, 5, 5, 7, 3, 1},
+	x509.ExtKeyUsageClientAuth:                     {1, 3, 6, 1, 5, 5, 7, 3, 2},
+	x509.ExtKeyUsageCodeSigning:                    {1, 3, 6, 1, 5, 5, 7, 3, 3},
+	x509.ExtKeyUsageEmailProtection:                {1, 3, 6, 1, 5, 5, 7, 3, 4},
+	x509.ExtKeyUsageIPSECEndSystem:                 {1, 3, 6, 1, 5, 5, 7, 3, 5},
+	x509.ExtKeyUsageIPSECTunnel:                    {1, 3, 6, 1, 5, 5, 7, 3, 6},
+	x509.ExtKeyUsageIPSECUser:                      {1, 3, 6, 1, 5, 5, 7, 3, 7},
+	x509.ExtKeyUsageTimeStamping:                   {1, 3, 6, 1, 5, 5, 7, 3, 8},
+	x509.ExtKeyUsageOCSPSigning:                    {1, 3, 6, 1, 5, 5, 7, 3, 9},
+	x509.ExtKeyUsageMicrosoftServerGatedCrypto:     {1, 3, 6, 1, 4, 1, 311, 10, 3, 3},
+	x509.ExtKeyUsageNetscapeServerGatedCrypto:      {2, 16, 840, 1, 113730, 4, 1},
+	x509.ExtKeyUsageMicrosoftCommercialCodeSigning: {1, 3, 6, 1, 4, 1, 311, 2, 1, 22},
+	x509.ExtKeyUsageMicrosoftKernelCodeSigning:     {1, 3, 6, 1, 4, 1, 311, 61, 1, 1},
+}
+
+// extKeyUsageNames are the names used to display the extended key usages.
+var extKeyUsageNames = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:                            "any",
+	x509.ExtKeyUsageServerAuth:                     "serverAuth",
+	x509.ExtKeyUsageClientAuth:                     "clientAuth",
+	x509.ExtKeyUsageCodeSigning:                    "codeSigning",
+	x509.ExtKeyUsageEmailProtection:                "emailProtection",
+	x509.ExtKeyUsageIPSECEndSystem:                 "ipsecEndSystem",
+	x509.ExtKeyUsageIPSECTunnel:                    "ipsecTunnel",
+	x509.ExtKeyUsageIPSECUser:                      "ipsecUser",
+	x509.ExtKeyUsageTimeStamping:                   "timeStamping",
+	x509.ExtKeyUsageOCSPSigning:                    "ocspSigning",
+	x509.ExtKeyUsageMicrosoftServerGatedCrypto:     "microsoftServerGatedCrypto",
+	x509.ExtKeyUsageNetscapeServerGatedCrypto:      "netscapeServerGatedCrypto",
+	x509.ExtKeyUsageMicrosoftCommercialCodeSigning: "microsoftCommercialCodeSigning",
+	x509.ExtKeyUsageMicrosoftKernelCodeSigning:     "microsoftKernelCodeSigning",
+}
+
+// Usage is a preset of the key usage and extended key usage of a leaf
+// certificate.
+type Usage struct {
+	KeyUsage    x509.KeyUsage
+	ExtKeyUsage []x509.ExtKeyUsage
+	// CriticalExtKeyUsage marks the extended key usage extension as critical,
+	// RFC3161 requires it for time-stamping certificates.
+	CriticalExtKeyUsage bool
+}
+
+// usages are the built-in presets supported by WithUsage.
+var usages = map[string]Usage{
+	"server": {
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	},
+	"client": {
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	},
+	"code-signing": {
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	},
+	"email": {
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageContentCommitment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+	},
+	"ocsp-signing": {
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+	},
+	"timestamping": {
+		KeyUsage:            x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:         []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+		CriticalExtKeyUsage: true,
+	},
+}
+
+// GetUsage returns the usage preset with the given name.
+func GetUsage(name string) (Usage, bool) {
+	u, ok := usages[name]
+	return u, ok
+}
+
+// UsageNames returns the sorted list of the names of the usage presets.
+func UsageNames() []string {
+	names := make([]string, 0, len(usages))
+	for name := range usages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WithUsage returns a Profile modifier which sets the key usage and extended
+// key usage of the Certificate using the preset with the given name.
+func WithUsage(name string) WithOption {
+	return func(p Profile) error {
+		u, ok := GetUsage(name)
+		if !ok {
+			return errors.Errorf("unsupported usage '%s'", name)
+		}
+		crt := p.Subject()
+		crt.KeyUsage = u.KeyUsage
+		crt.ExtKeyUsage = append([]x509.ExtKeyUsage{}, u.ExtKeyUsage...)
+		crt.UnknownExtKeyUsage = nil
+		p.RemoveExtension(oidExtensionExtendedKeyUsage)
+		if u.CriticalExtKeyUsage {
+			ext, err := marshalExtKeyUsage(crt.ExtKeyUsage, nil)
+			if err != nil {
+				return err
+			}
+			ext.Critical = true
+			crt.ExtraExtensions = append(crt.ExtraExtensions, ext)
+		}
+		return nil
+	}
+}
+
+// WithKeyUsage returns a Profile modifier which sets the key usage of the
+// Certificate. The names are case-insensitive, e.g. digitalSignature or
+// digital-signature.
+func WithKeyUsage(names []string) WithOption {
+	return func(p Profile) error {
+		ku, err := parseKeyUsage(names)
+		if err != nil {
+			return err
+		}
+		p.Subject().KeyUsage = ku
+		return nil
+	}
+}
+
+// WithExtKeyUsage returns a Profile modifier which sets the extended key usage
+// of the Certificate. The values can be names, e.g. serverAuth or
+// code-signing, or object identifiers in the dotted notation.
+func WithExtKeyUsage(names []string) WithOption {
+	return func(p Profile) error {
+		ekus, oids, err := parseExtKeyUsages(names)
+		if err != nil {
+			return err
+		}
+		crt := p.Subject()
+		crt.ExtKeyUsage, crt.UnknownExtKeyUsage = ekus, oids
+		p.RemoveExtension(oidExtensionExtendedKeyUsage)
+		return nil
+	}
+}
+
+// ParseExtKeyUsage returns the extended key usage with the given name. The
+// names are case-insensitive, e.g. serverAuth or server-auth.
+func ParseExtKeyUsage(name string) (x509.ExtKeyUsage, error) {
+	eku, ok := extKeyUsages[normalizeUsage(name)]
+	if !ok {
+		return 0, errors.Errorf("unsupported extended key usage '%s'", name)
+	}
+	return eku, nil
+}
+
+// ExtKeyUsageString returns the name of the given extended key usage.
+func ExtKeyUsageString(eku x509.ExtKeyUsage) string {
+	if name, ok := extKeyUsageNames[eku]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", eku)
+}
+
+// keyUsageNames are the names of the key usage bits in the order they are
+// defined in RFC 5280.
+var keyUsageNames = []struct {
+	usage x509.KeyUsage
+	name  string
+}{
+	{x509.KeyUsageDigitalSignature, "digitalSignature"},
+	{x509.KeyUsageContentCommitment, "contentCommitment"},
+	{x509.KeyUsageKeyEncipherment, "keyEncipherment"},
+	{x509.KeyUsageDataEncipherment, "dataEncipherment"},
+	{x509.KeyUsageKeyAgreement, "keyAgreement"},
+	{x509.KeyUsageCertSign, "certSign"},
+	{x509.KeyUsageCRLSign, "crlSign"},
+	{x509.KeyUsageEncipherOnly, "encipherOnly"},
+	{x509.KeyUsageDecipherOnly, "decipherOnly"},
+}
+
+// KeyUsageStrings returns the names of the bits set in the given key usage.
+func KeyUsageStrings(ku x509.KeyUsage) []string {
+	var names []string
+	for _, u := range keyUsageNames {
+		if ku&u.usage != 0 {
+			names = append(names, u.name)
+		}
+	}
+	return names
+}
+
+// marshalExtKeyUsage returns the extended key usage extension with the given
+// usages.
+func marshalExtKeyUsage(ekus []x509.ExtKeyUsage, unknown []asn1.ObjectIdentifier) (pkix.Extension, error) {
+	oids := make([]asn1.ObjectIdentifier, 0, len(ekus)+len(unknown))
+	for _, eku := range ekus {
+		oid, ok := extKeyUsageOIDs[eku]
+		if !ok {
+			return pkix.Extension{}, errors.Errorf("unsupported extended key usage %d", eku)
+		}
+		oids = append(oids, oid)
+	}
+	oids = append(oids, unknown...)
+	b, err := asn1.Marshal(oids)
+	if err != nil {
+		return pkix.Extension{}, errors.Wrap(err, "error marshaling extended key usage extension")
+	}
+	return pkix.Extension{Id: oidExtensionExtendedKeyUsage, Value: b}, nil
+}
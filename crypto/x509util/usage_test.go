@@ -0,0 +1,80 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestWithUsage(t *testing.T) {
+	root, err := NewRootProfile("root")
+	assert.FatalError(t, err)
+	b, err := root.CreateCertificate()
+	assert.FatalError(t, err)
+	rootCrt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+
+	for _, name := range UsageNames() {
+		t.Run(name, func(t *testing.T) {
+			u, ok := GetUsage(name)
+			assert.True(t, ok)
+			leaf, err := NewLeafProfile("foo", rootCrt, root.SubjectPrivateKey(), WithUsage(name))
+			assert.FatalError(t, err)
+			b, err := leaf.CreateCertificate()
+			assert.FatalError(t, err)
+			crt, err := x509.ParseCertificate(b)
+			assert.FatalError(t, err)
+			assert.Equals(t, u.KeyUsage, crt.KeyUsage)
+			assert.Equals(t, u.ExtKeyUsage, crt.ExtKeyUsage)
+			for _, ext := range crt.Extensions {
+				if ext.Id.Equal(oidExtensionExtendedKeyUsage) {
+					assert.Equals(t, u.CriticalExtKeyUsage, ext.Critical)
+				}
+			}
+		})
+	}
+
+	_, err = NewLeafProfile("foo", rootCrt, root.SubjectPrivateKey(), WithUsage("foo"))
+	assert.Error(t, err)
+}
+
+func TestWithKeyUsage(t *testing.T) {
+	root, err := NewRootProfile("root")
+	assert.FatalError(t, err)
+	b, err := root.CreateCertificate()
+	assert.FatalError(t, err)
+	rootCrt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+
+	leaf, err := NewLeafProfile("foo", rootCrt, root.SubjectPrivateKey(),
+		WithUsage("timestamping"),
+		WithKeyUsage([]string{"digitalSignature", "key-agreement"}),
+		WithExtKeyUsage([]string{"clientAuth", "Code Signing", "1.3.6.1.5.5.7.3.17"}))
+	assert.FatalError(t, err)
+	b, err = leaf.CreateCertificate()
+	assert.FatalError(t, err)
+	crt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+	assert.Equals(t, x509.KeyUsageDigitalSignature|x509.KeyUsageKeyAgreement, crt.KeyUsage)
+	assert.Equals(t, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageCodeSigning}, crt.ExtKeyUsage)
+	assert.Equals(t, []asn1.ObjectIdentifier{{1, 3, 6, 1, 5, 5, 7, 3, 17}}, crt.UnknownExtKeyUsage)
+	for _, ext := range crt.Extensions {
+		if ext.Id.Equal(oidExtensionExtendedKeyUsage) {
+			assert.False(t, ext.Critical)
+		}
+	}
+
+	_, err = NewLeafProfile("foo", rootCrt, root.SubjectPrivateKey(), WithKeyUsage([]string{"foo"}))
+	assert.Error(t, err)
+	_, err = NewLeafProfile("foo", rootCrt, root.SubjectPrivateKey(), WithExtKeyUsage([]string{"foo"}))
+	assert.Error(t, err)
+}
+
+func TestKeyUsageStrings(t *testing.T) {
+	assert.Len(t, 0, KeyUsageStrings(0))
+	assert.Equals(t, []string{"digitalSignature", "keyEncipherment"},
+		KeyUsageStrings(x509.KeyUsageKeyEncipherment|x509.KeyUsageDigitalSignature))
+	assert.Equals(t, []string{"certSign", "crlSign"}, KeyUsageStrings(x509.KeyUsageCertSign|x509.KeyUsageCRLSign))
+}
@@ -0,0 +1,593 @@
+package x509util
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxVerifyPaths is the maximum number of candidate paths diagnosed.
+const maxVerifyPaths = 16
+
+// maxVerifyPathLength is the maximum number of certificates in a candidate
+// path.
+const maxVerifyPathLength = 10
+
+// Names of the checks in a VerifyReport.
+const (
+	CheckValidity         = "validity"
+	CheckSignature        = "signature"
+	CheckBasicConstraints = "basic-constraints"
+	CheckPathLength       = "path-length"
+	CheckExtKeyUsage      = "ext-key-usage"
+	CheckNameConstraints  = "name-constraints"
+	CheckTrustAnchor      = "trust-anchor"
+	CheckHostname         = "hostname"
+	CheckIPAddress        = "ip"
+	CheckEmail            = "email"
+)
+
+// DiagnoseOptions are the options used to verify and diagnose a certificate.
+type DiagnoseOptions struct {
+	// Roots are the trusted certificates, if empty the system roots are used.
+	Roots []*x509.Certificate
+	// Intermediates are the certificates used to build the paths to a root.
+	Intermediates []*x509.Certificate
+	// CurrentTime is the time used to check the validity, defaults to now.
+	CurrentTime time.Time
+	// DNSName, IPAddress and Email, if set, are checked against the Subject
+	// Alternative Names of the certificate.
+	DNSName   string
+	IPAddress net.IP
+	Email     string
+	// KeyUsages are the accepted extended key usages, defaults to serverAuth.
+	KeyUsages []x509.ExtKeyUsage
+}
+
+// VerifyCheck is the result of a check done verifying a certificate.
+type VerifyCheck struct {
+	Name    string `json:"check"`
+	Subject string `json:"subject,omitempty"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message"`
+}
+
+// VerifyCertificate is the summary of a certificate in a VerifyPath.
+type VerifyCertificate struct {
+	Subject      string    `json:"subject"`
+	Issuer       string    `json:"issuer"`
+	SerialNumber string    `json:"serial_number"`
+	NotBefore    time.Time `json:"not_before"`
+	NotAfter     time.Time `json:"not_after"`
+	Fingerprint  string    `json:"fingerprint"`
+}
+
+// VerifyPath is a candidate path from the certificate to a trusted root and
+// the result of the checks done in each certificate of the path.
+type VerifyPath struct {
+	Certificates []VerifyCertificate `json:"certificates"`
+	Trusted      bool                `json:"trusted"`
+	Valid        bool                `json:"valid"`
+	Checks       []VerifyCheck       `json:"checks"`
+}
+
+// VerifyReport is the result of the verification of a certificate. It
+// contains the checks done on the certificate identity and all the
+// candidate paths found with the result of their checks.
+type VerifyReport struct {
+	Valid  bool          `json:"valid"`
+	Error  string        `json:"error,omitempty"`
+	Time   time.Time     `json:"time"`
+	Checks []VerifyCheck `json:"checks,omitempty"`
+	Paths  []*VerifyPath `json:"paths"`
+
+	// Chains are the valid chains returned by the x509 package.
+	Chains [][]*x509.Certificate `json:"-"`
+	// Err is the error found verifying the certificate.
+	Err error `json:"-"`
+}
+
+// DiagnoseVerify verifies the certificate using the x509 package and builds
+// a report with the result of every check in every candidate path from the
+// certificate to a trusted root. The report is valid if the x509 package can
+// verify the certificate and the certificate matches the given DNS name, IP
+// address and email.
+func DiagnoseVerify(crt *x509.Certificate, opts DiagnoseOptions) *VerifyReport {
+	now := opts.CurrentTime
+	if now.IsZero() {
+		now = time.Now()
+	}
+	keyUsages := opts.KeyUsages
+	if len(keyUsages) == 0 {
+		keyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	}
+
+	var rootPool *x509.CertPool
+	if len(opts.Roots) > 0 {
+		rootPool = x509.NewCertPool()
+		for _, c := range opts.Roots {
+			rootPool.AddCert(c)
+		}
+	}
+	intermediatePool := x509.NewCertPool()
+	for _, c := range opts.Intermediates {
+		intermediatePool.AddCert(c)
+	}
+
+	report := &VerifyReport{Time: now}
+	report.Chains, report.Err = crt.Verify(x509.VerifyOptions{
+		DNSName:       opts.DNSName,
+		Roots:         rootPool,
+		Intermediates: intermediatePool,
+		CurrentTime:   now,
+		KeyUsages:     keyUsages,
+	})
+
+	// Checks on the identity of the certificate.
+	if opts.DNSName != "" {
+		report.Checks = append(report.Checks, hostnameCheck(crt, CheckHostname, opts.DNSName))
+	}
+	if opts.IPAddress != nil {
+		check := hostnameCheck(crt, CheckIPAddress, opts.IPAddress.String())
+		if !check.Passed && report.Err == nil {
+			report.Err = errors.New(check.Message)
+		}
+		report.Checks = append(report.Checks, check)
+	}
+	if opts.Email != "" {
+		check := emailCheck(crt, opts.Email)
+		if !check.Passed && report.Err == nil {
+			report.Err = errors.New(check.Message)
+		}
+		report.Checks = append(report.Checks, check)
+	}
+
+	// Diagnose all the candidate paths.
+	b := &pathBuilder{
+		intermediates: opts.Intermediates,
+		roots:         opts.Roots,
+		systemRoots:   len(opts.Roots) == 0,
+	}
+	b.build([]*x509.Certificate{crt})
+	for _, p := range b.paths {
+		report.Paths = append(report.Paths, diagnosePath(p, now, keyUsages))
+	}
+
+	report.Valid = report.Err == nil
+	if report.Err != nil {
+		report.Error = report.Err.Error()
+	}
+	return report
+}
+
+// candidatePath is a path built by the pathBuilder.
+type candidatePath struct {
+	certs   []*x509.Certificate
+	trusted bool
+	// missing is the issuer of the last certificate if the path is not
+	// trusted.
+	missing string
+}
+
+// pathBuilder builds all the candidate paths from a certificate to a root.
+// Unlike the x509 package, it does not check signatures, validity or
+// constraints, so paths that would be rejected are also found.
+type pathBuilder struct {
+	intermediates []*x509.Certificate
+	roots         []*x509.Certificate
+	systemRoots   bool
+	paths         []*candidatePath
+}
+
+func (b *pathBuilder) build(path []*x509.Certificate) {
+	if len(b.paths) >= maxVerifyPaths {
+		return
+	}
+	last := path[len(path)-1]
+	if containsCertificate(b.roots, last) {
+		b.add(path, true, "")
+		return
+	}
+
+	var found bool
+	if len(path) < maxVerifyPathLength {
+		for _, pool := range [][]*x509.Certificate{b.roots, b.intermediates} {
+			for _, c := range pool {
+				if !isIssuerCandidate(last, c) || containsCertificate(path, c) {
+					continue
+				}
+				found = true
+				b.build(append(path[:len(path):len(path)], c))
+			}
+		}
+	}
+	if found {
+		return
+	}
+
+	// Look for the issuer in the system roots.
+	if b.systemRoots {
+		if anchor := systemAnchor(last); anchor != nil {
+			if bytes.Equal(anchor.Raw, last.Raw) {
+				b.add(path, true, "")
+			} else {
+				b.add(append(path[:len(path):len(path)], anchor), true, "")
+			}
+			return
+		}
+	}
+	b.add(path, false, last.Issuer.String())
+}
+
+func (b *pathBuilder) add(path []*x509.Certificate, trusted bool, missing string) {
+	b.paths = append(b.paths, &candidatePath{
+		certs:   path,
+		trusted: trusted,
+		missing: missing,
+	})
+}
+
+// isIssuerCandidate returns true if the subject and key identifiers of the
+// candidate match the issuer of the certificate.
+func isIssuerCandidate(crt, candidate *x509.Certificate) bool {
+	if !bytes.Equal(crt.RawIssuer, candidate.RawSubject) {
+		return false
+	}
+	if len(crt.AuthorityKeyId) > 0 && len(candidate.SubjectKeyId) > 0 {
+		return bytes.Equal(crt.AuthorityKeyId, candidate.SubjectKeyId)
+	}
+	return true
+}
+
+func containsCertificate(certs []*x509.Certificate, crt *x509.Certificate) bool {
+	for _, c := range certs {
+		if bytes.Equal(c.Raw, crt.Raw) {
+			return true
+		}
+	}
+	return false
+}
+
+// systemAnchor returns the system root that issued the given certificate, or
+// the certificate itself if it is a system root. The certificate is verified
+// at a time in which is valid, so expired certificates still find their
+// anchor.
+func systemAnchor(crt *x509.Certificate) *x509.Certificate {
+	t := crt.NotBefore.Add(crt.NotAfter.Sub(crt.NotBefore) / 2)
+	chains, err := crt.Verify(x509.VerifyOptions{
+		CurrentTime: t,
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil || len(chains) == 0 {
+		return nil
+	}
+	return chains[0][len(chains[0])-1]
+}
+
+// diagnosePath runs all the checks in the candidate path.
+func diagnosePath(p *candidatePath, now time.Time, keyUsages []x509.ExtKeyUsage) *VerifyPath {
+	vp := &VerifyPath{Trusted: p.trusted}
+	for _, c := range p.certs {
+		vp.Certificates = append(vp.Certificates, VerifyCertificate{
+			Subject:      c.Subject.String(),
+			Issuer:       c.Issuer.String(),
+			SerialNumber: c.SerialNumber.String(),
+			NotBefore:    c.NotBefore,
+			NotAfter:     c.NotAfter,
+			Fingerprint:  Fingerprint(c),
+		})
+	}
+
+	leaf := p.certs[0]
+	for i, c := range p.certs {
+		vp.Checks = append(vp.Checks, validityCheck(c, now))
+		if i == 0 {
+			continue
+		}
+		child := p.certs[i-1]
+		vp.Checks = append(vp.Checks, basicConstraintsCheck(c))
+		if c.MaxPathLen >= 0 && c.BasicConstraintsValid {
+			vp.Checks = append(vp.Checks, pathLengthCheck(c, i-1))
+		}
+		vp.Checks = append(vp.Checks, signatureCheck(child, c))
+		if hasNameConstraints(c) {
+			vp.Checks = append(vp.Checks, nameConstraintsCheck(leaf, c))
+		}
+	}
+	vp.Checks = append(vp.Checks, extKeyUsageCheck(p.certs, keyUsages))
+
+	if p.trusted {
+		anchor := p.certs[len(p.certs)-1]
+		vp.Checks = append(vp.Checks, VerifyCheck{
+			Name:    CheckTrustAnchor,
+			Subject: anchor.Subject.String(),
+			Passed:  true,
+			Message: "certificate is a trusted root",
+		})
+	} else {
+		last := p.certs[len(p.certs)-1]
+		check := VerifyCheck{Name: CheckTrustAnchor, Subject: last.Subject.String()}
+		if bytes.Equal(last.RawIssuer, last.RawSubject) {
+			check.Message = "self-signed certificate is not trusted"
+		} else {
+			check.Message = fmt.Sprintf("missing intermediate or root: no certificate found for issuer '%s'", p.missing)
+		}
+		vp.Checks = append(vp.Checks, check)
+	}
+
+	vp.Valid = true
+	for _, c := range vp.Checks {
+		if !c.Passed {
+			vp.Valid = false
+			break
+		}
+	}
+	return vp
+}
+
+func validityCheck(c *x509.Certificate, now time.Time) VerifyCheck {
+	check := VerifyCheck{Name: CheckValidity, Subject: c.Subject.String()}
+	switch {
+	case now.Before(c.NotBefore):
+		check.Message = fmt.Sprintf("certificate is not valid until %s, %s from %s",
+			c.NotBefore.UTC().Format(time.RFC3339), c.NotBefore.Sub(now).Round(time.Second), now.UTC().Format(time.RFC3339))
+	case now.After(c.NotAfter):
+		check.Message = fmt.Sprintf("certificate expired at %s, %s before %s",
+			c.NotAfter.UTC().Format(time.RFC3339), now.Sub(c.NotAfter).Round(time.Second), now.UTC().Format(time.RFC3339))
+	default:
+		check.Passed = true
+		check.Message = fmt.Sprintf("certificate is valid from %s to %s",
+			c.NotBefore.UTC().Format(time.RFC3339), c.NotAfter.UTC().Format(time.RFC3339))
+	}
+	return check
+}
+
+func basicConstraintsCheck(c *x509.Certificate) VerifyCheck {
+	check := VerifyCheck{Name: CheckBasicConstraints, Subject: c.Subject.String()}
+	switch {
+	case !c.BasicConstraintsValid || !c.IsCA:
+		check.Message = "certificate is not a certificate authority"
+	case c.KeyUsage != 0 && c.KeyUsage&x509.KeyUsageCertSign == 0:
+		check.Message = "certificate authority key usage does not include certSign"
+	default:
+		check.Passed = true
+		check.Message = "certificate is a certificate authority"
+	}
+	return check
+}
+
+func pathLengthCheck(c *x509.Certificate, intermediates int) VerifyCheck {
+	check := VerifyCheck{Name: CheckPathLength, Subject: c.Subject.String()}
+	check.Passed = intermediates <= c.MaxPathLen
+	if check.Passed {
+		check.Message = fmt.Sprintf("%d intermediates in the path, the maximum allowed is %d", intermediates, c.MaxPathLen)
+	} else {
+		check.Message = fmt.Sprintf("too many intermediates in the path: found %d, the maximum allowed is %d", intermediates, c.MaxPathLen)
+	}
+	return check
+}
+
+func signatureCheck(c, parent *x509.Certificate) VerifyCheck {
+	check := VerifyCheck{Name: CheckSignature, Subject: c.Subject.String()}
+	if err := parent.CheckSignature(c.SignatureAlgorithm, c.RawTBSCertificate, c.Signature); err != nil {
+		check.Message = fmt.Sprintf("signature does not match the key of '%s': %v", parent.Subject, err)
+	} else {
+		check.Passed = true
+		check.Message = fmt.Sprintf("certificate is signed by '%s'", parent.Subject)
+	}
+	return check
+}
+
+// extKeyUsageCheck checks that the requested usages are allowed by all the
+// certificates in the path. Certificates without extended key usages or with
+// the any usage allow all of them.
+func extKeyUsageCheck(path []*x509.Certificate, keyUsages []x509.ExtKeyUsage) VerifyCheck {
+	check := VerifyCheck{Name: CheckExtKeyUsage, Subject: path[0].Subject.String()}
+	requested := formatExtKeyUsages(keyUsages, nil)
+	for _, u := range keyUsages {
+		if u == x509.ExtKeyUsageAny {
+			check.Passed = true
+			check.Message = "any extended key usage is accepted"
+			return check
+		}
+	}
+
+	usable := append([]x509.ExtKeyUsage{}, keyUsages...)
+	for _, c := range path {
+		if len(c.ExtKeyUsage) == 0 && len(c.UnknownExtKeyUsage) == 0 {
+			continue
+		}
+		if containsExtKeyUsage(c.ExtKeyUsage, x509.ExtKeyUsageAny) {
+			continue
+		}
+		var remaining []x509.ExtKeyUsage
+		for _, u := range usable {
+			if containsExtKeyUsage(c.ExtKeyUsage, u) {
+				remaining = append(remaining, u)
+			}
+		}
+		if len(remaining) == 0 {
+			check.Subject = c.Subject.String()
+			check.Message = fmt.Sprintf("certificate extended key usage is [%s], but one of [%s] is required",
+				formatExtKeyUsages(c.ExtKeyUsage, c.UnknownExtKeyUsage), requested)
+			return check
+		}
+		usable = remaining
+	}
+	check.Passed = true
+	check.Message = fmt.Sprintf("certificate path is valid for [%s]", formatExtKeyUsages(usable, nil))
+	return check
+}
+
+func containsExtKeyUsage(usages []x509.ExtKeyUsage, u x509.ExtKeyUsage) bool {
+	for _, v := range usages {
+		if v == u {
+			return true
+		}
+	}
+	return false
+}
+
+func formatExtKeyUsages(usages []x509.ExtKeyUsage, unknown []asn1.ObjectIdentifier) string {
+	var names []string
+	for _, u := range usages {
+		names = append(names, ExtKeyUsageString(u))
+	}
+	for _, oid := range unknown {
+		names = append(names, oid.String())
+	}
+	return strings.Join(names, ", ")
+}
+
+// hostnameCheck checks the certificate against a DNS name or an IP address.
+func hostnameCheck(c *x509.Certificate, name, host string) VerifyCheck {
+	check := VerifyCheck{Name: name, Subject: c.Subject.String()}
+	var sans []string
+	if name == CheckIPAddress {
+		for _, ip := range c.IPAddresses {
+			sans = append(sans, ip.String())
+		}
+	} else {
+		sans = c.DNSNames
+	}
+	if err := c.VerifyHostname(host); err != nil {
+		check.Message = fmt.Sprintf("certificate is not valid for '%s', it is valid for [%s]", host, strings.Join(sans, ", "))
+	} else {
+		check.Passed = true
+		check.Message = fmt.Sprintf("certificate is valid for '%s'", host)
+	}
+	return check
+}
+
+func emailCheck(c *x509.Certificate, email string) VerifyCheck {
+	check := VerifyCheck{Name: CheckEmail, Subject: c.Subject.String()}
+	for _, e := range c.EmailAddresses {
+		if strings.EqualFold(e, email) {
+			check.Passed = true
+			check.Message = fmt.Sprintf("certificate is valid for '%s'", email)
+			return check
+		}
+	}
+	check.Message = fmt.Sprintf("certificate is not valid for '%s', it is valid for [%s]", email, strings.Join(c.EmailAddresses, ", "))
+	return check
+}
+
+func hasNameConstraints(c *x509.Certificate) bool {
+	return len(c.PermittedDNSDomains) > 0 || len(c.ExcludedDNSDomains) > 0 ||
+		len(c.PermittedIPRanges) > 0 || len(c.ExcludedIPRanges) > 0 ||
+		len(c.PermittedEmailAddresses) > 0 || len(c.ExcludedEmailAddresses) > 0 ||
+		len(c.PermittedURIDomains) > 0 || len(c.ExcludedURIDomains) > 0
+}
+
+// nameConstraintsCheck checks the Subject Alternative Names of the leaf
+// against the name constraints of a certificate authority in the path.
+func nameConstraintsCheck(leaf, ca *x509.Certificate) VerifyCheck {
+	check := VerifyCheck{Name: CheckNameConstraints, Subject: ca.Subject.String()}
+	fail := func(kind, name string, excluded bool) VerifyCheck {
+		if excluded {
+			check.Message = fmt.Sprintf("%s '%s' of '%s' is excluded by the name constraints", kind, name, leaf.Subject)
+		} else {
+			check.Message = fmt.Sprintf("%s '%s' of '%s' is not permitted by the name constraints", kind, name, leaf.Subject)
+		}
+		return check
+	}
+
+	for _, name := range leaf.DNSNames {
+		if ok, excluded := checkConstraints(name, ca.PermittedDNSDomains, ca.ExcludedDNSDomains, matchDomainConstraint); !ok {
+			return fail("DNS name", name, excluded)
+		}
+	}
+	for _, ip := range leaf.IPAddresses {
+		if ok, excluded := checkIPConstraints(ip, ca.PermittedIPRanges, ca.ExcludedIPRanges); !ok {
+			return fail("IP address", ip.String(), excluded)
+		}
+	}
+	for _, email := range leaf.EmailAddresses {
+		if ok, excluded := checkConstraints(email, ca.PermittedEmailAddresses, ca.ExcludedEmailAddresses, matchEmailConstraint); !ok {
+			return fail("email", email, excluded)
+		}
+	}
+	for _, u := range leaf.URIs {
+		if ok, excluded := checkConstraints(u.Hostname(), ca.PermittedURIDomains, ca.ExcludedURIDomains, matchDomainConstraint); !ok {
+			return fail("URI", u.String(), excluded)
+		}
+	}
+
+	check.Passed = true
+	check.Message = fmt.Sprintf("names of '%s' are permitted by the name constraints", leaf.Subject)
+	return check
+}
+
+// checkConstraints returns true if the name is permitted. If it's not, the
+// second value indicates if it was explicitly excluded.
+func checkConstraints(name string, permitted, excluded []string, match func(name, constraint string) bool) (bool, bool) {
+	for _, c := range excluded {
+		if match(name, c) {
+			return false, true
+		}
+	}
+	if len(permitted) == 0 {
+		return true, false
+	}
+	for _, c := range permitted {
+		if match(name, c) {
+			return true, false
+		}
+	}
+	return false, false
+}
+
+func checkIPConstraints(ip net.IP, permitted, excluded []*net.IPNet) (bool, bool) {
+	for _, n := range excluded {
+		if n.Contains(ip) {
+			return false, true
+		}
+	}
+	if len(permitted) == 0 {
+		return true, false
+	}
+	for _, n := range permitted {
+		if n.Contains(ip) {
+			return true, false
+		}
+	}
+	return false, false
+}
+
+// matchDomainConstraint matches a domain with a constraint as defined in
+// RFC5280: a constraint with a leading period only matches subdomains, and a
+// constraint without it matches the domain and all its subdomains.
+func matchDomainConstraint(domain, constraint string) bool {
+	domain, constraint = strings.ToLower(domain), strings.ToLower(constraint)
+	if constraint == "" {
+		return true
+	}
+	if strings.HasPrefix(constraint, ".") {
+		return strings.HasSuffix(domain, constraint)
+	}
+	return domain == constraint || strings.HasSuffix(domain, "."+constraint)
+}
+
+// matchEmailConstraint matches an email with a constraint that can be a
+// mailbox, a host, or a domain with a leading period.
+func matchEmailConstraint(email, constraint string) bool {
+	if strings.Contains(constraint, "@") {
+		return strings.EqualFold(email, constraint)
+	}
+	i := strings.LastIndex(email, "@")
+	if i < 0 {
+		return false
+	}
+	host := strings.ToLower(email[i+1:])
+	constraint = strings.ToLower(constraint)
+	if strings.HasPrefix(constraint, ".") {
+		return strings.HasSuffix(host, constraint)
+	}
+	return host == constraint
+}
@@ -0,0 +1,176 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+func TestDiagnoseVerify(t *testing.T) {
+	root, err := NewRootProfile("root")
+	assert.FatalError(t, err)
+	b, err := root.CreateCertificate()
+	assert.FatalError(t, err)
+	rootCrt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+
+	inter, err := NewIntermediateProfile("intermediate", rootCrt, root.SubjectPrivateKey(),
+		WithNameConstraints(NameConstraints{PermittedDNSDomains: []string{"example.com"}}))
+	assert.FatalError(t, err)
+	b, err = inter.CreateCertificate()
+	assert.FatalError(t, err)
+	interCrt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+
+	createLeaf := func(opts ...WithOption) *x509.Certificate {
+		p, err := NewLeafProfile("leaf", interCrt, inter.SubjectPrivateKey(), opts...)
+		assert.FatalError(t, err)
+		b, err := p.CreateCertificate()
+		assert.FatalError(t, err)
+		crt, err := x509.ParseCertificate(b)
+		assert.FatalError(t, err)
+		return crt
+	}
+	leaf := createLeaf(WithDNSNames([]string{"foo.example.com"}), WithEmailAddresses([]string{"jane@example.com"}))
+	outside := createLeaf(WithDNSNames([]string{"foo.example.org"}))
+
+	roots := []*x509.Certificate{rootCrt}
+	intermediates := []*x509.Certificate{interCrt}
+
+	type want struct {
+		valid  bool
+		failed string
+		msg    string
+	}
+	tests := []struct {
+		name string
+		crt  *x509.Certificate
+		opts DiagnoseOptions
+		want want
+	}{
+		{"ok", leaf, DiagnoseOptions{Roots: roots, Intermediates: intermediates, DNSName: "foo.example.com", Email: "Jane@example.com"}, want{true, "", ""}},
+		{"ok clientAuth", leaf, DiagnoseOptions{Roots: roots, Intermediates: intermediates, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}, want{true, "", ""}},
+		{"fail host", leaf, DiagnoseOptions{Roots: roots, Intermediates: intermediates, DNSName: "bar.example.com"}, want{false, CheckHostname, "it is valid for [foo.example.com]"}},
+		{"fail ip", leaf, DiagnoseOptions{Roots: roots, Intermediates: intermediates, IPAddress: net.ParseIP("10.0.0.1")}, want{false, CheckIPAddress, "not valid for '10.0.0.1'"}},
+		{"fail email", leaf, DiagnoseOptions{Roots: roots, Intermediates: intermediates, Email: "john@example.com"}, want{false, CheckEmail, "it is valid for [jane@example.com]"}},
+		{"fail expired", leaf, DiagnoseOptions{Roots: roots, Intermediates: intermediates, CurrentTime: time.Now().Add(10 * 365 * 24 * time.Hour)}, want{false, CheckValidity, "certificate expired at"}},
+		{"fail not yet valid", leaf, DiagnoseOptions{Roots: roots, Intermediates: intermediates, CurrentTime: time.Now().Add(-time.Hour)}, want{false, CheckValidity, "not valid until"}},
+		{"fail eku", leaf, DiagnoseOptions{Roots: roots, Intermediates: intermediates, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}}, want{false, CheckExtKeyUsage, "one of [codeSigning] is required"}},
+		{"fail missing intermediate", leaf, DiagnoseOptions{Roots: roots}, want{false, CheckTrustAnchor, "no certificate found for issuer 'CN=intermediate'"}},
+		{"fail name constraints", outside, DiagnoseOptions{Roots: roots, Intermediates: intermediates}, want{false, CheckNameConstraints, "'foo.example.org' of 'CN=leaf' is not permitted"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := DiagnoseVerify(tt.crt, tt.opts)
+			assert.Equals(t, tt.want.valid, report.Valid)
+			assert.Equals(t, tt.want.valid, report.Err == nil)
+			assert.True(t, len(report.Paths) > 0)
+			if tt.want.valid {
+				assert.Len(t, 1, report.Chains)
+				for _, p := range report.Paths {
+					assert.True(t, p.Valid)
+					assert.True(t, p.Trusted)
+				}
+				return
+			}
+
+			var found bool
+			checks := report.Checks
+			for _, p := range report.Paths {
+				checks = append(checks, p.Checks...)
+			}
+			for _, c := range checks {
+				if !c.Passed && c.Name == tt.want.failed {
+					found = true
+					if !strings.Contains(c.Message, tt.want.msg) {
+						t.Errorf("check %s message = %q, want %q", c.Name, c.Message, tt.want.msg)
+					}
+				}
+			}
+			if !found {
+				t.Errorf("check %s did not fail", tt.want.failed)
+			}
+		})
+	}
+}
+
+func TestDiagnoseVerify_signature(t *testing.T) {
+	createRoot := func() (*x509.Certificate, Profile) {
+		p, err := NewRootProfile("root")
+		assert.FatalError(t, err)
+		b, err := p.CreateCertificate()
+		assert.FatalError(t, err)
+		crt, err := x509.ParseCertificate(b)
+		assert.FatalError(t, err)
+		return crt, p
+	}
+	root, _ := createRoot()
+	other, otherProfile := createRoot()
+
+	// Leaf issued by a root with the same name but a different key.
+	p, err := NewLeafProfile("leaf", other, otherProfile.SubjectPrivateKey())
+	assert.FatalError(t, err)
+	b, err := p.CreateCertificate()
+	assert.FatalError(t, err)
+	leaf, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+	// Remove the key identifiers to build the path using the name only.
+	leaf.AuthorityKeyId = nil
+
+	report := DiagnoseVerify(leaf, DiagnoseOptions{Roots: []*x509.Certificate{root}})
+	assert.False(t, report.Valid)
+	assert.Len(t, 1, report.Paths)
+	assert.True(t, report.Paths[0].Trusted)
+	assert.False(t, report.Paths[0].Valid)
+	for _, c := range report.Paths[0].Checks {
+		if c.Name == CheckSignature {
+			assert.False(t, c.Passed)
+			assert.True(t, strings.Contains(c.Message, "signature does not match the key of 'CN=root'"))
+			return
+		}
+	}
+	t.Error("signature check not found")
+}
+
+func TestMatchDomainConstraint(t *testing.T) {
+	tests := []struct {
+		domain, constraint string
+		want               bool
+	}{
+		{"example.com", "example.com", true},
+		{"foo.example.com", "example.com", true},
+		{"fooexample.com", "example.com", false},
+		{"example.com", ".example.com", false},
+		{"foo.example.com", ".example.com", true},
+		{"FOO.Example.com", "example.COM", true},
+		{"example.org", "", true},
+	}
+	for _, tt := range tests {
+		if got := matchDomainConstraint(tt.domain, tt.constraint); got != tt.want {
+			t.Errorf("matchDomainConstraint(%q, %q) = %v, want %v", tt.domain, tt.constraint, got, tt.want)
+		}
+	}
+}
+
+func TestMatchEmailConstraint(t *testing.T) {
+	tests := []struct {
+		email, constraint string
+		want              bool
+	}{
+		{"jane@example.com", "jane@example.com", true},
+		{"jane@example.com", "john@example.com", false},
+		{"jane@example.com", "example.com", true},
+		{"jane@mail.example.com", "example.com", false},
+		{"jane@mail.example.com", ".example.com", true},
+		{"jane", "example.com", false},
+	}
+	for _, tt := range tests {
+		if got := matchEmailConstraint(tt.email, tt.constraint); got != tt.want {
+			t.Errorf("matchEmailConstraint(%q, %q) = %v, want %v", tt.email, tt.constraint, got, tt.want)
+		}
+	}
+}
@@ -96,6 +96,22 @@ unset, default is P-256 for EC keys and Ed25519 for OKP keys.
 		Usage: `The path to the <file> containing the password to encrypt or decrypt the private key.`,
 	}
 
+	// KeystorePasswordFile is a cli.Flag used to pass a file with the password
+	// of a Java KeyStore.
+	KeystorePasswordFile = cli.StringFlag{
+		Name:  "keystore-password-file",
+		Usage: `The path to the <file> containing the password of the Java KeyStore.`,
+	}
+
+	// Alias is a cli.Flag used to set the alias of the entry in a Java KeyStore
+	// or the name of a Kubernetes object.
+	Alias = cli.StringFlag{
+		Name: "alias",
+		Usage: `The <name> of the entry in the Java KeyStore, or the name of the Kubernetes
+Secret or ConfigMap. Defaults to "mykey" for keystores and to a name derived
+from the certificate common name for Kubernetes objects.`,
+	}
+
 	// NoPassword is a cli.Flag used to avoid using a password to encrypt private
 	// keys.
 	NoPassword = cli.BoolFlag{
@@ -218,6 +234,30 @@ be stored in the 'sshpop' header.`,
 		Name:  "redirect-url",
 		Usage: "Terminal OAuth redirect <url>.",
 	}
+
+	// Template is a cli.Flag used to pass the certificate template file.
+	Template = cli.StringFlag{
+		Name: "template",
+		Usage: `The certificate template <file>, a JSON representation of the certificate to
+create rendered using Go's text/template package. The variables .Subject and
+.SANs, and the ones defined with **--set** and **--set-file** are available in
+the template.`,
+	}
+
+	// TemplateSet is a cli.Flag used to pass a variable to the certificate
+	// template.
+	TemplateSet = cli.StringSliceFlag{
+		Name: "set",
+		Usage: `The <key=value> pair with template data variables to send to the certificate
+template. Use the '--set' flag multiple times to add multiple variables.`,
+	}
+
+	// TemplateSetFile is a cli.Flag used to pass a JSON file with the variables
+	// of the certificate template.
+	TemplateSetFile = cli.StringFlag{
+		Name:  "set-file",
+		Usage: `The <file> with the template data variables, in JSON format, to send to the certificate template.`,
+	}
 )
 
 // ParseTimeOrDuration is a helper that returns the time or the current time
@@ -8,6 +8,7 @@ import (
 	"encoding/pem"
 	"fmt"
 	"net"
+	"net/url"
 	"os"
 	"strings"
 	"time"
@@ -181,15 +182,33 @@ func (f *CertificateFlow) GenerateIdentityToken(ctx *cli.Context) (string, error
 
 // Sign signs the CSR using the online or the offline certificate authority.
 func (f *CertificateFlow) Sign(ctx *cli.Context, token string, csr api.CertificateRequest, crtFile string) error {
-	client, err := f.GetClient(ctx, token)
+	certs, err := f.SignCertificates(ctx, token, csr)
 	if err != nil {
 		return err
 	}
+	var data []byte
+	for _, crt := range certs {
+		pemblk, err := pemutil.Serialize(crt)
+		if err != nil {
+			return errors.Wrap(err, "error serializing from step-ca API response")
+		}
+		data = append(data, pem.EncodeToMemory(pemblk)...)
+	}
+	return utils.WriteFile(crtFile, data, 0600)
+}
+
+// SignCertificates signs the CSR using the online or the offline certificate
+// authority and returns the certificate and its chain.
+func (f *CertificateFlow) SignCertificates(ctx *cli.Context, token string, csr api.CertificateRequest) ([]*x509.Certificate, error) {
+	client, err := f.GetClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
 
 	// parse times or durations
 	notBefore, notAfter, err := parseTimeDuration(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	req := &api.SignRequest{
@@ -201,21 +220,20 @@ func (f *CertificateFlow) Sign(ctx *cli.Context, token string, csr api.Certifica
 
 	resp, err := client.Sign(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if resp.CertChainPEM == nil || len(resp.CertChainPEM) == 0 {
 		resp.CertChainPEM = []api.Certificate{resp.ServerPEM, resp.CaPEM}
 	}
-	var data []byte
+	certs := make([]*x509.Certificate, 0, len(resp.CertChainPEM))
 	for _, certPEM := range resp.CertChainPEM {
-		pemblk, err := pemutil.Serialize(certPEM.Certificate)
-		if err != nil {
-			return errors.Wrap(err, "error serializing from step-ca API response")
+		if certPEM.Certificate == nil {
+			return nil, errors.New("error parsing step-ca API response: missing certificate")
 		}
-		data = append(data, pem.EncodeToMemory(pemblk)...)
+		certs = append(certs, certPEM.Certificate)
 	}
-	return utils.WriteFile(crtFile, data, 0600)
+	return certs, nil
 }
 
 // CreateSignRequest is a helper function that given an x509 OTT returns a
@@ -235,11 +253,14 @@ func (f *CertificateFlow) CreateSignRequest(ctx *cli.Context, tok, subject strin
 		return nil, nil, err
 	}
 
-	dnsNames, ips, emails := splitSANs(sans, jwt.Payload.SANs)
+	dnsNames, ips, emails, uris := splitSANs(sans, jwt.Payload.SANs)
+	if err := x509util.ValidateURIs(uris); err != nil {
+		return nil, nil, err
+	}
 	switch jwt.Payload.Type() {
 	case token.AWS:
 		doc := jwt.Payload.Amazon.InstanceIdentityDocument
-		if len(ips) == 0 && len(dnsNames) == 0 {
+		if len(ips) == 0 && len(dnsNames) == 0 && len(uris) == 0 {
 			defaultSANs := []string{
 				doc.PrivateIP,
 				fmt.Sprintf("ip-%s.%s.compute.internal", strings.Replace(doc.PrivateIP, ".", "-", -1), doc.Region),
@@ -247,11 +268,11 @@ func (f *CertificateFlow) CreateSignRequest(ctx *cli.Context, tok, subject strin
 			if !sharedContext.DisableCustomSANs {
 				defaultSANs = append(defaultSANs, subject)
 			}
-			dnsNames, ips, emails = splitSANs(defaultSANs)
+			dnsNames, ips, emails, uris = splitSANs(defaultSANs)
 		}
 	case token.GCP:
 		ce := jwt.Payload.Google.ComputeEngine
-		if len(ips) == 0 && len(dnsNames) == 0 {
+		if len(ips) == 0 && len(dnsNames) == 0 && len(uris) == 0 {
 			defaultSANs := []string{
 				fmt.Sprintf("%s.c.%s.internal", ce.InstanceName, ce.ProjectID),
 				fmt.Sprintf("%s.%s.c.%s.internal", ce.InstanceName, ce.Zone, ce.ProjectID),
@@ -259,17 +280,17 @@ func (f *CertificateFlow) CreateSignRequest(ctx *cli.Context, tok, subject strin
 			if !sharedContext.DisableCustomSANs {
 				defaultSANs = append(defaultSANs, subject)
 			}
-			dnsNames, ips, emails = splitSANs(defaultSANs)
+			dnsNames, ips, emails, uris = splitSANs(defaultSANs)
 		}
 	case token.Azure:
-		if len(ips) == 0 && len(dnsNames) == 0 {
+		if len(ips) == 0 && len(dnsNames) == 0 && len(uris) == 0 {
 			defaultSANs := []string{
 				jwt.Payload.Azure.VirtualMachine,
 			}
 			if !sharedContext.DisableCustomSANs {
 				defaultSANs = append(defaultSANs, subject)
 			}
-			dnsNames, ips, emails = splitSANs(defaultSANs)
+			dnsNames, ips, emails, uris = splitSANs(defaultSANs)
 		}
 	case token.OIDC:
 		if jwt.Payload.Email != "" {
@@ -287,6 +308,7 @@ func (f *CertificateFlow) CreateSignRequest(ctx *cli.Context, tok, subject strin
 		DNSNames:       dnsNames,
 		IPAddresses:    ips,
 		EmailAddresses: emails,
+		URIs:           uris,
 	}
 
 	csr, err := x509.CreateCertificateRequest(rand.Reader, template, pk)
@@ -307,8 +329,8 @@ func (f *CertificateFlow) CreateSignRequest(ctx *cli.Context, tok, subject strin
 }
 
 // splitSANs unifies the SAN collections passed as arguments and returns a list
-// of DNS names, a list of IP addresses, and a list of emails.
-func splitSANs(args ...[]string) (dnsNames []string, ipAddresses []net.IP, email []string) {
+// of DNS names, a list of IP addresses, a list of emails, and a list of URIs.
+func splitSANs(args ...[]string) (dnsNames []string, ipAddresses []net.IP, email []string, uris []*url.URL) {
 	m := make(map[string]bool)
 	var unique []string
 	for _, sans := range args {
@@ -319,7 +341,7 @@ func splitSANs(args ...[]string) (dnsNames []string, ipAddresses []net.IP, email
 			}
 		}
 	}
-	return x509util.SplitSANs(unique)
+	return x509util.SplitSANsWithURIs(unique)
 }
 
 // parseTimeDuration parses the not-before and not-after flags as a timeDuration